@@ -66,6 +66,31 @@ func (am *ArgMapper) ReadString(v **StringValue) *ArgMapper {
 	return am
 }
 
+// ReadSymbol will try to read the next argument as a symbol value, or report an
+// error.
+func (am *ArgMapper) ReadSymbol(v **SymbolValue) *ArgMapper {
+	switch tV := am.next().(type) {
+	case *SymbolValue:
+		*v = tV
+	default:
+		am.err = fmt.Errorf("ArgMapper: type error - expected symbol, got %T", tV)
+	}
+	return am
+}
+
+// ReadKey will try to read the next argument as a map key, or report an error.
+// Strings and keywords can be used as keys; a keyword is read as its name.
+func (am *ArgMapper) ReadKey(v *string) *ArgMapper {
+	next := am.next()
+	key, isKey := mapKey(next)
+	if !isKey {
+		am.err = fmt.Errorf("ArgMapper: type error - expected key, got %T", next)
+		return am
+	}
+	*v = key
+	return am
+}
+
 // ReadBool will try to read the next argument as a bool value, or report an
 // error.
 func (am *ArgMapper) ReadBool(v **BoolValue) *ArgMapper {
@@ -138,6 +163,31 @@ func (am *ArgMapper) ReadMap(v **MapValue) *ArgMapper {
 	return am
 }
 
+// ReadTable will try to read the next argument as a table, or report an error.
+func (am *ArgMapper) ReadTable(v **TableValue) *ArgMapper {
+	switch tV := am.next().(type) {
+	case *TableValue:
+		*v = tV
+	default:
+		am.err = fmt.Errorf("ArgMapper: type error - expected table, got %T", tV)
+	}
+	return am
+}
+
+// ReadSeq will try to read the next argument as a sequence, or report an
+// error. Lists are accepted, and are converted to a sequence.
+func (am *ArgMapper) ReadSeq(v **SeqValue) *ArgMapper {
+	switch tV := am.next().(type) {
+	case *SeqValue:
+		*v = tV
+	case *ListValue:
+		*v = NewListSeq(tV)
+	default:
+		am.err = fmt.Errorf("ArgMapper: type error - expected seq, got %T", tV)
+	}
+	return am
+}
+
 // ReadValue will try to read the next argument as any value, or report an
 // error.
 func (am *ArgMapper) ReadValue(v *Value) *ArgMapper {
@@ -156,6 +206,20 @@ func (am *ArgMapper) MaybeReadValue(v *Value) *ArgMapper {
 	return am
 }
 
+// ReadValues will read the remaining arguments as any values.
+func (am *ArgMapper) ReadValues(v *[]Value) *ArgMapper {
+	vals := []Value{}
+	for {
+		nextV := am.maybeNext()
+		if nextV == nil {
+			break
+		}
+		vals = append(vals, nextV)
+	}
+	*v = vals
+	return am
+}
+
 // ReadNumbers will try to read the remaining argument as number values, or
 // report an error.
 func (am *ArgMapper) ReadNumbers(v *[]*NumberValue) *ArgMapper {
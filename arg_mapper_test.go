@@ -52,6 +52,28 @@ func Test_ArgMapper(t *testing.T) {
 		require.Equal(t, 1, len(mv.Vals))
 	})
 
+	t.Run("valueVarargs", func(t *testing.T) {
+		var sv *StringValue
+		var rest []Value
+		err := ArgMapperValues(
+			&StringValue{Val: "abc"},
+			&NumberValue{Val: 1},
+			&NilValue{},
+		).
+			ReadString(&sv).
+			ReadValues(&rest).
+			Complete()
+		require.NoError(t, err)
+		require.Equal(t, []Value{&NumberValue{Val: 1}, &NilValue{}}, rest)
+
+		err = ArgMapperValues(&StringValue{Val: "abc"}).
+			ReadString(&sv).
+			ReadValues(&rest).
+			Complete()
+		require.NoError(t, err)
+		require.Empty(t, rest)
+	})
+
 	t.Run("numVarags", func(t *testing.T) {
 		t.Run("basic", func(t *testing.T) {
 			args := []Value{
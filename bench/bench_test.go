@@ -0,0 +1,88 @@
+package bench
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
+)
+
+// workload is a script that's benchmarked, and the value it evaluates to.
+type workload struct {
+	name string
+	want float64
+}
+
+var workloads = []workload{
+	{name: "fib", want: 6765},
+	{name: "list_pipeline", want: 41320334000},
+	{name: "map_heavy", want: 999499},
+	{name: "string_concat", want: 8890},
+	{name: "deep_recursion", want: 4501500},
+}
+
+// readWorkload returns the source of the workload.
+func readWorkload(tb testing.TB, w workload) string {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", w.name+".l"))
+	require.NoError(tb, err)
+	return string(src)
+}
+
+func parseWorkload(tb testing.TB, w workload, src string) *golisp2.Program {
+	prog, err := golisp2.ParseProgram(golisp2.NewTokenScanner(golisp2.NewRuneScanner(
+		w.name+".l", strings.NewReader(src))))
+	require.NoError(tb, err)
+	return prog
+}
+
+func evalWorkload(tb testing.TB, prog *golisp2.Program) golisp2.Value {
+	v, err := prog.Eval(golisp2.BuiltinContext().SubContext(nil))
+	require.NoError(tb, err)
+	return v
+}
+
+// Test_workloads checks each workload still evaluates to what it should, so a
+// benchmark can't become faster by being broken.
+func Test_workloads(t *testing.T) {
+	for _, w := range workloads {
+		t.Run(w.name, func(t *testing.T) {
+			v := evalWorkload(t, parseWorkload(t, w, readWorkload(t, w)))
+			num, isNum := v.(*golisp2.NumberValue)
+			require.True(t, isNum, "got %s", v.InspectStr())
+			require.Equal(t, w.want, num.Val)
+		})
+	}
+}
+
+// BenchmarkWorkloads times each workload: parsing it, evaluating it once
+// parsed, and both together.
+func BenchmarkWorkloads(b *testing.B) {
+	for _, w := range workloads {
+		src := readWorkload(b, w)
+		b.Run(w.name, func(b *testing.B) {
+			b.Run("parse", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					parseWorkload(b, w, src)
+				}
+			})
+			b.Run("eval", func(b *testing.B) {
+				prog := parseWorkload(b, w, src)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					evalWorkload(b, prog)
+				}
+			})
+			b.Run("run", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					evalWorkload(b, parseWorkload(b, w, src))
+				}
+			})
+		})
+	}
+}
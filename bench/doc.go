@@ -0,0 +1,4 @@
+// Package bench holds benchmarks of the interpreter on representative
+// workloads, so changes to its performance can be measured and regressions
+// caught. Each workload is a script in testdata; see `make bench`.
+package bench
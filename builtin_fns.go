@@ -1,42 +1,312 @@
 package golisp2
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
+// builtinFns is the full set of builtin plain functions, by name.
+var builtinFns = map[string]*FuncValue{
+	"concat": &FuncValue{Fn: concatFn},
+	"cons":   &FuncValue{Fn: consFn},
+	"car":    &FuncValue{Fn: carFn},
+	"cdr":    &FuncValue{Fn: cdrFn},
+	"and":    &FuncValue{Fn: andFn},
+	"or":     &FuncValue{Fn: orFn},
+	"not":    &FuncValue{Fn: notFn},
+
+	"strEq": &FuncValue{Fn: strEqFn},
+
+	"values": &FuncValue{Fn: valuesFn},
+	"divmod": &FuncValue{Fn: divmodFn},
+	"mod":    &FuncValue{Fn: modFn},
+	"pow":    &FuncValue{Fn: powFn},
+	"isNaN":  &FuncValue{Fn: isNaNFn},
+	"isInf":  &FuncValue{Fn: isInfFn},
+
+	"listFromCells": &FuncValue{Fn: listFromCellsFn},
+	"cellsFromList": &FuncValue{Fn: cellsFromListFn},
+	"nth":           &FuncValue{Fn: nthFn},
+	"lastCell":      &FuncValue{Fn: lastCellFn},
+
+	"list":       &FuncValue{Fn: listCreateFn},
+	"listGet":    &FuncValue{Fn: listGetFn},
+	"listFilter": &FuncValue{Fn: listFilterFn},
+	"listMap":    &FuncValue{Fn: listMapFn},
+	"listReduce": &FuncValue{Fn: listReduceFn},
+	"len":        &FuncValue{Fn: lenFn},
+	"range":      &FuncValue{Fn: rangeFn},
+
+	"sort":      &FuncValue{Fn: sortFn},
+	"sortBy":    &FuncValue{Fn: sortByFn},
+	"compare":   &FuncValue{Fn: compareFn},
+	"groupBy":   &FuncValue{Fn: groupByFn},
+	"uniq":      &FuncValue{Fn: uniqFn},
+	"zip":       &FuncValue{Fn: zipFn},
+	"flatten":   &FuncValue{Fn: flattenFn},
+	"partition": &FuncValue{Fn: partitionFn},
+
+	"listFind":      &FuncValue{Fn: listFindFn},
+	"listAny":       &FuncValue{Fn: listAnyFn},
+	"listAll":       &FuncValue{Fn: listAllFn},
+	"listTake":      &FuncValue{Fn: listTakeFn},
+	"listDrop":      &FuncValue{Fn: listDropFn},
+	"listTakeWhile": &FuncValue{Fn: listTakeWhileFn},
+	"listDropWhile": &FuncValue{Fn: listDropWhileFn},
+
+	"iterate":   &FuncValue{Fn: iterateFn},
+	"repeat":    &FuncValue{Fn: repeatFn},
+	"take":      &FuncValue{Fn: takeFn},
+	"drop":      &FuncValue{Fn: dropFn},
+	"seqToList": &FuncValue{Fn: seqToListFn},
+
+	"map":       &FuncValue{Fn: mapCreateFn},
+	"mapGet":    &FuncValue{Fn: mapGetFn},
+	"mapFilter": &FuncValue{Fn: mapFilterFn},
+	"mapMap":    &FuncValue{Fn: mapMapFn},
+	"mapReduce": &FuncValue{Fn: mapReduceFn},
+	"mapKeys":   &FuncValue{Fn: mapKeysFn},
+	"mapValues": &FuncValue{Fn: mapValuesFn},
+	"query":     &FuncValue{Fn: queryFn},
+	"validate":  &FuncValue{Fn: validateFn},
+
+	"table":         &FuncValue{Fn: tableFn},
+	"tableRows":     &FuncValue{Fn: tableRowsFn},
+	"tableSelect":   &FuncValue{Fn: tableSelectFn},
+	"tableWhere":    &FuncValue{Fn: tableWhereFn},
+	"tableJoin":     &FuncValue{Fn: tableJoinFn},
+	"tableGroup":    &FuncValue{Fn: tableGroupFn},
+	"tableSortBy":   &FuncValue{Fn: tableSortByFn},
+	"tableFromCSV":  &FuncValue{Fn: tableFromCSVFn},
+	"tableFromJSON": &FuncValue{Fn: tableFromJSONFn},
+
+	"plotLine": &FuncValue{Fn: plotLineFn},
+	"plotBar":  &FuncValue{Fn: plotBarFn},
+
+	"apply":   &FuncValue{Fn: applyFn},
+	"partial": &FuncValue{Fn: partialFn},
+	"compose": &FuncValue{Fn: composeFn},
+	"callEc":  &FuncValue{Fn: callEcFn},
+
+	"typeOf":    &FuncValue{Fn: typeOfFn},
+	"isNil":     &FuncValue{Fn: typePredicate("nil")},
+	"isNumber":  &FuncValue{Fn: typePredicate("number")},
+	"isString":  &FuncValue{Fn: typePredicate("string")},
+	"isBool":    &FuncValue{Fn: typePredicate("bool")},
+	"isKeyword": &FuncValue{Fn: typePredicate("keyword")},
+	"isList":    &FuncValue{Fn: typePredicate("list")},
+	"isMap":     &FuncValue{Fn: typePredicate("map")},
+	"isFunc":    &FuncValue{Fn: typePredicate("func")},
+	"isCell":    &FuncValue{Fn: typePredicate("cell")},
+	"isSeq":     &FuncValue{Fn: typePredicate("seq")},
+	"isTable":   &FuncValue{Fn: typePredicate("table")},
+	"isSymbol":  &FuncValue{Fn: typePredicate("symbol")},
+	"isChan":    &FuncValue{Fn: typePredicate("chan")},
+	"isTime":    &FuncValue{Fn: typePredicate("time")},
+	"isObject":  &FuncValue{Fn: typePredicate("object")},
+	"isHost":    &FuncValue{Fn: typePredicate("host")},
+
+	"symbol":     &FuncValue{Fn: symbolFn},
+	"symbolName": &FuncValue{Fn: symbolNameFn},
+	"gensym":     &FuncValue{Fn: gensymFn},
+
+	"toString":     &FuncValue{Fn: toStringFn},
+	"toNumber":     &FuncValue{Fn: toNumberFn},
+	"toBool":       &FuncValue{Fn: toBoolFn},
+	"charCode":     &FuncValue{Fn: charCodeFn},
+	"charFromCode": &FuncValue{Fn: charFromCodeFn},
+
+	"busPublish":   &FuncValue{Fn: busPublishFn},
+	"busSubscribe": &FuncValue{Fn: busSubscribeFn},
+
+	"chan":          &FuncValue{Fn: chanFn},
+	"send":          &FuncValue{Fn: sendFn},
+	"recv":          &FuncValue{Fn: recvFn},
+	"chanClose":     &FuncValue{Fn: chanCloseFn},
+	"waitGroup":     &FuncValue{Fn: waitGroupFn},
+	"waitGroupAdd":  &FuncValue{Fn: waitGroupAddFn},
+	"waitGroupDone": &FuncValue{Fn: waitGroupDoneFn},
+	"waitGroupWait": &FuncValue{Fn: waitGroupWaitFn},
+
+	"supervise":  &FuncValue{Fn: superviseFn},
+	"onShutdown": &FuncValue{Fn: onShutdownFn},
+
+	"assert":     &FuncValue{Fn: assertFn},
+	"fail":       &FuncValue{Fn: failFn},
+	"assertEq":   &FuncValue{Fn: assertEqFn},
+	"assertTrue": &FuncValue{Fn: assertTrueFn},
+
+	"now":        &FuncValue{Fn: nowFn},
+	"timeFormat": &FuncValue{Fn: timeFormatFn},
+	"timeParse":  &FuncValue{Fn: timeParseFn},
+	"timeAdd":    &FuncValue{Fn: timeAddFn},
+	"timeDiff":   &FuncValue{Fn: timeDiffFn},
+	"sleep":      &FuncValue{Fn: sleepFn},
+
+	"object":      &FuncValue{Fn: objectFn},
+	"objectGet":   &FuncValue{Fn: objectGetFn},
+	"objectSet":   &FuncValue{Fn: objectSetFn},
+	"objectProto": &FuncValue{Fn: objectProtoFn},
+
+	"hostClose": &FuncValue{Fn: hostCloseFn},
+
+	"print":    &FuncValue{Fn: printFn},
+	"printErr": &FuncValue{Fn: printErrFn},
+	"random":   &FuncValue{Fn: randomFn},
+	"trace":    &FuncValue{Fn: traceFn},
+	"bench":    &FuncValue{Fn: benchFn},
+
+	"readFile": &FuncValue{Fn: readFileFn, Nondeterministic: true},
+	"getEnv":   &FuncValue{Fn: getEnvFn, Nondeterministic: true},
+	"httpGet":  &FuncValue{Fn: httpGetFn, Nondeterministic: true},
+
+	"writeFile": &FuncValue{Fn: writeFileFn},
+	"exec":      &FuncValue{Fn: execFn, Nondeterministic: true},
+	"execPipe":  &FuncValue{Fn: execPipeFn, Nondeterministic: true},
+	"httpPost":  &FuncValue{Fn: httpPostFn, Nondeterministic: true},
+
+	"httpServe":  &FuncValue{Fn: httpServeFn, Nondeterministic: true},
+	"jsonEncode": &FuncValue{Fn: jsonEncodeFn},
+	"jsonDecode": &FuncValue{Fn: jsonDecodeFn},
+}
+
+// impureBuiltins are the builtins with side effects, or whose results depend
+// on more than their arguments. Every other builtin is pure.
+var impureBuiltins = map[string]bool{
+	"gensym": true, "busPublish": true, "busSubscribe": true, "supervise": true,
+	"onShutdown": true, "print": true, "printErr": true, "random": true, "trace": true,
+	"bench": true, "readFile": true, "getEnv": true, "httpGet": true,
+	"writeFile": true, "exec": true, "execPipe": true, "httpPost": true, "plotLine": true,
+	"plotBar": true, "chan": true, "send": true, "recv": true, "chanClose": true,
+	"waitGroup": true, "waitGroupAdd": true, "waitGroupDone": true,
+	"waitGroupWait": true, "now": true, "sleep": true, "httpServe": true,
+	"object": true, "objectGet": true, "objectSet": true, "hostClose": true,
+}
+
+// builtinSignatures are the parameters of each builtin. Parameters ending in
+// `?` are optional, and one ending in `...` collects any remaining arguments.
+var builtinSignatures = map[string]string{
+	"concat": "strs...", "cons": "left? right?", "car": "cell", "cdr": "cell",
+	"and": "val vals...", "or": "val vals...", "not": "val",
+
+	"strEq": "a b",
+
+	"values": "vals...", "divmod": "x y", "mod": "x y", "pow": "x y",
+	"isNaN": "val", "isInf": "val",
+
+	"listFromCells": "cell", "cellsFromList": "list", "nth": "cell n",
+	"lastCell": "cell",
+
+	"list": "vals...", "listGet": "list i", "listFilter": "coll fn",
+	"listMap": "coll fn", "listReduce": "init list fn", "len": "val",
+	"range": "from to? step?",
+
+	"sort": "list", "sortBy": "list fn", "compare": "a b", "groupBy": "list fn", "uniq": "list",
+	"zip": "left right", "flatten": "list", "partition": "list n",
+
+	"listFind": "list fn", "listAny": "list fn", "listAll": "list fn",
+	"listTake": "list n", "listDrop": "list n", "listTakeWhile": "list fn",
+	"listDropWhile": "list fn",
+
+	"iterate": "fn initial", "repeat": "val", "take": "n seq", "drop": "n seq",
+	"seqToList": "seq",
+
+	"map": "keysAndVals...", "mapGet": "map key", "mapFilter": "map fn",
+	"mapMap": "map fn", "mapReduce": "init map fn", "mapKeys": "map",
+	"mapValues": "map", "query": "data query", "validate": "data schema",
+
+	"table": "maps", "tableRows": "table", "tableSelect": "table cols...",
+	"tableWhere": "table fn", "tableJoin": "left right col",
+	"tableGroup": "table col aggs", "tableSortBy": "table col desc?",
+	"tableFromCSV": "csv", "tableFromJSON": "json",
+
+	"plotLine": "data opts?", "plotBar": "data opts?",
+
+	"apply": "fn args", "partial": "fn args...", "compose": "fn fns...",
+	"callEc": "fn",
+
+	"typeOf": "val", "isNil": "val", "isNumber": "val", "isString": "val",
+	"isBool": "val", "isKeyword": "val", "isList": "val", "isMap": "val",
+	"isFunc": "val", "isCell": "val", "isSeq": "val", "isSymbol": "val",
+	"isTable": "val", "isChan": "val", "isTime": "val", "isObject": "val",
+	"isHost": "val", "hostClose": "handle",
+
+	"symbol": "name", "symbolName": "sym", "gensym": "prefix?",
+
+	"toString": "val", "toNumber": "val", "toBool": "val",
+	"charCode": "str i?", "charFromCode": "code",
+
+	"busPublish": "topic val", "busSubscribe": "topic fn",
+
+	"chan": "size?", "send": "ch val", "recv": "ch", "chanClose": "ch",
+	"waitGroup": "", "waitGroupAdd": "wg n?", "waitGroupDone": "wg",
+	"waitGroupWait": "wg",
+
+	"supervise": "opts children...", "onShutdown": "fn",
+
+	"assert": "cond msg?", "fail": "msg", "assertEq": "actual expected",
+	"assertTrue": "val",
+
+	"now": "", "timeFormat": "time layout", "timeParse": "layout str",
+	"timeAdd": "time dur", "timeDiff": "a b", "sleep": "ms",
+
+	"object": "slots proto?", "objectGet": "obj name",
+	"objectSet": "obj name val", "objectProto": "obj",
+
+	"print": "vals...", "printErr": "vals...", "random": "", "trace": "fn", "bench": "n fn",
+
+	"readFile": "path", "getEnv": "name", "httpGet": "url",
+
+	"writeFile": "path contents", "exec": "cmd args...",
+	"execPipe": "onLine cmd args...",
+	"httpPost": "url contentType body",
+
+	"httpServe": "addr handler", "jsonEncode": "val", "jsonDecode": "json",
+}
+
+func init() {
+	for name, fn := range builtinFns {
+		fn.Name = name
+		fn.builtin = true
+		fn.Pure = !impureBuiltins[name]
+		fn.Params, fn.MinArgs, fn.MaxArgs = parseSignature(builtinSignatures[name])
+	}
+}
+
+// parseSignature reads the parameters and number of arguments accepted from a
+// signature in builtinSignatures.
+func parseSignature(sig string) ([]string, int, int) {
+	params := strings.Fields(sig)
+	min, max := 0, len(params)
+	for i, p := range params {
+		switch {
+		case strings.HasSuffix(p, "..."):
+			params[i], max = strings.TrimSuffix(p, "..."), -1
+		case strings.HasSuffix(p, "?"):
+			params[i] = strings.TrimSuffix(p, "?")
+		default:
+			min++
+		}
+	}
+	return params, min, max
+}
+
 // BuiltinContext returns a context that contains the full set of builtin
 // functions. Note this just includes built-in plain functions; not operators.
 func BuiltinContext() *EvalContext {
-	return NewContext(map[string]Value{
-		"concat": &FuncValue{Fn: concatFn},
-		"cons":   &FuncValue{Fn: consFn},
-		"car":    &FuncValue{Fn: carFn},
-		"cdr":    &FuncValue{Fn: cdrFn},
-		"and":    &FuncValue{Fn: andFn},
-		"or":     &FuncValue{Fn: orFn},
-		"not":    &FuncValue{Fn: notFn},
-
-		"strEq": &FuncValue{Fn: strEqFn},
-
-		"list":       &FuncValue{Fn: listCreateFn},
-		"listGet":    &FuncValue{Fn: listGetFn},
-		"listFilter": &FuncValue{Fn: listFilterFn},
-		"listMap":    &FuncValue{Fn: listMapFn},
-		"listReduce": &FuncValue{Fn: listReduceFn},
-		"len":        &FuncValue{Fn: lenFn},
-
-		"map":       &FuncValue{Fn: mapCreateFn},
-		"mapGet":    &FuncValue{Fn: mapGetFn},
-		"mapFilter": &FuncValue{Fn: mapFilterFn},
-		"mapMap":    &FuncValue{Fn: mapMapFn},
-		"mapReduce": &FuncValue{Fn: mapReduceFn},
-		"mapKeys":   &FuncValue{Fn: mapKeysFn},
-		"mapValues": &FuncValue{Fn: mapValuesFn},
-
-		"print": &FuncValue{Fn: printFn},
-	})
+	vals := make(map[string]Value, len(builtinFns))
+	for name, fn := range builtinFns {
+		vals[name] = fn
+	}
+	return NewContext(vals)
 }
 
 //
@@ -69,9 +339,7 @@ func strEqFn(c *EvalContext, vals ...Value) (Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: v1.Val == v2.Val,
-	}, nil
+	return NewBoolValue(v1.Val == v2.Val), nil
 }
 
 func consFn(c *EvalContext, vals ...Value) (Value, error) {
@@ -119,14 +387,14 @@ func andFn(c *EvalContext, vals ...Value) (Value, error) {
 		return nil, err
 	}
 	if !firstV.Val {
-		return &BoolValue{Val: false}, nil
+		return False, nil
 	}
 	for _, v := range remainingVals {
 		if !v.Val {
-			return &BoolValue{Val: false}, nil
+			return False, nil
 		}
 	}
-	return &BoolValue{Val: true}, nil
+	return True, nil
 }
 
 func orFn(c *EvalContext, vals ...Value) (Value, error) {
@@ -140,14 +408,14 @@ func orFn(c *EvalContext, vals ...Value) (Value, error) {
 		return nil, err
 	}
 	if firstV.Val {
-		return &BoolValue{Val: true}, nil
+		return True, nil
 	}
 	for _, v := range remainingVals {
 		if v.Val {
-			return &BoolValue{Val: true}, nil
+			return True, nil
 		}
 	}
-	return &BoolValue{Val: false}, nil
+	return False, nil
 }
 
 func notFn(c *EvalContext, vals ...Value) (Value, error) {
@@ -158,168 +426,361 @@ func notFn(c *EvalContext, vals ...Value) (Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: !v1.Val,
-	}, nil
+	return NewBoolValue(!v1.Val), nil
 }
 
 //
-// Mathematical operator built-ins
+// Cell list functions
 //
 
-func addFn(c *EvalContext, vals ...Value) (Value, error) {
-	var firstVal *NumberValue
-	var remainingVals []*NumberValue
+// listFromCellsFn converts a proper list of cells (a chain of cells terminated
+// by nil) into a list value.
+func listFromCellsFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asCell *CellValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&firstVal).
-		ReadNumbers(&remainingVals).
+		ReadCell(&asCell).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	total := firstVal.Val
-	for _, v := range remainingVals {
-		total += v.Val
+
+	cellVals, tail := asCell.chainVals()
+	if _, isNil := tail.(*NilValue); !isNil {
+		return nil, fmt.Errorf("listFromCells expects cells terminated by nil")
 	}
-	return &NumberValue{
-		Val: total,
+	return &ListValue{
+		Vals: cellVals,
 	}, nil
 }
 
-func subFn(c *EvalContext, vals ...Value) (Value, error) {
-	var firstVal *NumberValue
-	var remainingVals []*NumberValue
+// cellsFromListFn converts a list value into a proper list of cells. An empty
+// list is converted to nil.
+func cellsFromListFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&firstVal).
-		ReadNumbers(&remainingVals).
+		ReadList(&asList).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	if len(remainingVals) == 0 {
-		return &NumberValue{
-			Val: -firstVal.Val,
-		}, nil
-	}
-	total := firstVal.Val
-	for _, v := range remainingVals {
-		total -= v.Val
+
+	var cells Value = Nil
+	for i := len(asList.Vals) - 1; i >= 0; i-- {
+		cells = NewCellValue(asList.Vals[i], cells)
 	}
-	return &NumberValue{
-		Val: total,
-	}, nil
+	return cells, nil
 }
 
-func multFn(c *EvalContext, vals ...Value) (Value, error) {
-	var firstVal *NumberValue
-	var remainingVals []*NumberValue
+// nthFn returns the element at the given index of a chain of cells.
+func nthFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asCell *CellValue
+	var asNum *NumberValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&firstVal).
-		ReadNumbers(&remainingVals).
+		ReadCell(&asCell).
+		ReadNumber(&asNum).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	total := firstVal.Val
-	for _, v := range remainingVals {
-		total *= v.Val
+
+	index := int(math.Floor(asNum.Val))
+	cellVals, _ := asCell.chainVals()
+	if index < 0 || index >= len(cellVals) {
+		return nil, fmt.Errorf("nth out of bounds")
 	}
-	return &NumberValue{
-		Val: total,
-	}, nil
+	return cellVals[index], nil
 }
 
-func divFn(c *EvalContext, vals ...Value) (Value, error) {
-	var firstVal *NumberValue
-	var remainingVals []*NumberValue
+// lastCellFn returns the final cell in a chain of cells.
+func lastCellFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asCell *CellValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&firstVal).
-		ReadNumbers(&remainingVals).
+		ReadCell(&asCell).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	total := firstVal.Val
-	for _, v := range remainingVals {
-		total /= v.Val
+
+	last := asCell
+	for {
+		next, isCell := last.Right.(*CellValue)
+		if !isCell {
+			return last, nil
+		}
+		last = next
 	}
-	return &NumberValue{
-		Val: total,
-	}, nil
 }
 
 //
-// Comparison operator built-in
+// Mathematical operator built-ins
 //
 
-func eqNumFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var v1, v2 *NumberValue
-	err := ArgMapperValues(vals...).
-		ReadNumber(&v1).
-		ReadNumber(&v2).
+// The arithmetic and comparison operators are called far more than any other
+// builtins, and almost always with numbers, so they read their arguments
+// directly rather than with an ArgMapper. Only if the arguments are wrong is
+// one used, to report the error.
+
+// foldNumbers folds the arguments, left to right, with op. Returns false if
+// there are none, or any isn't a number.
+func foldNumbers(vals []Value, op func(a, b float64) float64) (float64, bool) {
+	if len(vals) == 0 {
+		return 0, false
+	}
+	first, isNum := vals[0].(*NumberValue)
+	if !isNum {
+		return 0, false
+	}
+	total := first.Val
+	for _, v := range vals[1:] {
+		num, isNum := v.(*NumberValue)
+		if !isNum {
+			return 0, false
+		}
+		total = op(total, num.Val)
+	}
+	return total, true
+}
+
+// numbersErr returns the error for arguments foldNumbers rejects.
+func numbersErr(vals []Value) error {
+	var first *NumberValue
+	var rest []*NumberValue
+	return ArgMapperValues(vals...).
+		ReadNumber(&first).
+		ReadNumbers(&rest).
 		Complete()
-	if err != nil {
-		return nil, err
+}
+
+// numberPairErr returns the error for arguments numberPair rejects.
+func numberPairErr(vals []Value) error {
+	var a, b *NumberValue
+	return ArgMapperValues(vals...).
+		ReadNumber(&a).
+		ReadNumber(&b).
+		Complete()
+}
+
+// numberPair returns the two arguments, if there are exactly two numbers.
+func numberPair(vals []Value) (float64, float64, bool) {
+	if len(vals) != 2 {
+		return 0, 0, false
 	}
-	return &BoolValue{
-		Val: v1.Val == v2.Val,
-	}, nil
+	a, isNumA := vals[0].(*NumberValue)
+	b, isNumB := vals[1].(*NumberValue)
+	if !isNumA || !isNumB {
+		return 0, 0, false
+	}
+	return a.Val, b.Val, true
 }
 
-func gtNumFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var v1, v2 *NumberValue
+func addFn(c *EvalContext, vals ...Value) (Value, error) {
+	total, ok := foldNumbers(vals, func(a, b float64) float64 { return a + b })
+	if !ok {
+		return nil, numbersErr(vals)
+	}
+	return NewNumberValue(total), nil
+}
+
+func subFn(c *EvalContext, vals ...Value) (Value, error) {
+	if len(vals) == 1 {
+		if num, isNum := vals[0].(*NumberValue); isNum {
+			return NewNumberValue(-num.Val), nil
+		}
+	}
+	total, ok := foldNumbers(vals, func(a, b float64) float64 { return a - b })
+	if !ok {
+		return nil, numbersErr(vals)
+	}
+	return NewNumberValue(total), nil
+}
+
+func multFn(c *EvalContext, vals ...Value) (Value, error) {
+	total, ok := foldNumbers(vals, func(a, b float64) float64 { return a * b })
+	if !ok {
+		return nil, numbersErr(vals)
+	}
+	return NewNumberValue(total), nil
+}
+
+func divFn(c *EvalContext, vals ...Value) (Value, error) {
+	total, ok := foldNumbers(vals, func(a, b float64) float64 { return a / b })
+	if !ok {
+		return nil, numbersErr(vals)
+	}
+	if len(vals) > 1 {
+		for _, v := range vals[1:] {
+			if err := checkDivisor(c, v.(*NumberValue).Val, "division"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return NewNumberValue(total), nil
+}
+
+// checkDivisor returns an error if the divisor is zero, unless the context
+// allows IEEE division; see Options.IEEEDivision.
+func checkDivisor(c *EvalContext, divisor float64, op string) error {
+	if divisor != 0 || c.environ().ieeeDivision {
+		return nil
+	}
+	return &EvalError{
+		Msg: op + " by zero",
+		Pos: c.CallPos(),
+	}
+}
+
+// divmodFn returns the quotient of the numbers rounded down, and the remainder,
+// as two values. The remainder has the sign of the divisor.
+func divmodFn(c *EvalContext, vals ...Value) (Value, error) {
+	var x, y *NumberValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&v1).
-		ReadNumber(&v2).
+		ReadNumber(&x).
+		ReadNumber(&y).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: v1.Val > v2.Val,
+	if err := checkDivisor(c, y.Val, "divmod"); err != nil {
+		return nil, err
+	}
+	q := math.Floor(x.Val / y.Val)
+	return &ValuesValue{
+		Vals: []Value{
+			&NumberValue{Val: q},
+			&NumberValue{Val: x.Val - q*y.Val},
+		},
 	}, nil
 }
 
-func ltNumFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var v1, v2 *NumberValue
-	err := ArgMapperValues(vals...).
-		ReadNumber(&v1).
-		ReadNumber(&v2).
-		Complete()
-	if err != nil {
+// modFn returns the remainder of dividing the numbers, which has the sign of
+// the divisor, as with divmod. It's the % operator.
+func modFn(c *EvalContext, vals ...Value) (Value, error) {
+	x, y, ok := numberPair(vals)
+	if !ok {
+		return nil, numberPairErr(vals)
+	}
+	if err := checkDivisor(c, y, "modulo"); err != nil {
+		return nil, err
+	}
+	return NewNumberValue(x - math.Floor(x/y)*y), nil
+}
+
+// floorDivFn returns the quotient of the numbers rounded down, as with divmod.
+// It's the // operator.
+func floorDivFn(c *EvalContext, vals ...Value) (Value, error) {
+	x, y, ok := numberPair(vals)
+	if !ok {
+		return nil, numberPairErr(vals)
+	}
+	if err := checkDivisor(c, y, "integer division"); err != nil {
+		return nil, err
+	}
+	return NewNumberValue(math.Floor(x / y)), nil
+}
+
+// powFn returns the first number raised to the power of the second. It's the
+// ** operator.
+func powFn(c *EvalContext, vals ...Value) (Value, error) {
+	x, y, ok := numberPair(vals)
+	if !ok {
+		return nil, numberPairErr(vals)
+	}
+	return NewNumberValue(math.Pow(x, y)), nil
+}
+
+// isNaNFn returns whether its argument is the number NaN, e.g. as produced by
+// (/ 0 0) in IEEE division mode.
+func isNaNFn(c *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	if err := ArgMapperValues(vals...).ReadValue(&v).Complete(); err != nil {
+		return nil, err
+	}
+	num, isNum := v.(*NumberValue)
+	return NewBoolValue(isNum && math.IsNaN(num.Val)), nil
+}
+
+// isInfFn returns whether its argument is a positive or negative infinite
+// number.
+func isInfFn(c *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	if err := ArgMapperValues(vals...).ReadValue(&v).Complete(); err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: v1.Val < v2.Val,
+	num, isNum := v.(*NumberValue)
+	return NewBoolValue(isNum && math.IsInf(num.Val, 0)), nil
+}
+
+// valuesFn returns all of its arguments as separate results, to be bound with
+// letValues.
+func valuesFn(ec *EvalContext, vals ...Value) (Value, error) {
+	return &ValuesValue{
+		Vals: append([]Value{}, vals...),
 	}, nil
 }
 
+//
+// Comparison operator built-in
+//
+
+func eqNumFn(ec *EvalContext, vals ...Value) (Value, error) {
+	return chainNumbers(vals, func(a, b float64) bool { return a == b })
+}
+
+func gtNumFn(ec *EvalContext, vals ...Value) (Value, error) {
+	return chainNumbers(vals, func(a, b float64) bool { return a > b })
+}
+
+func ltNumFn(ec *EvalContext, vals ...Value) (Value, error) {
+	return chainNumbers(vals, func(a, b float64) bool { return a < b })
+}
+
 func gteNumFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var v1, v2 *NumberValue
+	return chainNumbers(vals, func(a, b float64) bool { return a >= b })
+}
+
+func lteNumFn(ec *EvalContext, vals ...Value) (Value, error) {
+	return chainNumbers(vals, func(a, b float64) bool { return a <= b })
+}
+
+// chainNumbers returns whether cmp holds for each adjacent pair of the
+// arguments, so (< 1 2 3) is true as both 1 < 2 and 2 < 3. There must be at
+// least two arguments, all numbers.
+func chainNumbers(vals []Value, cmp func(a, b float64) bool) (Value, error) {
+	if a, b, ok := numberPair(vals); ok {
+		return NewBoolValue(cmp(a, b)), nil
+	}
+	var first, second *NumberValue
+	var rest []*NumberValue
 	err := ArgMapperValues(vals...).
-		ReadNumber(&v1).
-		ReadNumber(&v2).
+		ReadNumber(&first).
+		ReadNumber(&second).
+		ReadNumbers(&rest).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: v1.Val >= v2.Val,
-	}, nil
+	holds := cmp(first.Val, second.Val)
+	prev := second.Val
+	for _, num := range rest {
+		holds = holds && cmp(prev, num.Val)
+		prev = num.Val
+	}
+	return NewBoolValue(holds), nil
 }
 
-func lteNumFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var v1, v2 *NumberValue
+// compareFn returns -1, 0 or 1 as the first argument orders before, the same
+// as, or after the second, in the order sort uses: numbers, strings and times
+// compare by value, nil comes first, and other values are ordered by type.
+func compareFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var a, b Value
 	err := ArgMapperValues(vals...).
-		ReadNumber(&v1).
-		ReadNumber(&v2).
+		ReadValue(&a).
+		ReadValue(&b).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
-	return &BoolValue{
-		Val: v1.Val <= v2.Val,
-	}, nil
+	return NewNumberValue(float64(compareSortValues(a, b))), nil
 }
 
 //
@@ -333,6 +794,59 @@ func listCreateFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}, nil
 }
 
+// maxRangeLen is the most numbers range will create. Longer sequences can be
+// built lazily with iterate and take.
+const maxRangeLen = 1 << 24
+
+// rangeFn creates a list of numbers. Accepts (range end), (range start end) or
+// (range start end step); start defaults to 0 and step to 1. The end is
+// exclusive. Each number is computed from the start rather than accumulated, so
+// steps too small to change a large start can't loop forever.
+func rangeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var nums []*NumberValue
+	err := ArgMapperValues(vals...).
+		ReadNumbers(&nums).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, step := 0.0, 0.0, 1.0
+	switch len(nums) {
+	case 1:
+		end = nums[0].Val
+	case 2:
+		start, end = nums[0].Val, nums[1].Val
+	case 3:
+		start, end, step = nums[0].Val, nums[1].Val, nums[2].Val
+	default:
+		return nil, fmt.Errorf("range expects 1 to 3 arguments, got %d", len(nums))
+	}
+	if step == 0 {
+		return nil, fmt.Errorf("range step cannot be zero")
+	}
+
+	count := math.Ceil((end - start) / step)
+	if !(count > 0) {
+		count = 0
+	}
+	if count > maxRangeLen {
+		return nil, fmt.Errorf("range is longer than the limit of %d numbers", maxRangeLen)
+	}
+	rangeVals := make([]Value, 0, int(count))
+	for i := 0; i < int(count); i++ {
+		if i%4096 == 0 {
+			if err := checkHalted(ec, ec.CallPos()); err != nil {
+				return nil, err
+			}
+		}
+		rangeVals = append(rangeVals, &NumberValue{Val: start + float64(i)*step})
+	}
+	return &ListValue{
+		Vals: rangeVals,
+	}, nil
+}
+
 // listGetFn gets and returns the given index from the list. If it doesn't exit;
 // returns zero.
 func listGetFn(ec *EvalContext, vals ...Value) (Value, error) {
@@ -347,6 +861,13 @@ func listGetFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	index := int(math.Floor(asNum.Val))
+	if float64(index) != asNum.Val {
+		err := ec.warn(fmt.Sprintf(
+			"listGet index %s truncated to %d", asNum.InspectStr(), index))
+		if err != nil {
+			return nil, err
+		}
+	}
 	if index < 0 || index >= len(asList.Vals) {
 		return nil, fmt.Errorf("listGet out of bounds")
 	}
@@ -356,34 +877,38 @@ func listGetFn(ec *EvalContext, vals ...Value) (Value, error) {
 // listFilterFn expects a list and a function argument. The function will take an
 // element, and return either true or false. It will be called on each element
 // of the list, and all values that are marked true will be collected and
-// returned in a new list.
+// returned in a new list. If given a sequence rather than a list, a lazily
+// filtered sequence is returned.
 func listFilterFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var asList *ListValue
+	var coll Value
 	var asFn *FuncValue
 	err := ArgMapperValues(vals...).
-		ReadList(&asList).
+		ReadValue(&coll).
 		ReadFunc(&asFn).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
 
+	var asList *ListValue
+	switch tV := coll.(type) {
+	case *SeqValue:
+		return seqFilter(tV, asFn), nil
+	case *ListValue:
+		asList = tV
+	default:
+		return nil, fmt.Errorf("listFilter expects a list or seq, got %T", tV)
+	}
+
 	filteredVals := []Value{}
 	for _, v := range asList.Vals {
 		// todo (bs): double check that this couldn't contaminate the scope
-		filterVal, filterErr := asFn.Fn(ec, v)
-		if filterErr != nil {
-			return nil, fmt.Errorf("listFilter encountered an error: %w", filterErr)
+		keep, keepErr := filterKeep(ec, asFn, v)
+		if keepErr != nil {
+			return nil, keepErr
 		}
-		switch tV := filterVal.(type) {
-		case *NilValue:
-			continue
-		case *BoolValue:
-			if tV.Val {
-				filteredVals = append(filteredVals, v)
-			}
-		default:
-			return nil, fmt.Errorf("listFilter fn must return boolean")
+		if keep {
+			filteredVals = append(filteredVals, v)
 		}
 	}
 
@@ -392,23 +917,51 @@ func listFilterFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}, nil
 }
 
+// filterKeep calls the filter function on the value, and reports whether it
+// should be kept.
+func filterKeep(ec *EvalContext, asFn *FuncValue, v Value) (bool, error) {
+	filterVal, filterErr := ec.callValue(asFn, v)
+	if filterErr != nil {
+		return false, fmt.Errorf("listFilter encountered an error: %w", filterErr)
+	}
+	switch tV := filterVal.(type) {
+	case *NilValue:
+		return false, nil
+	case *BoolValue:
+		return tV.Val, nil
+	default:
+		return false, fmt.Errorf("listFilter fn must return boolean")
+	}
+}
+
 // listMapFn expects a list and a function argument. The function will take an
 // element and return an element. It will be called on each element on the list;
-// and the returned values will be returned in a new list.
+// and the returned values will be returned in a new list. If given a sequence
+// rather than a list, a lazily mapped sequence is returned.
 func listMapFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var asList *ListValue
+	var coll Value
 	var asFn *FuncValue
 	err := ArgMapperValues(vals...).
-		ReadList(&asList).
+		ReadValue(&coll).
 		ReadFunc(&asFn).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
 
+	var asList *ListValue
+	switch tV := coll.(type) {
+	case *SeqValue:
+		return seqMap(tV, asFn), nil
+	case *ListValue:
+		asList = tV
+	default:
+		return nil, fmt.Errorf("listMap expects a list or seq, got %T", tV)
+	}
+
 	mappedVals := []Value{}
 	for _, v := range asList.Vals {
-		mapVal, mapErr := asFn.Fn(ec, v)
+		mapVal, mapErr := ec.callValue(asFn, v)
 		if mapErr != nil {
 			return nil, fmt.Errorf("listMap encountered an error: %w", mapErr)
 		}
@@ -440,7 +993,7 @@ func listReduceFn(ec *EvalContext, vals ...Value) (Value, error) {
 
 	reducedVal := initVal
 	for _, v := range asList.Vals {
-		innerRVal, err := asFn.Fn(ec, reducedVal, v)
+		innerRVal, err := ec.callValue(asFn, reducedVal, v)
 		if err != nil {
 			return nil, fmt.Errorf("listReduce encountered an error: %w", err)
 		}
@@ -463,11 +1016,11 @@ func mapCreateFn(ec *EvalContext, vals ...Value) (Value, error) {
 	mapVals := map[string]Value{}
 	for i := 0; i+1 < len(vals); i += 2 {
 		k, v := vals[i], vals[i+1]
-		asStr, isStr := k.(*StringValue)
-		if !isStr {
+		key, isKey := mapKey(k)
+		if !isKey {
 			return nil, fmt.Errorf("map expects hashable keys")
 		}
-		mapVals[asStr.Val] = v
+		mapVals[key] = v
 	}
 
 	return &MapValue{
@@ -479,22 +1032,35 @@ func mapCreateFn(ec *EvalContext, vals ...Value) (Value, error) {
 // returns nil.
 func mapGetFn(ec *EvalContext, vals ...Value) (Value, error) {
 	var asMap *MapValue
-	var asStr *StringValue
+	var key string
 	err := ArgMapperValues(vals...).
 		ReadMap(&asMap).
-		ReadString(&asStr).
+		ReadKey(&key).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
 
-	val, hasVal := asMap.Vals[asStr.Val]
+	val, hasVal := asMap.Vals[key]
 	if !hasVal {
-		return &NilValue{}, nil
+		return Nil, nil
 	}
 	return val, nil
 }
 
+// mapKey returns the key the value is stored under in a map. Strings and
+// keywords can be used as keys; so `:a` and "a" refer to the same entry.
+func mapKey(v Value) (string, bool) {
+	switch tV := v.(type) {
+	case *StringValue:
+		return tV.Val, true
+	case *KeywordValue:
+		return tV.Val, true
+	default:
+		return "", false
+	}
+}
+
 // mapFilterFn expects a map and a function argument. The function will take a
 // key/value pair, and return either true or false. It will be called on each
 // element of the list, and all values that are marked true will be collected
@@ -511,8 +1077,9 @@ func mapFilterFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	filteredVals := map[string]Value{}
-	for k, v := range asMap.Vals {
-		filterVal, filterErr := asFn.Fn(ec, &StringValue{Val: k}, v)
+	for _, k := range ec.mapKeys(asMap.Vals) {
+		v := asMap.Vals[k]
+		filterVal, filterErr := ec.callValue(asFn, &StringValue{Val: k}, v)
 		if filterErr != nil {
 			return nil, fmt.Errorf("mapFilter encountered an error: %w", filterErr)
 		}
@@ -548,8 +1115,9 @@ func mapMapFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	mappedVals := map[string]Value{}
-	for k, v := range asMap.Vals {
-		mappedVal, mapErr := asFn.Fn(ec, &StringValue{Val: k}, v)
+	for _, k := range ec.mapKeys(asMap.Vals) {
+		v := asMap.Vals[k]
+		mappedVal, mapErr := ec.callValue(asFn, &StringValue{Val: k}, v)
 		if mapErr != nil {
 			return nil, fmt.Errorf("mapMap encountered an error: %w", mapErr)
 		}
@@ -580,8 +1148,9 @@ func mapReduceFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	reducedVal := initVal
-	for k, v := range asMap.Vals {
-		innerRVal, err := asFn.Fn(ec, reducedVal, &StringValue{Val: k}, v)
+	for _, k := range ec.mapKeys(asMap.Vals) {
+		v := asMap.Vals[k]
+		innerRVal, err := ec.callValue(asFn, reducedVal, &StringValue{Val: k}, v)
 		if err != nil {
 			return nil, fmt.Errorf("mapReduce encountered an error: %w", err)
 		}
@@ -602,7 +1171,7 @@ func mapKeysFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	keys := make([]Value, 0, len(asMap.Vals))
-	for k := range asMap.Vals {
+	for _, k := range ec.mapKeys(asMap.Vals) {
 		keys = append(keys, &StringValue{Val: k})
 	}
 
@@ -622,8 +1191,8 @@ func mapValuesFn(ec *EvalContext, vals ...Value) (Value, error) {
 	}
 
 	values := make([]Value, 0, len(asMap.Vals))
-	for _, v := range asMap.Vals {
-		values = append(values, v)
+	for _, k := range ec.mapKeys(asMap.Vals) {
+		values = append(values, asMap.Vals[k])
 	}
 
 	return &ListValue{
@@ -632,44 +1201,713 @@ func mapValuesFn(ec *EvalContext, vals ...Value) (Value, error) {
 }
 
 //
-// Misc values
+// Higher-order functions
 //
 
-// printFn outputs the values in stdout.
-func printFn(ec *EvalContext, vals ...Value) (Value, error) {
-	for i, v := range vals {
-		if i > 0 {
-			fmt.Print(" ")
-		}
-		fmt.Print(v.InspectStr())
+// applyFn calls the function with the elements of the list as it's arguments.
+func applyFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	var asList *ListValue
+	err := ArgMapperValues(vals...).
+		ReadFunc(&asFn).
+		ReadList(&asList).
+		Complete()
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println()
-	return &NilValue{}, nil
+	return ec.callValue(asFn, asList.Vals...)
 }
 
-// lenFn will return the length of maps, lists, and strings.
-func lenFn(ec *EvalContext, vals ...Value) (Value, error) {
-	var val Value
+// partialFn returns a function that calls the given function with the given
+// arguments, followed by any it is called with.
+func partialFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	var bound []Value
 	err := ArgMapperValues(vals...).
-		ReadValue(&val).
+		ReadFunc(&asFn).
+		ReadValues(&bound).
 		Complete()
 	if err != nil {
 		return nil, err
 	}
 
-	// ques (bs): should this be solved via subtyping?
-	switch tV := val.(type) {
-	case *ListValue:
-		return &NumberValue{
-			Val: float64(len(tV.Vals)),
-		}, nil
-	case *StringValue:
-		return &NumberValue{
-			Val: float64(len(tV.Val)),
-		}, nil
-	case *MapValue:
-		return &NumberValue{
-			Val: float64(len(tV.Vals)),
+	return &FuncValue{
+		Pure: asFn.Pure,
+		Fn: func(ec *EvalContext, vals ...Value) (Value, error) {
+			args := make([]Value, 0, len(bound)+len(vals))
+			args = append(args, bound...)
+			args = append(args, vals...)
+			return ec.callValue(asFn, args...)
+		},
+	}, nil
+}
+
+// composeFn returns a function that calls the last of the given functions with
+// it's arguments, then passes the result through each of the others from right
+// to left. (compose f g) is equivalent to (fn (x) (f (g x))).
+func composeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	fns := make([]*FuncValue, 0, len(vals))
+	pure := true
+	for _, v := range vals {
+		asFn, isFn := v.(*FuncValue)
+		if !isFn {
+			return nil, fmt.Errorf("compose expects functions, got %s", TypeName(v))
+		}
+		fns = append(fns, asFn)
+		pure = pure && asFn.Pure
+	}
+	if len(fns) == 0 {
+		return nil, fmt.Errorf("compose expects at least one function")
+	}
+
+	return &FuncValue{
+		Pure: pure,
+		Fn: func(ec *EvalContext, vals ...Value) (Value, error) {
+			v, err := ec.callValue(fns[len(fns)-1], vals...)
+			for i := len(fns) - 2; i >= 0 && err == nil; i-- {
+				v, err = ec.callValue(fns[i], v)
+			}
+			return v, err
+		},
+	}, nil
+}
+
+// callEcFn calls the function with an escape function. Calling the escape
+// with a value, from anywhere within the call, ends it immediately, and callEc
+// returns that value; otherwise callEc returns what the function does. The
+// escape can't be used once callEc has returned.
+func callEcFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	var returned int32
+	escape := &FuncValue{
+		Name:    "escape",
+		Params:  []string{"val"},
+		MinArgs: 0,
+		MaxArgs: 1,
+		Pure:    true,
+	}
+	escape.Fn = func(ec *EvalContext, vals ...Value) (Value, error) {
+		if atomic.LoadInt32(&returned) != 0 {
+			return nil, &EvalError{
+				Msg: "escape called after its callEc returned",
+				Pos: ec.CallPos(),
+			}
+		}
+		var v Value = Nil
+		if len(vals) > 0 {
+			v = vals[0]
+		}
+		return nil, &escapeSignal{
+			escape: escape,
+			Val:    v,
+			Pos:    ec.CallPos(),
+		}
+	}
+	defer atomic.StoreInt32(&returned, 1)
+
+	v, err := ec.callValue(asFn, escape)
+	var esc *escapeSignal
+	if errors.As(err, &esc) && esc.escape == escape {
+		return esc.Val, nil
+	}
+	return v, err
+}
+
+//
+// Type functions
+//
+
+// typeOfFn returns the name of the value's type as a string; e.g. "number".
+func typeOfFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &StringValue{
+		Val: TypeName(v),
+	}, nil
+}
+
+// typePredicate returns a function that checks if it's argument is of the
+// named type.
+func typePredicate(name string) func(*EvalContext, ...Value) (Value, error) {
+	return func(ec *EvalContext, vals ...Value) (Value, error) {
+		var v Value
+		err := ArgMapperValues(vals...).
+			ReadValue(&v).
+			Complete()
+		if err != nil {
+			return nil, err
+		}
+		return NewBoolValue(TypeName(v) == name), nil
+	}
+}
+
+//
+// Conversion functions
+//
+
+// toStringFn converts the value to a string. Strings are returned as-is,
+// numbers are written in their shortest form, and anything else is written as
+// it would be printed.
+func toStringFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tV := v.(type) {
+	case *StringValue:
+		return tV, nil
+	case *NumberValue:
+		return &StringValue{
+			Val: strconv.FormatFloat(tV.Val, 'f', -1, 64),
+		}, nil
+	default:
+		return &StringValue{
+			Val: InspectBounded(v, DefaultInspectOptions),
+		}, nil
+	}
+}
+
+// toNumberFn converts the value to a number. Strings are parsed, ignoring
+// surrounding whitespace, and it's an error if they aren't a valid number.
+func toNumberFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tV := v.(type) {
+	case *NumberValue:
+		return tV, nil
+	case *StringValue:
+		n, parseErr := strconv.ParseFloat(strings.TrimSpace(tV.Val), 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("toNumber cannot parse %s",
+				InspectBounded(tV, DefaultInspectOptions))
+		}
+		return &NumberValue{
+			Val: n,
+		}, nil
+	default:
+		return nil, fmt.Errorf("toNumber cannot convert %s", TypeName(v))
+	}
+}
+
+// toBoolFn converts the value to a bool. The strings "true" and "false" are
+// parsed, numbers are true if non-zero, and nil is false.
+func toBoolFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tV := v.(type) {
+	case *BoolValue:
+		return tV, nil
+	case *NilValue:
+		return False, nil
+	case *NumberValue:
+		return NewBoolValue(tV.Val != 0), nil
+	case *StringValue:
+		switch strings.TrimSpace(tV.Val) {
+		case "true":
+			return True, nil
+		case "false":
+			return False, nil
+		default:
+			return nil, fmt.Errorf("toBool cannot parse %s",
+				InspectBounded(tV, DefaultInspectOptions))
+		}
+	default:
+		return nil, fmt.Errorf("toBool cannot convert %s", TypeName(v))
+	}
+}
+
+// charCodeFn returns the unicode code point of a character in the string. By
+// default this is the first character; an optional second argument gives the
+// index of the character.
+func charCodeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var str *StringValue
+	var index Value
+	err := ArgMapperValues(vals...).
+		ReadString(&str).
+		MaybeReadValue(&index).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	i := 0
+	if index != nil {
+		asNum, isNum := index.(*NumberValue)
+		if !isNum {
+			return nil, fmt.Errorf("charCode index must be a number")
+		}
+		i = int(math.Floor(asNum.Val))
+	}
+	runes := []rune(str.Val)
+	if i < 0 || i >= len(runes) {
+		return nil, fmt.Errorf("charCode index %d out of bounds", i)
+	}
+	return &NumberValue{
+		Val: float64(runes[i]),
+	}, nil
+}
+
+// charFromCodeFn returns a single-character string for the unicode code point.
+func charFromCodeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var code *NumberValue
+	err := ArgMapperValues(vals...).
+		ReadNumber(&code).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	r := rune(code.Val)
+	if float64(r) != code.Val || !utf8.ValidRune(r) {
+		return nil, fmt.Errorf("charFromCode invalid code point %s", code.InspectStr())
+	}
+	return &StringValue{
+		Val: string(r),
+	}, nil
+}
+
+//
+// Symbol functions
+//
+
+// symbolFn returns the symbol with the given name.
+func symbolFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var name *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&name).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if name.Val == "" {
+		return nil, fmt.Errorf("symbol expects a non-empty name")
+	}
+	return &SymbolValue{
+		Val: name.Val,
+	}, nil
+}
+
+// symbolNameFn returns the name of the symbol as a string.
+func symbolNameFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var sym *SymbolValue
+	err := ArgMapperValues(vals...).
+		ReadSymbol(&sym).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &StringValue{
+		Val: sym.Val,
+	}, nil
+}
+
+// gensymFn returns a new symbol that is different from every other; e.g. to
+// name a binding in generated code. Takes an optional prefix for the name.
+func gensymFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var prefixes []*StringValue
+	err := ArgMapperValues(vals...).
+		ReadStrings(&prefixes).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if len(prefixes) > 1 {
+		return nil, fmt.Errorf("gensym expects at most 1 argument; got %d", len(prefixes))
+	}
+	prefix := "g"
+	if len(prefixes) == 1 {
+		prefix = prefixes[0].Val
+	}
+	return &SymbolValue{
+		Val: ec.gensym(prefix),
+	}, nil
+}
+
+//
+// Bus functions
+//
+
+// busPublishFn delivers a value to every subscriber of a topic on the context's
+// bus, and returns how many there were.
+func busPublishFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var topic *StringValue
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadString(&topic).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	n, err := ec.Bus().Publish(topic.Val, v)
+	if err != nil {
+		return nil, err
+	}
+	return &NumberValue{
+		Val: float64(n),
+	}, nil
+}
+
+// busSubscribeFn calls the handler with each value later published to a topic
+// on the context's bus.
+func busSubscribeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var topic *StringValue
+	var handler *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadString(&topic).
+		ReadFunc(&handler).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	ec.Bus().Subscribe(topic.Val, func(v Value) error {
+		_, err := ec.callValue(handler, v)
+		return err
+	})
+	return Nil, nil
+}
+
+//
+// Supervision functions
+//
+
+// superviseFn runs each of the child functions on its own goroutine, as a go
+// expression would, restarting them per the policy in the options map:
+//
+//   - "restart": "on-failure" (the default) restarts a child that fails,
+//     "always" restarts it whenever it finishes, and "never" doesn't.
+//   - "maxRestarts": how many times each child may be restarted. Defaults to 3.
+//
+// The first child to fail once it's out of restarts is escalated: the others
+// are halted, and supervise fails with its error. Otherwise, waits for every
+// child and returns a list of their final values.
+func superviseFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var opts *MapValue
+	var rest []Value
+	err := ArgMapperValues(vals...).
+		ReadMap(&opts).
+		ReadValues(&rest).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	children := make([]*FuncValue, 0, len(rest))
+	for _, v := range rest {
+		asFn, isFn := v.(*FuncValue)
+		if !isFn {
+			return nil, fmt.Errorf("supervise expects child functions, got %s", TypeName(v))
+		}
+		children = append(children, asFn)
+	}
+
+	restart, maxRestarts := "on-failure", 3
+	for k, v := range opts.Vals {
+		switch k {
+		case "restart":
+			asStr, isStr := v.(*StringValue)
+			if !isStr || (asStr.Val != "on-failure" &&
+				asStr.Val != "always" && asStr.Val != "never") {
+				return nil, fmt.Errorf(
+					"supervise restart must be \"on-failure\", \"always\" or \"never\"")
+			}
+			restart = asStr.Val
+		case "maxRestarts":
+			asNum, isNum := v.(*NumberValue)
+			if !isNum || asNum.Val < 0 || asNum.Val != float64(int(asNum.Val)) {
+				return nil, fmt.Errorf(
+					"supervise maxRestarts must be a non-negative whole number")
+			}
+			maxRestarts = int(asNum.Val)
+		default:
+			return nil, fmt.Errorf("supervise has no option '%s'", k)
+		}
+	}
+
+	pos := ec.CallPos()
+	ctx, cancel := context.WithCancel(ec.Context())
+	defer cancel()
+	runEc := ec.withContext(ctx)
+	results := make([]*ChanValue, len(children))
+	finished := make(chan int, len(children))
+	for i, child := range children {
+		result := newChanValue(1)
+		results[i] = result
+		sub := runEc.SubContext(nil)
+		go func(i int, child *FuncValue) {
+			defer func() { finished <- i }()
+			v, err := superviseChild(sub, child, i, restart, maxRestarts, pos)
+			if err != nil {
+				result.closeWithErr(stopSignals(err))
+				return
+			}
+			result.ch <- v
+			result.closeWithErr(nil)
+		}(i, child)
+	}
+
+	var escalated error
+	for range children {
+		i := <-finished
+		if err := results[i].err; err != nil && escalated == nil {
+			escalated = fmt.Errorf("supervised child %d failed: %w", i+1, err)
+			// halt the other children; they're still waited for, so none are left
+			// running once supervise returns.
+			cancel()
+		}
+	}
+	if haltErr := checkHalted(ec, pos); haltErr != nil {
+		return nil, haltErr
+	}
+	if escalated != nil {
+		return nil, escalated
+	}
+	finals := make([]Value, 0, len(children))
+	for _, result := range results {
+		finals = append(finals, <-result.ch)
+	}
+	return &ListValue{
+		Vals: finals,
+	}, nil
+}
+
+// superviseChild calls the supervised child until it finishes without being
+// restarted per the policy, and returns its final result. i is the child's
+// index, for diagnostics.
+func superviseChild(
+	ec *EvalContext,
+	child *FuncValue,
+	i int,
+	restart string,
+	maxRestarts int,
+	pos ScannerPosition,
+) (Value, error) {
+	for restarts := 0; ; restarts++ {
+		if haltErr := checkHalted(ec, pos); haltErr != nil {
+			return nil, haltErr
+		}
+		v, err := ec.callValue(child)
+		retry := restart == "always" || (restart == "on-failure" && err != nil)
+		if !retry || restarts >= maxRestarts {
+			return v, err
+		}
+		msg := fmt.Sprintf("restarting supervised child %d", i+1)
+		if err != nil {
+			msg = fmt.Sprintf("%s after error: %s", msg, err)
+		}
+		ec.Diagnostics().Add(Diagnostic{
+			Severity: InfoSeverity,
+			Msg:      msg,
+			Pos:      pos,
+		})
+	}
+}
+
+//
+// Assertion functions
+//
+
+// assertFn fails unless the condition is true. The error has the position of
+// the call, and includes the message if one is given.
+func assertFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var cond *BoolValue
+	var maybeMsg Value
+	err := ArgMapperValues(vals...).
+		ReadBool(&cond).
+		MaybeReadValue(&maybeMsg).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if cond.Val {
+		return Nil, nil
+	}
+	msg := "assertion failed"
+	if maybeMsg != nil {
+		asStr, isStr := maybeMsg.(*StringValue)
+		if !isStr {
+			return nil, fmt.Errorf("assert expects a string message, got %s",
+				TypeName(maybeMsg))
+		}
+		msg = fmt.Sprintf("%s: %s", msg, asStr.Val)
+	}
+	return nil, &EvalError{
+		Msg: msg,
+		Pos: ec.CallPos(),
+	}
+}
+
+// failFn always fails, with the message and the position of the call.
+func failFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var msg *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&msg).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return nil, &EvalError{
+		Msg: msg.Val,
+		Pos: ec.CallPos(),
+	}
+}
+
+//
+// Misc values
+//
+
+// printFn outputs the values to the context's stdout. Huge values are elided, per
+// DefaultInspectOptions.
+func printFn(ec *EvalContext, vals ...Value) (Value, error) {
+	if err := writeValues(ec.Stdout(), vals); err != nil {
+		return nil, err
+	}
+	return Nil, nil
+}
+
+// printErrFn outputs the values to the context's stderr, like printFn.
+func printErrFn(ec *EvalContext, vals ...Value) (Value, error) {
+	if err := writeValues(ec.Stderr(), vals); err != nil {
+		return nil, err
+	}
+	return Nil, nil
+}
+
+// writeValues writes the values on a line, separated by spaces.
+func writeValues(out io.Writer, vals []Value) error {
+	for i, v := range vals {
+		if i > 0 {
+			if _, err := io.WriteString(out, " "); err != nil {
+				return err
+			}
+		}
+		if err := WriteInspect(out, v, DefaultInspectOptions); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+// randomFn returns a random number in [0, 1). In deterministic mode the
+// sequence is seeded, and so is reproducible.
+func randomFn(ec *EvalContext, vals ...Value) (Value, error) {
+	err := ArgMapperValues(vals...).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &NumberValue{
+		Val: ec.Rand().Float64(),
+	}, nil
+}
+
+// benchFn calls the function the given number of times, and returns a map of
+// timing statistics in milliseconds: runs, totalMs, meanMs, minMs and maxMs.
+// Time is measured with the context's clock.
+func benchFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asNum *NumberValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadNumber(&asNum).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	runs := int(asNum.Val)
+	if float64(runs) != asNum.Val || runs < 1 {
+		return nil, fmt.Errorf("bench expects a positive whole number of runs; got %s",
+			asNum.InspectStr())
+	}
+
+	var total, min, max time.Duration
+	for i := 0; i < runs; i++ {
+		if err := checkHalted(ec, ec.CallPos()); err != nil {
+			return nil, err
+		}
+		start := ec.Now()
+		if _, err := ec.callValue(asFn); err != nil {
+			return nil, err
+		}
+		d := ec.Now().Sub(start)
+		total += d
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+
+	ms := func(d time.Duration) Value {
+		return &NumberValue{Val: float64(d) / float64(time.Millisecond)}
+	}
+	return &MapValue{
+		Vals: map[string]Value{
+			"runs":    &NumberValue{Val: float64(runs)},
+			"totalMs": ms(total),
+			"meanMs":  ms(total / time.Duration(runs)),
+			"minMs":   ms(min),
+			"maxMs":   ms(max),
+		},
+	}, nil
+}
+
+// lenFn will return the length of maps, lists, and strings.
+func lenFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var val Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&val).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	// ques (bs): should this be solved via subtyping?
+	switch tV := val.(type) {
+	case *ListValue:
+		return &NumberValue{
+			Val: float64(len(tV.Vals)),
+		}, nil
+	case *StringValue:
+		return &NumberValue{
+			Val: float64(len(tV.Val)),
+		}, nil
+	case *MapValue:
+		return &NumberValue{
+			Val: float64(len(tV.Vals)),
+		}, nil
+	case *TableValue:
+		return &NumberValue{
+			Val: float64(len(tV.Rows)),
 		}, nil
 	default:
 		return nil, fmt.Errorf("Cannot get length of type %T", tV)
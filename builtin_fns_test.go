@@ -2,7 +2,12 @@ package golisp2
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func Test_string(t *testing.T) {
@@ -104,6 +109,74 @@ func Test_cells(t *testing.T) {
 			evalStrToErr(t, `(cdr "abc")`)
 		})
 	})
+
+	t.Run("listFromCells", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			assertListValue(t,
+				evalStrToVal(t, `(listFromCells (cons 1 (cons 2 (cons 3 nil))))`),
+				[]Value{
+					&NumberValue{Val: 1},
+					&NumberValue{Val: 2},
+					&NumberValue{Val: 3},
+				},
+			)
+		})
+
+		t.Run("improper", func(t *testing.T) {
+			evalStrToErr(t, `(listFromCells (cons 1 2))`)
+		})
+
+		t.Run("badType", func(t *testing.T) {
+			evalStrToErr(t, `(listFromCells (list 1 2))`)
+		})
+	})
+
+	t.Run("cellsFromList", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			v := evalStrToVal(t, `(cellsFromList (list 1 2 3))`)
+			assertAsCell(t, v)
+			require.Equal(t, "(1 2 3)", v.InspectStr())
+		})
+
+		t.Run("empty", func(t *testing.T) {
+			assertNilValue(t, evalStrToVal(t, `(cellsFromList (list))`))
+		})
+
+		t.Run("roundTrip", func(t *testing.T) {
+			assertNumValue(t,
+				evalStrToVal(t, `(len (listFromCells (cellsFromList (list 1 2))))`),
+				2,
+			)
+		})
+	})
+
+	t.Run("nth", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			assertNumValue(t,
+				evalStrToVal(t, `(nth (cellsFromList (list 1 2 3)) 2)`),
+				3,
+			)
+		})
+
+		t.Run("outOfBounds", func(t *testing.T) {
+			evalStrToErr(t, `(nth (cellsFromList (list 1 2 3)) 3)`)
+			evalStrToErr(t, `(nth (cellsFromList (list 1 2 3)) -1)`)
+		})
+	})
+
+	t.Run("lastCell", func(t *testing.T) {
+		t.Run("basic", func(t *testing.T) {
+			assertCellValue(t,
+				evalStrToVal(t, `(lastCell (cons 1 (cons 2 3)))`),
+				&NumberValue{Val: 2},
+				&NumberValue{Val: 3},
+			)
+		})
+
+		t.Run("badType", func(t *testing.T) {
+			evalStrToErr(t, `(lastCell nil)`)
+		})
+	})
 }
 
 func Test_math(t *testing.T) {
@@ -207,10 +280,115 @@ func Test_math(t *testing.T) {
 				in:  `(/ 1 nil)`,
 				err: true,
 			},
+			testCase{
+				in:  `(/ 1 2 0)`,
+				err: true,
+			},
+			testCase{
+				in:  `(/ 0 0)`,
+				err: true,
+			},
+		)
+		err := evalStrToErr(t, "\n  (/ 1 0)")
+		require.Contains(t, err.Error(), "division by zero")
+		require.Equal(t, 2, err.(*EvalError).Pos.Row)
+	})
+
+	t.Run("mod", func(t *testing.T) {
+		runCases(t,
+			testCase{in: `(% 7 3)`, out: 1},
+			testCase{in: `(% -7 3)`, out: 2},
+			testCase{in: `(% 7 -3)`, out: -2},
+			testCase{in: `(% 7.5 2)`, out: 1.5},
+			testCase{in: `(mod 10 4)`, out: 2},
+			testCase{in: `(% 1 0)`, err: true},
+			testCase{in: `(% 1 2 3)`, err: true},
+		)
+	})
+
+	t.Run("floorDiv", func(t *testing.T) {
+		runCases(t,
+			testCase{in: `(// 7 2)`, out: 3},
+			testCase{in: `(// -7 2)`, out: -4},
+			testCase{in: `(// 1 0)`, err: true},
+			testCase{in: `(// 1 nil)`, err: true},
+		)
+	})
+
+	t.Run("pow", func(t *testing.T) {
+		runCases(t,
+			testCase{in: `(** 2 10)`, out: 1024},
+			testCase{in: `(** 9 0.5)`, out: 3},
+			testCase{in: `(pow 2 -1)`, out: 0.5},
+			testCase{in: `(** 2)`, err: true},
 		)
 	})
 }
 
+func Test_nanInf(t *testing.T) {
+	assertBoolValue(t, evalStrToVal(t, `(isNaN 1)`), false)
+	assertBoolValue(t, evalStrToVal(t, `(isNaN "NaN")`), false)
+	assertBoolValue(t, evalStrToVal(t, `(isNaN (** -1 0.5))`), true)
+	assertBoolValue(t, evalStrToVal(t, `(isInf (** 10 400))`), true)
+	assertBoolValue(t, evalStrToVal(t, `(isInf (- 0 (** 10 400)))`), true)
+	assertBoolValue(t, evalStrToVal(t, `(isInf (** 10 300))`), false)
+	assertBoolValue(t, evalStrToVal(t, `(isInf nil)`), false)
+	evalStrToErr(t, `(isInf)`)
+}
+
+func Test_numberValues(t *testing.T) {
+	require.True(t, NewNumberValue(3) == NewNumberValue(3))
+	require.False(t, NewNumberValue(3.5) == NewNumberValue(3.5))
+	require.False(t, NewNumberValue(-1) == NewNumberValue(-1))
+	require.True(t, math.Signbit(NewNumberValue(math.Copysign(0, -1)).Val))
+
+	// with small results, the operators don't allocate at all.
+	ec := BuiltinContext()
+	args := []Value{NewNumberValue(1), NewNumberValue(2)}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := addFn(ec, args...); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ltNumFn(ec, args...); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkAddFn(b *testing.B) {
+	ec := BuiltinContext()
+	args := []Value{&NumberValue{Val: 1000.5}, &NumberValue{Val: 2}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := addFn(ec, args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNumericLoop(b *testing.B) {
+	exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("bench.l", strings.NewReader(`
+		(let total 0)
+		(let i 0)
+		(while (< i 1000)
+			(set! total (+ total (* i 0.5) (- i 1)))
+			(set! i (+ i 1)))`))))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ec := BuiltinContext().SubContext(nil)
+		for _, e := range exprs {
+			if _, err := e.Eval(ec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func Test_comparisons(t *testing.T) {
 	type testCase struct {
 		name string
@@ -431,15 +609,58 @@ func Test_comparisons(t *testing.T) {
 			},
 		)
 	})
+
+	t.Run("chained", func(t *testing.T) {
+		runCases(t,
+			testCase{in: `(< 1 2 3)`, out: true},
+			testCase{in: `(< 1 3 2)`, out: false},
+			testCase{in: `(< 1 1 2)`, out: false},
+			testCase{in: `(<= 1 1 2 2)`, out: true},
+			testCase{in: `(> 3 2 1 0)`, out: true},
+			testCase{in: `(>= 3 3 4)`, out: false},
+			testCase{in: `(== 2 2 2)`, out: true},
+			testCase{in: `(== 2 2 3)`, out: false},
+			testCase{in: `(< 3 1 nil)`, err: true},
+			testCase{in: `(< 1)`, err: true},
+			testCase{in: `(<)`, err: true},
+		)
+	})
 }
 
-func Test_print(t *testing.T) {
-	// note (bs): this isn't really a meaningful test; not sure if there's a good
-	// way to do so without some very awkward dependency reconfiguration
+func Test_compare(t *testing.T) {
+	assertNumValue(t, evalStrToVal(t, `(compare 1 2)`), -1)
+	assertNumValue(t, evalStrToVal(t, `(compare 2 2)`), 0)
+	assertNumValue(t, evalStrToVal(t, `(compare 3 2)`), 1)
+	assertNumValue(t, evalStrToVal(t, `(compare "b" "a")`), 1)
+	assertNumValue(t, evalStrToVal(t, `(compare "a" "ab")`), -1)
+	assertNumValue(t, evalStrToVal(t, `(compare nil 1)`), -1)
+	evalStrToErr(t, `(compare 1)`)
+
+	// compare orders values the same way sort does.
+	ec := BuiltinContext()
+	evalStrInContext(t, ec, `(let xs (sort (list "b" 3 nil "a" 1)))`)
+	assertBoolValue(t, evalStrInContext(t, ec, `
+		(and
+			(== (compare (listGet xs 0) (listGet xs 1)) -1)
+			(== (compare (listGet xs 1) (listGet xs 2)) -1)
+			(== (compare (listGet xs 3) (listGet xs 4)) -1))`), true)
+}
 
-	assertNilValue(t, evalStrToVal(t, `(print (list 1 2 3))`))
-	assertNilValue(t, evalStrToVal(t, `(print)`))
-	assertNilValue(t, evalStrToVal(t, `(print 1 2 3)`))
+func Test_print(t *testing.T) {
+	var out strings.Builder
+	ec := BuiltinContext().SubContext(nil)
+	ec.SetStdout(&out)
+
+	assertNilValue(t, evalStrInContext(t, ec, `(print (list 1 2 3))`))
+	assertNilValue(t, evalStrInContext(t, ec, `(print)`))
+	assertNilValue(t, evalStrInContext(t, ec, `(print 1 "a" 3)`))
+	require.Equal(t, "[1 2 3]\n\n1 \"a\" 3\n", out.String())
+
+	var errOut strings.Builder
+	ec.SetStderr(&errOut)
+	assertNilValue(t, evalStrInContext(t, ec, `(printErr "failed:" 2)`))
+	require.Equal(t, "\"failed:\" 2\n", errOut.String())
+	require.Equal(t, "[1 2 3]\n\n1 \"a\" 3\n", out.String())
 }
 
 func Test_len(t *testing.T) {
@@ -464,3 +685,319 @@ func Test_len(t *testing.T) {
 		evalStrToErr(t, `(len "a" "b")`)
 	})
 }
+
+func Test_keywordKeys(t *testing.T) {
+	assertNumValue(t, evalStrToVal(t, `(mapGet (map :a 1 "b" 2) :a)`), 1)
+	assertNumValue(t, evalStrToVal(t, `(mapGet (map :a 1 "b" 2) "a")`), 1)
+	assertNumValue(t, evalStrToVal(t, `(mapGet (map :a 1 "b" 2) :b)`), 2)
+	assertBoolValue(t, evalStrToVal(t, `(isKeyword :a)`), true)
+	require.Equal(t, ":a", evalStrToVal(t, `:a`).InspectStr())
+	evalStrToErr(t, `(mapGet (map :a 1) 1)`)
+}
+
+func Test_symbolFns(t *testing.T) {
+	sym := evalStrToVal(t, `(symbol "abc")`)
+	require.Equal(t, &SymbolValue{Val: "abc"}, sym)
+	require.Equal(t, "abc", sym.InspectStr())
+	assertStringValue(t, evalStrToVal(t, `(symbolName (symbol "abc"))`), "abc")
+	assertStringValue(t, evalStrToVal(t, `(typeOf (symbol "abc"))`), "symbol")
+	assertBoolValue(t, evalStrToVal(t, `(isSymbol (symbol "abc"))`), true)
+	assertBoolValue(t, evalStrToVal(t, `(isSymbol "abc")`), false)
+	evalStrToErr(t, `(symbol "")`)
+	evalStrToErr(t, `(symbolName "abc")`)
+
+	ec := BuiltinContext().SubContext(nil)
+	g1 := evalStrInContext(t, ec, `(gensym)`).(*SymbolValue)
+	g2 := evalStrInContext(t, ec, `(gensym "tmp")`).(*SymbolValue)
+	require.NotEqual(t, g1.Val, g2.Val)
+	require.True(t, strings.HasPrefix(g2.Val, "tmp#"))
+	evalStrInContextToErr(t, ec, `(gensym "a" "b")`)
+}
+
+func Test_bench(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `(let calls 0)`)
+	stats := evalStrInContext(t, ec,
+		`(bench 3 (fn () (set! calls (+ calls 1))))`).(*MapValue)
+	assertNumValue(t, evalStrInContext(t, ec, `calls`), 3)
+	assertNumValue(t, stats.Vals["runs"], 3)
+	require.True(t, stats.Vals["minMs"].(*NumberValue).Val <=
+		stats.Vals["maxMs"].(*NumberValue).Val)
+
+	detEc := BuiltinContext().SubContext(nil)
+	detEc.SetDeterministic(1, time.Unix(0, 0))
+	stats = evalStrInContext(t, detEc, `(bench 2 (fn () 1))`).(*MapValue)
+	assertNumValue(t, stats.Vals["totalMs"], 0)
+
+	evalStrToErr(t, `(bench 0 (fn () 1))`)
+	evalStrToErr(t, `(bench 1.5 (fn () 1))`)
+	evalStrToErr(t, `(bench 2 (fn () (car 1)))`)
+}
+
+func Test_range(t *testing.T) {
+	nums := func(ns ...float64) []Value {
+		vals := []Value{}
+		for _, n := range ns {
+			vals = append(vals, &NumberValue{Val: n})
+		}
+		return vals
+	}
+
+	assertListValue(t, evalStrToVal(t, `(range 3)`), nums(0, 1, 2))
+	assertListValue(t, evalStrToVal(t, `(range 2 5)`), nums(2, 3, 4))
+	assertListValue(t, evalStrToVal(t, `(range 0 10 4)`), nums(0, 4, 8))
+	assertListValue(t, evalStrToVal(t, `(range 3 0 -1)`), nums(3, 2, 1))
+	assertListValue(t, evalStrToVal(t, `(range 0)`), nums())
+	assertListValue(t, evalStrToVal(t, `(range 0 1 0.25)`), nums(0, 0.25, 0.5, 0.75))
+	assertListValue(t, evalStrToVal(t, `(range 0 0.3 0.1)`), nums(0, 0.1, 0.2))
+	assertListValue(t,
+		evalStrToVal(t, `(range 9007199254740992 9007199254740994)`),
+		nums(9007199254740992, 9007199254740992))
+	evalStrToErr(t, `(range 1000000000000)`)
+	evalStrToErr(t, `(range 0 (pow 10 400))`)
+	evalStrToErr(t, `(range)`)
+	evalStrToErr(t, `(range 1 2 0)`)
+	evalStrToErr(t, `(range 1 2 3 4)`)
+	evalStrToErr(t, `(range "a")`)
+}
+
+func Test_typeFns(t *testing.T) {
+
+	t.Run("typeOf", func(t *testing.T) {
+		cases := map[string]string{
+			`nil`:         "nil",
+			`1`:           "number",
+			`"a"`:         "string",
+			`true`:        "bool",
+			`(fn () 1)`:   "func",
+			`(cons 1 2)`:  "cell",
+			`(list 1)`:    "list",
+			`(map "a" 1)`: "map",
+			`(repeat 1)`:  "seq",
+			`:a`:          "keyword",
+		}
+		for src, expected := range cases {
+			assertStringValue(t, evalStrToVal(t, `(typeOf `+src+`)`), expected)
+		}
+		evalStrToErr(t, `(typeOf)`)
+		evalStrToErr(t, `(typeOf 1 2)`)
+	})
+
+	t.Run("predicates", func(t *testing.T) {
+		assertBoolValue(t, evalStrToVal(t, `(isNil nil)`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isNil 0)`), false)
+		assertBoolValue(t, evalStrToVal(t, `(isNumber 1)`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isString 1)`), false)
+		assertBoolValue(t, evalStrToVal(t, `(isBool false)`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isList (list))`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isMap (list))`), false)
+		assertBoolValue(t, evalStrToVal(t, `(isFunc isFunc)`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isCell (cons 1 2))`), true)
+		assertBoolValue(t, evalStrToVal(t, `(isSeq (list))`), false)
+		evalStrToErr(t, `(isNil)`)
+	})
+}
+
+func Test_conversionFns(t *testing.T) {
+
+	t.Run("toString", func(t *testing.T) {
+		assertStringValue(t, evalStrToVal(t, `(toString "abc")`), "abc")
+		assertStringValue(t, evalStrToVal(t, `(toString 1.5)`), "1.5")
+		assertStringValue(t, evalStrToVal(t, `(toString 10)`), "10")
+		assertStringValue(t, evalStrToVal(t, `(toString true)`), "true")
+		assertStringValue(t, evalStrToVal(t, `(toString (list 1 "a"))`), `[1 "a"]`)
+		evalStrToErr(t, `(toString)`)
+	})
+
+	t.Run("toNumber", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(toNumber " 1.25 ")`), 1.25)
+		assertNumValue(t, evalStrToVal(t, `(toNumber 3)`), 3)
+		require.Contains(t,
+			evalStrToErr(t, `(toNumber "abc")`).Error(), `cannot parse "abc"`)
+		evalStrToErr(t, `(toNumber nil)`)
+	})
+
+	t.Run("toBool", func(t *testing.T) {
+		assertBoolValue(t, evalStrToVal(t, `(toBool "true")`), true)
+		assertBoolValue(t, evalStrToVal(t, `(toBool "false")`), false)
+		assertBoolValue(t, evalStrToVal(t, `(toBool 0)`), false)
+		assertBoolValue(t, evalStrToVal(t, `(toBool 2)`), true)
+		assertBoolValue(t, evalStrToVal(t, `(toBool nil)`), false)
+		evalStrToErr(t, `(toBool "yes")`)
+		evalStrToErr(t, `(toBool (list))`)
+	})
+
+	t.Run("charCode", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(charCode "a")`), 97)
+		assertNumValue(t, evalStrToVal(t, `(charCode "héllo" 1)`), 233)
+		evalStrToErr(t, `(charCode "")`)
+		evalStrToErr(t, `(charCode "a" 1)`)
+		evalStrToErr(t, `(charCode "a" "b")`)
+	})
+
+	t.Run("charFromCode", func(t *testing.T) {
+		assertStringValue(t, evalStrToVal(t, `(charFromCode 97)`), "a")
+		assertStringValue(t, evalStrToVal(t, `(charFromCode (charCode "é"))`), "é")
+		evalStrToErr(t, `(charFromCode 1.5)`)
+		evalStrToErr(t, `(charFromCode -1)`)
+	})
+}
+
+func Test_higherOrderFns(t *testing.T) {
+
+	t.Run("apply", func(t *testing.T) {
+		assertStringValue(t, evalStrToVal(t, `(apply concat (list "a" "b" "c"))`), "abc")
+		assertNumValue(t, evalStrToVal(t, `(apply (fn (a b) (- a b)) (list 5 2))`), 3)
+		evalStrToErr(t, `(apply concat "a")`)
+		evalStrToErr(t, `(apply (fn (a) a) (list 1 2))`)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		assertStringValue(t, evalStrToVal(t, `((partial concat "a" "b") "c")`), "abc")
+		assertNumValue(t, evalStrToVal(t, `((partial (fn (a b) (- a b)) 10) 4)`), 6)
+		assertNumValue(t, evalStrToVal(t, `((partial (fn () 1)))`), 1)
+		evalStrToErr(t, `(partial 1 2)`)
+	})
+
+	t.Run("compose", func(t *testing.T) {
+		assertNumValue(t,
+			evalStrToVal(t, `((compose (fn (x) (* x 2)) (fn (x) (+ x 1))) 3)`), 8)
+		assertNumValue(t, evalStrToVal(t, `((compose len concat) "ab" "cd")`), 4)
+		evalStrToErr(t, `(compose)`)
+		evalStrToErr(t, `(compose len 1)`)
+		evalStrToErr(t, `((compose len len) "ab")`)
+	})
+
+	t.Run("values", func(t *testing.T) {
+		v := evalStrToVal(t, `(values 1 "a")`)
+		require.Equal(t, `(values 1 "a")`, v.InspectStr())
+		require.Equal(t, "values", TypeName(v))
+		require.Equal(t, "(values)", evalStrToVal(t, `(values)`).InspectStr())
+	})
+
+	t.Run("divmod", func(t *testing.T) {
+		require.Equal(t, "(values 3 1)", evalStrToVal(t, `(divmod 7 2)`).InspectStr())
+		require.Equal(t, "(values -4 1)", evalStrToVal(t, `(divmod -7 2)`).InspectStr())
+		require.Equal(t, "(values -4 -1)", evalStrToVal(t, `(divmod 7 -2)`).InspectStr())
+		evalStrToErr(t, `(divmod 1 0)`)
+		evalStrToErr(t, `(divmod 1)`)
+	})
+
+	t.Run("callEc", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(callEc (fn (k) (+ 1 2)))`), 3)
+		assertNumValue(t, evalStrToVal(t, `
+			(callEc (fn (k)
+				(listMap (list 1 2 3) (fn (n) (if (== n 2) (k (* n 10)) n)))
+				0))`), 20)
+		assertNilValue(t, evalStrToVal(t, `(callEc (fn (k) (k) 1))`))
+		assertNumValue(t, evalStrToVal(t, `
+			(callEc (fn (outer)
+				(callEc (fn (inner) (outer 1)))
+				2))`), 1)
+		err := evalStrToErr(t, `((callEc (fn (k) k)) 1)`)
+		require.Contains(t, err.Error(), "escape called after its callEc returned")
+		evalStrToErr(t, `(callEc 1)`)
+	})
+}
+
+func Test_supervise(t *testing.T) {
+
+	t.Run("onFailure", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		v := evalStrInContext(t, ec, `
+			(let attempts 0)
+			(supervise (map "maxRestarts" 3)
+				(fn ()
+					(set! attempts (+ attempts 1))
+					(if (< attempts 3) (car 1) attempts))
+				(fn () "ok"))`)
+		assertListValue(t, v, []Value{
+			&NumberValue{Val: 3},
+			&StringValue{Val: "ok"},
+		})
+		require.Len(t, ec.Diagnostics().All(), 2)
+	})
+
+	t.Run("escalate", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(let attempts 0)`)
+		err := evalStrInContextToErr(t, ec, `
+			(supervise (map "restart" "on-failure" "maxRestarts" 2)
+				(fn () (set! attempts (+ attempts 1)) (car 1)))`)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "supervised child 1 failed")
+		attempts, _ := ec.Resolve("attempts")
+		assertNumValue(t, attempts, 3)
+	})
+
+	t.Run("always", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+			(let runs 0)
+			(supervise (map "restart" "always" "maxRestarts" 4)
+				(fn () (set! runs (+ runs 1))))`)
+		runs, _ := ec.Resolve("runs")
+		assertNumValue(t, runs, 5)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		// the children would deadlock if they weren't run concurrently.
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(let c (chan))`)
+		v := evalStrInContext(t, ec, `
+			(supervise (map)
+				(fn () (recv c))
+				(fn () (send c 1) "sent"))`)
+		assertListValue(t, v, []Value{
+			&NumberValue{Val: 1},
+			&StringValue{Val: "sent"},
+		})
+	})
+
+	t.Run("escalateHalts", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(let c (chan))`)
+		err := evalStrInContextToErr(t, ec, `
+			(supervise (map "restart" "never")
+				(fn () (recv c))
+				(fn () (car 1)))`)
+		require.Contains(t, err.Error(), "supervised child 2 failed")
+	})
+
+	t.Run("never", func(t *testing.T) {
+		require.Error(t, evalStrToErr(t, `(supervise (map "restart" "never") (fn () (car 1)))`))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(t, evalStrToErr(t, `(supervise (map "restart" "sometimes"))`))
+		require.Error(t, evalStrToErr(t, `(supervise (map "maxRestarts" -1))`))
+		require.Error(t, evalStrToErr(t, `(supervise (map "other" 1))`))
+		require.Error(t, evalStrToErr(t, `(supervise (map) 1)`))
+	})
+}
+
+func Test_assertFns(t *testing.T) {
+	assertNilValue(t, evalStrToVal(t, `(assert (== 1 1))`))
+	assertNilValue(t, evalStrToVal(t, `(assert true "unused")`))
+
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `(defun check (n) (assert (> n 0) "n must be positive"))`)
+	err := evalStrInContextToErr(t, ec, `
+		(check -1)`)
+	require.IsType(t, (*EvalError)(nil), err)
+	require.Equal(t, "assertion failed: n must be positive", err.(*EvalError).Msg)
+	require.Equal(t, 1, err.(*EvalError).Pos.Row)
+	require.Equal(t, 18, err.(*EvalError).Pos.Col)
+
+	err = evalStrToErr(t, `(assert false)`)
+	require.Equal(t, "assertion failed", err.(*EvalError).Msg)
+	err = evalStrToErr(t, `(assert false 1)`)
+	require.Contains(t, err.Error(), "assert expects a string message, got number")
+
+	err = evalStrToErr(t, `(if true (fail "unreachable state"))`)
+	require.IsType(t, (*EvalError)(nil), err)
+	require.Equal(t, "unreachable state", err.(*EvalError).Msg)
+	require.Equal(t, 10, err.(*EvalError).Pos.Col)
+	_, err = ExecString(`(if true (fail "unreachable state"))`)
+	require.Contains(t, err.Error(), "\t(if true (fail \"unreachable state\"))\n\t         ^")
+}
@@ -0,0 +1,225 @@
+package golisp2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// httpShutdownTimeout bounds how long httpServe waits for in-flight requests
+// once evaluation is halted.
+const httpShutdownTimeout = 5 * time.Second
+
+const (
+	// httpReadHeaderTimeout and httpReadTimeout bound how long httpServe waits
+	// for a request's headers, and for the whole request, so slow clients can't
+	// hold connections open indefinitely.
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+
+	// httpMaxBodyBytes is the largest request body httpServe accepts. Larger
+	// requests are refused with a 413 without calling the handler.
+	httpMaxBodyBytes = 1 << 20
+)
+
+// httpServeFn serves HTTP on the address, calling the handler function for each
+// request. The handler receives a map of the request's method, path, query,
+// headers and body, and returns a map of the response's status, headers and
+// body; or just a string body. Each request is handled in its own sub context.
+//
+// Serving blocks until evaluation is halted, at which point the server is shut
+// down and nil returned.
+func httpServeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var addr *StringValue
+	var handler *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadString(&addr).
+		ReadFunc(&handler).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicy("httpServe", networkAction); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr.Val)
+	if err != nil {
+		return nil, fmt.Errorf("httpServe failed: %w", err)
+	}
+	return serveHTTP(ec, ln, handler)
+}
+
+// serveHTTP serves requests from the listener with the handler function, until
+// evaluation is halted.
+func serveHTTP(ec *EvalContext, ln net.Listener, handler *FuncValue) (Value, error) {
+	srv := &http.Server{
+		Handler:           httpHandler(ec, handler),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+	select {
+	case err := <-served:
+		return nil, fmt.Errorf("httpServe failed: %w", err)
+	case <-ec.Context().Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return nil, fmt.Errorf("httpServe could not shut down: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return nil, fmt.Errorf("httpServe failed: %w", err)
+	}
+	return Nil, nil
+}
+
+// httpHandler adapts the handler function to an http.Handler. If the function
+// fails, or returns something that isn't a response, the error is written to
+// the context's stderr and a 500 sent. Requests with bodies over
+// httpMaxBodyBytes get a 413.
+func httpHandler(ec *EvalContext, handler *FuncValue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, httpMaxBodyBytes)
+		reqV, err := httpRequestValue(r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err == nil {
+			var respV Value
+			if respV, err = ec.SubContext(nil).callValue(handler, reqV); err == nil {
+				err = writeHTTPResponse(w, respV)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(ec.Stderr(), "httpServe: %s %s: %s\n", r.Method, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+		}
+	})
+}
+
+// httpRequestValue converts the request to the map handlers receive. Header
+// names are lowercased; repeated headers and query parameters are joined with
+// commas.
+func httpRequestValue(r *http.Request) (Value, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %w", err)
+	}
+	query := map[string]Value{}
+	for k, vs := range r.URL.Query() {
+		query[k] = &StringValue{Val: strings.Join(vs, ",")}
+	}
+	headers := map[string]Value{}
+	for k, vs := range r.Header {
+		headers[strings.ToLower(k)] = &StringValue{Val: strings.Join(vs, ",")}
+	}
+	return &MapValue{
+		Vals: map[string]Value{
+			"method":  &StringValue{Val: r.Method},
+			"path":    &StringValue{Val: r.URL.Path},
+			"query":   &MapValue{Vals: query},
+			"headers": &MapValue{Vals: headers},
+			"body":    &StringValue{Val: string(body)},
+		},
+	}, nil
+}
+
+// writeHTTPResponse writes the value a handler returned as the response. A
+// string is sent as the body with a 200 status. A map may set the status,
+// headers and body, which default to 200, none and empty.
+func writeHTTPResponse(w http.ResponseWriter, v Value) error {
+	if asStr, isStr := v.(*StringValue); isStr {
+		_, err := w.Write([]byte(asStr.Val))
+		return err
+	}
+	asMap, isMap := v.(*MapValue)
+	if !isMap {
+		return fmt.Errorf("handler must return a map or string; got %s", TypeName(v))
+	}
+	status := http.StatusOK
+	if statusV, hasStatus := asMap.Vals["status"]; hasStatus {
+		asNum, isNum := statusV.(*NumberValue)
+		if !isNum || asNum.Val < 100 || asNum.Val > 999 ||
+			asNum.Val != float64(int(asNum.Val)) {
+			return fmt.Errorf("response status must be a number from 100 to 999")
+		}
+		status = int(asNum.Val)
+	}
+	body := ""
+	if bodyV, hasBody := asMap.Vals["body"]; hasBody {
+		asStr, isStr := bodyV.(*StringValue)
+		if !isStr {
+			return fmt.Errorf("response body must be a string; got %s", TypeName(bodyV))
+		}
+		body = asStr.Val
+	}
+	if headersV, hasHeaders := asMap.Vals["headers"]; hasHeaders {
+		headers, isMap := headersV.(*MapValue)
+		if !isMap {
+			return fmt.Errorf("response headers must be a map; got %s", TypeName(headersV))
+		}
+		names := make([]string, 0, len(headers.Vals))
+		for name := range headers.Vals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			asStr, isStr := headers.Vals[name].(*StringValue)
+			if !isStr {
+				return fmt.Errorf("response header '%s' must be a string", name)
+			}
+			w.Header().Set(name, asStr.Val)
+		}
+	}
+	w.WriteHeader(status)
+	_, err := w.Write([]byte(body))
+	return err
+}
+
+// jsonEncodeFn converts the value to a JSON string.
+func jsonEncodeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	b, err := MarshalValueJSON(v)
+	if err != nil {
+		return nil, fmt.Errorf("jsonEncode failed: %w", err)
+	}
+	return &StringValue{
+		Val: string(b),
+	}, nil
+}
+
+// jsonDecodeFn parses the JSON string into a value.
+func jsonDecodeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var str *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&str).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	v, err := UnmarshalValueJSON([]byte(str.Val))
+	if err != nil {
+		return nil, fmt.Errorf("jsonDecode failed: %w", err)
+	}
+	return v, nil
+}
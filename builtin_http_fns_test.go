@@ -0,0 +1,105 @@
+package golisp2
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_httpServe(t *testing.T) {
+
+	handle := func(t *testing.T, handlerSrc string, req *http.Request) (*httptest.ResponseRecorder, string) {
+		t.Helper()
+		var stderr bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetStderr(&stderr)
+		handler := assertAsFunc(t, evalStrInContext(t, ec, handlerSrc))
+		rec := httptest.NewRecorder()
+		httpHandler(ec, handler).ServeHTTP(rec, req)
+		return rec, stderr.String()
+	}
+
+	t.Run("request", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/items?id=4", strings.NewReader(`{"a":1}`))
+		req.Header.Set("X-Token", "abc")
+		rec, _ := handle(t, `
+			(fn (req)
+				(map
+					"status" 201
+					"headers" (map "Content-Type" "application/json")
+					"body" (jsonEncode (list
+						(mapGet req "method")
+						(mapGet req "path")
+						(mapGet (mapGet req "query") "id")
+						(mapGet (mapGet req "headers") "x-token")
+						(jsonDecode (mapGet req "body"))))))`, req)
+		require.Equal(t, 201, rec.Code)
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.JSONEq(t, `["POST", "/items", "4", "abc", {"a": 1}]`, rec.Body.String())
+	})
+
+	t.Run("stringResponse", func(t *testing.T) {
+		rec, _ := handle(t, `(fn (req) "hi")`, httptest.NewRequest("GET", "/", nil))
+		require.Equal(t, 200, rec.Code)
+		require.Equal(t, "hi", rec.Body.String())
+	})
+
+	t.Run("handlerErrors", func(t *testing.T) {
+		rec, stderr := handle(t, `(fn (req) (car 1))`, httptest.NewRequest("GET", "/x", nil))
+		require.Equal(t, 500, rec.Code)
+		require.Contains(t, stderr, "httpServe: GET /x:")
+
+		rec, stderr = handle(t, `(fn (req) 1)`, httptest.NewRequest("GET", "/", nil))
+		require.Equal(t, 500, rec.Code)
+		require.Contains(t, stderr, "handler must return a map or string")
+
+		rec, _ = handle(t, `(fn (req) (map "status" 42))`, httptest.NewRequest("GET", "/", nil))
+		require.Equal(t, 500, rec.Code)
+	})
+
+	t.Run("bodyTooLarge", func(t *testing.T) {
+		body := strings.Repeat("x", httpMaxBodyBytes+1)
+		rec, stderr := handle(t, `(fn (req) (car 1))`,
+			httptest.NewRequest("POST", "/", strings.NewReader(body)))
+		require.Equal(t, 413, rec.Code)
+		require.Empty(t, stderr)
+	})
+
+	t.Run("serve", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetContext(ctx)
+		handler := assertAsFunc(t, evalStrInContext(t, ec, `(fn (req) (mapGet req "path"))`))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := serveHTTP(ec, ln, handler)
+			done <- err
+		}()
+		resp, err := http.Get("http://" + ln.Addr().String() + "/ping")
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, "/ping", string(body))
+
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		evalStrToErr(t, `(httpServe "not an address" (fn (req) ""))`)
+		evalStrToErr(t, `(httpServe ":0" 1)`)
+		evalStrToErr(t, `(jsonDecode "{")`)
+		evalStrToErr(t, `(jsonEncode (fn () 1))`)
+	})
+}
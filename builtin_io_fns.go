@@ -0,0 +1,309 @@
+package golisp2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+//
+// Effectful I/O built-ins. All of these go through EvalContext.effect, so they
+// can be recorded and replayed. Those that write go through
+// EvalContext.writeEffect, so they can also be dry-run.
+//
+
+// readFileFn reads the file at the given path, and returns it's contents as a
+// string.
+func readFileFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var path *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&path).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicyPath("readFile", readFileAction, path.Val); err != nil {
+		return nil, err
+	}
+
+	return ec.effect("readFile", vals, func() (Value, error) {
+		contents, err := ioutil.ReadFile(path.Val)
+		if err != nil {
+			return nil, fmt.Errorf("readFile failed: %w", err)
+		}
+		return &StringValue{
+			Val: string(contents),
+		}, nil
+	})
+}
+
+// getEnvFn returns the value of the given environment variable, or nil if it
+// isn't set.
+func getEnvFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var name *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&name).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicy("getEnv", envAction); err != nil {
+		return nil, err
+	}
+
+	return ec.effect("getEnv", vals, func() (Value, error) {
+		v, isSet := os.LookupEnv(name.Val)
+		if !isSet {
+			return Nil, nil
+		}
+		return &StringValue{
+			Val: v,
+		}, nil
+	})
+}
+
+// httpGetFn performs a GET request against the given url, and returns a map of
+// the response's status code and body.
+func httpGetFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var url *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&url).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicy("httpGet", networkAction); err != nil {
+		return nil, err
+	}
+
+	return ec.effect("httpGet", vals, func() (Value, error) {
+		req, err := http.NewRequestWithContext(ec.Context(), "GET", url.Val, nil)
+		if err != nil {
+			return nil, fmt.Errorf("httpGet failed: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("httpGet failed: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("httpGet failed: %w", err)
+		}
+		return httpResult(resp.StatusCode, string(body)), nil
+	})
+}
+
+// writeFileFn writes the string to the file at the given path, replacing any
+// existing contents.
+func writeFileFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var path, contents *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&path).
+		ReadString(&contents).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicyPath("writeFile", writeFileAction, path.Val); err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf(
+		"would write %d bytes to %s", len(contents.Val), path.Val)
+	return ec.writeEffect("writeFile", vals, description, Nil,
+		func() (Value, error) {
+			if err := ioutil.WriteFile(path.Val, []byte(contents.Val), 0644); err != nil {
+				return nil, fmt.Errorf("writeFile failed: %w", err)
+			}
+			return Nil, nil
+		})
+}
+
+// execFn runs the given command with the remaining arguments, and returns a map
+// of it's exit code, stdout and stderr. A non-zero exit is not an error.
+func execFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var cmdArgs []*StringValue
+	err := ArgMapperValues(vals...).
+		ReadStrings(&cmdArgs).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExecEnabled(ec, "exec"); err != nil {
+		return nil, err
+	}
+	if len(cmdArgs) == 0 {
+		return nil, fmt.Errorf("exec expects a command")
+	}
+	argStrs := stringVals(cmdArgs)
+
+	description := fmt.Sprintf("would run %s", strings.Join(argStrs, " "))
+	synthetic := execResult(0, "", "")
+	return ec.writeEffect("exec", vals, description, synthetic,
+		func() (Value, error) {
+			var stdout, stderr bytes.Buffer
+			cmd := exec.CommandContext(ec.Context(), argStrs[0], argStrs[1:]...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			runErr := cmd.Run()
+			var exitErr *exec.ExitError
+			if runErr != nil && !errors.As(runErr, &exitErr) {
+				return nil, fmt.Errorf("exec failed: %w", runErr)
+			}
+			return execResult(
+				cmd.ProcessState.ExitCode(), stdout.String(), stderr.String()), nil
+		})
+}
+
+// execPipeFn runs the given command with the remaining arguments, and calls the
+// function with each line of its stdout as it's written. Returns a map of the
+// exit code and stderr, like exec; stdout is always empty, as it's been
+// consumed. If the function fails, the command is killed.
+//
+// As the function is called as the command runs, execPipe can't be recorded
+// or replayed.
+func execPipeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var onLine *FuncValue
+	var cmdArgs []*StringValue
+	err := ArgMapperValues(vals...).
+		ReadFunc(&onLine).
+		ReadStrings(&cmdArgs).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExecEnabled(ec, "execPipe"); err != nil {
+		return nil, err
+	}
+	if len(cmdArgs) == 0 {
+		return nil, fmt.Errorf("execPipe expects a command")
+	}
+	if ec.environ().effectMode != liveEffects {
+		return nil, fmt.Errorf("execPipe cannot be recorded or replayed")
+	}
+	argStrs := stringVals(cmdArgs)
+
+	description := fmt.Sprintf("would run %s", strings.Join(argStrs, " "))
+	synthetic := execResult(0, "", "")
+	return ec.writeEffect("execPipe", vals[1:], description, synthetic,
+		func() (Value, error) {
+			ctx, cancel := context.WithCancel(ec.Context())
+			defer cancel()
+			var stderr bytes.Buffer
+			cmd := exec.CommandContext(ctx, argStrs[0], argStrs[1:]...)
+			cmd.Stderr = &stderr
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				return nil, fmt.Errorf("execPipe failed: %w", err)
+			}
+			if err := cmd.Start(); err != nil {
+				return nil, fmt.Errorf("execPipe failed: %w", err)
+			}
+			lines := bufio.NewScanner(stdout)
+			for lines.Scan() {
+				_, err := ec.callValue(onLine, &StringValue{Val: lines.Text()})
+				if err != nil {
+					cancel()
+					cmd.Wait()
+					return nil, fmt.Errorf("execPipe encountered an error: %w", err)
+				}
+			}
+			runErr := cmd.Wait()
+			var exitErr *exec.ExitError
+			if runErr != nil && !errors.As(runErr, &exitErr) {
+				return nil, fmt.Errorf("execPipe failed: %w", runErr)
+			}
+			return execResult(cmd.ProcessState.ExitCode(), "", stderr.String()), nil
+		})
+}
+
+// checkExecEnabled returns an error naming the builtin if running processes
+// has been disabled, or is forbidden by the policy. See EvalContext.DisableExec.
+func checkExecEnabled(ec *EvalContext, fnName string) error {
+	if !ec.environ().execDisabled {
+		return ec.checkPolicy(fnName, execAction)
+	}
+	return &EvalError{
+		Msg: fmt.Sprintf("'%s' cannot run processes; they're disabled", fnName),
+		Pos: ec.CallPos(),
+	}
+}
+
+// stringVals returns the strings held by each of the values.
+func stringVals(vals []*StringValue) []string {
+	strs := make([]string, 0, len(vals))
+	for _, v := range vals {
+		strs = append(strs, v.Val)
+	}
+	return strs
+}
+
+// execResult builds the map returned by exec.
+func execResult(exitCode int, stdout, stderr string) Value {
+	return &MapValue{
+		Vals: map[string]Value{
+			"exitCode": &NumberValue{Val: float64(exitCode)},
+			"stdout":   &StringValue{Val: stdout},
+			"stderr":   &StringValue{Val: stderr},
+		},
+	}
+}
+
+// httpPostFn performs a POST request against the given url with the given
+// content type and body, and returns a map of the response's status code and
+// body.
+func httpPostFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var url, contentType, body *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&url).
+		ReadString(&contentType).
+		ReadString(&body).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if err := ec.checkPolicy("httpPost", networkAction); err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf(
+		"would POST %d bytes of %s to %s", len(body.Val), contentType.Val, url.Val)
+	synthetic := httpResult(http.StatusOK, "")
+	return ec.writeEffect("httpPost", vals, description, synthetic,
+		func() (Value, error) {
+			req, err := http.NewRequestWithContext(
+				ec.Context(), "POST", url.Val, strings.NewReader(body.Val))
+			if err != nil {
+				return nil, fmt.Errorf("httpPost failed: %w", err)
+			}
+			req.Header.Set("Content-Type", contentType.Val)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, fmt.Errorf("httpPost failed: %w", err)
+			}
+			defer resp.Body.Close()
+			respBody, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return nil, fmt.Errorf("httpPost failed: %w", err)
+			}
+			return httpResult(resp.StatusCode, string(respBody)), nil
+		})
+}
+
+// httpResult builds the map returned by the http functions.
+func httpResult(status int, body string) Value {
+	return &MapValue{
+		Vals: map[string]Value{
+			"status": &NumberValue{Val: float64(status)},
+			"body":   &StringValue{Val: body},
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package golisp2
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_getEnv(t *testing.T) {
+	os.Setenv("GOLISP_TEST_VAR", "value")
+	defer os.Unsetenv("GOLISP_TEST_VAR")
+
+	assertStringValue(t, evalStrToVal(t, `(getEnv "GOLISP_TEST_VAR")`), "value")
+	assertNilValue(t, evalStrToVal(t, `(getEnv "GOLISP_TEST_UNSET_VAR")`))
+	evalStrToErr(t, `(getEnv 1)`)
+}
+
+func Test_httpGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "body")
+		}))
+	defer srv.Close()
+
+	assertMapValue(t, evalStrToVal(t, `(httpGet "`+srv.URL+`")`), map[string]Value{
+		"status": &NumberValue{Val: 200},
+		"body":   &StringValue{Val: "body"},
+	})
+	evalStrToErr(t, `(httpGet "bad://url")`)
+}
+
+func Test_writeFile(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "writeFile")
+	require.NoError(t, dirErr)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.txt")
+
+	assertNilValue(t, evalStrToVal(t, `(writeFile "`+path+`" "contents")`))
+	contents, readErr := ioutil.ReadFile(path)
+	require.NoError(t, readErr)
+	require.Equal(t, "contents", string(contents))
+	evalStrToErr(t, `(writeFile "`+path+`")`)
+
+	t.Run("dryRun", func(t *testing.T) {
+		dryPath := filepath.Join(dir, "dry.txt")
+		var log bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetDryRun(&log)
+		require.True(t, ec.DryRun())
+		assertNilValue(t, evalStrInContext(t, ec, `(writeFile "`+dryPath+`" "abc")`))
+		require.Contains(t, log.String(), "writeFile: would write 3 bytes to "+dryPath)
+		_, statErr := os.Stat(dryPath)
+		require.True(t, os.IsNotExist(statErr))
+	})
+}
+
+func Test_exec(t *testing.T) {
+	assertMapValue(t, evalStrToVal(t, `(exec "sh" "-c" "echo out; echo err >&2; exit 3")`),
+		map[string]Value{
+			"exitCode": &NumberValue{Val: 3},
+			"stdout":   &StringValue{Val: "out\n"},
+			"stderr":   &StringValue{Val: "err\n"},
+		})
+	evalStrToErr(t, `(exec)`)
+	evalStrToErr(t, `(exec "golisp-not-a-real-command")`)
+
+	t.Run("dryRun", func(t *testing.T) {
+		var log bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetDryRun(&log)
+		v := evalStrInContext(t, ec, `(exec "rm" "-rf" "/")`)
+		require.Equal(t, "dry-run: exec: would run rm -rf /\n", log.String())
+		assertNumValue(t, assertAsMap(t, v).Vals["exitCode"], 0)
+	})
+}
+
+func Test_execPipe(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	v := evalStrInContext(t, ec, `
+	  (let seen "")
+	  (execPipe
+	    (fn (line) (set! seen (concat seen "[" line "]")))
+	    "sh" "-c" "echo a; echo b; echo err >&2; exit 2")`)
+	assertMapValue(t, v, map[string]Value{
+		"exitCode": &NumberValue{Val: 2},
+		"stdout":   &StringValue{Val: ""},
+		"stderr":   &StringValue{Val: "err\n"},
+	})
+	assertStringValue(t, evalStrInContext(t, ec, `seen`), "[a][b]")
+
+	evalStrToErr(t, `(execPipe (fn (line) (assert false)) "echo" "a")`)
+	evalStrToErr(t, `(execPipe (fn (line) line))`)
+
+	t.Run("dryRun", func(t *testing.T) {
+		var log bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetDryRun(&log)
+		evalStrInContext(t, ec, `(execPipe (fn (line) line) "rm" "-rf" "/")`)
+		require.Equal(t, "dry-run: execPipe: would run rm -rf /\n", log.String())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.DisableExec()
+		err := evalStrInContextToErr(t, ec, `(exec "echo" "a")`)
+		require.Contains(t, err.Error(), "'exec' cannot run processes")
+		err = evalStrInContextToErr(t, ec, `(execPipe (fn (line) line) "echo" "a")`)
+		require.Contains(t, err.Error(), "'execPipe' cannot run processes")
+	})
+}
+
+func Test_httpPost(t *testing.T) {
+	posted := ""
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			posted = r.Header.Get("Content-Type") + ":" + string(body)
+			fmt.Fprint(w, "ok")
+		}))
+	defer srv.Close()
+
+	assertMapValue(t,
+		evalStrToVal(t, `(httpPost "`+srv.URL+`" "text/plain" "hi")`),
+		map[string]Value{
+			"status": &NumberValue{Val: 200},
+			"body":   &StringValue{Val: "ok"},
+		})
+	require.Equal(t, "text/plain:hi", posted)
+
+	t.Run("dryRun", func(t *testing.T) {
+		posted = ""
+		var log bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetDryRun(&log)
+		evalStrInContext(t, ec, `(httpPost "`+srv.URL+`" "text/plain" "hi")`)
+		require.Empty(t, posted)
+		require.Contains(t, log.String(), "would POST 2 bytes")
+	})
+}
@@ -0,0 +1,405 @@
+package golisp2
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+//
+// Collection built-ins, for reordering, grouping and reshaping lists.
+//
+
+// sortFn returns a copy of the list in ascending order. Numbers and strings are
+// ordered by value; see compareSortValues for mixed types. The sort is stable.
+func sortFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	sorted := append([]Value{}, asList.Vals...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareSortValues(sorted[i], sorted[j]) < 0
+	})
+	return &ListValue{
+		Vals: sorted,
+	}, nil
+}
+
+// sortByFn returns a copy of the list in ascending order of the key the
+// function returns for each element. The function is called once per element.
+func sortByFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	type keyed struct {
+		key, val Value
+	}
+	elems := make([]keyed, 0, len(asList.Vals))
+	for _, v := range asList.Vals {
+		key, err := ec.callValue(asFn, v)
+		if err != nil {
+			return nil, fmt.Errorf("sortBy encountered an error: %w", err)
+		}
+		elems = append(elems, keyed{key: key, val: v})
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return compareSortValues(elems[i].key, elems[j].key) < 0
+	})
+	sorted := make([]Value, len(elems))
+	for i, e := range elems {
+		sorted[i] = e.val
+	}
+	return &ListValue{
+		Vals: sorted,
+	}, nil
+}
+
+// groupByFn groups the elements of the list by the key the function returns
+// for each. Returns a map from each key to the list of elements with it, in
+// their original order. Keys may be strings, keywords, numbers or bools.
+func groupByFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string]*ListValue{}
+	for _, v := range asList.Vals {
+		keyV, err := ec.callValue(asFn, v)
+		if err != nil {
+			return nil, fmt.Errorf("groupBy encountered an error: %w", err)
+		}
+		key, isKey := groupKey(keyV)
+		if !isKey {
+			return nil, fmt.Errorf(
+				"groupBy expects keys to be strings, keywords, numbers or bools; got %s",
+				TypeName(keyV))
+		}
+		if groups[key] == nil {
+			groups[key] = &ListValue{}
+		}
+		groups[key].Vals = append(groups[key].Vals, v)
+	}
+	mapVals := make(map[string]Value, len(groups))
+	for k, g := range groups {
+		mapVals[k] = g
+	}
+	return &MapValue{
+		Vals: mapVals,
+	}, nil
+}
+
+// groupKey returns the map key a group is stored under. Like mapKey, but
+// numbers and bools are also allowed, as their string form.
+func groupKey(v Value) (string, bool) {
+	switch tV := v.(type) {
+	case *NumberValue:
+		return strconv.FormatFloat(tV.Val, 'f', -1, 64), true
+	case *BoolValue:
+		return strconv.FormatBool(tV.Val), true
+	default:
+		return mapKey(v)
+	}
+}
+
+// uniqFn returns a copy of the list without duplicates, keeping the first of
+// each. Elements are compared structurally.
+func uniqFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	uniq := []Value{}
+	for _, v := range asList.Vals {
+		seen := false
+		for _, u := range uniq {
+			if valuesEqual(u, v) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			uniq = append(uniq, v)
+		}
+	}
+	return &ListValue{
+		Vals: uniq,
+	}, nil
+}
+
+// zipFn pairs up the elements of the two lists: returns a list of [a b] lists.
+// Stops at the end of the shorter list.
+func zipFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var left, right *ListValue
+	err := ArgMapperValues(vals...).
+		ReadList(&left).
+		ReadList(&right).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	n := minInt(len(left.Vals), len(right.Vals))
+	pairs := make([]Value, n)
+	for i := 0; i < n; i++ {
+		pairs[i] = &ListValue{
+			Vals: []Value{left.Vals[i], right.Vals[i]},
+		}
+	}
+	return &ListValue{
+		Vals: pairs,
+	}, nil
+}
+
+// flattenFn returns the elements of the list, with any nested lists replaced by
+// their elements, at every depth.
+func flattenFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &ListValue{
+		Vals: flatten(nil, asList),
+	}, nil
+}
+
+// flatten appends the elements of the list to flat, flattening any nested
+// lists.
+func flatten(flat []Value, lv *ListValue) []Value {
+	for _, v := range lv.Vals {
+		if nested, isList := v.(*ListValue); isList {
+			flat = flatten(flat, nested)
+		} else {
+			flat = append(flat, v)
+		}
+	}
+	return flat
+}
+
+// partitionFn splits the list into a list of lists of n elements each. The last
+// may have fewer.
+func partitionFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asNum *NumberValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadNumber(&asNum).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if asNum.Val < 1 || asNum.Val != float64(int(asNum.Val)) {
+		return nil, fmt.Errorf("partition size must be a positive whole number")
+	}
+	n := int(asNum.Val)
+	parts := []Value{}
+	for i := 0; i < len(asList.Vals); i += n {
+		end := minInt(i+n, len(asList.Vals))
+		parts = append(parts, &ListValue{
+			Vals: append([]Value{}, asList.Vals[i:end]...),
+		})
+	}
+	return &ListValue{
+		Vals: parts,
+	}, nil
+}
+
+// listFindFn returns the first element of the list the function returns true
+// for, or nil if there is none.
+func listFindFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range asList.Vals {
+		match, err := listPredicate(ec, "listFind", asFn, v)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return v, nil
+		}
+	}
+	return Nil, nil
+}
+
+// listAnyFn returns whether the function returns true for any element of the
+// list. Stops at the first that it does.
+func listAnyFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range asList.Vals {
+		match, err := listPredicate(ec, "listAny", asFn, v)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			return True, nil
+		}
+	}
+	return False, nil
+}
+
+// listAllFn returns whether the function returns true for every element of the
+// list. Stops at the first that it doesn't.
+func listAllFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range asList.Vals {
+		match, err := listPredicate(ec, "listAll", asFn, v)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			return False, nil
+		}
+	}
+	return True, nil
+}
+
+// listTakeFn returns a list of the first n elements of the list; or all of
+// them, if there are fewer.
+func listTakeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	asList, n, err := readListCount("listTake", vals)
+	if err != nil {
+		return nil, err
+	}
+	n = minInt(n, len(asList.Vals))
+	return &ListValue{
+		Vals: append([]Value{}, asList.Vals[:n]...),
+	}, nil
+}
+
+// listDropFn returns a list of all but the first n elements of the list.
+func listDropFn(ec *EvalContext, vals ...Value) (Value, error) {
+	asList, n, err := readListCount("listDrop", vals)
+	if err != nil {
+		return nil, err
+	}
+	n = minInt(n, len(asList.Vals))
+	return &ListValue{
+		Vals: append([]Value{}, asList.Vals[n:]...),
+	}, nil
+}
+
+// listTakeWhileFn returns a list of the elements of the list up to the first
+// the function returns false for.
+func listTakeWhileFn(ec *EvalContext, vals ...Value) (Value, error) {
+	asList, n, err := countWhile(ec, "listTakeWhile", vals)
+	if err != nil {
+		return nil, err
+	}
+	return &ListValue{
+		Vals: append([]Value{}, asList.Vals[:n]...),
+	}, nil
+}
+
+// listDropWhileFn returns a list of the elements of the list from the first
+// the function returns false for.
+func listDropWhileFn(ec *EvalContext, vals ...Value) (Value, error) {
+	asList, n, err := countWhile(ec, "listDropWhile", vals)
+	if err != nil {
+		return nil, err
+	}
+	return &ListValue{
+		Vals: append([]Value{}, asList.Vals[n:]...),
+	}, nil
+}
+
+// readListCount reads the list and count arguments of listTake and listDrop.
+func readListCount(fnName string, vals []Value) (*ListValue, int, error) {
+	var asList *ListValue
+	var asNum *NumberValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadNumber(&asNum).
+		Complete()
+	if err != nil {
+		return nil, 0, err
+	}
+	if asNum.Val < 0 || asNum.Val != float64(int(asNum.Val)) {
+		return nil, 0, fmt.Errorf("%s count must be a non-negative whole number", fnName)
+	}
+	return asList, int(asNum.Val), nil
+}
+
+// countWhile reads the list and function arguments of listTakeWhile and
+// listDropWhile, and returns how many elements at the start of the list the
+// function returns true for.
+func countWhile(ec *EvalContext, fnName string, vals []Value) (*ListValue, int, error) {
+	var asList *ListValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, v := range asList.Vals {
+		match, err := listPredicate(ec, fnName, asFn, v)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !match {
+			return asList, i, nil
+		}
+	}
+	return asList, len(asList.Vals), nil
+}
+
+// listPredicate calls the function on the value, and returns whether it
+// matched. Like filterKeep, nil is treated as false, and anything but a bool is
+// an error.
+func listPredicate(ec *EvalContext, fnName string, asFn *FuncValue, v Value) (bool, error) {
+	matchVal, err := ec.callValue(asFn, v)
+	if err != nil {
+		return false, fmt.Errorf("%s encountered an error: %w", fnName, err)
+	}
+	switch tV := matchVal.(type) {
+	case *NilValue:
+		return false, nil
+	case *BoolValue:
+		return tV.Val, nil
+	default:
+		return false, fmt.Errorf("%s fn must return boolean; got %s", fnName, TypeName(matchVal))
+	}
+}
@@ -0,0 +1,96 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_listFns(t *testing.T) {
+	// assertInspect evaluates the source, and checks how its value prints.
+	assertInspect := func(t *testing.T, src, expected string) {
+		t.Helper()
+		require.Equal(t, expected, evalStrToVal(t, src).InspectStr())
+	}
+
+	t.Run("sort", func(t *testing.T) {
+		assertInspect(t, `(sort (list 3 1 2))`, "[1 2 3]")
+		assertInspect(t, `(sort (list "b" nil "a"))`, `[nil "a" "b"]`)
+		assertInspect(t, `(sort (list))`, "[]")
+		evalStrToErr(t, `(sort 1)`)
+	})
+
+	t.Run("sortBy", func(t *testing.T) {
+		assertInspect(t,
+			`(sortBy (list "ccc" "a" "bb" "d") (fn (s) (len s)))`,
+			`["a" "d" "bb" "ccc"]`)
+		evalStrToErr(t, `(sortBy (list 1) (fn (x) (car x)))`)
+	})
+
+	t.Run("groupBy", func(t *testing.T) {
+		assertInspect(t,
+			`(groupBy (list 1 2 3 4 5) (fn (n) (if (> n 2) "big" "small")))`,
+			"{ big:[3 4 5] small:[1 2] }")
+		assertInspect(t,
+			`(groupBy (list "a" "bb" "cc") (fn (s) (len s)))`,
+			`{ 1:["a"] 2:["bb" "cc"] }`)
+		evalStrToErr(t, `(groupBy (list 1) (fn (n) (list n)))`)
+	})
+
+	t.Run("uniq", func(t *testing.T) {
+		assertInspect(t, `(uniq (list 1 2 1 "a" (list 1) "a" (list 1)))`, `[1 2 "a" [1]]`)
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		assertInspect(t, `(zip (list 1 2 3) (list "a" "b"))`, `[[1 "a"] [2 "b"]]`)
+		evalStrToErr(t, `(zip (list 1))`)
+	})
+
+	t.Run("flatten", func(t *testing.T) {
+		assertInspect(t, `(flatten (list 1 (list 2 (list 3 (list))) 4))`, "[1 2 3 4]")
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		assertInspect(t, `(partition (list 1 2 3 4 5) 2)`, "[[1 2] [3 4] [5]]")
+		assertInspect(t, `(partition (list) 3)`, "[]")
+		evalStrToErr(t, `(partition (list 1) 0)`)
+		evalStrToErr(t, `(partition (list 1) 1.5)`)
+	})
+
+	t.Run("listFind", func(t *testing.T) {
+		assertInspect(t, `(listFind (list 1 4 6) (fn (n) (> n 3)))`, "4")
+		assertInspect(t, `(listFind (list 1 2) (fn (n) (> n 3)))`, "nil")
+		assertInspect(t, `(listFind (list 1 2) (fn (n) (if (== n 1) true (car n))))`, "1")
+		evalStrToErr(t, `(listFind (list 1) (fn (n) n))`)
+	})
+
+	t.Run("listAnyAll", func(t *testing.T) {
+		assertInspect(t, `(listAny (list 1 4) (fn (n) (> n 3)))`, "true")
+		assertInspect(t, `(listAny (list) (fn (n) true))`, "false")
+		assertInspect(t, `(listAny (list 1 2) (fn (n) (if (== n 1) true (car n))))`, "true")
+		assertInspect(t, `(listAll (list 4 5) (fn (n) (> n 3)))`, "true")
+		assertInspect(t, `(listAll (list) (fn (n) false))`, "true")
+		assertInspect(t, `(listAll (list 1 2) (fn (n) (if (== n 1) false (car n))))`, "false")
+		evalStrToErr(t, `(listAny (list 1) (fn (n) (car n)))`)
+		evalStrToErr(t, `(listAll (list 1))`)
+	})
+
+	t.Run("listTakeDrop", func(t *testing.T) {
+		assertInspect(t, `(listTake (list 1 2 3) 2)`, "[1 2]")
+		assertInspect(t, `(listTake (list 1 2 3) 5)`, "[1 2 3]")
+		assertInspect(t, `(listDrop (list 1 2 3) 2)`, "[3]")
+		assertInspect(t, `(listDrop (list 1 2 3) 5)`, "[]")
+		assertInspect(t, `(listTake (list 1 2 3) 0)`, "[]")
+		evalStrToErr(t, `(listTake (list 1) -1)`)
+		evalStrToErr(t, `(listDrop (list 1) 0.5)`)
+	})
+
+	t.Run("listTakeDropWhile", func(t *testing.T) {
+		assertInspect(t, `(listTakeWhile (list 1 2 5 1) (fn (n) (< n 3)))`, "[1 2]")
+		assertInspect(t, `(listDropWhile (list 1 2 5 1) (fn (n) (< n 3)))`, "[5 1]")
+		assertInspect(t, `(listTakeWhile (list 1 2) (fn (n) true))`, "[1 2]")
+		assertInspect(t, `(listDropWhile (list 1 2) (fn (n) true))`, "[]")
+		assertInspect(t, `(listTakeWhile (list 5 "a") (fn (n) (< n 3)))`, "[]")
+		evalStrToErr(t, `(listDropWhile (list 1) (fn (n) 1))`)
+	})
+}
@@ -0,0 +1,103 @@
+package golisp2
+
+import "fmt"
+
+//
+// Object built-ins. Objects bundle state with the methods that act on it;
+// methods are called with `(: obj name args...)`, which passes the object as
+// the first argument. Slots missing from an object are looked up in its
+// prototype.
+//
+
+// objectFn creates an object with the slots of the given map. If a second
+// object is given, it's the new object's prototype.
+func objectFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var slots *MapValue
+	var protoV Value
+	err := ArgMapperValues(vals...).
+		ReadMap(&slots).
+		MaybeReadValue(&protoV).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	var proto *ObjectValue
+	if protoV != nil {
+		if proto, err = asObject("object", protoV); err != nil {
+			return nil, err
+		}
+	}
+	return NewObjectValue(slots.Vals, proto), nil
+}
+
+// objectGetFn returns the value of the object's slot, which may be inherited
+// from its prototype. Returns nil if neither has it.
+func objectGetFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var objV Value
+	var name string
+	err := ArgMapperValues(vals...).
+		ReadValue(&objV).
+		ReadKey(&name).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := asObject("objectGet", objV)
+	if err != nil {
+		return nil, err
+	}
+	v, hasV := obj.Get(name)
+	if !hasV {
+		return Nil, nil
+	}
+	return v, nil
+}
+
+// objectSetFn sets the object's slot to the value, and returns the value. The
+// slot is set on the object itself, even if it was inherited.
+func objectSetFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var objV, v Value
+	var name string
+	err := ArgMapperValues(vals...).
+		ReadValue(&objV).
+		ReadKey(&name).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := asObject("objectSet", objV)
+	if err != nil {
+		return nil, err
+	}
+	obj.Set(name, v)
+	return v, nil
+}
+
+// objectProtoFn returns the object's prototype, or nil if it has none.
+func objectProtoFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var objV Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&objV).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := asObject("objectProto", objV)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Proto == nil {
+		return Nil, nil
+	}
+	return obj.Proto, nil
+}
+
+// asObject checks that the value is an object.
+func asObject(fnName string, v Value) (*ObjectValue, error) {
+	asObj, isObj := v.(*ObjectValue)
+	if !isObj {
+		return nil, fmt.Errorf("%s expects an object; got %s", fnName, TypeName(v))
+	}
+	return asObj, nil
+}
@@ -0,0 +1,60 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_objectFns(t *testing.T) {
+
+	t.Run("methods", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		  (let counter (object (map
+		    "count" 0
+		    "add" (fn (self n)
+		      (objectSet self "count" (+ (objectGet self "count") n)))
+		    "get" (fn (self) (objectGet self "count")))))`)
+		evalStrInContext(t, ec, `(: counter add 2)`)
+		evalStrInContext(t, ec, `(: counter add 3)`)
+		assertNumValue(t, evalStrInContext(t, ec, `(: counter get)`), 5)
+		assertBoolValue(t, evalStrInContext(t, ec, `(isObject counter)`), true)
+		require.Equal(t, "object", TypeName(evalStrInContext(t, ec, `counter`)))
+	})
+
+	t.Run("prototypes", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		  (let animal (object (map
+		    "name" "animal"
+		    "greet" (fn (self) (concat "I am " (objectGet self "name"))))))
+		  (let dog (object (map "name" "dog") animal))`)
+		assertStringValue(t, evalStrInContext(t, ec, `(: dog greet)`), "I am dog")
+		assertStringValue(t, evalStrInContext(t, ec, `(: animal greet)`), "I am animal")
+
+		// setting an inherited slot only changes the object itself.
+		evalStrInContext(t, ec, `(objectSet dog "greet" (fn (self) "woof"))`)
+		assertStringValue(t, evalStrInContext(t, ec, `(: dog greet)`), "woof")
+		assertStringValue(t, evalStrInContext(t, ec, `(: animal greet)`), "I am animal")
+
+		require.True(t, valuesEqual(
+			evalStrInContext(t, ec, `(objectProto dog)`), evalStrInContext(t, ec, `animal`)))
+		assertNilValue(t, evalStrInContext(t, ec, `(objectProto animal)`))
+		assertNilValue(t, evalStrInContext(t, ec, `(objectGet dog "missing")`))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := evalStrToErr(t, `(: (object (map)) greet)`)
+		require.Contains(t, err.Error(), "object has no method 'greet'")
+		err = evalStrToErr(t, `(: (object (map "x" 1)) x)`)
+		require.Contains(t, err.Error(), "'x' is a number, not a method")
+		err = evalStrToErr(t, `(: (map) greet)`)
+		require.Contains(t, err.Error(), "only objects have methods")
+		err = evalStrToErr(t, `(: (object (map "f" (fn (self) 1))) f 2)`)
+		require.Error(t, err)
+		evalStrToErr(t, `(object (map) 1)`)
+		parseStrToErr(t, `(: obj)`)
+		parseStrToErr(t, `(: obj "greet")`)
+	})
+}
@@ -0,0 +1,199 @@
+package golisp2
+
+import (
+	"fmt"
+	"math"
+)
+
+//
+// Lazy sequence built-ins. Wherever a sequence is expected, a list may be used
+// instead.
+//
+
+// iterateFn returns the infinite sequence x, (f x), (f (f x)), ...
+func iterateFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	var initial Value
+	err := ArgMapperValues(vals...).
+		ReadFunc(&asFn).
+		ReadValue(&initial).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			var next Value
+			return func(ec *EvalContext) (Value, bool, error) {
+				if next == nil {
+					next = initial
+					return next, true, nil
+				}
+				v, err := ec.callValue(asFn, next)
+				if err != nil {
+					return nil, false, fmt.Errorf("iterate encountered an error: %w", err)
+				}
+				next = v
+				return next, true, nil
+			}
+		},
+	}, nil
+}
+
+// repeatFn returns the infinite sequence of the given value.
+func repeatFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			return func(_ *EvalContext) (Value, bool, error) {
+				return v, true, nil
+			}
+		},
+	}, nil
+}
+
+// takeFn returns a sequence of at most the first n elements of the sequence.
+func takeFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asNum *NumberValue
+	var asSeq *SeqValue
+	err := ArgMapperValues(vals...).
+		ReadNumber(&asNum).
+		ReadSeq(&asSeq).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(math.Floor(asNum.Val))
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			iter := asSeq.Iter()
+			taken := 0
+			return func(ec *EvalContext) (Value, bool, error) {
+				if taken >= n {
+					return nil, false, nil
+				}
+				taken++
+				return iter(ec)
+			}
+		},
+	}, nil
+}
+
+// dropFn returns a sequence of all but the first n elements of the sequence.
+func dropFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asNum *NumberValue
+	var asSeq *SeqValue
+	err := ArgMapperValues(vals...).
+		ReadNumber(&asNum).
+		ReadSeq(&asSeq).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(math.Floor(asNum.Val))
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			iter := asSeq.Iter()
+			toDrop := n
+			return func(ec *EvalContext) (Value, bool, error) {
+				for ; toDrop > 0; toDrop-- {
+					if _, ok, err := iter(ec); err != nil || !ok {
+						return nil, false, err
+					}
+				}
+				return iter(ec)
+			}
+		},
+	}, nil
+}
+
+// seqToListFn consumes the sequence, and returns it's elements as a list. Note
+// that this will not terminate on an infinite sequence, unless evaluation is
+// halted.
+func seqToListFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asSeq *SeqValue
+	err := ArgMapperValues(vals...).
+		ReadSeq(&asSeq).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	listVals := []Value{}
+	iter := asSeq.Iter()
+	for {
+		if err := checkHalted(ec, ec.CallPos()); err != nil {
+			return nil, err
+		}
+		v, ok, err := iter(ec)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		listVals = append(listVals, v)
+	}
+	return &ListValue{
+		Vals: listVals,
+	}, nil
+}
+
+// seqMap returns a sequence of the elements of the sequence transformed by the
+// function.
+func seqMap(asSeq *SeqValue, asFn *FuncValue) *SeqValue {
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			iter := asSeq.Iter()
+			return func(ec *EvalContext) (Value, bool, error) {
+				v, ok, err := iter(ec)
+				if err != nil || !ok {
+					return nil, false, err
+				}
+				mapVal, mapErr := ec.callValue(asFn, v)
+				if mapErr != nil {
+					return nil, false, fmt.Errorf("listMap encountered an error: %w", mapErr)
+				}
+				return mapVal, true, nil
+			}
+		},
+	}
+}
+
+// seqFilter returns a sequence of the elements of the sequence for which the
+// function returns true.
+func seqFilter(asSeq *SeqValue, asFn *FuncValue) *SeqValue {
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			iter := asSeq.Iter()
+			return func(ec *EvalContext) (Value, bool, error) {
+				for {
+					if err := checkHalted(ec, ec.CallPos()); err != nil {
+						return nil, false, err
+					}
+					v, ok, err := iter(ec)
+					if err != nil || !ok {
+						return nil, false, err
+					}
+					keep, keepErr := filterKeep(ec, asFn, v)
+					if keepErr != nil {
+						return nil, false, keepErr
+					}
+					if keep {
+						return v, true, nil
+					}
+				}
+			}
+		},
+	}
+}
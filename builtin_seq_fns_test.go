@@ -0,0 +1,71 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_seqFns(t *testing.T) {
+	nums := func(ns ...float64) []Value {
+		vals := []Value{}
+		for _, n := range ns {
+			vals = append(vals, &NumberValue{Val: n})
+		}
+		return vals
+	}
+
+	t.Run("iterate", func(t *testing.T) {
+		assertListValue(t,
+			evalStrToVal(t, `(seqToList (take 4 (iterate (fn (x) (* x 2)) 1)))`),
+			nums(1, 2, 4, 8))
+		evalStrToErr(t, `(iterate 1 1)`)
+	})
+
+	t.Run("repeat", func(t *testing.T) {
+		assertListValue(t, evalStrToVal(t, `(seqToList (take 3 (repeat 7)))`),
+			nums(7, 7, 7))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		assertListValue(t,
+			evalStrToVal(t, `(seqToList (take 2 (drop 3 (iterate (fn (x) (+ x 1)) 0))))`),
+			nums(3, 4))
+		assertListValue(t, evalStrToVal(t, `(seqToList (drop 5 (list 1 2)))`), nums())
+	})
+
+	t.Run("list", func(t *testing.T) {
+		assertListValue(t, evalStrToVal(t, `(seqToList (take 2 (list 1 2 3)))`),
+			nums(1, 2))
+		evalStrToErr(t, `(take 2 "abc")`)
+	})
+
+	t.Run("reiterable", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(let s (drop 1 (take 3 (iterate (fn (x) (+ x 1)) 0))))`)
+		assertListValue(t, evalStrInContext(t, ec, `(seqToList s)`), nums(1, 2))
+		assertListValue(t, evalStrInContext(t, ec, `(seqToList s)`), nums(1, 2))
+	})
+
+	t.Run("mapFilter", func(t *testing.T) {
+		assertListValue(t, evalStrToVal(t, `
+		(seqToList
+		  (take 3
+		    (listMap
+		      (listFilter (iterate (fn (x) (+ x 1)) 0) (fn (x) (> x 2)))
+		      (fn (x) (* x 10)))))`),
+			nums(30, 40, 50))
+	})
+
+	t.Run("for", func(t *testing.T) {
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let total 0)
+		(for (x (take 4 (repeat 2)))
+		  (set! total (+ total x)))
+		total`), 8)
+	})
+
+	t.Run("inspect", func(t *testing.T) {
+		require.Equal(t, "<seq>", evalStrToVal(t, `(repeat 1)`).InspectStr())
+	})
+}
@@ -0,0 +1,144 @@
+package golisp2
+
+import (
+	"fmt"
+	"time"
+)
+
+//
+// Date and time built-ins. Times are read from the context's clock, so they're
+// frozen in deterministic mode. Layouts are go's reference layouts, e.g.
+// "2006-01-02 15:04:05"; durations are go duration strings, e.g. "1h30m".
+//
+
+// nowFn returns the current time.
+func nowFn(ec *EvalContext, vals ...Value) (Value, error) {
+	err := ArgMapperValues(vals...).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &TimeValue{
+		Val: ec.Now(),
+	}, nil
+}
+
+// timeFormatFn returns the time as a string in the given layout.
+func timeFormatFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var tV Value
+	var layout *StringValue
+	err := ArgMapperValues(vals...).
+		ReadValue(&tV).
+		ReadString(&layout).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	t, err := asTime("timeFormat", tV)
+	if err != nil {
+		return nil, err
+	}
+	return &StringValue{
+		Val: t.Val.Format(layout.Val),
+	}, nil
+}
+
+// timeParseFn parses the string as a time in the given layout.
+func timeParseFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var layout, str *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&layout).
+		ReadString(&str).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(layout.Val, str.Val)
+	if err != nil {
+		return nil, fmt.Errorf("timeParse could not parse '%s': %w", str.Val, err)
+	}
+	return &TimeValue{
+		Val: t,
+	}, nil
+}
+
+// timeAddFn returns the time plus the duration, which may be negative.
+func timeAddFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var tV Value
+	var durStr *StringValue
+	err := ArgMapperValues(vals...).
+		ReadValue(&tV).
+		ReadString(&durStr).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	t, err := asTime("timeAdd", tV)
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(durStr.Val)
+	if err != nil {
+		return nil, fmt.Errorf("timeAdd expects a duration like \"1h30m\": %w", err)
+	}
+	return &TimeValue{
+		Val: t.Val.Add(d),
+	}, nil
+}
+
+// timeDiffFn returns the milliseconds from the second time to the first; so
+// it's negative if the first is earlier.
+func timeDiffFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var aV, bV Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&aV).
+		ReadValue(&bV).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	a, err := asTime("timeDiff", aV)
+	if err != nil {
+		return nil, err
+	}
+	b, err := asTime("timeDiff", bV)
+	if err != nil {
+		return nil, err
+	}
+	return &NumberValue{
+		Val: float64(a.Val.Sub(b.Val)) / float64(time.Millisecond),
+	}, nil
+}
+
+// sleepFn blocks for the given number of milliseconds, or until evaluation is
+// halted.
+func sleepFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var ms *NumberValue
+	err := ArgMapperValues(vals...).
+		ReadNumber(&ms).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if ms.Val < 0 {
+		return nil, fmt.Errorf("sleep expects a non-negative number of milliseconds")
+	}
+	timer := time.NewTimer(time.Duration(ms.Val * float64(time.Millisecond)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return Nil, nil
+	case <-ec.Context().Done():
+		return nil, checkHalted(ec, ec.CallPos())
+	}
+}
+
+// asTime returns the value as a time, or an error naming the builtin if it
+// isn't one.
+func asTime(fnName string, v Value) (*TimeValue, error) {
+	asTime, isTime := v.(*TimeValue)
+	if !isTime {
+		return nil, fmt.Errorf("%s expects a time; got %s", fnName, TypeName(v))
+	}
+	return asTime, nil
+}
@@ -0,0 +1,74 @@
+package golisp2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_timeFns(t *testing.T) {
+
+	t.Run("now", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		frozen := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+		ec.SetDeterministic(1, frozen)
+		v := evalStrInContext(t, ec, `(now)`)
+		require.Equal(t, "<time 2020-05-01T12:30:00Z>", v.InspectStr())
+		assertBoolValue(t, evalStrInContext(t, ec, `(isTime (now))`), true)
+		assertStringValue(t,
+			evalStrInContext(t, ec, `(timeFormat (now) "2006-01-02 15:04")`),
+			"2020-05-01 12:30")
+	})
+
+	t.Run("parseAndFormat", func(t *testing.T) {
+		assertStringValue(t, evalStrToVal(t,
+			`(timeFormat (timeParse "2006-01-02" "2021-03-04") "Jan 2, 2006")`),
+			"Mar 4, 2021")
+		evalStrToErr(t, `(timeParse "2006-01-02" "not a date")`)
+		evalStrToErr(t, `(timeFormat "2021-03-04" "2006")`)
+	})
+
+	t.Run("addAndDiff", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(let start (timeParse "15:04" "10:00"))`)
+		assertStringValue(t, evalStrInContext(t, ec,
+			`(timeFormat (timeAdd start "1h30m") "15:04")`), "11:30")
+		assertNumValue(t, evalStrInContext(t, ec,
+			`(timeDiff (timeAdd start "2s") start)`), 2000)
+		assertNumValue(t, evalStrInContext(t, ec,
+			`(timeDiff start (timeAdd start "1m"))`), -60000)
+		assertBoolValue(t, evalStrInContext(t, ec,
+			`(isTime (timeAdd start "-1h"))`), true)
+		evalStrInContextToErr(t, ec, `(timeAdd start "soon")`)
+		evalStrInContextToErr(t, ec, `(timeDiff start 1)`)
+	})
+
+	t.Run("sleep", func(t *testing.T) {
+		assertNilValue(t, evalStrToVal(t, `(sleep 1)`))
+		evalStrToErr(t, `(sleep -1)`)
+
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetContext(cancelled)
+		err := evalStrInContextToErr(t, ec, `(sleep 60000)`)
+		require.Contains(t, err.Error(), "evaluation halted")
+	})
+
+	t.Run("values", func(t *testing.T) {
+		a := &TimeValue{Val: time.Unix(10, 0)}
+		b := &TimeValue{Val: time.Unix(10, 0).UTC()}
+		require.True(t, valuesEqual(a, b))
+		require.Equal(t, -1, compareSortValues(a, &TimeValue{Val: time.Unix(11, 0)}))
+
+		data, err := MarshalValueJSON(&TimeValue{Val: time.Unix(0, 0).UTC()})
+		require.NoError(t, err)
+		require.Equal(t, `"1970-01-01T00:00:00Z"`, string(data))
+
+		v, err := ValueFromGo(time.Unix(0, 0))
+		require.NoError(t, err)
+		require.IsType(t, (*TimeValue)(nil), v)
+	})
+}
@@ -0,0 +1,69 @@
+package golisp2
+
+import (
+	"sync"
+)
+
+type (
+	// Bus passes messages between scripts. Values published to a topic are
+	// delivered to every handler subscribed to it, in the order they subscribed.
+	// A host can share one bus between the contexts of several scripts so they
+	// can form a pipeline, and can subscribe to it from Go to bridge it to other
+	// processes.
+	//
+	// It is safe for concurrent use. Note handlers are called on the publisher's
+	// goroutine.
+	Bus struct {
+		mu       sync.Mutex
+		handlers map[string][]BusHandler
+	}
+
+	// BusHandler receives a value published to a topic it is subscribed to.
+	BusHandler func(v Value) error
+)
+
+// NewBus creates a bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		handlers: map[string][]BusHandler{},
+	}
+}
+
+// Subscribe adds a handler for the values published to the topic.
+func (b *Bus) Subscribe(topic string, h BusHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], h)
+}
+
+// Publish delivers the value to each handler subscribed to the topic, and
+// returns how many there were. Stops at the first handler that fails, and
+// returns its error.
+func (b *Bus) Publish(topic string, v Value) (int, error) {
+	b.mu.Lock()
+	// handlers are copied so they can publish or subscribe
+	// themselves without deadlocking.
+	handlers := append([]BusHandler{}, b.handlers[topic]...)
+	b.mu.Unlock()
+	for _, h := range handlers {
+		if err := h(v); err != nil {
+			return 0, err
+		}
+	}
+	return len(handlers), nil
+}
+
+// SetBus sets the bus busPublish and busSubscribe use. A nil bus gives the
+// context a new one of its own. This applies to all parent and sub contexts.
+func (ec *EvalContext) SetBus(b *Bus) {
+	if b == nil {
+		b = NewBus()
+	}
+	ec.environ().bus = b
+}
+
+// Bus returns the bus scripts in the context publish and subscribe to. Unless
+// one has been set, it's private to the context.
+func (ec *EvalContext) Bus() *Bus {
+	return ec.environ().bus
+}
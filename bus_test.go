@@ -0,0 +1,75 @@
+package golisp2
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus(t *testing.T) {
+
+	t.Run("publish", func(t *testing.T) {
+		b := NewBus()
+		got := []string{}
+		b.Subscribe("t", func(v Value) error {
+			got = append(got, "a:"+v.InspectStr())
+			return nil
+		})
+		b.Subscribe("t", func(v Value) error {
+			got = append(got, "b:"+v.InspectStr())
+			return nil
+		})
+		b.Subscribe("other", func(v Value) error {
+			got = append(got, "other")
+			return nil
+		})
+
+		n, err := b.Publish("t", &NumberValue{Val: 1})
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+		require.Equal(t, []string{"a:1", "b:1"}, got)
+
+		n, err = b.Publish("none", &NilValue{})
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("handlerError", func(t *testing.T) {
+		b := NewBus()
+		b.Subscribe("t", func(v Value) error { return errors.New("bad") })
+		_, err := b.Publish("t", &NilValue{})
+		require.EqualError(t, err, "bad")
+	})
+
+	t.Run("builtins", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		v := evalStrInContext(t, ec, `
+			(let seen nil)
+			(busSubscribe "nums" (fn (v) (set! seen (cons v seen))))
+			(busSubscribe "nums" (fn (v) (busPublish "doubled" (* v 2))))
+			(busPublish "nums" 1)
+			(busPublish "nums" 2)`)
+		assertNumValue(t, v, 2)
+		seen, _ := ec.Resolve("seen")
+		require.Equal(t, "(2 1)", seen.InspectStr())
+	})
+
+	t.Run("sharedBetweenScripts", func(t *testing.T) {
+		b := NewBus()
+		consumer := BuiltinContext().SubContext(nil)
+		consumer.SetBus(b)
+		producer := BuiltinContext().SubContext(nil)
+		producer.SetBus(b)
+
+		evalStrInContext(t, consumer, `
+			(let total 0)
+			(busSubscribe "nums" (fn (v) (set! total (+ total v))))`)
+		evalStrInContext(t, producer, `(busPublish "nums" 3) (busPublish "nums" 4)`)
+		total, _ := consumer.Resolve("total")
+		assertNumValue(t, total, 7)
+
+		err := evalStrInContextToErr(t, producer, `(busPublish "nums" "x")`)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,68 @@
+package golisp2
+
+import "sort"
+
+// The capabilities a script can require. They're named as the permissions a
+// script's manifest requests.
+const (
+	// FileCapability is reading and writing files.
+	FileCapability = "file"
+
+	// NetCapability is making and serving HTTP requests.
+	NetCapability = "net"
+
+	// ExecCapability is running other processes.
+	ExecCapability = "exec"
+
+	// EnvCapability is reading environment variables.
+	EnvCapability = "env"
+)
+
+// builtinCapabilities maps each permission-gated builtin to the capability it
+// requires.
+var builtinCapabilities = map[string]string{
+	"readFile": FileCapability, "writeFile": FileCapability,
+	"plotLine": FileCapability, "plotBar": FileCapability,
+
+	"httpGet": NetCapability, "httpPost": NetCapability,
+	"httpServe": NetCapability,
+
+	"exec": ExecCapability, "execPipe": ExecCapability,
+
+	"getEnv": EnvCapability,
+}
+
+// RequiredCapabilities returns the capabilities the program may use, sorted by
+// name, without evaluating it: FileCapability, NetCapability, ExecCapability
+// and EnvCapability. Hosts can use it to ask for approval before running a
+// script they don't trust.
+//
+// A capability is required if any builtin that needs it is referenced, whether
+// or not it's called, and whether or not the code that references it can be
+// reached. Identifiers that shadow a builtin are still counted; the result may
+// include more than the script uses, but never less.
+func RequiredCapabilities(exprs []Expr) []string {
+	required := map[string]bool{}
+	require := func(name string) {
+		if c, isGated := builtinCapabilities[name]; isGated {
+			required[c] = true
+		}
+	}
+	for _, e := range exprs {
+		Walk(e, func(e Expr) bool {
+			switch tE := e.(type) {
+			case *IdentLiteral:
+				require(tE.Val)
+			case *FuncLiteral:
+				require(tE.Name)
+			}
+			return true
+		})
+	}
+	caps := make([]string, 0, len(required))
+	for c := range required {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	return caps
+}
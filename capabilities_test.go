@@ -0,0 +1,32 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RequiredCapabilities(t *testing.T) {
+
+	capsOf := func(t *testing.T, src string) []string {
+		t.Helper()
+		exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(src))))
+		require.NoError(t, err)
+		return RequiredCapabilities(exprs)
+	}
+
+	require.Empty(t, capsOf(t, `(defun f (n) (+ n 1)) (print (f 1))`))
+	require.Equal(t, []string{"file"}, capsOf(t, `(print (readFile "a.txt"))`))
+	require.Equal(t, []string{"env", "exec", "file", "net"}, capsOf(t, `
+		(defun deploy (host)
+			(when (getEnv "DEPLOY")
+				(let ((res (exec "scp" "a.txt" host)))
+					(httpPost host "text/plain" (readFile "log.txt")))))`))
+
+	t.Run("referenced", func(t *testing.T) {
+		// passing a builtin along is as good as calling it.
+		require.Equal(t, []string{"file"}, capsOf(t, `(listMap (list "a") readFile)`))
+		require.Equal(t, []string{"net"}, capsOf(t, `(if false (go (httpGet "x")))`))
+	})
+}
@@ -0,0 +1,434 @@
+package golisp2
+
+import (
+	"fmt"
+	"sort"
+)
+
+type (
+	// checker walks a program looking for likely mistakes, without evaluating
+	// it.
+	checker struct {
+		diags []Diagnostic
+
+		// pureFn is the innermost function declared :pure that's being checked, if
+		// any.
+		pureFn *FnExpr
+	}
+
+	// checkScope is the set of identifiers visible at a point in the program.
+	checkScope struct {
+		parent   *checkScope
+		bindings map[string]*checkBinding
+	}
+
+	// checkBinding is a single identifier defined in a scope.
+	checkBinding struct {
+		ident *IdentLiteral
+		used  bool
+
+		// reportUnused indicates a warning should be raised if the binding is
+		// never referenced.
+		reportUnused bool
+
+		// arity is the number of arguments the binding takes, if it's known to be
+		// a function.
+		arity *checkArity
+
+		// impure is set for builtins that have side effects.
+		impure bool
+	}
+
+	// checkArity is the number of arguments a function accepts. max is -1 if
+	// there's no upper limit.
+	checkArity struct {
+		min, max int
+	}
+)
+
+// Check looks for likely mistakes in the parsed program, without evaluating
+// it: references to undefined identifiers, calls with the wrong number of
+// arguments, if/cond branches that can never be reached, let bindings that are
+// never used, and :pure functions that use impure builtins. Returns a warning diagnostic for each one found.
+//
+// Identifiers are resolved against the builtins, and the top-level definitions
+// of the program. Top-level definitions are never reported as unused, as they
+// may be used elsewhere.
+func Check(exprs []Expr) []Diagnostic {
+	globals := newCheckScope(nil)
+	for name, fn := range builtinFns {
+		globals.define(name, nil, builtinArity(name), false)
+		globals.bindings[name].impure = !fn.Pure
+	}
+	for _, e := range exprs {
+		switch tE := e.(type) {
+		case *LetExpr:
+			globals.define(tE.Ident.Val, tE.Ident, fnArity(tE.Value), false)
+		case *DefStructExpr:
+			defineStruct(globals, tE)
+		case *DefGenericExpr:
+			globals.define(tE.Name.Val, tE.Name, genericArity(tE), false)
+		}
+	}
+
+	c := &checker{}
+	c.exprs(exprs, globals)
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.diags[i].Pos.Offset < c.diags[j].Pos.Offset
+	})
+	return c.diags
+}
+
+func (c *checker) exprs(exprs []Expr, s *checkScope) {
+	for _, e := range exprs {
+		c.expr(e, s)
+	}
+}
+
+// body checks expressions in a new scope, and reports anything left unused in
+// it once done.
+func (c *checker) body(exprs []Expr, s *checkScope) {
+	c.exprs(exprs, s)
+	c.closeScope(s)
+}
+
+func (c *checker) expr(e Expr, s *checkScope) {
+	switch tE := e.(type) {
+	case *IdentLiteral:
+		if b, found := s.resolve(tE.Val); !found {
+			c.warn(tE.Pos, "undefined identifier '%s'%s", tE.Val, s.suggest(tE.Val))
+		} else {
+			c.checkPure(tE, b)
+		}
+
+	case *CallExpr:
+		c.call(tE, s)
+
+	case *IfExpr:
+		c.expr(tE.Cond, s)
+		if truth, isConst := constTruth(tE.Cond); isConst {
+			if truth && tE.Case2 != nil {
+				c.warn(tE.Case2.SourcePos(), "unreachable else branch; condition is always true")
+			} else if !truth {
+				c.warn(tE.Case1.SourcePos(), "unreachable then branch; condition is always false")
+			}
+		}
+		c.expr(tE.Case1, s)
+		if tE.Case2 != nil {
+			c.expr(tE.Case2, s)
+		}
+
+	case *CondExpr:
+		alwaysMatched := false
+		for _, clause := range tE.Clauses {
+			if alwaysMatched {
+				pos := tE.Pos
+				if clause.Test != nil {
+					pos = clause.Test.SourcePos()
+				} else if len(clause.Body) > 0 {
+					pos = clause.Body[0].SourcePos()
+				}
+				c.warn(pos, "unreachable cond clause; an earlier clause always matches")
+				alwaysMatched = false
+			}
+			if clause.Test == nil {
+				alwaysMatched = true
+			} else {
+				c.expr(clause.Test, s)
+				if truth, isConst := constTruth(clause.Test); isConst && truth {
+					alwaysMatched = true
+				}
+			}
+			c.body(clause.Body, newCheckScope(s))
+		}
+
+	case *WhenExpr:
+		c.expr(tE.Cond, s)
+		c.body(tE.Body, newCheckScope(s))
+
+	case *WhileExpr:
+		c.expr(tE.Cond, s)
+		c.body(tE.Body, newCheckScope(s))
+
+	case *ForExpr:
+		c.expr(tE.Binding.Value, s)
+		inner := newCheckScope(s)
+		inner.define(tE.Binding.Ident.Val, tE.Binding.Ident, nil, false)
+		c.body(tE.Body, inner)
+
+	case *DoTimesExpr:
+		c.expr(tE.Binding.Value, s)
+		inner := newCheckScope(s)
+		inner.define(tE.Binding.Ident.Val, tE.Binding.Ident, nil, false)
+		c.body(tE.Body, inner)
+
+	case *FnExpr:
+		inner := newCheckScope(s)
+		if tE.Name != "" {
+			inner.define(tE.Name, nil, fnArity(tE), false)
+		}
+		for _, a := range tE.Args {
+			inner.define(a.Ident, nil, nil, false)
+		}
+		if tE.Rest != nil {
+			inner.define(tE.Rest.Ident, nil, nil, false)
+		}
+		if tE.Pure {
+			outerPureFn := c.pureFn
+			c.pureFn = tE
+			defer func() {
+				c.pureFn = outerPureFn
+			}()
+		}
+		c.body(tE.Body, inner)
+
+	case *LetExpr:
+		c.expr(tE.Value, s)
+		// top-level definitions are already known; they can be used by anything.
+		if s.parent != nil {
+			s.define(tE.Ident.Val, tE.Ident, fnArity(tE.Value), true)
+		}
+
+	case *BlockLetExpr:
+		inner := newCheckScope(s)
+		for _, b := range tE.Bindings {
+			if tE.Sequential {
+				c.expr(b.Value, inner)
+			} else {
+				c.expr(b.Value, s)
+			}
+			inner.define(b.Ident.Val, b.Ident, fnArity(b.Value), true)
+		}
+		c.body(tE.Body, inner)
+
+	case *LetValuesExpr:
+		c.expr(tE.Value, s)
+		inner := newCheckScope(s)
+		for _, ident := range tE.Idents {
+			inner.define(ident.Val, ident, nil, true)
+		}
+		c.body(tE.Body, inner)
+
+	case *SetExpr:
+		c.expr(tE.Value, s)
+		if _, found := s.lookup(tE.Ident.Val); !found {
+			c.warn(tE.Ident.Pos, "set! of undefined identifier '%s'%s",
+				tE.Ident.Val, s.suggest(tE.Ident.Val))
+		}
+
+	case *DefStructExpr:
+		if s.parent != nil {
+			defineStruct(s, tE)
+		}
+
+	case *TimeExpr:
+		c.expr(tE.Expr, s)
+
+	case *DefTestExpr:
+		c.body(tE.Body, newCheckScope(s))
+
+	case *AssertErrorExpr:
+		c.expr(tE.Expr, s)
+
+	case *GoExpr:
+		c.expr(tE.Expr, s)
+
+	case *ReturnExpr:
+		if tE.Expr != nil {
+			c.expr(tE.Expr, s)
+		}
+
+	case *MethodCallExpr:
+		c.expr(tE.Object, s)
+		c.exprs(tE.Args, s)
+
+	case *DefGenericExpr:
+		if s.parent != nil {
+			s.define(tE.Name.Val, tE.Name, genericArity(tE), true)
+		}
+
+	case *DefMethodExpr:
+		if _, found := s.resolve(tE.Name.Val); !found {
+			c.warn(tE.Name.Pos, "defmethod of undefined generic '%s'%s",
+				tE.Name.Val, s.suggest(tE.Name.Val))
+		}
+		c.expr(tE.Fn, s)
+	}
+}
+
+// call checks a function call: that the function is defined, and that it's
+// passed a number of arguments it accepts.
+func (c *checker) call(ce *CallExpr, s *checkScope) {
+	if len(ce.Exprs) == 0 {
+		return
+	}
+	args := ce.Exprs[1:]
+	if ident, isIdent := ce.Exprs[0].(*IdentLiteral); isIdent {
+		b, found := s.resolve(ident.Val)
+		if !found {
+			c.warn(ident.Pos, "undefined function '%s'%s", ident.Val, s.suggest(ident.Val))
+		} else {
+			if b.arity != nil && !b.arity.accepts(len(args)) {
+				c.warn(ce.Pos, "'%s' expects %s; got %d", ident.Val, b.arity, len(args))
+			}
+			c.checkPure(ident, b)
+		}
+	} else {
+		c.expr(ce.Exprs[0], s)
+	}
+	c.exprs(args, s)
+}
+
+// checkPure reports a use of an impure builtin within a :pure function.
+func (c *checker) checkPure(ident *IdentLiteral, b *checkBinding) {
+	if c.pureFn == nil || !b.impure {
+		return
+	}
+	fnDesc := "pure function"
+	if c.pureFn.Name != "" {
+		fnDesc = fmt.Sprintf("pure function '%s'", c.pureFn.Name)
+	}
+	c.warn(ident.Pos, "%s uses impure builtin '%s'", fnDesc, ident.Val)
+}
+
+// closeScope reports any bindings in the scope that were never used.
+func (c *checker) closeScope(s *checkScope) {
+	for name, b := range s.bindings {
+		if b.reportUnused && !b.used {
+			c.warn(b.ident.Pos, "'%s' is bound but never used", name)
+		}
+	}
+}
+
+func (c *checker) warn(pos ScannerPosition, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{
+		Severity: WarningSeverity,
+		Msg:      fmt.Sprintf(format, args...),
+		Pos:      pos,
+	})
+}
+
+func newCheckScope(parent *checkScope) *checkScope {
+	return &checkScope{
+		parent:   parent,
+		bindings: map[string]*checkBinding{},
+	}
+}
+
+// define adds the identifier to the scope, replacing any previous binding of
+// the same name.
+func (s *checkScope) define(
+	name string, ident *IdentLiteral, arity *checkArity, reportUnused bool,
+) {
+	s.bindings[name] = &checkBinding{
+		ident:        ident,
+		arity:        arity,
+		reportUnused: reportUnused && ident != nil,
+	}
+}
+
+// lookup finds the binding of the identifier in the scope or its parents.
+func (s *checkScope) lookup(name string) (*checkBinding, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if b, ok := sc.bindings[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// resolve finds the binding of the identifier, and marks it as used.
+func (s *checkScope) resolve(name string) (*checkBinding, bool) {
+	b, found := s.lookup(name)
+	if found {
+		b.used = true
+	}
+	return b, found
+}
+
+// suggest returns a "did you mean" suffix for an undefined identifier, if a
+// similar one is defined. Otherwise returns an empty string.
+func (s *checkScope) suggest(name string) string {
+	best, bestDist := "", 3
+	for sc := s; sc != nil; sc = sc.parent {
+		for candidate := range sc.bindings {
+			d := editDistance(name, candidate)
+			if d >= len(name) {
+				continue
+			}
+			if d < bestDist || (d == bestDist && candidate < best) {
+				best, bestDist = candidate, d
+			}
+		}
+	}
+	if bestDist > 2 {
+		return ""
+	}
+	return "; " + formatMessage(DidYouMeanMsg, struct {
+		Suggestion string
+	}{best})
+}
+
+// accepts indicates if a call with n arguments is allowed.
+func (a *checkArity) accepts(n int) bool {
+	return n >= a.min && (a.max < 0 || n <= a.max)
+}
+
+// String describes the arity; e.g. "1 to 2 arguments".
+func (a *checkArity) String() string {
+	return describeArity(a.min, a.max)
+}
+
+// builtinArity returns the arity of the named builtin, if it's known.
+func builtinArity(name string) *checkArity {
+	fn := builtinFns[name]
+	if fn == nil || fn.Params == nil {
+		return nil
+	}
+	return &checkArity{min: fn.MinArgs, max: fn.MaxArgs}
+}
+
+// fnArity returns the arity of the expression if it's a function definition;
+// otherwise nil.
+func fnArity(e Expr) *checkArity {
+	fe, isFn := e.(*FnExpr)
+	if !isFn {
+		return nil
+	}
+	a := &checkArity{max: len(fe.Args)}
+	for _, arg := range fe.Args {
+		if arg.Keyword != "" {
+			// keyword arguments are optional, and come in pairs.
+			a.max = -1
+			break
+		}
+		a.min++
+	}
+	if fe.Rest != nil {
+		a.max = -1
+	}
+	return a
+}
+
+// defineStruct adds the functions declared by the struct to the scope.
+func defineStruct(s *checkScope, dse *DefStructExpr) {
+	name := dse.Name.Val
+	s.define(name, nil, &checkArity{len(dse.Fields), len(dse.Fields)}, false)
+	s.define(name+"?", nil, &checkArity{1, 1}, false)
+	for _, f := range dse.Fields {
+		s.define(name+"-"+f.Val, nil, &checkArity{1, 1}, false)
+	}
+}
+
+// genericArity returns the number of arguments the generic function takes.
+func genericArity(dge *DefGenericExpr) *checkArity {
+	return &checkArity{len(dge.Params), len(dge.Params)}
+}
+
+// constTruth returns the value of the condition if it's a constant.
+func constTruth(cond Expr) (truth, isConst bool) {
+	if asBool, isBool := cond.(*BoolLiteral); isBool {
+		return asBool.Bool, true
+	}
+	return false, false
+}
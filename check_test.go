@@ -0,0 +1,90 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Check(t *testing.T) {
+	// check parses the source, and returns the messages of the diagnostics
+	// found.
+	check := func(t *testing.T, src string) []string {
+		exprs, err := ParseTokens(NewTokenScanner(
+			NewRuneScanner("check.l", strings.NewReader(src))))
+		require.NoError(t, err)
+		msgs := []string{}
+		for _, d := range Check(exprs) {
+			require.Equal(t, WarningSeverity, d.Severity)
+			msgs = append(msgs, d.Msg)
+		}
+		return msgs
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		require.Empty(t, check(t, `
+			(defun fact (n) (if (<= n 1) 1 (* n (fact (- n 1)))))
+			(defun useLater () (later 1))
+			(let later (fn (a . rest) (list a rest)))
+			(defstruct point x y)
+			(point-x (point 1 2))
+			(let ((a 1) (b 2)) (+ a b))
+			(for (v (list 1 2)) (print v))
+			(fn (a :opts o) (list a o))`))
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		require.Equal(t, []string{
+			"undefined function 'listMpa'; did you mean 'listMap'?",
+			"undefined identifier 'x'",
+			"set! of undefined identifier 'y'",
+		}, check(t, `(listMpa (list x) (fn (v) v)) (set! y 1)`))
+	})
+
+	t.Run("arity", func(t *testing.T) {
+		require.Equal(t, []string{
+			"'car' expects 1 argument; got 2",
+			"'f' expects 2 arguments; got 1",
+			"'point' expects 2 arguments; got 0",
+		}, check(t, `
+			(car (list 1) 2)
+			(defun f (a b) a)
+			(f 1)
+			(defstruct point x y)
+			(point)`))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		require.Equal(t, []string{
+			"unreachable else branch; condition is always true",
+			"unreachable then branch; condition is always false",
+			"unreachable cond clause; an earlier clause always matches",
+		}, check(t, `
+			(if true 1 2)
+			(if false 1 2)
+			(cond (true 1) (else 2))`))
+	})
+
+	t.Run("unused", func(t *testing.T) {
+		require.Equal(t, []string{
+			"'b' is bound but never used",
+			"'c' is bound but never used",
+		}, check(t, `
+			(let ((a 1) (b 2)) a)
+			(defun f () (let c 1) 2)`))
+	})
+
+	t.Run("pure", func(t *testing.T) {
+		require.Equal(t, []string{
+			"pure function 'f' uses impure builtin 'print'",
+			"pure function 'g' uses impure builtin 'random'",
+			"pure function uses impure builtin 'print'",
+		}, check(t, `
+			(defun f :pure (a) (print a) (+ a 1))
+			(defun g :pure (a) (listMap (list a) (fn (v) (+ v (random)))))
+			(fn :pure (xs) (listMap xs print))
+			(defun h :pure (print) (print 1))
+			(defun i (a) (print a))`))
+	})
+}
@@ -0,0 +1,238 @@
+package golisp2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Checkpoint is the progress of a program's evaluation, taken between two of
+// its top-level expressions: how many have been evaluated, and the values they
+// defined. A long running program can be resumed from its last checkpoint,
+// rather than started again.
+//
+// Values are saved as JSON (see MarshalValueJSON). Those JSON can't represent
+// exactly, such as keywords, times and tables, can't be checkpointed. Functions
+// and struct types aren't saved; they're defined again on restore by
+// re-evaluating the top-level defun, fn let, defstruct, defgeneric and
+// defmethod expressions that were evaluated before the checkpoint. Any other
+// function, such as a closure one of them returned or one a definition's name
+// was later set to, can't be checkpointed. Struct instances are saved by their
+// fields, and restored with their type's constructor.
+type Checkpoint struct {
+	// Program identifies the program the checkpoint was taken of. A checkpoint
+	// can only be restored into the same program.
+	Program string `json:"program"`
+
+	// Next is the index of the next top-level expression to evaluate.
+	Next int `json:"next"`
+
+	// Bindings are the values defined in the context, by name.
+	Bindings map[string]json.RawMessage `json:"bindings"`
+
+	// Structs are the struct instances defined in the context, by name.
+	Structs map[string]checkpointStruct `json:"structs,omitempty"`
+}
+
+// checkpointStruct is a saved struct instance: the name of its type, and the
+// value of each of its fields in order.
+type checkpointStruct struct {
+	Type   string            `json:"type"`
+	Fields []json.RawMessage `json:"fields"`
+}
+
+// NewCheckpoint captures the values defined directly in the context, after
+// the first next expressions of the program have been evaluated. Returns an
+// error if any value can't be saved, or is a function that restoring won't
+// define again.
+func NewCheckpoint(p *Program, ec *EvalContext, next int) (*Checkpoint, error) {
+	if next < 0 || next > len(p.Exprs) {
+		return nil, fmt.Errorf(
+			"cannot checkpoint at expression %d; the program has %d", next, len(p.Exprs))
+	}
+	cp := &Checkpoint{
+		Program:  p.fingerprint(),
+		Next:     next,
+		Bindings: map[string]json.RawMessage{},
+		Structs:  map[string]checkpointStruct{},
+	}
+	defs := definitions(p.Exprs[:next])
+	vals := ec.Bindings()
+	names := make([]string, 0, len(vals))
+	for name := range vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch tV := vals[name].(type) {
+		case *FuncValue:
+			if tV.def == nil || defs[name] != tV.def {
+				return nil, fmt.Errorf(
+					"cannot checkpoint '%s': only the functions top-level "+
+						"definitions created can be restored", name)
+			}
+			continue
+		case *StructValue:
+			if _, isStruct := defs[tV.Type.Name].(*DefStructExpr); !isStruct {
+				return nil, fmt.Errorf(
+					"cannot checkpoint '%s': struct '%s' isn't defined by a top-level "+
+						"defstruct", name, tV.Type.Name)
+			}
+			saved := checkpointStruct{Type: tV.Type.Name}
+			for i, field := range tV.Vals {
+				data, err := checkpointValue(field)
+				if err != nil {
+					return nil, fmt.Errorf("cannot checkpoint '%s' field '%s': %w",
+						name, tV.Type.Fields[i], err)
+				}
+				saved.Fields = append(saved.Fields, data)
+			}
+			cp.Structs[name] = saved
+			continue
+		}
+		data, err := checkpointValue(vals[name])
+		if err != nil {
+			return nil, fmt.Errorf("cannot checkpoint '%s': %w", name, err)
+		}
+		cp.Bindings[name] = data
+	}
+	return cp, nil
+}
+
+// checkpointValue encodes the value as JSON, if it will be restored exactly.
+func checkpointValue(v Value) ([]byte, error) {
+	data, err := MarshalValueJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := UnmarshalValueJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if !valuesEqual(v, restored) {
+		return nil, fmt.Errorf(
+			"%s would be restored as %s", TypeName(v), TypeName(restored))
+	}
+	return data, nil
+}
+
+// LoadCheckpoint reads a checkpoint previously written with Save.
+func LoadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	if err := json.NewDecoder(r).Decode(cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint as JSON.
+func (cp *Checkpoint) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(cp)
+}
+
+// Restore defines the program's functions and structs from before the
+// checkpoint in the context, followed by the checkpoint's values. Evaluation
+// can then carry on from the expression at index Next. Returns an error if the
+// checkpoint was taken of a different program.
+func (cp *Checkpoint) Restore(p *Program, ec *EvalContext) error {
+	if cp.Program != p.fingerprint() {
+		return fmt.Errorf("checkpoint was taken of a different program")
+	}
+	if cp.Next < 0 || cp.Next > len(p.Exprs) {
+		return fmt.Errorf(
+			"checkpoint resumes at expression %d; the program has %d", cp.Next, len(p.Exprs))
+	}
+	for _, e := range p.Exprs[:cp.Next] {
+		if !isDefinition(e) {
+			continue
+		}
+		if _, err := e.Eval(ec); err != nil {
+			return fmt.Errorf("cannot restore checkpoint: %w", err)
+		}
+	}
+	for name, data := range cp.Bindings {
+		v, err := UnmarshalValueJSON(data)
+		if err != nil {
+			return fmt.Errorf("cannot restore '%s' from checkpoint: %w", name, err)
+		}
+		ec.Add(name, v)
+	}
+	for name, saved := range cp.Structs {
+		v, err := saved.restore(ec)
+		if err != nil {
+			return fmt.Errorf("cannot restore '%s' from checkpoint: %w", name, err)
+		}
+		ec.Add(name, v)
+	}
+	return nil
+}
+
+// restore creates the struct instance with the constructor of its type, which
+// must already be defined in the context.
+func (cs checkpointStruct) restore(ec *EvalContext) (Value, error) {
+	v, _ := ec.Resolve(cs.Type)
+	constructor, isFn := v.(*FuncValue)
+	if !isFn {
+		return nil, fmt.Errorf("struct '%s' isn't defined", cs.Type)
+	}
+	fields := make([]Value, len(cs.Fields))
+	for i, data := range cs.Fields {
+		field, err := UnmarshalValueJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = field
+	}
+	return constructor.Fn(ec, fields...)
+}
+
+// isDefinition indicates if the expression defines a function or struct, and
+// has no other effect.
+func isDefinition(e Expr) bool {
+	switch tE := e.(type) {
+	case *LetExpr:
+		_, isFn := tE.Value.(*FnExpr)
+		return isFn
+	case *DefStructExpr, *DefGenericExpr, *DefMethodExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+// definitions returns the names the definitions among the expressions bind;
+// the functions that restoring a checkpoint defines again. Each is mapped to
+// the expression that creates its function, which is its def.
+func definitions(exprs []Expr) map[string]Expr {
+	defs := map[string]Expr{}
+	for _, e := range exprs {
+		switch tE := e.(type) {
+		case *LetExpr:
+			if fe, isFn := tE.Value.(*FnExpr); isFn {
+				defs[tE.Ident.Val] = fe
+			}
+		case *DefStructExpr:
+			defs[tE.Name.Val] = tE
+			defs[tE.Name.Val+"?"] = tE
+			for _, f := range tE.Fields {
+				defs[fmt.Sprintf("%s-%s", tE.Name.Val, f.Val)] = tE
+			}
+		case *DefGenericExpr:
+			defs[tE.Name.Val] = tE
+		}
+	}
+	return defs
+}
+
+// fingerprint identifies the program by its code.
+func (p *Program) fingerprint() string {
+	h := sha256.New()
+	for _, e := range p.Exprs {
+		io.WriteString(h, e.CodeStr())
+		io.WriteString(h, "\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
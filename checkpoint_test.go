@@ -0,0 +1,164 @@
+package golisp2
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Checkpoint(t *testing.T) {
+	parse := func(t *testing.T, src string) *Program {
+		t.Helper()
+		prog, err := ParseProgram(NewTokenScanner(
+			NewRuneScanner("testfile", strings.NewReader(src))))
+		require.NoError(t, err)
+		return prog
+	}
+
+	src := `
+		(defun double (n) (* n 2))
+		(let total 1)
+		(set! total (double total))
+		(print "once")
+		(set! total (double total))
+		(let names (list "a" "b"))`
+
+	t.Run("resume", func(t *testing.T) {
+		prog := parse(t, src)
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetStdout(&bytes.Buffer{})
+		for _, e := range prog.Exprs[:4] {
+			mustEval(t, e, ec)
+		}
+		cp, err := NewCheckpoint(prog, ec, 4)
+		require.NoError(t, err)
+		var saved bytes.Buffer
+		require.NoError(t, cp.Save(&saved))
+
+		loaded, err := LoadCheckpoint(&saved)
+		require.NoError(t, err)
+		require.Equal(t, 4, loaded.Next)
+		var out bytes.Buffer
+		resumed := BuiltinContext().SubContext(nil)
+		resumed.SetStdout(&out)
+		require.NoError(t, loaded.Restore(prog, resumed))
+		for _, e := range prog.Exprs[loaded.Next:] {
+			mustEval(t, e, resumed)
+		}
+		// nothing before the checkpoint is run again, other than definitions.
+		require.Empty(t, out.String())
+		total, _ := resumed.Resolve("total")
+		assertNumValue(t, total, 4)
+		names, _ := resumed.Resolve("names")
+		assertListValue(t, names, []Value{
+			&StringValue{Val: "a"}, &StringValue{Val: "b"}})
+	})
+
+	t.Run("otherProgram", func(t *testing.T) {
+		prog := parse(t, src)
+		cp, err := NewCheckpoint(prog, BuiltinContext().SubContext(nil), 0)
+		require.NoError(t, err)
+		other := parse(t, src+"\n(print total)")
+		require.Error(t, cp.Restore(other, BuiltinContext().SubContext(nil)))
+	})
+
+	t.Run("closure", func(t *testing.T) {
+		// a function that isn't defined by a top-level definition wouldn't be
+		// restored, so can't be checkpointed.
+		prog := parse(t, `
+			(defun mk () (fn () 1))
+			(let c (mk))`)
+		ec := BuiltinContext().SubContext(nil)
+		for _, e := range prog.Exprs {
+			mustEval(t, e, ec)
+		}
+		_, err := NewCheckpoint(prog, ec, 2)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'c'")
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		prog := parse(t, `
+			(defstruct point x y)
+			(let p (point 1 (list 2 3)))
+			(print "once")
+			(point-x p)`)
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetStdout(&bytes.Buffer{})
+		for _, e := range prog.Exprs[:3] {
+			mustEval(t, e, ec)
+		}
+		cp, err := NewCheckpoint(prog, ec, 3)
+		require.NoError(t, err)
+		var saved bytes.Buffer
+		require.NoError(t, cp.Save(&saved))
+
+		loaded, err := LoadCheckpoint(&saved)
+		require.NoError(t, err)
+		resumed := BuiltinContext().SubContext(nil)
+		require.NoError(t, loaded.Restore(prog, resumed))
+		assertNumValue(t, mustEval(t, prog.Exprs[3], resumed), 1)
+		assertBoolValue(t, evalStrInContext(t, resumed, `(point? p)`), true)
+		assertListValue(t, evalStrInContext(t, resumed, `(point-y p)`), []Value{
+			NewNumberValue(2), NewNumberValue(3)})
+	})
+
+	t.Run("nestedStruct", func(t *testing.T) {
+		prog := parse(t, `
+			(defstruct point x y)
+			(let ps (list (point 1 2)))`)
+		ec := BuiltinContext().SubContext(nil)
+		for _, e := range prog.Exprs {
+			mustEval(t, e, ec)
+		}
+		_, err := NewCheckpoint(prog, ec, 2)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'ps'")
+	})
+
+	t.Run("reboundFunc", func(t *testing.T) {
+		// restoring would define the original function again, not the one it was
+		// set to.
+		prog := parse(t, `
+			(defun f () 1)
+			(defun g () 2)
+			(set! f g)`)
+		ec := BuiltinContext().SubContext(nil)
+		for _, e := range prog.Exprs {
+			mustEval(t, e, ec)
+		}
+		_, err := NewCheckpoint(prog, ec, 3)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'f'")
+	})
+
+	t.Run("lossyValues", func(t *testing.T) {
+		for _, src := range []string{
+			`(let v :a)`,
+			`(let v (list 1 :a))`,
+			`(let v (map "a" (now)))`,
+			`(let v (table (list (map "a" 1))))`,
+			`(defstruct point x y)
+			(let v (point :a 1))`,
+		} {
+			prog := parse(t, src)
+			ec := BuiltinContext().SubContext(nil)
+			for _, e := range prog.Exprs {
+				mustEval(t, e, ec)
+			}
+			_, err := NewCheckpoint(prog, ec, len(prog.Exprs))
+			require.Error(t, err, src)
+			require.Contains(t, err.Error(), "'v'", src)
+		}
+	})
+
+	t.Run("unsaveable", func(t *testing.T) {
+		prog := parse(t, `(let c (chan 1))`)
+		ec := BuiltinContext().SubContext(nil)
+		mustEval(t, prog.Exprs[0], ec)
+		_, err := NewCheckpoint(prog, ec, 1)
+		require.Error(t, err)
+	})
+}
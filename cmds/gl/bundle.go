@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A bundle is a copy of the gl binary with a script appended to it. When run,
+// the binary finds the script at its end and runs it, rather than acting as gl.
+//
+// The script is followed by a trailer:
+//
+//	name | script | name length (uint32) | script length (uint64) | bundleMagic
+//
+// This avoids needing a go toolchain to build scripts. It does rely
+// on the executable being readable by the process running it.
+const bundleMagic = "\x00gl-bundle\x00"
+
+// bundleTrailerLen is the length of the fixed-size part of the trailer.
+const bundleTrailerLen = 4 + 8 + len(bundleMagic)
+
+// bundle is a script embedded in a binary.
+type bundle struct {
+	// name is the file the script was built from, which it is run under.
+	name   string
+	script []byte
+
+	// runtimeLen is the length of the binary before the bundle.
+	runtimeLen int64
+}
+
+// buildBundle writes a copy of the running gl binary with the script in the
+// file embedded in it to out.
+func buildBundle(file, out string) error {
+	script, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Could not read file '%s': %w", file, err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not locate the gl binary: %w", err)
+	}
+	runtime, err := os.Open(exe)
+	if err != nil {
+		return fmt.Errorf("could not read the gl binary: %w", err)
+	}
+	defer runtime.Close()
+
+	// a bundled binary only copies the runtime part of itself.
+	var runtimeSrc io.Reader = runtime
+	if b, hasBundle, err := readBundle(runtime); err != nil {
+		return err
+	} else if hasBundle {
+		runtimeSrc = io.NewSectionReader(runtime, 0, b.runtimeLen)
+	}
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %w", out, err)
+	}
+	if err := writeBundle(f, runtimeSrc, filepath.Base(file), script); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write '%s': %w", out, err)
+	}
+	return f.Close()
+}
+
+// writeBundle writes the runtime followed by the script to w.
+func writeBundle(w io.Writer, runtime io.Reader, name string, script []byte) error {
+	if _, err := io.Copy(w, runtime); err != nil {
+		return err
+	}
+	var trailer bytes.Buffer
+	trailer.WriteString(name)
+	trailer.Write(script)
+	binary.Write(&trailer, binary.LittleEndian, uint32(len(name)))
+	binary.Write(&trailer, binary.LittleEndian, uint64(len(script)))
+	trailer.WriteString(bundleMagic)
+	_, err := w.Write(trailer.Bytes())
+	return err
+}
+
+// readBundle reads the script bundled at the end of the binary, if there is
+// one. Errors reading a bundle whose trailer was found are returned along with
+// true.
+func readBundle(f *os.File) (*bundle, bool, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	size := info.Size()
+	if size < int64(bundleTrailerLen) {
+		return nil, false, nil
+	}
+	trailer := make([]byte, bundleTrailerLen)
+	if _, err := f.ReadAt(trailer, size-int64(bundleTrailerLen)); err != nil {
+		return nil, false, err
+	}
+	if string(trailer[12:]) != bundleMagic {
+		return nil, false, nil
+	}
+	nameLen := int64(binary.LittleEndian.Uint32(trailer[:4]))
+	scriptLen := int64(binary.LittleEndian.Uint64(trailer[4:12]))
+	runtimeLen := size - int64(bundleTrailerLen) - scriptLen - nameLen
+	if nameLen < 0 || scriptLen < 0 || runtimeLen < 0 {
+		return nil, true, errors.New("bundled script is corrupt")
+	}
+	payload := make([]byte, nameLen+scriptLen)
+	if _, err := f.ReadAt(payload, runtimeLen); err != nil {
+		return nil, true, err
+	}
+	return &bundle{
+		name:       string(payload[:nameLen]),
+		script:     payload[nameLen:],
+		runtimeLen: runtimeLen,
+	}, true, nil
+}
+
+// ownBundle returns the script bundled into the running binary, if there is
+// one. Only errors reading a bundle that was found are returned: a binary that
+// can't be read, e.g. as it's execute-only, is run as plain gl.
+func ownBundle() (*bundle, bool, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, false, nil
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer f.Close()
+	b, isBundle, err := readBundle(f)
+	if err != nil && !isBundle {
+		return nil, false, nil
+	}
+	return b, isBundle, err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_bundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	open := func(t *testing.T, contents []byte) *os.File {
+		file := filepath.Join(dir, "bin")
+		require.NoError(t, ioutil.WriteFile(file, contents, 0755))
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		return f
+	}
+
+	t.Run("roundTrip", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeBundle(
+			&out, strings.NewReader("runtime"), "tool.l", []byte(`(print "hi")`)))
+
+		f := open(t, out.Bytes())
+		defer f.Close()
+		b, isBundle, err := readBundle(f)
+		require.NoError(t, err)
+		require.True(t, isBundle)
+		require.Equal(t, "tool.l", b.name)
+		require.Equal(t, `(print "hi")`, string(b.script))
+		require.Equal(t, int64(len("runtime")), b.runtimeLen)
+	})
+
+	t.Run("notBundle", func(t *testing.T) {
+		f := open(t, []byte("just a binary"))
+		defer f.Close()
+		_, isBundle, err := readBundle(f)
+		require.NoError(t, err)
+		require.False(t, isBundle)
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, writeBundle(&out, strings.NewReader(""), "a.l", []byte("1")))
+		f := open(t, out.Bytes()[2:])
+		defer f.Close()
+		_, isBundle, err := readBundle(f)
+		require.Error(t, err)
+		// the trailer was found, so the error is reported rather than ignored.
+		require.True(t, isBundle)
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+// checkFiles parses each file and runs the static checks on it, without
+// executing anything. Every problem found is written to out. Returns false if
+// there were any.
+func checkFiles(out io.Writer, files []string) bool {
+	ok := true
+	for _, file := range files {
+		if !checkFile(out, file) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func checkFile(out io.Writer, file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(out, "Could not read file '%s': %s\n", file, err)
+		return false
+	}
+	defer f.Close()
+
+	// every parse error is reported, and the expressions that did parse are
+	// still checked.
+	exprs, parseErr := golisp2.ParseTokensRecovering(
+		golisp2.NewTokenScanner(golisp2.NewRuneScanner(file, f)))
+	if parseErr != nil {
+		errs := []error{parseErr}
+		if me, isMulti := parseErr.(*golisp2.MultiError); isMulti {
+			errs = me.Errs
+		}
+		for _, err := range errs {
+			fmt.Fprintf(out, "Parse error in '%s': %s\n", file, err)
+		}
+	}
+	diags := golisp2.Check(exprs)
+	for _, d := range diags {
+		fmt.Fprintln(out, d.String())
+	}
+	return parseErr == nil && len(diags) == 0
+}
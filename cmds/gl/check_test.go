@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, src string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		return file
+	}
+	good := write("good.l", "(defun f (n) (+ n 1)) (f 1)")
+	bad := write("bad.l", "(car 1 2)\n(print x)")
+	broken := write("broken.l", "(car 1\n")
+	twoBroken := write("twoBroken.l", "(if)\n(car 1 2)\n(let)\n")
+
+	var out strings.Builder
+	require.True(t, checkFiles(&out, []string{good}))
+	require.Empty(t, out.String())
+
+	require.False(t, checkFiles(&out, []string{good, bad, broken}))
+	require.Contains(t, out.String(), "'car' expects 1 argument; got 2")
+	require.Contains(t, out.String(), "undefined identifier 'x' ('"+bad+"' line 2, col 8)")
+	require.Contains(t, out.String(), "Parse error in '"+broken+"'")
+
+	out.Reset()
+	require.False(t, checkFiles(&out, []string{twoBroken}))
+	require.Equal(t, 2, strings.Count(out.String(), "Parse error in '"+twoBroken+"'"))
+	require.Contains(t, out.String(), "'car' expects 1 argument; got 2")
+}
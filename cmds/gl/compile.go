@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// compileFile parses the script in the file, and writes it to out in compiled
+// form. gl runs files with the compiled extension without parsing them again.
+// If asJSON is set, the program's syntax tree is written as JSON instead, for
+// other tools to use.
+func compileFile(file, out string, asJSON bool) error {
+	prog, err := parseFile(file)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %w", out, err)
+	}
+	if asJSON {
+		err = json.NewEncoder(f).Encode(prog)
+	} else {
+		err = prog.WriteCompiled(f)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_compileFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "script.l")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`
+		;; gl: {"permissions": ["file"]}
+		(defun inc (n) (+ n 1))
+		(writeFile "`+out+`" (toString (inc 2)))
+	`), 0644))
+
+	compiled := filepath.Join(dir, "script.glc")
+	require.NoError(t, compileFile(script, compiled, false))
+
+	// the compiled script's manifest still needs its permissions granted.
+	err = execFile(context.Background(), compiled, runOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires permissions [file]")
+
+	require.NoError(t, execFile(context.Background(), compiled, runOptions{
+		allowed: []string{"file"},
+	}))
+	written, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "3", string(written))
+
+	// a source file isn't a compiled one.
+	require.NoError(t, ioutil.WriteFile(compiled, []byte(`(+ 1 2)`), 0644))
+	err = execFile(context.Background(), compiled, runOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Could not load")
+}
+
+func Test_compileFileJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "script.l")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`(+ 1 2)`), 0644))
+
+	out := filepath.Join(dir, "script.json")
+	require.NoError(t, compileFile(script, out, true))
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	prog := &golisp2.Program{}
+	require.NoError(t, json.Unmarshal(data, prog))
+	require.Equal(t, 1, len(prog.Exprs))
+	require.Equal(t, "(+ 1.000000 2.000000)", strings.TrimSpace(prog.Exprs[0].CodeStr()))
+}
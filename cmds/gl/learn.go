@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+// learnTimeout bounds how long an answer to an exercise can run for.
+const learnTimeout = 2 * time.Second
+
+type (
+	// tutorial is an interactive session that walks through the lessons. Each
+	// lesson ends with an exercise, which must be answered before moving on to
+	// the next one.
+	tutorial struct {
+		ctx context.Context
+		in  *bufio.Scanner
+		out io.Writer
+	}
+
+	// lesson is a single step of the tutorial.
+	lesson struct {
+		title    string
+		text     string
+		exercise string
+		hint     string
+
+		// check verifies the value the answer evaluated to, in the context it
+		// was evaluated in. Returns why the answer is wrong if it is.
+		check func(ec *golisp2.EvalContext, v golisp2.Value) error
+	}
+)
+
+// lessons are the steps of the tutorial, in order.
+var lessons = []lesson{
+	{
+		title: "Calling functions",
+		text: `Code is made of expressions. A call is written as a list in parens: the
+function comes first, followed by its arguments. So (+ 1 2) adds 1 and 2,
+and (* 2 (+ 1 2)) multiplies 2 by the result of adding 1 and 2.`,
+		exercise: "Multiply 6 by 7.",
+		hint:     "(* 6 7)",
+		check:    expectAnswer("42"),
+	},
+	{
+		title: "Strings",
+		text: `Strings are written in double quotes. concat joins any number of them
+together: (concat "a" "b" "c") is "abc".`,
+		exercise: `Join "go" and "lisp" into one string.`,
+		hint:     `(concat "go" "lisp")`,
+		check:    expectAnswer(`"golisp"`),
+	},
+	{
+		title: "Naming values",
+		text: `let binds a name to a value, so it can be used by later expressions:
+
+  (let width 3)
+  (* width width)
+
+An answer can be several expressions; the last is the one that's checked.`,
+		exercise: "Bind side to 5, then compute the area of a square with that side.",
+		hint:     "(let side 5) (* side side)",
+		check:    expectAnswer("25"),
+	},
+	{
+		title: "Conditionals",
+		text: `if evaluates its condition, then either the first branch if it's true or
+the second if it's false: (if (< 1 2) "yes" "no") is "yes".`,
+		exercise: `Write an expression that is "big" if 10 is greater than 5, and
+"small" otherwise.`,
+		hint:  `(if (> 10 5) "big" "small")`,
+		check: expectAnswer(`"big"`),
+	},
+	{
+		title: "Functions",
+		text: `defun defines a named function: a name, a list of parameters, and a body.
+
+  (defun square (n) (* n n))
+  (square 4)
+
+fn creates a function without a name, which is handy to pass to other
+functions: (fn (n) (* n n)).`,
+		exercise: "Define a function named double that doubles a number, then call it on 21.",
+		hint:     "(defun double (n) (* n 2)) (double 21)",
+		check: func(ec *golisp2.EvalContext, v golisp2.Value) error {
+			fn, found := ec.Resolve("double")
+			if _, isFn := fn.(*golisp2.FuncValue); !found || !isFn {
+				return fmt.Errorf("define a function named double")
+			}
+			return expectAnswer("42")(ec, v)
+		},
+	},
+	{
+		title: "Lists",
+		text: `(list 1 2 3) creates a list. listMap calls a function on each element of a
+list, and returns a list of the results; listFilter keeps the elements a
+function returns true for.`,
+		exercise: "Use listMap to add one to each element of (list 1 2 3).",
+		hint:     "(listMap (list 1 2 3) (fn (n) (+ n 1)))",
+		check:    expectAnswer("[2 3 4]"),
+	},
+	{
+		title: "Maps",
+		text: `(map "name" "gl" "age" 3) creates a map from keys to values, and mapGet
+looks up the value of a key: (mapGet m "name").`,
+		exercise: `Create a map with the key "lang" set to "golisp", and get "lang" from it.`,
+		hint:     `(mapGet (map "lang" "golisp") "lang")`,
+		check:    expectAnswer(`"golisp"`),
+	},
+}
+
+// expectAnswer returns a check that the answer is the given value, as it's
+// printed.
+func expectAnswer(expected string) func(*golisp2.EvalContext, golisp2.Value) error {
+	return func(ec *golisp2.EvalContext, v golisp2.Value) error {
+		if actual := v.InspectStr(); actual != expected {
+			return fmt.Errorf("expected %s; got %s", expected, actual)
+		}
+		return nil
+	}
+}
+
+// newTutorial creates a session that reads answers from in, and writes to out.
+func newTutorial(ctx context.Context, in io.Reader, out io.Writer) *tutorial {
+	return &tutorial{
+		ctx: ctx,
+		in:  bufio.NewScanner(in),
+		out: out,
+	}
+}
+
+// run works through the lessons from the start-th (counting from 1), until
+// they're done or the user quits.
+func (tu *tutorial) run(start int) error {
+	if start < 1 || start > len(lessons) {
+		return fmt.Errorf("there are lessons 1 to %d; got %d", len(lessons), start)
+	}
+	fmt.Fprintln(tu.out, "Welcome! Answer each exercise to move on. Commands: :hint, :skip, :quit")
+	for i := start - 1; i < len(lessons); i++ {
+		more, err := tu.lesson(i)
+		if err != nil || !more {
+			return err
+		}
+	}
+	fmt.Fprintln(tu.out, "\nThat's every lesson. Run gl with no arguments to keep experimenting.")
+	return nil
+}
+
+// lesson presents the i-th lesson, and reads answers to its exercise until one
+// is correct. Returns false if the user quit, or input ran out.
+func (tu *tutorial) lesson(i int) (bool, error) {
+	l := lessons[i]
+	fmt.Fprintf(tu.out, "\nLesson %d/%d: %s\n\n%s\n\nExercise: %s\n",
+		i+1, len(lessons), l.title, l.text, l.exercise)
+
+	// answers are sandboxed: they can only call pure functions, and
+	// are halted if they run too long.
+	ec := golisp2.BuiltinContext().SubContext(nil)
+	ec.SetPureOnly()
+
+	var pending strings.Builder
+	for {
+		if pending.Len() == 0 {
+			fmt.Fprint(tu.out, "> ")
+		} else {
+			fmt.Fprint(tu.out, "... ")
+		}
+		if !tu.in.Scan() {
+			fmt.Fprintln(tu.out)
+			return false, tu.in.Err()
+		}
+		line := tu.in.Text()
+
+		if pending.Len() == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				continue
+			case ":hint":
+				fmt.Fprintf(tu.out, "Try: %s\n", l.hint)
+				continue
+			case ":skip":
+				return true, nil
+			case ":quit":
+				return false, nil
+			}
+		}
+
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if isIncomplete(pending.String()) {
+			continue
+		}
+		v, err := tu.answer(ec, pending.String())
+		pending.Reset()
+		if err != nil {
+			fmt.Fprintln(tu.out, err)
+			continue
+		}
+		fmt.Fprintln(tu.out, golisp2.InspectBounded(v, golisp2.DefaultInspectOptions))
+		if err := l.check(ec, v); err != nil {
+			fmt.Fprintf(tu.out, "Not quite: %s. Type :hint for help.\n", err)
+			continue
+		}
+		fmt.Fprintln(tu.out, "Correct!")
+		return true, nil
+	}
+}
+
+// answer evaluates the expressions of an answer, and returns the value of the
+// last.
+func (tu *tutorial) answer(ec *golisp2.EvalContext, src string) (golisp2.Value, error) {
+	sources := golisp2.NewSourceRegistry()
+	exprs, err := parseRepl(src, sources)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(tu.ctx, learnTimeout)
+	defer cancel()
+	ec.SetContext(ctx)
+	var v golisp2.Value = golisp2.Nil
+	for _, e := range exprs {
+		if v, err = e.Eval(ec); err != nil {
+			return nil, sources.Quote(err)
+		}
+	}
+	return v, nil
+}
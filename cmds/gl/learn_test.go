@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tutorial(t *testing.T) {
+	// runTutorial runs a session from the start-th lesson with the given lines
+	// of input, and returns the output.
+	runTutorial := func(t *testing.T, start int, lines ...string) string {
+		var out strings.Builder
+		in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+		require.NoError(t, newTutorial(context.Background(), in, &out).run(start))
+		return out.String()
+	}
+
+	t.Run("hintsAreCorrect", func(t *testing.T) {
+		hints := make([]string, len(lessons))
+		for i, l := range lessons {
+			hints[i] = l.hint
+		}
+		out := runTutorial(t, 1, hints...)
+		require.Equal(t, len(lessons), strings.Count(out, "Correct!"))
+		require.Contains(t, out, "That's every lesson")
+	})
+
+	t.Run("wrongAnswers", func(t *testing.T) {
+		out := runTutorial(t, 1, "(* 6 6)", "(* 6", "  7)", ":quit")
+		require.Contains(t, out, "Not quite: expected 42; got 36")
+		require.Contains(t, out, "... 42\nCorrect!")
+		require.Contains(t, out, "Lesson 2/")
+		require.NotContains(t, out, "Lesson 3/")
+	})
+
+	t.Run("commands", func(t *testing.T) {
+		out := runTutorial(t, 2, ":hint", ":skip", ":quit")
+		require.Contains(t, out, `Try: (concat "go" "lisp")`)
+		require.Contains(t, out, "Lesson 3/")
+		require.NotContains(t, out, "Correct!")
+	})
+
+	t.Run("sandboxed", func(t *testing.T) {
+		out := runTutorial(t, 1, `(print 1)`, `(readFile "/etc/passwd")`, `(while true 1)`)
+		require.Equal(t, 2, strings.Count(out, "cannot be called in pure mode"))
+		require.Contains(t, out, "halted")
+	})
+
+	t.Run("invalidStart", func(t *testing.T) {
+		err := newTutorial(context.Background(), strings.NewReader(""), &strings.Builder{}).
+			run(len(lessons) + 1)
+		require.Error(t, err)
+	})
+}
@@ -1,16 +1,122 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bennettjames/go-compiler-experiments/golisp2"
 )
 
 func main() {
+	if b, isBundle, err := ownBundle(); err != nil {
+		log.Fatal(err)
+	} else if isBundle {
+		runBundle(b)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		buildFlags := flag.NewFlagSet("build", flag.ExitOnError)
+		out := buildFlags.String("o", "", "The binary to write")
+		buildFlags.Parse(os.Args[2:])
+		file := buildFlags.Arg(0)
+		// flags may also follow the file.
+		if buildFlags.NArg() > 0 {
+			buildFlags.Parse(buildFlags.Args()[1:])
+		}
+		if file == "" || buildFlags.NArg() != 0 || *out == "" {
+			fmt.Fprintln(os.Stderr, "usage: gl build file -o binary")
+			os.Exit(2)
+		}
+		if err := buildBundle(file, *out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "compile" {
+		compileFlags := flag.NewFlagSet("compile", flag.ExitOnError)
+		out := compileFlags.String("o", "", "The compiled file to write")
+		asJSON := compileFlags.Bool("json", false,
+			"Writes the syntax tree as JSON, rather than a compiled file")
+		compileFlags.Parse(os.Args[2:])
+		file := compileFlags.Arg(0)
+		// flags may also follow the file.
+		if compileFlags.NArg() > 0 {
+			compileFlags.Parse(compileFlags.Args()[1:])
+		}
+		if file == "" || compileFlags.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "usage: gl compile file [-json] [-o file.glc]")
+			os.Exit(2)
+		}
+		if *out == "" {
+			ext := golisp2.CompiledExt
+			if *asJSON {
+				ext = ".json"
+			}
+			*out = strings.TrimSuffix(file, filepath.Ext(file)) + ext
+		}
+		if err := compileFile(file, *out, *asJSON); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: gl check file...")
+			os.Exit(2)
+		}
+		if !checkFiles(os.Stdout, os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: gl test dir-or-file...")
+			os.Exit(2)
+		}
+		if !testFiles(os.Stdout, os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "learn" {
+		start := 1
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || len(os.Args) > 3 {
+				fmt.Fprintln(os.Stderr, "usage: gl learn [lesson]")
+				os.Exit(2)
+			}
+			start = n
+		}
+		ctx, cancel := RootContext()
+		defer cancel()
+		if err := newTutorial(ctx, os.Stdin, os.Stdout).run(start); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+
 	ctx, cancel := RootContext()
 	defer cancel()
 	var _ = ctx
@@ -19,46 +125,529 @@ func main() {
 		flags    = flag.NewFlagSet("flags", flag.PanicOnError)
 		showVals = flags.Bool("show-vals", false,
 			"Shows all evaluated values; rather than just printed ones")
+		inline = flags.String("e", "",
+			"Runs the given expressions rather than a file, and prints the value of the last")
+		allow = flags.String("allow", "",
+			"Comma-separated permissions granted to scripts that request them")
+		deterministic = flags.Bool("deterministic", false,
+			"Makes runs reproducible: seeds random, freezes the clock, sorts maps")
+		seed = flags.Int64("seed", 0,
+			"Random seed used in deterministic mode")
+		clock = flags.String("clock", "1970-01-01T00:00:00Z",
+			"RFC3339 instant the clock is frozen at in deterministic mode")
+		record = flags.String("record", "",
+			"Records effects (file reads, env, HTTP) to the given cassette file")
+		replay = flags.String("replay", "",
+			"Serves effects from the given cassette file instead of performing them")
+		dryRun = flags.Bool("dry-run", false,
+			"Logs write effects (files, commands, HTTP posts) instead of performing them")
+		noExec = flags.Bool("no-exec", false,
+			"Makes exec and execPipe fail rather than run processes")
+		jsonOut = flags.Bool("json", false,
+			"Writes the values, output, diagnostics and stats of the run as JSON")
+		jsonLines = flags.Bool("json-lines", false,
+			"Writes the value of each top-level expression as a line of JSON as it's evaluated")
+		keepGoing = flags.Bool("keep-going", false,
+			"Continues past failing top-level forms, and reports every failure at the end")
+		trace = flags.Bool("trace", false,
+			"Prints an indented trace of every function call to stderr")
+		profile = flags.Bool("profile", false,
+			"Prints a profile of where the run spent its time to stderr")
+		traceResolve = flags.Bool("trace-resolve", false,
+			"Prints each identifier lookup, and the scope level that resolved it, to stderr")
+		checkpoint = flags.String("checkpoint", "",
+			"Saves the script's progress to the given file after each top-level expression")
+		resume = flags.String("resume", "",
+			"Resumes the script from the given checkpoint file, and keeps checkpointing to it")
+		maxDepth = flags.Int("max-depth", 0,
+			"Fails calls nested deeper than this; zero for the default, negative for no limit")
+		strict = flags.Bool("strict", false,
+			"Makes warnings, such as calling deprecated functions, errors")
+		truthy = flags.Bool("truthy", false,
+			"Lets conditions be any value: nil and false are false, everything else true")
+		sortMaps = flags.Bool("sort-maps", false,
+			"Iterates maps in sorted key order")
+		ieeeDiv = flags.Bool("ieee-div", false,
+			"Makes dividing by zero produce an infinity or NaN, rather than failing")
+		caps = flags.Bool("caps", false,
+			"Prints the capabilities (file, net, exec, env) the script may use, rather than running it")
 	)
-	flags.Parse(os.Args[1:])
+	flags.Parse(args)
 	files := flags.Args()
 
-	if len(files) != 1 {
-		// note (bs): let's see if this can trigger an interpreter
-		fmt.Fprint(os.Stderr, "gl requires a file argument to execute")
+	var det *determinism
+	if *deterministic {
+		frozen, err := time.Parse(time.RFC3339, *clock)
+		if err != nil {
+			log.Fatalf("invalid -clock value: %s", err)
+		}
+		det = &determinism{seed: *seed, now: frozen}
+	}
+
+	if *record != "" && *replay != "" {
+		log.Fatalf("-record and -replay cannot be used together")
+	}
+	if *checkpoint != "" && *resume != "" && *checkpoint != *resume {
+		log.Fatalf("-checkpoint and -resume must be the same file")
+	}
+	if *trace && *profile {
+		log.Fatalf("-trace and -profile cannot be used together")
+	}
+	if *jsonOut && *jsonLines {
+		log.Fatalf("-json and -json-lines cannot be used together")
+	}
+
+	if *inline != "" && len(files) > 0 {
+		log.Fatalf("-e cannot be used along with files")
+	}
+	if len(files) == 0 && *inline == "" {
+		if err := newRepl(ctx, os.Stdin, os.Stdout).run(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *caps {
+		if err := printCapabilities(os.Stdout, files); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	if err := execFile(ctx, files[0], *showVals); err != nil {
+	cassette := cassetteFiles{record: *record, replay: *replay}
+	checkpoints := checkpointFiles{save: *checkpoint, resume: *resume}
+	if *resume != "" {
+		checkpoints.save = *resume
+	}
+	var report *runReport
+	if *jsonOut {
+		name := inlineSource
+		if len(files) > 0 {
+			name = files[0]
+		}
+		report = newRunReport(name)
+	}
+	opts := runOptions{
+		showVals:     *showVals,
+		jsonLines:    *jsonLines,
+		allowed:      splitList(*allow),
+		det:          det,
+		cassette:     cassette,
+		checkpoints:  checkpoints,
+		dryRun:       *dryRun,
+		noExec:       *noExec,
+		keepGoing:    *keepGoing,
+		trace:        *trace,
+		profile:      *profile,
+		traceResolve: *traceResolve,
+		report:       report,
+		eval: golisp2.Options{
+			MaxDepth:     *maxDepth,
+			Strict:       *strict,
+			Truthy:       *truthy,
+			SortMaps:     *sortMaps,
+			IEEEDivision: *ieeeDiv,
+		},
+	}
+	var err error
+	if *inline != "" {
+		opts.showLast = true
+		err = execSource(ctx, inlineSource, strings.NewReader(*inline), opts)
+	} else {
+		err = execFiles(ctx, files, opts)
+	}
+	if report != nil {
+		if writeErr := report.write(os.Stdout); writeErr != nil {
+			log.Fatal(writeErr)
+		}
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func execFile(ctx context.Context, file string, showVals bool) error {
-	f, err := os.Open(file)
+// runBundle runs the script bundled into the binary, and exits. The script is
+// granted the permissions it requests, as whoever built it chose to.
+func runBundle(b *bundle) {
+	ctx, cancel := RootContext()
+	defer cancel()
+	err := execSource(ctx, b.name, bytes.NewReader(b.script), runOptions{
+		trusted: true,
+	})
 	if err != nil {
-		return fmt.Errorf("Could not read file '%s': %w", file, err)
+		log.Fatal(err)
 	}
+}
 
-	// note (bs): consider folding these up into a utility method. It seems
-	// reasonable to have a "prepare file" function.
-	ts := golisp2.NewTokenScanner(
-		golisp2.NewRuneScanner(file, f),
-	)
-	exprs, exprsErr := golisp2.ParseTokens(ts)
-	if exprsErr != nil {
-		return fmt.Errorf("Parse error in '%s': %w", file, exprsErr)
+// determinism holds the settings for a deterministic run.
+type determinism struct {
+	seed int64
+	now  time.Time
+}
+
+// cassetteFiles holds the paths effects are recorded to or replayed from.
+type cassetteFiles struct {
+	record string
+	replay string
+}
+
+// checkpointFiles holds the paths a run's progress is saved to and resumed
+// from.
+type checkpointFiles struct {
+	save   string
+	resume string
+}
+
+// runOptions controls how a script is run.
+type runOptions struct {
+	showVals  bool
+	allowed   []string
+	det       *determinism
+	cassette  cassetteFiles
+	dryRun    bool
+	noExec    bool
+	keepGoing bool
+	trace     bool
+	profile   bool
+
+	// showLast prints the value of the last expression, unless it's nil.
+	showLast bool
+
+	// jsonLines writes the value of every top-level expression, as a line of
+	// JSON, in place of printing any.
+	jsonLines bool
+
+	// eval configures evaluation. Output, determinism and policy are set by the
+	// other options instead.
+	eval golisp2.Options
+
+	// traceResolve logs each identifier resolution to stderr.
+	traceResolve bool
+
+	// checkpoints saves progress after each top-level expression, and resumes
+	// from a previous run's progress.
+	checkpoints checkpointFiles
+
+	// trusted grants the script every permission it requests.
+	trusted bool
+
+	// stream evaluates each top-level form as it's read, rather than parsing
+	// the whole script first. Streamed scripts have no manifest.
+	stream bool
+
+	// report, if set, collects the results of the run rather than them being
+	// printed.
+	report *runReport
+}
+
+// stdinFile is the file argument that runs the script piped in on stdin.
+const stdinFile = "-"
+
+// inlineSource is the name expressions passed with -e are reported under.
+const inlineSource = "<expr>"
+
+// execFile runs the script in the file. The script on stdin is streamed: each
+// top-level form is evaluated as soon as it's read.
+func execFile(ctx context.Context, file string, opts runOptions) error {
+	return execFiles(ctx, []string{file}, opts)
+}
+
+// execFiles runs the scripts in the files in order, in a single context. See
+// execSources. stdin can only be run on its own.
+func execFiles(ctx context.Context, files []string, opts runOptions) error {
+	if len(files) == 1 && files[0] == stdinFile {
+		opts.stream = true
+		return execSource(ctx, "<stdin>", os.Stdin, opts)
 	}
+	sources := make([]scriptSource, 0, len(files))
+	for _, file := range files {
+		if file == stdinFile {
+			return fmt.Errorf("stdin can't be run along with other files")
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			err = fmt.Errorf("Could not read file '%s': %w", file, err)
+			if opts.report != nil {
+				opts.report.finish(time.Now(), totalAlloc(), err)
+			}
+			return err
+		}
+		defer f.Close()
+		sources = append(sources, scriptSource{name: file, src: f})
+	}
+	return execSources(ctx, sources, opts)
+}
+
+// execSource runs the script read from src. file is the name it is reported
+// under.
+func execSource(
+	ctx context.Context, file string, src io.Reader, opts runOptions,
+) error {
+	return execSources(ctx, []scriptSource{{name: file, src: src}}, opts)
+}
+
+// scriptSource is a script to run, and the name it's reported under.
+type scriptSource struct {
+	name string
+	src  io.Reader
+}
+
+// loadedSource is a script that's ready to run: either parsed, or about to be
+// streamed.
+type loadedSource struct {
+	name string
+
+	// prog is the parsed script; nil if it's streamed.
+	prog *golisp2.Program
+
+	nextExpr func() (golisp2.Expr, error)
+
+	// quote adds an excerpt of the script to an error that occurred in it.
+	quote func(error) error
+}
+
+// execSources runs each of the scripts in turn, in a single context; each
+// can use what the ones before it defined. Errors are reported under the name
+// of the script they occurred in. Every script is parsed, and its permissions
+// checked, before any are run.
+func execSources(
+	ctx context.Context, sources []scriptSource, opts runOptions,
+) (err error) {
+	report := opts.report
+	if report != nil {
+		start, startAlloc := time.Now(), totalAlloc()
+		defer func() {
+			report.finish(start, startAlloc, err)
+		}()
+	}
+	if len(sources) > 1 && opts.checkpoints != (checkpointFiles{}) {
+		return fmt.Errorf("only a single file can be checkpointed")
+	}
+
+	// retained holds the text of the scripts that aren't streamed, so errors in
+	// them can be quoted; even when they occur running a later script.
+	retained := golisp2.NewSourceRegistry()
+	loaded := make([]loadedSource, 0, len(sources))
+	for _, s := range sources {
+		ls, err := loadSource(s, opts, retained)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, ls)
+	}
+
 	baseCtx := golisp2.BuiltinContext()
 	execCtx := baseCtx.SubContext(nil)
+	execCtx.SetContext(ctx)
+	execCtx.SetOptions(opts.eval)
+	if opts.det != nil {
+		execCtx.SetDeterministic(opts.det.seed, opts.det.now)
+	}
+	if report != nil {
+		report.attach(execCtx)
+	} else {
+		defer printDiagnostics(execCtx.Diagnostics())
+	}
+	defer func() {
+		if err := execCtx.Shutdown(shutdownTimeout); err != nil {
+			log.Print(err)
+		}
+	}()
+	if opts.dryRun {
+		execCtx.SetDryRun(os.Stderr)
+	}
+	if opts.noExec {
+		execCtx.DisableExec()
+	}
+	if opts.traceResolve {
+		execCtx.SetResolveLog(os.Stderr)
+	}
+	// tails is the hook that annotates calls from tail position, if any.
+	var tails tailCallMarker
+	if opts.trace {
+		tracer := newCallTracer(os.Stderr)
+		execCtx.SetEvalHook(tracer)
+		tails = tracer
+	}
+	if opts.profile {
+		profiler := golisp2.NewProfiler()
+		execCtx.SetEvalHook(profiler)
+		tails = profiler
+		defer func() {
+			fmt.Fprintln(os.Stderr)
+			profiler.WriteReport(os.Stderr)
+		}()
+	}
+
+	if cassette := opts.cassette; cassette.replay != "" {
+		c, err := loadCassette(cassette.replay)
+		if err != nil {
+			return err
+		}
+		execCtx.ReplayEffects(c)
+	} else if cassette.record != "" {
+		c := golisp2.NewCassette()
+		execCtx.RecordEffects(c)
+		defer func() {
+			if err := saveCassette(cassette.record, c); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	// next is the index of the next top-level expression, for checkpoints.
+	next := 0
+	if opts.checkpoints.resume != "" {
+		ls := &loaded[0]
+		cp, err := loadCheckpoint(opts.checkpoints.resume)
+		if err != nil {
+			return err
+		}
+		if err := cp.Restore(ls.prog, execCtx); err != nil {
+			return fmt.Errorf("Could not resume '%s': %w", ls.name, err)
+		}
+		next = cp.Next
+		ls.nextExpr = exprsIter(ls.prog.Exprs[next:])
+	}
+
+	// checkpointing stops at the first checkpoint that can't be saved; later
+	// ones would fail the same way. The last one saved is kept to resume from.
+	checkpointing := opts.checkpoints.save != ""
+	execErrs := []error{}
+	halted := false
+	var last golisp2.Value
+	for _, ls := range loaded {
+		if halted {
+			break
+		}
+		// the timeout is only cancelled once every script has run, as
+		// goroutines started by this one may still be running.
+		if ls.prog != nil && ls.prog.Manifest.Timeout > 0 {
+			timeoutCtx, cancel := context.WithTimeout(ctx, ls.prog.Manifest.Timeout)
+			defer cancel()
+			execCtx.SetContext(timeoutCtx)
+		} else {
+			execCtx.SetContext(ctx)
+		}
+		for {
+			e, err := ls.nextExpr()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				execErrs = append(execErrs,
+					fmt.Errorf("Parse error in '%s': %w", ls.name, err))
+				halted = true
+				break
+			}
+			if tails != nil {
+				tails.MarkTailCalls(golisp2.TailCalls([]golisp2.Expr{e}))
+			}
+			val, err := e.Eval(execCtx)
+			next++
+			if err == nil {
+				last = val
+			}
+			if err == nil && checkpointing {
+				if err := saveCheckpoint(opts.checkpoints.save, ls.prog, execCtx, next); err != nil {
+					log.Printf("Checkpointing stopped: %v", err)
+					checkpointing = false
+				}
+			}
+			if err != nil {
+				execErrs = append(execErrs,
+					fmt.Errorf("Execution error in '%s': %w", ls.name, ls.quote(err)))
+				if !opts.keepGoing || execCtx.Context().Err() != nil {
+					halted = true
+					break
+				}
+			} else if report != nil {
+				report.addValue(val)
+			} else if opts.jsonLines {
+				fmt.Printf("%s\n", valueJSON(val))
+			} else if _, isNil := val.(*golisp2.NilValue); !isNil && opts.showVals {
+				fmt.Println(golisp2.InspectBounded(val, golisp2.DefaultInspectOptions))
+			}
+		}
+	}
 
-	for _, e := range exprs {
-		if val, err := e.Eval(execCtx); err != nil {
-			return fmt.Errorf("Execution error in '%s': %w", file, err)
-		} else if _, isNil := val.(*golisp2.NilValue); !isNil && showVals {
-			fmt.Println(val.InspectStr())
+	switch len(execErrs) {
+	case 0:
+		if _, isNil := last.(*golisp2.NilValue); last != nil && !isNil &&
+			opts.showLast && !opts.showVals && !opts.jsonLines && report == nil {
+			fmt.Println(golisp2.InspectBounded(last, golisp2.DefaultInspectOptions))
 		}
+		return nil
+	case 1:
+		return execErrs[0]
+	default:
+		return &golisp2.MultiError{Errs: execErrs}
 	}
+}
 
-	return nil
+// loadSource parses or loads the script, and checks it's been granted the permissions
+// it requests. Streamed scripts are only read once they're run; the source of
+// the others is retained in sources.
+func loadSource(
+	s scriptSource, opts runOptions, sources *golisp2.SourceRegistry,
+) (loadedSource, error) {
+	if opts.stream {
+		rs := golisp2.NewRuneScanner(s.name, s.src)
+		if opts.checkpoints != (checkpointFiles{}) {
+			return loadedSource{}, fmt.Errorf(
+				"'%s' is streamed, so cannot be checkpointed", s.name)
+		}
+		return loadedSource{
+			name:     s.name,
+			nextExpr: golisp2.NewExprScanner(golisp2.NewTokenScanner(rs)).Next,
+			quote:    rs.Quote,
+		}, nil
+	}
+	prog, err := readProgram(s.name, s.src, sources)
+	if err != nil {
+		return loadedSource{}, err
+	}
+	if undeclared := undeclaredCapabilities(prog); len(undeclared) > 0 {
+		return loadedSource{}, fmt.Errorf(
+			"'%s' uses capabilities %v its manifest doesn't request", s.name, undeclared)
+	}
+	missing := missingPermissions(prog.Manifest, opts.allowed)
+	if len(missing) > 0 && !opts.trusted {
+		return loadedSource{}, fmt.Errorf(
+			"'%s' requires permissions %v; grant them with -allow", s.name, missing)
+	}
+	return loadedSource{
+		name:     s.name,
+		prog:     prog,
+		nextExpr: exprsIter(prog.Exprs),
+		quote:    sources.Quote,
+	}, nil
+}
+
+// tailCallMarker is a hook that annotates calls made from tail position.
+type tailCallMarker interface {
+	MarkTailCalls(calls []*golisp2.CallExpr)
+}
+
+// exprsIter returns a function that returns each of the expressions in turn,
+// and then io.EOF.
+func exprsIter(exprs []golisp2.Expr) func() (golisp2.Expr, error) {
+	return func() (golisp2.Expr, error) {
+		if len(exprs) == 0 {
+			return nil, io.EOF
+		}
+		e := exprs[0]
+		exprs = exprs[1:]
+		return e, nil
+	}
+}
+
+// printDiagnostics writes any collected diagnostics to stderr.
+func printDiagnostics(ds *golisp2.Diagnostics) {
+	for _, d := range ds.All() {
+		fmt.Fprintln(os.Stderr, d.String())
+	}
 }
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_clarifyFlags(t *testing.T) {
@@ -19,3 +27,133 @@ func Test_clarifyFlags(t *testing.T) {
 	fmt.Println("@@@ out", *outFile)
 	fmt.Println("@@@ values", flags.Args())
 }
+
+func Test_checkpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "marker")
+	out := filepath.Join(dir, "out")
+	state := filepath.Join(dir, "state.json")
+	script := filepath.Join(dir, "script.l")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`
+		(defun inc (n) (+ n 1))
+		(let n 1)
+		(set! n (inc n))
+		(when (strEq (readFile "`+marker+`") "stop") (fail "interrupted"))
+		(writeFile "`+out+`" (toString (inc n)))
+	`), 0644))
+
+	require.NoError(t, ioutil.WriteFile(marker, []byte("stop"), 0644))
+	err = execFile(context.Background(), script, runOptions{
+		checkpoints: checkpointFiles{save: state},
+	})
+	require.Error(t, err)
+	_, statErr := os.Stat(out)
+	require.True(t, os.IsNotExist(statErr))
+
+	// the resumed run picks up at the failed expression.
+	require.NoError(t, ioutil.WriteFile(marker, []byte("go"), 0644))
+	require.NoError(t, execFile(context.Background(), script, runOptions{
+		checkpoints: checkpointFiles{save: state, resume: state},
+	}))
+	written, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "3", string(written))
+}
+
+func Test_execFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execFiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, src string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		return file
+	}
+	out := filepath.Join(dir, "out")
+	lib := write("lib.l", `(defun inc (n) (+ n 1))`)
+	util := write("util.l", `(let start (inc 1))`)
+	main := write("main.l", `(writeFile "`+out+`" (toString (inc start)))`)
+	broken := write("broken.l", "(let x 1)\n(car 1 2)")
+
+	// later files see what earlier ones defined.
+	require.NoError(t, execFiles(context.Background(), []string{lib, util, main}, runOptions{}))
+	written, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "3", string(written))
+
+	err = execFiles(context.Background(), []string{lib, broken, main}, runOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Execution error in '"+broken+"'")
+
+	err = execFiles(context.Background(), []string{util, lib}, runOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Execution error in '"+util+"'")
+
+	err = execFiles(context.Background(), []string{lib, stdinFile}, runOptions{})
+	require.Error(t, err)
+}
+
+func Test_inline(t *testing.T) {
+	run := func(src string) string {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		stdout := os.Stdout
+		os.Stdout = w
+		runErr := execSource(context.Background(), inlineSource, strings.NewReader(src),
+			runOptions{showLast: true})
+		os.Stdout = stdout
+		w.Close()
+		out, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, runErr)
+		return string(out)
+	}
+
+	require.Equal(t, "3\n", run(`(let x 2) (+ x 1)`))
+	require.Equal(t, "[1 \"a\"]\n", run(`(list 1 "a")`))
+	require.Equal(t, "", run(`(let x nil) x`))
+}
+
+func Test_jsonLines(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	runErr := execSource(context.Background(), inlineSource,
+		strings.NewReader(`(let x 2) (map "a" (list x "b")) (fn () 1) nil`),
+		runOptions{showLast: true, jsonLines: true})
+	os.Stdout = stdout
+	w.Close()
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, runErr)
+	// values that can't be represented in JSON are given as their inspected
+	// string.
+	require.Equal(t, `2
+{"a":[2,"b"]}
+"\u003cfunc\u003e"
+null
+`, string(out))
+}
+
+func Test_evalOptions(t *testing.T) {
+	run := func(src string, opts golisp2.Options) error {
+		return execSource(context.Background(), "options.l", strings.NewReader(src),
+			runOptions{eval: opts})
+	}
+	deep := `
+		(defun depth (n) (if (== n 0) 0 (+ 1 (depth (- n 1)))))
+		(depth 30)`
+	require.NoError(t, run(deep, golisp2.Options{}))
+	err := run(deep, golisp2.Options{MaxDepth: 10})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "maximum depth of 10")
+
+	require.Error(t, run(`(if 1 2 3)`, golisp2.Options{}))
+	require.NoError(t, run(`(if 1 2 3)`, golisp2.Options{Truthy: true}))
+
+	require.NoError(t, run(`(let car 1)`, golisp2.Options{}))
+	require.Error(t, run(`(let car 1)`, golisp2.Options{Strict: true}))
+}
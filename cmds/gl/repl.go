@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+// replSource is the source name given to code entered into the repl.
+const replSource = "repl"
+
+type (
+	// repl is an interactive session. Each line of input is evaluated in a
+	// context that persists for the whole session; unless it starts with a ':',
+	// in which case it's a meta-command (see replCommands).
+	repl struct {
+		ctx context.Context
+		in  *bufio.Scanner
+		out io.Writer
+
+		ec *golisp2.EvalContext
+
+		// sources retains the last input, and the files loaded, so errors can
+		// quote them.
+		sources *golisp2.SourceRegistry
+
+		// seenDiagnostics is the number of diagnostics that have been printed.
+		seenDiagnostics int
+	}
+
+	// replCommand is a meta-command that can be run in the repl.
+	replCommand struct {
+		usage string
+		help  string
+		run   func(r *repl, arg string) error
+	}
+)
+
+// replCommands are the meta-commands the repl supports, by name.
+var replCommands map[string]replCommand
+
+func init() {
+	replCommands = map[string]replCommand{
+		"help": {
+			usage: ":help",
+			help:  "Lists the available commands",
+			run:   (*repl).help,
+		},
+		"load": {
+			usage: ":load file",
+			help:  "Evaluates the file in the session",
+			run:   (*repl).load,
+		},
+		"bindings": {
+			usage: ":bindings",
+			help:  "Lists the values defined in the session",
+			run:   (*repl).bindings,
+		},
+		"doc": {
+			usage: ":doc name",
+			help:  "Prints how the named function is called",
+			run:   (*repl).doc,
+		},
+		"type": {
+			usage: ":type expr",
+			help:  "Evaluates the expression, and prints the type of the result",
+			run:   (*repl).typeOf,
+		},
+		"time": {
+			usage: ":time expr",
+			help:  "Evaluates the expression, and prints how long it took",
+			run:   (*repl).time,
+		},
+		"reset": {
+			usage: ":reset",
+			help:  "Discards everything defined in the session",
+			run:   (*repl).reset,
+		},
+	}
+}
+
+// newRepl creates a session that reads from in, and writes to out.
+func newRepl(ctx context.Context, in io.Reader, out io.Writer) *repl {
+	r := &repl{
+		ctx:     ctx,
+		in:      bufio.NewScanner(in),
+		out:     out,
+		sources: golisp2.NewSourceRegistry(),
+	}
+	r.reset("")
+	return r
+}
+
+// run reads and evaluates input until it is exhausted. Expressions can span
+// multiple lines; input is collected until it's complete.
+func (r *repl) run() error {
+	var pending strings.Builder
+	for {
+		if pending.Len() == 0 {
+			fmt.Fprint(r.out, "> ")
+		} else {
+			fmt.Fprint(r.out, "... ")
+		}
+		if !r.in.Scan() {
+			fmt.Fprintln(r.out)
+			return r.in.Err()
+		}
+		line := r.in.Text()
+
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if err := r.command(strings.TrimSpace(line)); err != nil {
+				fmt.Fprintln(r.out, err)
+			}
+			continue
+		}
+
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if isIncomplete(pending.String()) {
+			continue
+		}
+		exprs, err := parseRepl(pending.String(), r.sources)
+		pending.Reset()
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			continue
+		}
+		for _, e := range exprs {
+			v, err := e.Eval(r.ec)
+			r.printDiagnostics()
+			if err != nil {
+				fmt.Fprintln(r.out, r.sources.Quote(err))
+				break
+			}
+			fmt.Fprintln(r.out, golisp2.InspectBounded(v, golisp2.DefaultInspectOptions))
+		}
+	}
+}
+
+// command runs the meta-command in the line.
+func (r *repl) command(line string) error {
+	name, arg := strings.TrimPrefix(line, ":"), ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+	cmd, hasCmd := replCommands[name]
+	if !hasCmd {
+		return fmt.Errorf("unknown command ':%s'; see :help", name)
+	}
+	return cmd.run(r, arg)
+}
+
+func (r *repl) help(string) error {
+	names := make([]string, 0, len(replCommands))
+	for name := range replCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := replCommands[name]
+		fmt.Fprintf(r.out, "  %-12s %s\n", cmd.usage, cmd.help)
+	}
+	return nil
+}
+
+func (r *repl) load(file string) error {
+	if file == "" {
+		return errors.New("usage: :load file")
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Could not read file '%s': %w", file, err)
+	}
+	defer f.Close()
+	rs := golisp2.NewRuneScanner(file, f)
+	rs.SetSourceRegistry(r.sources)
+	exprs, err := golisp2.ParseTokens(golisp2.NewTokenScanner(rs))
+	if err != nil {
+		return fmt.Errorf("Parse error in '%s': %w", file, err)
+	}
+	for _, e := range exprs {
+		_, err := e.Eval(r.ec)
+		r.printDiagnostics()
+		if err != nil {
+			return fmt.Errorf("Execution error in '%s': %w", file, r.sources.Quote(err))
+		}
+	}
+	return nil
+}
+
+func (r *repl) bindings(string) error {
+	vals := r.ec.Bindings()
+	names := make([]string, 0, len(vals))
+	for name := range vals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.out, "  %s: %s\n", name, golisp2.InspectBounded(
+			vals[name], golisp2.InspectOptions{MaxDepth: 2, MaxLen: 10}))
+	}
+	return nil
+}
+
+func (r *repl) doc(name string) error {
+	if name == "" {
+		return errors.New("usage: :doc name")
+	}
+	v, found := r.ec.Resolve(name)
+	if !found {
+		return fmt.Errorf("'%s' is not defined", name)
+	}
+	fn, isFn := v.(*golisp2.FuncValue)
+	if !isFn {
+		return fmt.Errorf("'%s' is a %s, not a function", name, golisp2.TypeName(v))
+	}
+	fmt.Fprintln(r.out, fn.Signature())
+	if fn.Deprecated != nil {
+		fmt.Fprintf(r.out, "deprecated: %s\n", fn.Deprecated.Notice)
+	}
+	return nil
+}
+
+func (r *repl) typeOf(src string) error {
+	v, err := r.evalArg(src, "usage: :type expr")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, golisp2.TypeName(v))
+	return nil
+}
+
+func (r *repl) time(src string) error {
+	start := time.Now()
+	v, err := r.evalArg(src, "usage: :time expr")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, golisp2.InspectBounded(v, golisp2.DefaultInspectOptions))
+	fmt.Fprintf(r.out, "took %s\n", time.Since(start))
+	return nil
+}
+
+func (r *repl) reset(string) error {
+	r.ec = golisp2.BuiltinContext().SubContext(nil)
+	r.ec.SetContext(r.ctx)
+	r.seenDiagnostics = 0
+	return nil
+}
+
+// evalArg evaluates the argument of a command, which should be a single
+// expression.
+func (r *repl) evalArg(src, usage string) (golisp2.Value, error) {
+	exprs, err := parseRepl(src, r.sources)
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) != 1 {
+		return nil, errors.New(usage)
+	}
+	v, err := exprs[0].Eval(r.ec)
+	r.printDiagnostics()
+	return v, r.sources.Quote(err)
+}
+
+// printDiagnostics prints any diagnostics raised since it was last called.
+func (r *repl) printDiagnostics() {
+	all := r.ec.Diagnostics().All()
+	for _, d := range all[r.seenDiagnostics:] {
+		fmt.Fprintln(r.out, d.String())
+	}
+	r.seenDiagnostics = len(all)
+}
+
+// parseRepl parses the code entered into the repl. It's retained in sources,
+// in place of the code entered before it, so errors evaluating it can be quoted.
+func parseRepl(src string, sources *golisp2.SourceRegistry) ([]golisp2.Expr, error) {
+	rs := golisp2.NewRuneScanner(replSource, strings.NewReader(src))
+	rs.SetSourceRegistry(sources)
+	return golisp2.ParseTokens(golisp2.NewTokenScanner(rs))
+}
+
+// isIncomplete indicates the input has parens that haven't been closed yet, so
+// more is needed to complete it.
+func isIncomplete(src string) bool {
+	ts := golisp2.NewTokenScanner(
+		golisp2.NewRuneScanner(replSource, strings.NewReader(src)))
+	depth := 0
+	for ts.Advance(); !ts.Done(); ts.Advance() {
+		switch ts.Token().Typ {
+		case golisp2.OpenParenTT:
+			depth++
+		case golisp2.CloseParenTT:
+			depth--
+		}
+	}
+	return depth > 0
+}
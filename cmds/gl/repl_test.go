@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_repl(t *testing.T) {
+	// runRepl runs a session with the given lines of input, and returns the
+	// output.
+	runRepl := func(t *testing.T, lines ...string) string {
+		var out strings.Builder
+		in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+		require.NoError(t, newRepl(context.Background(), in, &out).run())
+		return out.String()
+	}
+
+	t.Run("eval", func(t *testing.T) {
+		out := runRepl(t, "(let a 2)", "(+ a", "  3)")
+		require.Contains(t, out, "> 2\n")
+		require.Contains(t, out, "... 5\n")
+	})
+
+	t.Run("help", func(t *testing.T) {
+		out := runRepl(t, ":help")
+		for name := range replCommands {
+			require.Contains(t, out, ":"+name)
+		}
+		require.Contains(t, runRepl(t, ":nope"), "unknown command ':nope'")
+	})
+
+	t.Run("bindingsAndReset", func(t *testing.T) {
+		out := runRepl(t, "(let a 2)", ":bindings", ":reset", ":bindings", "a")
+		require.Equal(t, 1, strings.Count(out, "a: 2"))
+		require.True(t, strings.HasSuffix(out, "> nil\n> \n"))
+	})
+
+	t.Run("doc", func(t *testing.T) {
+		require.Contains(t, runRepl(t, `:doc range`), "> (range from [to] [step])\n")
+		out := runRepl(t, `(defun f (a . rest) a)`, `:doc f`)
+		require.Contains(t, out, "(f a rest...)\n")
+		require.Contains(t, runRepl(t, `:doc nope`), "'nope' is not defined")
+		require.Contains(t, runRepl(t, `(let n 1)`, `:doc n`), "'n' is a number, not a function")
+	})
+
+	t.Run("type", func(t *testing.T) {
+		require.Contains(t, runRepl(t, `:type (list 1 2)`), "> list\n")
+		require.Contains(t, runRepl(t, `:type`), "usage: :type expr")
+	})
+
+	t.Run("time", func(t *testing.T) {
+		out := runRepl(t, `:time (+ 1 2)`)
+		require.Contains(t, out, "> 3\ntook ")
+	})
+
+	t.Run("load", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "repl")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "lib.l")
+		require.NoError(t, ioutil.WriteFile(file, []byte("(defun double (n) (* n 2))"), 0644))
+
+		out := runRepl(t, ":load "+file, "(double 4)")
+		require.Contains(t, out, "> 8\n")
+		require.Contains(t, runRepl(t, ":load missing.l"), "Could not read file")
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+type (
+	// runReport is the machine-readable result of running a file, written in
+	// -json mode so other tools can consume it.
+	runReport struct {
+		File string `json:"file"`
+
+		// Values holds the value of each top-level expression that was evaluated.
+		// Values that can't be represented in JSON (e.g. functions) are given as
+		// their inspected string.
+		Values []json.RawMessage `json:"values"`
+
+		// Output is everything the script printed.
+		Output string `json:"output"`
+
+		Diagnostics []reportDiagnostic `json:"diagnostics"`
+
+		// Error is the error the run failed with; empty if it succeeded.
+		Error string `json:"error,omitempty"`
+
+		Stats reportStats `json:"stats"`
+
+		output  bytes.Buffer
+		metrics *statsMetrics
+		ec      *golisp2.EvalContext
+	}
+
+	reportDiagnostic struct {
+		Severity string `json:"severity"`
+		Msg      string `json:"msg"`
+		File     string `json:"file"`
+		Line     int    `json:"line"`
+		Col      int    `json:"col"`
+	}
+
+	// reportStats are the resources used by a run.
+	reportStats struct {
+		DurationMs   float64 `json:"durationMs"`
+		BuiltinCalls int64   `json:"builtinCalls"`
+		AllocBytes   uint64  `json:"allocBytes"`
+	}
+
+	// statsMetrics is a golisp2.Metrics that counts builtin calls.
+	statsMetrics struct {
+		builtinCalls int64
+	}
+)
+
+func (m *statsMetrics) EvalStarted()                 {}
+func (m *statsMetrics) EvalFinished(d time.Duration) {}
+func (m *statsMetrics) EvalFailed(kind string)       {}
+func (m *statsMetrics) BuiltinCalled(name string) {
+	atomic.AddInt64(&m.builtinCalls, 1)
+}
+
+func newRunReport(file string) *runReport {
+	return &runReport{
+		File:        file,
+		Values:      []json.RawMessage{},
+		Diagnostics: []reportDiagnostic{},
+		metrics:     &statsMetrics{},
+	}
+}
+
+// attach directs the context's output, measurements and diagnostics into the
+// report.
+func (r *runReport) attach(ec *golisp2.EvalContext) {
+	r.ec = ec
+	ec.SetStdout(&r.output)
+	ec.SetMetrics(r.metrics)
+}
+
+// addValue records the value of a top-level expression.
+func (r *runReport) addValue(v golisp2.Value) {
+	r.Values = append(r.Values, valueJSON(v))
+}
+
+// valueJSON converts the value to JSON; or, if it can't be represented in
+// JSON, its inspected string.
+func valueJSON(v golisp2.Value) json.RawMessage {
+	data, err := golisp2.MarshalValueJSON(v)
+	if err != nil {
+		data, _ = json.Marshal(golisp2.InspectBounded(v, golisp2.DefaultInspectOptions))
+	}
+	return data
+}
+
+// finish fills in the parts of the report that are known once the run is done.
+func (r *runReport) finish(start time.Time, startAlloc uint64, err error) {
+	r.Output = r.output.String()
+	var ds []golisp2.Diagnostic
+	if r.ec != nil {
+		ds = r.ec.Diagnostics().All()
+	}
+	for _, d := range ds {
+		r.Diagnostics = append(r.Diagnostics, reportDiagnostic{
+			Severity: d.Severity.String(),
+			Msg:      d.Msg,
+			File:     d.Pos.SourceFile,
+			Line:     d.Pos.Row,
+			Col:      d.Pos.Col,
+		})
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Stats = reportStats{
+		DurationMs:   float64(time.Since(start)) / float64(time.Millisecond),
+		BuiltinCalls: atomic.LoadInt64(&r.metrics.builtinCalls),
+		AllocBytes:   totalAlloc() - startAlloc,
+	}
+}
+
+// write outputs the report as indented JSON.
+func (r *runReport) write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// totalAlloc returns the total bytes allocated by the process so far.
+func totalAlloc() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.TotalAlloc
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_runReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	run := func(src string, keepGoing bool) (map[string]interface{}, error) {
+		file := filepath.Join(dir, "script.l")
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		report := newRunReport(file)
+		runErr := execFile(context.Background(), file, runOptions{
+			keepGoing: keepGoing,
+			report:    report,
+		})
+		var out strings.Builder
+		require.NoError(t, report.write(&out))
+		decoded := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(out.String()), &decoded))
+		return decoded, runErr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		report, err := run(`(print "hi") (+ 1 2) (list 1 "a") (fn (a) a)`, false)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{nil, 3.0, []interface{}{1.0, "a"}, "<func>"},
+			report["values"])
+		require.Equal(t, "\"hi\"\n", report["output"])
+		require.Empty(t, report["diagnostics"])
+		require.NotContains(t, report, "error")
+		stats := report["stats"].(map[string]interface{})
+		require.Equal(t, 2.0, stats["builtinCalls"])
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		report, err := run(`(print 1) (car 1) (print 2)`, false)
+		require.Error(t, err)
+		require.Equal(t, []interface{}{nil}, report["values"])
+		require.Equal(t, "1\n", report["output"])
+		require.Contains(t, report["error"], "Execution error")
+	})
+
+	t.Run("keepGoing", func(t *testing.T) {
+		report, err := run(`(car 1) (print 1) (cdr 1) 2`, true)
+		require.Error(t, err)
+		require.Equal(t, []interface{}{nil, 2.0}, report["values"])
+		require.Equal(t, "1\n", report["output"])
+		require.Equal(t, 2, strings.Count(report["error"].(string), "Execution error"))
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+// isTestFile returns whether the file holds script tests.
+func isTestFile(name string) bool {
+	return strings.HasSuffix(name, "_test.gl") || strings.HasSuffix(name, "_test.l")
+}
+
+// findTestFiles returns the test files in each of the paths. Directories are
+// searched recursively; files are used as-is.
+func findTestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && isTestFile(info.Name()) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// testFiles runs the script tests in each of the paths, writing a line for each
+// test and a summary to out. Returns false if any test failed, or a file could
+// not be run.
+func testFiles(out io.Writer, paths []string) bool {
+	files, err := findTestFiles(paths)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	passed, failed := 0, 0
+	for _, file := range files {
+		results, err := testFile(file)
+		if err != nil {
+			fmt.Fprintf(out, "FAIL %s: %s\n", file, err)
+			failed++
+			continue
+		}
+		for _, r := range results {
+			pos := fmt.Sprintf("%s:%d", r.Pos.SourceFile, r.Pos.Row)
+			if r.Err != nil {
+				fmt.Fprintf(out, "FAIL %s (%s)\n    %s\n", r.Name, pos,
+					strings.Replace(r.Err.Error(), "\n", "\n    ", -1))
+				failed++
+			} else {
+				fmt.Fprintf(out, "PASS %s (%s)\n", r.Name, pos)
+				passed++
+			}
+		}
+	}
+	fmt.Fprintf(out, "\n%d passed, %d failed\n", passed, failed)
+	return failed == 0
+}
+
+// testFile runs the tests declared in the file.
+func testFile(file string) ([]golisp2.ScriptTestResult, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rs := golisp2.NewRuneScanner(file, f)
+	exprs, err := golisp2.ParseTokens(golisp2.NewTokenScanner(rs))
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	results, err := golisp2.RunScriptTests(exprs, func() *golisp2.EvalContext {
+		return golisp2.BuiltinContext().SubContext(nil)
+	})
+	if err != nil {
+		return nil, rs.Quote(err)
+	}
+	for _, r := range results {
+		rs.Quote(r.Err)
+	}
+	return results, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_testFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, src string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(src), 0644))
+		return file
+	}
+	write("math_test.gl", "(deftest adds (assertEq (+ 1 2) 3))")
+	nested := write("nested/more_test.l",
+		"(deftest ok (assertTrue true))\n(deftest broken\n  (assertEq 1 2))")
+	write("helpers.gl", "(car 1 2)")
+
+	var out strings.Builder
+	require.True(t, testFiles(&out, []string{filepath.Join(dir, "math_test.gl")}))
+	require.Contains(t, out.String(), "PASS adds")
+	require.Contains(t, out.String(), "1 passed, 0 failed")
+
+	out.Reset()
+	require.False(t, testFiles(&out, []string{dir}))
+	require.Contains(t, out.String(), "PASS ok ("+nested+":1)")
+	require.Contains(t, out.String(), "FAIL broken ("+nested+":2)")
+	require.Contains(t, out.String(), "assertion failed: expected 2; got 1")
+	require.Contains(t, out.String(), "2 passed, 1 failed")
+	require.NotContains(t, out.String(), "helpers.gl")
+}
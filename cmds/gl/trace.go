@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+)
+
+// traceInspectOptions limits how much of each value a call trace shows.
+var traceInspectOptions = golisp2.InspectOptions{MaxDepth: 2, MaxLen: 5}
+
+// callTracer is an eval hook that writes each function call and its result,
+// indented by how deeply nested the call is. Calls from tail position are
+// marked as such.
+type callTracer struct {
+	golisp2.NopEvalHook
+
+	out       io.Writer
+	depth     int
+	tailCalls map[golisp2.ScannerPosition]bool
+}
+
+func newCallTracer(out io.Writer) *callTracer {
+	return &callTracer{
+		out:       out,
+		tailCalls: map[golisp2.ScannerPosition]bool{},
+	}
+}
+
+// MarkTailCalls records that the calls are in tail position.
+func (ct *callTracer) MarkTailCalls(calls []*golisp2.CallExpr) {
+	for _, ce := range calls {
+		ct.tailCalls[ce.Pos] = true
+	}
+}
+
+func (ct *callTracer) OnCall(
+	fn *golisp2.FuncValue, args []golisp2.Value, pos golisp2.ScannerPosition,
+) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	var sb strings.Builder
+	sb.WriteString("(" + name)
+	for _, arg := range args {
+		sb.WriteString(" " + golisp2.InspectBounded(arg, traceInspectOptions))
+	}
+	sb.WriteString(")")
+	tail := ""
+	if ct.tailCalls[pos] {
+		tail = ", tail call"
+	}
+	fmt.Fprintf(ct.out, "%s%s ; line %d%s\n", ct.indent(), sb.String(), pos.Row, tail)
+	ct.depth++
+}
+
+func (ct *callTracer) OnReturn(
+	fn *golisp2.FuncValue, v golisp2.Value, err error,
+) {
+	ct.depth--
+	if err != nil {
+		fmt.Fprintf(ct.out, "%s! %s\n", ct.indent(), firstLine(err.Error()))
+		return
+	}
+	fmt.Fprintf(ct.out, "%s=> %s\n", ct.indent(),
+		golisp2.InspectBounded(v, traceInspectOptions))
+}
+
+func (ct *callTracer) indent() string {
+	return strings.Repeat("  ", ct.depth)
+}
+
+// firstLine returns the text up to the first newline.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_callTracer(t *testing.T) {
+	var out strings.Builder
+	ec := golisp2.BuiltinContext().SubContext(nil)
+	ec.SetEvalHook(newCallTracer(&out))
+	exprs, err := golisp2.ParseTokens(golisp2.NewTokenScanner(golisp2.NewRuneScanner(
+		"trace.l", strings.NewReader("(defun f (n) (+ n 1))\n(f (car (cons 1 2)))\n(car 1)"))))
+	require.NoError(t, err)
+	for _, e := range exprs {
+		e.Eval(ec)
+	}
+	require.Equal(t, strings.Join([]string{
+		"(cons 1 2) ; line 2",
+		"=> (1 . 2)",
+		"(car (1 . 2)) ; line 2",
+		"=> 1",
+		"(f 1) ; line 2",
+		"  (+ 1 1) ; line 1",
+		"  => 2",
+		"=> 2",
+		"(car 1) ; line 3",
+		"! ArgMapper: type error - expected cell, got *golisp2.NumberValue",
+		"",
+	}, "\n"), out.String())
+}
+
+func Test_callTracerTailCalls(t *testing.T) {
+	var out strings.Builder
+	tracer := newCallTracer(&out)
+	ec := golisp2.BuiltinContext().SubContext(nil)
+	ec.SetEvalHook(tracer)
+	exprs, err := golisp2.ParseTokens(golisp2.NewTokenScanner(golisp2.NewRuneScanner(
+		"trace.l", strings.NewReader("(defun f (n) (if (< n 1) 0 (f (- n 1))))\n(f 1)"))))
+	require.NoError(t, err)
+	tracer.MarkTailCalls(golisp2.TailCalls(exprs))
+	for _, e := range exprs {
+		e.Eval(ec)
+	}
+	require.Contains(t, out.String(), "(f 1) ; line 2\n")
+	require.Contains(t, out.String(), "  (f 0) ; line 1, tail call\n")
+	require.Contains(t, out.String(), "  (< 1 1) ; line 1\n")
+}
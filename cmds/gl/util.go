@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
 )
 
+// shutdownTimeout is how long scripts' shutdown handlers have to finish.
+const shutdownTimeout = 5 * time.Second
+
 func RootContext() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -25,10 +33,11 @@ func RootContext() (context.Context, context.CancelFunc) {
 		}
 		cancel()
 
-		// will force-exit and dump goroutine trace if it doesn't quickly shut down.
-		// Note that this is in a goroutine - if the main routine halts while this
-		// is sleeping, the program will exit before the sleep completes.
-		time.Sleep(1 * time.Second)
+		// will force-exit and dump goroutine trace if it doesn't quickly shut down;
+		// allowing time for the script's shutdown handlers. Note that this is in a
+		// goroutine - if the main routine halts while this is sleeping, the
+		// program will exit before the sleep completes.
+		time.Sleep(shutdownTimeout + 1*time.Second)
 		buf := make([]byte, 1<<20)
 		stacklen := runtime.Stack(buf, true)
 		log.Printf("=== received SIGQUIT ===\n*** goroutine dump...\n%s\n*** end\n", buf[:stacklen])
@@ -37,3 +46,154 @@ func RootContext() (context.Context, context.CancelFunc) {
 
 	return ctx, cancel
 }
+
+// splitList splits a comma-separated flag value, ignoring empty elements.
+func splitList(s string) []string {
+	var vals []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// missingPermissions returns the permissions requested by the manifest that
+// are not in the allowed set.
+func missingPermissions(m golisp2.Manifest, allowed []string) []string {
+	allowedSet := map[string]bool{}
+	for _, a := range allowed {
+		allowedSet[a] = true
+	}
+	var missing []string
+	for _, p := range m.Permissions {
+		if !allowedSet[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// undeclaredCapabilities returns the capabilities the program may use that
+// its manifest doesn't request. Scripts whose manifest doesn't list any
+// permissions aren't checked; they predate them.
+func undeclaredCapabilities(prog *golisp2.Program) []string {
+	if _, hasPerms := prog.Manifest.Raw["permissions"]; !hasPerms {
+		return nil
+	}
+	declared := map[string]bool{}
+	for _, p := range prog.Manifest.Permissions {
+		declared[p] = true
+	}
+	var undeclared []string
+	for _, c := range golisp2.RequiredCapabilities(prog.Exprs) {
+		if !declared[c] {
+			undeclared = append(undeclared, c)
+		}
+	}
+	return undeclared
+}
+
+// printCapabilities writes the capabilities the scripts in the files may use
+// to out, one per line.
+func printCapabilities(out io.Writer, files []string) error {
+	var exprs []golisp2.Expr
+	for _, file := range files {
+		prog, err := parseFile(file)
+		if err != nil {
+			return err
+		}
+		exprs = append(exprs, prog.Exprs...)
+	}
+	for _, c := range golisp2.RequiredCapabilities(exprs) {
+		fmt.Fprintln(out, c)
+	}
+	return nil
+}
+
+// parseFile reads and parses the script in the file.
+func parseFile(file string) (*golisp2.Program, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read file '%s': %w", file, err)
+	}
+	defer f.Close()
+	return readProgram(file, f, nil)
+}
+
+// readProgram parses the script read from src, or loads it if it was compiled
+// (see compileFile). name is the file it was read from. The source is retained
+// in sources, if set, so errors running it can quote it.
+func readProgram(
+	name string, src io.Reader, sources *golisp2.SourceRegistry,
+) (*golisp2.Program, error) {
+	if strings.HasSuffix(name, golisp2.CompiledExt) {
+		prog, err := golisp2.ReadCompiled(src)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load '%s': %w", name, err)
+		}
+		return prog, nil
+	}
+	rs := golisp2.NewRuneScanner(name, src)
+	rs.SetSourceRegistry(sources)
+	prog, err := golisp2.ParseProgram(golisp2.NewTokenScanner(rs))
+	if err != nil {
+		return nil, fmt.Errorf("Parse error in '%s': %w", name, err)
+	}
+	return prog, nil
+}
+
+// loadCheckpoint reads a run's progress from the given file.
+func loadCheckpoint(file string) (*golisp2.Checkpoint, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read checkpoint '%s': %w", file, err)
+	}
+	defer f.Close()
+	return golisp2.LoadCheckpoint(f)
+}
+
+// saveCheckpoint writes the run's progress to the given file. It's written to
+// a temporary file first, so an interrupted save leaves the last checkpoint in
+// place.
+func saveCheckpoint(
+	file string, prog *golisp2.Program, ec *golisp2.EvalContext, next int,
+) error {
+	cp, err := golisp2.NewCheckpoint(prog, ec, next)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("Could not write checkpoint '%s': %w", file, err)
+	}
+	if err := cp.Save(f); err != nil {
+		f.Close()
+		return fmt.Errorf("Could not write checkpoint '%s': %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Could not write checkpoint '%s': %w", file, err)
+	}
+	return os.Rename(tmp, file)
+}
+
+// loadCassette reads an effect cassette from the given file.
+func loadCassette(file string) (*golisp2.Cassette, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read cassette '%s': %w", file, err)
+	}
+	defer f.Close()
+	return golisp2.LoadCassette(f)
+}
+
+// saveCassette writes an effect cassette to the given file.
+func saveCassette(file string, c *golisp2.Cassette) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("Could not write cassette '%s': %w", file, err)
+	}
+	defer f.Close()
+	return c.Save(f)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_capabilities(t *testing.T) {
+	parse := func(t *testing.T, src string) *golisp2.Program {
+		t.Helper()
+		prog, err := golisp2.ParseProgram(golisp2.NewTokenScanner(
+			golisp2.NewRuneScanner("testfile", strings.NewReader(src))))
+		require.NoError(t, err)
+		return prog
+	}
+
+	t.Run("undeclared", func(t *testing.T) {
+		require.Empty(t, undeclaredCapabilities(parse(t, `(readFile "a")`)))
+		require.Empty(t, undeclaredCapabilities(parse(t,
+			";; gl: {\"permissions\": [\"file\"]}\n(readFile \"a\")")))
+		require.Equal(t, []string{"exec"}, undeclaredCapabilities(parse(t,
+			";; gl: {\"permissions\": [\"file\"]}\n(exec \"ls\" (readFile \"a\"))")))
+	})
+
+	t.Run("print", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "caps")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "script.l")
+		require.NoError(t, ioutil.WriteFile(file,
+			[]byte(`(httpGet (getEnv "URL"))`), 0644))
+		other := filepath.Join(dir, "other.l")
+		require.NoError(t, ioutil.WriteFile(other,
+			[]byte(`(getEnv "HOME")`), 0644))
+
+		var out strings.Builder
+		require.NoError(t, printCapabilities(&out, []string{file, other}))
+		require.Equal(t, "env\nnet\n", out.String())
+	})
+}
@@ -0,0 +1,86 @@
+package golisp2
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// CompiledExt is the extension of files written by WriteCompiled.
+const CompiledExt = ".glc"
+
+const (
+	// compiledFormat marks a stream as a compiled program.
+	compiledFormat = "golisp-compiled"
+
+	// compiledVersion is the version of the compiled format. It must be changed
+	// whenever the encoding of expressions is.
+	compiledVersion = 1
+)
+
+// compiledProgram is a program as it's written by WriteCompiled.
+type compiledProgram struct {
+	Format  string
+	Version int
+
+	// Manifest is the manifest's raw header fields, as JSON.
+	Manifest []byte
+
+	Exprs []*exprNode
+}
+
+// WriteCompiled writes the parsed program in a binary form, that ReadCompiled
+// can load without scanning or parsing the source again. The source itself
+// isn't included; errors from a loaded program still report positions, but
+// can't quote the lines they occur on.
+func (p *Program) WriteCompiled(w io.Writer) error {
+	nodes, err := exprsToNodes(p.Exprs)
+	if err != nil {
+		return fmt.Errorf("cannot compile program: %w", err)
+	}
+	manifest, err := json.Marshal(p.Manifest.Raw)
+	if err != nil {
+		return fmt.Errorf("cannot compile manifest: %w", err)
+	}
+	return gob.NewEncoder(w).Encode(compiledProgram{
+		Format:   compiledFormat,
+		Version:  compiledVersion,
+		Manifest: manifest,
+		Exprs:    nodes,
+	})
+}
+
+// ReadCompiled loads a program written by WriteCompiled. Returns an error if
+// the data isn't a compiled program, or was written by an incompatible version.
+func ReadCompiled(r io.Reader) (*Program, error) {
+	var cp compiledProgram
+	if err := gob.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("invalid compiled program: %w", err)
+	}
+	if cp.Format != compiledFormat {
+		return nil, fmt.Errorf("invalid compiled program: unrecognized format")
+	}
+	if cp.Version != compiledVersion {
+		return nil, fmt.Errorf(
+			"compiled program is version %d; expected %d; recompile it",
+			cp.Version, compiledVersion)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(cp.Manifest, &raw); err != nil {
+		return nil, fmt.Errorf("invalid compiled manifest: %w", err)
+	}
+	manifest, err := manifestFromRaw(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compiled manifest: %w", err)
+	}
+	exprs, err := nodesToExprs(cp.Exprs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compiled program: %w", err)
+	}
+	resolveLexical(exprs)
+	return &Program{
+		Manifest: manifest,
+		Exprs:    exprs,
+	}, nil
+}
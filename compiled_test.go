@@ -0,0 +1,82 @@
+package golisp2
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_compiled(t *testing.T) {
+	parse := func(t *testing.T, src string) *Program {
+		prog, err := ParseProgram(
+			NewTokenScanner(NewRuneScanner("compiled.l", strings.NewReader(src))))
+		require.NoError(t, err)
+		return prog
+	}
+	roundTrip := func(t *testing.T, prog *Program) *Program {
+		var buf bytes.Buffer
+		require.NoError(t, prog.WriteCompiled(&buf))
+		loaded, err := ReadCompiled(&buf)
+		require.NoError(t, err)
+		return loaded
+	}
+
+	t.Run("everyForm", func(t *testing.T) {
+		prog := parse(t, `;; gl: {"timeout": "5s", "author": "me"}
+			(defstruct point x y)
+			(defgeneric describe (v))
+			(defmethod describe (v :number) "number")
+			(defmethod describe (v :any) "other")
+			(defun sum (a . rest) (+ a (len rest)))
+			(defun scaled (a :scale b) (* a (if (isNil b) 1 b)))
+			(let total 0)
+			(for (x (list 1 2 3)) (set! total (+ total x)))
+			(dotimes (i 2) (set! total (+ total i)))
+			(let n 0)
+			(while true
+				(set! n (+ n 1))
+				(when (< n 3) (continue))
+				(unless (< n 3) (break)))
+			(let* ((a 1) (b (+ a 1))) (letValues ((q r) (divmod 7 2)) (list a b q r)))
+			(let early ((fn () (return 5) 6)))
+			(let o (object (map "inc" (fn (self v) (+ v 1)))))
+			(deftest "sums" (sum 1 2))
+			(let failed (assertError (car 1 2)))
+			(let ch (go (+ 1 2)))
+			(let t (time (- 3 1)))
+			(list
+				total n early (: o inc 1) (describe 1) (describe "s")
+				(cond ((> n 5) :big) (else nil))
+				(sum 1 2 3) (scaled 2 :scale 3) (point-x (point 1 2)) failed (recv ch) t (/ 6 2)
+				(>= 1 1) (<= 1 1) (== 1 1))
+		`)
+		loaded := roundTrip(t, prog)
+
+		require.Equal(t, prog.Manifest, loaded.Manifest)
+		require.Equal(t, len(prog.Exprs), len(loaded.Exprs))
+		for i := range prog.Exprs {
+			require.Equal(t, prog.Exprs[i].CodeStr(), loaded.Exprs[i].CodeStr())
+			require.Equal(t, prog.Exprs[i].SourceSpan(), loaded.Exprs[i].SourceSpan())
+		}
+
+		expected, err := prog.Eval(BuiltinContext().SubContext(nil))
+		require.NoError(t, err)
+		actual, err := loaded.Eval(BuiltinContext().SubContext(nil))
+		require.NoError(t, err)
+		require.Equal(t, expected.InspectStr(), actual.InspectStr())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ReadCompiled(strings.NewReader("(+ 1 2)"))
+		require.Error(t, err)
+
+		prog := &Program{Exprs: []Expr{
+			NewFuncLiteral("custom", func(*EvalContext, ...Value) (Value, error) {
+				return &NilValue{}, nil
+			}),
+		}}
+		require.Error(t, prog.WriteCompiled(&bytes.Buffer{}))
+	})
+}
@@ -0,0 +1,246 @@
+package golisp2
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Concurrency built-ins. Goroutines are started with go expressions (see
+// GoExpr), and communicate over channels. Blocking operations are halted when
+// the context is cancelled.
+
+// newChanValue creates an open channel that buffers up to size values.
+func newChanValue(size int) *ChanValue {
+	return &ChanValue{
+		ch:   make(chan Value, size),
+		done: make(chan struct{}),
+	}
+}
+
+// closeWithErr closes the channel. If err is set, receiving from the channel
+// once it's drained fails with it. Closing an already closed channel does
+// nothing.
+func (cv *ChanValue) closeWithErr(err error) {
+	cv.closeOnce.Do(func() {
+		cv.err = err
+		close(cv.done)
+	})
+}
+
+// chanFn creates a channel. It's unbuffered unless given a size.
+func chanFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var maybeSize Value
+	err := ArgMapperValues(vals...).
+		MaybeReadValue(&maybeSize).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	if maybeSize != nil {
+		asNum, isNum := maybeSize.(*NumberValue)
+		if !isNum || asNum.Val < 0 || asNum.Val != float64(int(asNum.Val)) {
+			return nil, fmt.Errorf("chan size must be a non-negative whole number")
+		}
+		size = int(asNum.Val)
+	}
+	return newChanValue(size), nil
+}
+
+// sendFn sends the value on the channel, blocking until it's received or
+// buffered. Fails if the channel is closed.
+func sendFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var chV, v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&chV).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := asChan("send", chV)
+	if err != nil {
+		return nil, err
+	}
+	// ch.ch is never closed, so sending can't panic. A send racing
+	// with a close may still succeed; the value can be received before the
+	// channel reports it's closed.
+	select {
+	case <-ch.done:
+		return nil, &EvalError{
+			Msg: "send on closed channel",
+			Pos: ec.CallPos(),
+		}
+	default:
+	}
+	select {
+	case ch.ch <- v:
+		return Nil, nil
+	case <-ch.done:
+		return nil, &EvalError{
+			Msg: "send on closed channel",
+			Pos: ec.CallPos(),
+		}
+	case <-ec.Context().Done():
+		return nil, checkHalted(ec, ec.CallPos())
+	}
+}
+
+// recvFn receives the next value from the channel, blocking until there is
+// one. Once the channel is closed and drained, returns nil; or, if it was
+// closed by a failed go expression, its error.
+func recvFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := asChan("recv", v)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case v := <-ch.ch:
+		return v, nil
+	case <-ch.done:
+		// values may still be buffered.
+		select {
+		case v := <-ch.ch:
+			return v, nil
+		default:
+		}
+		if ch.err != nil {
+			return nil, ch.err
+		}
+		return Nil, nil
+	case <-ec.Context().Done():
+		return nil, checkHalted(ec, ec.CallPos())
+	}
+}
+
+// chanCloseFn closes the channel: further sends fail, and receives return nil
+// once it's drained.
+func chanCloseFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := asChan("chanClose", v)
+	if err != nil {
+		return nil, err
+	}
+	ch.closeWithErr(nil)
+	return Nil, nil
+}
+
+// asChan returns the value as a channel, or an error naming the builtin if it
+// isn't one.
+func asChan(fnName string, v Value) (*ChanValue, error) {
+	asChan, isChan := v.(*ChanValue)
+	if !isChan {
+		return nil, fmt.Errorf("%s expects a chan; got %s", fnName, TypeName(v))
+	}
+	return asChan, nil
+}
+
+// waitGroupFn creates a wait group with a counter of zero.
+func waitGroupFn(ec *EvalContext, vals ...Value) (Value, error) {
+	err := ArgMapperValues(vals...).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	return &WaitGroupValue{}, nil
+}
+
+// waitGroupAddFn adds n, or 1 if not given, to the wait group's counter.
+func waitGroupAddFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v, maybeN Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		MaybeReadValue(&maybeN).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	wg, err := asWaitGroup("waitGroupAdd", v)
+	if err != nil {
+		return nil, err
+	}
+	n := 1
+	if maybeN != nil {
+		asNum, isNum := maybeN.(*NumberValue)
+		if !isNum || asNum.Val < 1 || asNum.Val != float64(int(asNum.Val)) {
+			return nil, fmt.Errorf("waitGroupAdd n must be a positive whole number")
+		}
+		n = int(asNum.Val)
+	}
+	atomic.AddInt64(&wg.count, int64(n))
+	wg.wg.Add(n)
+	return Nil, nil
+}
+
+// waitGroupDoneFn decrements the wait group's counter.
+func waitGroupDoneFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	wg, err := asWaitGroup("waitGroupDone", v)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.AddInt64(&wg.count, -1) < 0 {
+		atomic.AddInt64(&wg.count, 1)
+		return nil, &EvalError{
+			Msg: "waitGroupDone called more times than waitGroupAdd",
+			Pos: ec.CallPos(),
+		}
+	}
+	wg.wg.Done()
+	return Nil, nil
+}
+
+// waitGroupWaitFn blocks until the wait group's counter is zero.
+func waitGroupWaitFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	wg, err := asWaitGroup("waitGroupWait", v)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return Nil, nil
+	case <-ec.Context().Done():
+		return nil, checkHalted(ec, ec.CallPos())
+	}
+}
+
+// asWaitGroup returns the value as a wait group, or an error naming the builtin
+// if it isn't one.
+func asWaitGroup(fnName string, v Value) (*WaitGroupValue, error) {
+	asWG, isWG := v.(*WaitGroupValue)
+	if !isWG {
+		return nil, fmt.Errorf("%s expects a waitGroup; got %s", fnName, TypeName(v))
+	}
+	return asWG, nil
+}
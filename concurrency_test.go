@@ -0,0 +1,76 @@
+package golisp2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_concurrency(t *testing.T) {
+
+	t.Run("go", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(recv (go (+ 1 2)))`), 3)
+
+		err := evalStrToErr(t, `(recv (go (car 1)))`)
+		require.Contains(t, err.Error(), "expected cell")
+
+		parseStrToErr(t, `(go)`)
+		parseStrToErr(t, `(go 1 2)`)
+	})
+
+	t.Run("chan", func(t *testing.T) {
+		ec := BuiltinContext()
+		evalStrInContext(t, ec, `
+(let ch (chan))
+(let out (chan 3))
+(let wg (waitGroup))
+(dotimes (i 3)
+  (waitGroupAdd wg)
+  (go (let ((v (recv ch)))
+        (send out (* v 10))
+        (waitGroupDone wg))))
+(dotimes (i 3) (send ch i))
+(waitGroupWait wg)
+(chanClose out)`)
+		assertNumValue(t, evalStrInContext(t, ec,
+			`(+ (recv out) (recv out) (recv out))`), 30)
+		assertNilValue(t, evalStrInContext(t, ec, `(recv out)`))
+		evalStrInContextToErr(t, ec, `(send out 1)`)
+		assertBoolValue(t, evalStrInContext(t, ec, `(isChan ch)`), true)
+		assertStringValue(t, evalStrInContext(t, ec, `(typeOf wg)`), "waitGroup")
+	})
+
+	t.Run("sharedBindings", func(t *testing.T) {
+		ec := BuiltinContext()
+		evalStrInContext(t, ec, `
+(let total 0)
+(let wg (waitGroup))
+(waitGroupAdd wg 20)
+(dotimes (i 20)
+  (go (let ((r (random)))
+        (set! total (+ total 1))
+        (waitGroupDone wg))))
+(waitGroupWait wg)`)
+		v, _ := ec.Resolve("total")
+		require.IsType(t, (*NumberValue)(nil), v)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		evalStrToErr(t, `(chan -1)`)
+		evalStrToErr(t, `(send 1 2)`)
+		evalStrToErr(t, `(recv (list))`)
+		evalStrToErr(t, `(waitGroupDone (waitGroup))`)
+		evalStrToErr(t, `(waitGroupAdd (waitGroup) 0)`)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ec := BuiltinContext()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		ec.SetContext(ctx)
+		err := evalStrInContextToErr(t, ec, `(recv (chan))`)
+		require.IsType(t, (*EvalError)(nil), err)
+	})
+}
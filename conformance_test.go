@@ -0,0 +1,128 @@
+package golisp2
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// updateConformance rewrites the expected output of each conformance case
+// from the tree-walking backend.
+var updateConformance = flag.Bool("update-conformance", false,
+	"Rewrites the expected conformance outputs")
+
+// conformanceBackend is a way of evaluating programs. Every backend must
+// produce the same output for each of the conformance cases.
+type conformanceBackend struct {
+	name string
+
+	// run evaluates the source in the context, and returns its last value.
+	run func(ec *EvalContext, name, src string) (Value, error)
+}
+
+// conformanceBackends are the evaluation strategies under test. A new backend
+// (e.g. a bytecode VM) is covered by adding it here.
+var conformanceBackends = []conformanceBackend{
+	{
+		name: "tree",
+		run: func(ec *EvalContext, name, src string) (Value, error) {
+			prog, err := ParseProgram(NewTokenScanner(NewRuneScanner(name, strings.NewReader(src))))
+			if err != nil {
+				return nil, err
+			}
+			return prog.Eval(ec)
+		},
+	},
+	{
+		name: "interpreter",
+		run: func(ec *EvalContext, name, src string) (Value, error) {
+			return NewInterpreter(ec).Run(strings.NewReader(src))
+		},
+	},
+	{
+		name: "compiled",
+		run: func(ec *EvalContext, name, src string) (Value, error) {
+			prog, err := ParseProgram(NewTokenScanner(NewRuneScanner(name, strings.NewReader(src))))
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			if err := prog.WriteCompiled(&buf); err != nil {
+				return nil, err
+			}
+			if prog, err = ReadCompiled(&buf); err != nil {
+				return nil, err
+			}
+			return prog.Eval(ec)
+		},
+	},
+	{
+		name: "json",
+		run: func(ec *EvalContext, name, src string) (Value, error) {
+			prog, err := ParseProgram(NewTokenScanner(NewRuneScanner(name, strings.NewReader(src))))
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(prog)
+			if err != nil {
+				return nil, err
+			}
+			loaded := &Program{}
+			if err := json.Unmarshal(data, loaded); err != nil {
+				return nil, err
+			}
+			return loaded.Eval(ec)
+		},
+	},
+}
+
+// runConformanceCase evaluates the case with the backend, and returns what it
+// printed, followed by a line with its value; or "error" if it failed.
+func runConformanceCase(b conformanceBackend, name, src string) string {
+	var out bytes.Buffer
+	ec := BuiltinContext().SubContext(nil)
+	ec.SetStdout(&out)
+	ec.SetDeterministic(1, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	v, err := b.run(ec, name, src)
+	if err != nil {
+		io.WriteString(&out, "=> error\n")
+	} else {
+		fmt.Fprintf(&out, "=> %s\n", v.InspectStr())
+	}
+	return out.String()
+}
+
+// Test_conformance runs each case in testdata/conformance against every
+// backend, and checks the output matches the case's .out file.
+func Test_conformance(t *testing.T) {
+	cases, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.l"))
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	for _, file := range cases {
+		src, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		outFile := strings.TrimSuffix(file, ".l") + ".out"
+		if *updateConformance {
+			actual := runConformanceCase(conformanceBackends[0], file, string(src))
+			require.NoError(t, ioutil.WriteFile(outFile, []byte(actual), 0644))
+		}
+		expected, err := ioutil.ReadFile(outFile)
+		require.NoError(t, err)
+
+		for _, b := range conformanceBackends {
+			t.Run(filepath.Base(file)+"/"+b.name, func(t *testing.T) {
+				require.Equal(t, string(expected), runConformanceCase(b, file, string(src)))
+			})
+		}
+	}
+}
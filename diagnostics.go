@@ -0,0 +1,92 @@
+package golisp2
+
+import (
+	"fmt"
+	"sync"
+)
+
+type (
+	// DiagnosticSeverity indicates how serious a diagnostic is. Note that
+	// diagnostics are never fatal; failures are always reported as errors.
+	DiagnosticSeverity int
+
+	// Diagnostic is a non-fatal notice about a script, such as the use of a
+	// deprecated builtin or a likely mistake.
+	Diagnostic struct {
+		Severity DiagnosticSeverity
+		Msg      string
+		Pos      ScannerPosition
+	}
+
+	// Diagnostics collects diagnostics raised while parsing or evaluating. It is
+	// safe for concurrent use.
+	Diagnostics struct {
+		mu    sync.Mutex
+		items []Diagnostic
+	}
+)
+
+const (
+	// WarningSeverity marks a diagnostic as a warning: something is likely
+	// wrong, but execution can continue.
+	WarningSeverity DiagnosticSeverity = iota
+
+	// InfoSeverity marks a diagnostic as purely informational.
+	InfoSeverity
+)
+
+// String returns a human readable name for the severity.
+func (ds DiagnosticSeverity) String() string {
+	switch ds {
+	case WarningSeverity:
+		return "Warning"
+	case InfoSeverity:
+		return "Info"
+	default:
+		return fmt.Sprintf("<unknown severity %d>", ds)
+	}
+}
+
+// String returns a human readable description of the diagnostic.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s ('%s' line %d, col %d)",
+		d.Severity, d.Msg, d.Pos.SourceFile, d.Pos.Row, d.Pos.Col)
+}
+
+// NewDiagnostics creates an empty diagnostic collector.
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
+
+// Add appends the diagnostic to the collection.
+func (ds *Diagnostics) Add(d Diagnostic) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.items = append(ds.items, d)
+}
+
+// Warn appends a warning with the given message and position.
+func (ds *Diagnostics) Warn(msg string, pos ScannerPosition) {
+	ds.Add(Diagnostic{
+		Severity: WarningSeverity,
+		Msg:      msg,
+		Pos:      pos,
+	})
+}
+
+// All returns a copy of every diagnostic collected so far, in the order they
+// were added.
+func (ds *Diagnostics) All() []Diagnostic {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	all := make([]Diagnostic, len(ds.items))
+	copy(all, ds.items)
+	return all
+}
+
+// Len returns the number of diagnostics collected so far.
+func (ds *Diagnostics) Len() int {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return len(ds.items)
+}
@@ -0,0 +1,70 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Diagnostics(t *testing.T) {
+
+	t.Run("collect", func(t *testing.T) {
+		ds := NewDiagnostics()
+		require.Equal(t, 0, ds.Len())
+		pos := ScannerPosition{SourceFile: "diag.l", Row: 2, Col: 3}
+		ds.Warn("something odd", pos)
+		ds.Add(Diagnostic{Severity: InfoSeverity, Msg: "fyi", Pos: pos})
+
+		all := ds.All()
+		require.Equal(t, 2, len(all))
+		require.Equal(t, WarningSeverity, all[0].Severity)
+		require.Equal(t,
+			"Warning: something odd ('diag.l' line 2, col 3)", all[0].String())
+		require.Equal(t, "Info", all[1].Severity.String())
+	})
+
+	t.Run("sharedWithSubContexts", func(t *testing.T) {
+		ec := BuiltinContext()
+		ec.SubContext(nil).Diagnostics().Warn("sub", ScannerPosition{})
+		require.Equal(t, 1, ec.Diagnostics().Len())
+	})
+
+	t.Run("listGetTruncation", func(t *testing.T) {
+		ec := BuiltinContext()
+		assertNumValue(t, evalStrInContext(t, ec, `(listGet (list 1 2 3) 1.5)`), 2)
+		all := ec.Diagnostics().All()
+		require.Equal(t, 1, len(all))
+		require.Contains(t, all[0].Msg, "truncated")
+		require.Equal(t, 1, all[0].Pos.Row)
+		require.Equal(t, 1, all[0].Pos.Col)
+
+		evalStrInContext(t, ec, `(listGet (list 1 2 3) 1)`)
+		require.Equal(t, 1, ec.Diagnostics().Len())
+	})
+
+	t.Run("shadowedBuiltin", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, "(let x 1)\n(let list 2)\n(let list 3)")
+		all := ec.Diagnostics().All()
+		require.Equal(t, 1, len(all))
+		require.Contains(t, all[0].Msg, "'list'")
+		require.Equal(t, 2, all[0].Pos.Row)
+	})
+
+	t.Run("deprecatedFn", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(map[string]Value{
+			"oldAdd": NewDeprecatedFunc("oldAdd", addFn, Deprecation{
+				Notice:      "superseded by operators",
+				Replacement: "+",
+			}),
+		})
+		assertNumValue(t, evalStrInContext(t, ec, `(oldAdd 1 2)`), 3)
+		evalStrInContext(t, ec, "\n  (oldAdd 1 2)")
+		all := ec.Diagnostics().All()
+		require.Equal(t, 1, len(all))
+		require.Equal(t,
+			"'oldAdd' is deprecated: superseded by operators; use '+' instead",
+			all[0].Msg)
+		require.Equal(t, 1, all[0].Pos.Row)
+	})
+}
@@ -0,0 +1,271 @@
+package golisp2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+type (
+	// Document is a source file that is kept parsed as it is edited, such as one
+	// open in an editor. Edits only re-lex and re-parse the top-level
+	// expressions they touch, rather than the whole source.
+	//
+	// The source is split into spans: one per top-level expression, running
+	// from the start of the expression up to the start of the next one. A span
+	// that can't be parsed is kept as a single broken span with its error, and is
+	// re-parsed when an edit touches it.
+	Document struct {
+		srcName string
+		text    string
+		spans   []docSpan
+	}
+
+	// TextEdit replaces the text between the byte offsets Start and End with
+	// Text.
+	TextEdit struct {
+		Start, End int
+		Text       string
+	}
+
+	// docSpan is a region of a document. Exactly one of expr and err is set.
+	docSpan struct {
+		start ScannerPosition
+		expr  Expr
+		err   error
+	}
+)
+
+// NewDocument parses the source into a document.
+func NewDocument(srcName, text string) *Document {
+	d := &Document{
+		srcName: srcName,
+		text:    text,
+	}
+	d.spans = d.parseRegion(ScannerPosition{
+		SourceFile: srcName,
+		Row:        1,
+		Col:        1,
+	}, len(text))
+	return d
+}
+
+// Text returns the current text of the document.
+func (d *Document) Text() string {
+	return d.text
+}
+
+// Exprs returns the top-level expressions of the document that parsed
+// successfully.
+func (d *Document) Exprs() []Expr {
+	exprs := []Expr{}
+	for _, s := range d.spans {
+		if s.expr != nil {
+			exprs = append(exprs, s.expr)
+		}
+	}
+	return exprs
+}
+
+// Errors returns the parse errors in the document.
+func (d *Document) Errors() []error {
+	errs := []error{}
+	for _, s := range d.spans {
+		if s.err != nil {
+			errs = append(errs, s.err)
+		}
+	}
+	return errs
+}
+
+// Edit applies the edit to the document, and returns the updated expressions
+// and parse errors. Returns an error, and makes no change, if the edit is out
+// of range.
+func (d *Document) Edit(e TextEdit) ([]Expr, []error, error) {
+	if e.Start < 0 || e.End < e.Start || e.End > len(d.text) {
+		return nil, nil, fmt.Errorf(
+			"edit [%d, %d) out of range of document length %d",
+			e.Start, e.End, len(d.text))
+	}
+	oldText := d.text
+	d.text = oldText[:e.Start] + e.Text + oldText[e.End:]
+	delta := len(e.Text) - (e.End - e.Start)
+
+	if len(d.spans) == 0 {
+		d.spans = d.parseRegion(d.docStart(), len(d.text))
+		return d.Exprs(), d.Errors(), nil
+	}
+
+	// The edit affects every span it overlaps, including ones it only touches
+	// the edge of, as it could join their tokens. A comment or string opened by
+	// the edit runs to the end of the line, so spans that start on the rest of
+	// the line are affected too.
+	first, last := 0, 0
+	for i := range d.spans {
+		if d.spanEnd(i, oldText) >= e.Start {
+			first = i
+			break
+		}
+	}
+	lineEnd := strings.IndexByte(oldText[e.End:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(oldText)
+	} else {
+		lineEnd += e.End
+	}
+	for i := range d.spans {
+		if d.spans[i].start.Offset <= lineEnd {
+			last = i
+		}
+	}
+	if last < first {
+		last = first
+	}
+
+	start := d.spans[first].start
+	regionEnd := d.spanEnd(last, oldText) + delta
+	region := d.parseRegion(start, regionEnd)
+	if last < len(d.spans)-1 && isBroken(region) {
+		// an unbalanced paren may swallow the rest of the document, so
+		// try again with everything after the edit before giving up.
+		last = len(d.spans) - 1
+		regionEnd = len(d.text)
+		region = d.parseRegion(start, regionEnd)
+	}
+
+	rest := d.spans[last+1:]
+	if len(rest) > 0 {
+		rowDelta := strings.Count(e.Text, "\n") -
+			strings.Count(oldText[e.Start:e.End], "\n")
+		for i := range rest {
+			shiftSpan(&rest[i], rowDelta, delta)
+		}
+	}
+	spans := append([]docSpan{}, d.spans[:first]...)
+	spans = append(spans, region...)
+	d.spans = append(spans, rest...)
+	if len(d.spans) > 0 {
+		d.spans[0].start = d.docStart()
+	}
+	return d.Exprs(), d.Errors(), nil
+}
+
+// parseRegion parses the text of the document from the start position up to
+// the end offset into spans. If the region can't be parsed, it is returned as
+// a single broken span.
+func (d *Document) parseRegion(start ScannerPosition, end int) []docSpan {
+	rs := &RuneScanner{
+		buf:      bufio.NewReader(strings.NewReader(d.text[start.Offset:end])),
+		pos:      start,
+		offset:   start.Offset,
+		started:  start.Offset > 0,
+		tabWidth: 1,
+	}
+	// the scanner counts the column from the one before its first rune.
+	rs.pos.Col--
+	ts := NewTokenScanner(rs)
+	ts.Advance()
+
+	spans := []docSpan{}
+	for ts.Token() != nil {
+		spanStart := ts.Token().Pos
+		e, err := maybeParseExpr(ts)
+		if err == nil && e == nil {
+			err = NewParseError("unexpected close paren", *ts.Token())
+		}
+		if err != nil {
+			return []docSpan{{start: start, err: d.quote(err)}}
+		}
+		spans = append(spans, docSpan{start: spanStart, expr: e})
+	}
+	if ts.Err() != nil && !errors.Is(ts.Err(), io.EOF) {
+		return []docSpan{{start: start, err: d.quote(ts.Err())}}
+	}
+	if len(spans) > 0 {
+		spans[0].start = start
+	}
+	return spans
+}
+
+// spanEnd returns the offset that the span ends at in the given text.
+func (d *Document) spanEnd(i int, text string) int {
+	if i+1 < len(d.spans) {
+		return d.spans[i+1].start.Offset
+	}
+	return len(text)
+}
+
+// docStart returns the position of the start of the document.
+func (d *Document) docStart() ScannerPosition {
+	return ScannerPosition{
+		SourceFile: d.srcName,
+		Row:        1,
+		Col:        1,
+	}
+}
+
+// quote adds an excerpt of the document's current text to the error, where it
+// occurred.
+func (d *Document) quote(err error) error {
+	return quoteString(err, d.srcName, d.text)
+}
+
+// isBroken indicates if the spans are a region that failed to parse.
+func isBroken(spans []docSpan) bool {
+	return len(spans) == 1 && spans[0].err != nil
+}
+
+// shiftSpan moves every position in the span by the given number of rows and
+// bytes. Spans after an edit always start on a later line than it, so their
+// columns are unchanged.
+func shiftSpan(s *docSpan, rows, offset int) {
+	shift := func(pos *ScannerPosition) {
+		pos.Row += rows
+		pos.Offset += offset
+	}
+	shift(&s.start)
+	seen := map[uintptr]bool{}
+	shiftPositions(reflect.ValueOf(s.expr), shift, seen)
+	shiftPositions(reflect.ValueOf(s.err), shift, seen)
+}
+
+var scannerPositionType = reflect.TypeOf(ScannerPosition{})
+
+// shiftPositions applies shift to every ScannerPosition reachable from v.
+//
+// This relies on reflection so that every expression type doesn't
+// need to know how to move itself. If there's ever a general way to walk the
+// tree, this should use it instead.
+func shiftPositions(
+	v reflect.Value, shift func(*ScannerPosition), seen map[uintptr]bool,
+) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		shiftPositions(v.Elem(), shift, seen)
+	case reflect.Interface:
+		if !v.IsNil() {
+			shiftPositions(v.Elem(), shift, seen)
+		}
+	case reflect.Struct:
+		if v.Type() == scannerPositionType {
+			if v.CanAddr() && v.CanSet() {
+				shift(v.Addr().Interface().(*ScannerPosition))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			shiftPositions(v.Field(i), shift, seen)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			shiftPositions(v.Index(i), shift, seen)
+		}
+	}
+}
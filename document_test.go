@@ -0,0 +1,112 @@
+package golisp2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Document(t *testing.T) {
+	const srcName = "doc.l"
+
+	// positions collects every position in the expressions.
+	positions := func(exprs []Expr) []ScannerPosition {
+		ps := []ScannerPosition{}
+		shiftPositions(reflect.ValueOf(exprs), func(p *ScannerPosition) {
+			ps = append(ps, *p)
+		}, map[uintptr]bool{})
+		return ps
+	}
+
+	// requireReparsed checks the document matches a full parse of its text.
+	requireReparsed := func(t *testing.T, d *Document) {
+		full := NewDocument(srcName, d.Text())
+		require.Equal(t, len(full.Exprs()), len(d.Exprs()))
+		for i, e := range full.Exprs() {
+			require.Equal(t, e.CodeStr(), d.Exprs()[i].CodeStr())
+		}
+		require.Equal(t, positions(full.Exprs()), positions(d.Exprs()))
+		require.Equal(t, len(full.Errors()), len(d.Errors()))
+	}
+
+	// edit replaces the first occurrence of old in the document with new.
+	edit := func(t *testing.T, d *Document, old, new string) {
+		i := strings.Index(d.Text(), old)
+		require.True(t, i >= 0, "missing %q", old)
+		_, _, err := d.Edit(TextEdit{Start: i, End: i + len(old), Text: new})
+		require.NoError(t, err)
+	}
+
+	src := "(+ 1 2)\n(let a 3)\n\n(* a\n  2) ; done\n"
+
+	t.Run("replace", func(t *testing.T) {
+		d := NewDocument(srcName, src)
+		edit(t, d, "3", "40")
+		require.Contains(t, d.Exprs()[1].CodeStr(), "40.000000")
+		requireReparsed(t, d)
+		require.Equal(t, 20, d.Exprs()[2].SourcePos().Offset)
+	})
+
+	t.Run("newlines", func(t *testing.T) {
+		d := NewDocument(srcName, src)
+		edit(t, d, "(let a 3)", "(let a\n\n  3)")
+		requireReparsed(t, d)
+		require.Equal(t, 6, d.Exprs()[2].SourcePos().Row)
+
+		edit(t, d, "\n\n", "")
+		requireReparsed(t, d)
+	})
+
+	t.Run("joinTokens", func(t *testing.T) {
+		d := NewDocument(srcName, "a(b)")
+		exprs, errs, err := d.Edit(TextEdit{Start: 1, End: 1, Text: "x"})
+		require.NoError(t, err)
+		require.Empty(t, errs)
+		require.Len(t, exprs, 2)
+		requireReparsed(t, d)
+	})
+
+	t.Run("comment", func(t *testing.T) {
+		d := NewDocument(srcName, "a b\nc")
+		edit(t, d, "a", ";a")
+		require.Len(t, d.Exprs(), 1)
+		requireReparsed(t, d)
+	})
+
+	t.Run("brokenAndFixed", func(t *testing.T) {
+		d := NewDocument(srcName, src)
+		_, errs, err := d.Edit(TextEdit{Start: 0, End: 0, Text: "("})
+		require.NoError(t, err)
+		require.Len(t, errs, 1)
+		require.Empty(t, d.Exprs())
+
+		_, errs, err = d.Edit(TextEdit{Start: len(d.Text()), End: len(d.Text()), Text: ")"})
+		require.NoError(t, err)
+		require.Empty(t, errs)
+		require.Len(t, d.Exprs(), 1)
+		requireReparsed(t, d)
+	})
+
+	t.Run("emptyDocument", func(t *testing.T) {
+		d := NewDocument(srcName, "")
+		exprs, errs, err := d.Edit(TextEdit{Text: "(a)"})
+		require.NoError(t, err)
+		require.Empty(t, errs)
+		require.Len(t, exprs, 1)
+
+		exprs, _, err = d.Edit(TextEdit{Start: 0, End: 3})
+		require.NoError(t, err)
+		require.Empty(t, exprs)
+	})
+
+	t.Run("outOfRange", func(t *testing.T) {
+		d := NewDocument(srcName, src)
+		_, _, err := d.Edit(TextEdit{Start: 2, End: 1})
+		require.Error(t, err)
+		_, _, err = d.Edit(TextEdit{Start: 0, End: len(src) + 1})
+		require.Error(t, err)
+		require.Equal(t, src, d.Text())
+	})
+}
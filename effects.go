@@ -0,0 +1,201 @@
+package golisp2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type (
+	// Cassette is a recording of the calls made to effectful builtins (file
+	// reads, environment lookups, HTTP requests), along with their results. A
+	// cassette recorded from a real run can be replayed to run the same script
+	// hermetically.
+	Cassette struct {
+		Calls []CassetteCall `json:"calls"`
+
+		mu     sync.Mutex
+		played map[int]bool
+	}
+
+	// CassetteCall is a single recorded effect.
+	CassetteCall struct {
+		Fn     string          `json:"fn"`
+		Args   json.RawMessage `json:"args"`
+		Result json.RawMessage `json:"result,omitempty"`
+		Err    string          `json:"error,omitempty"`
+	}
+
+	// effectMode controls how effectful builtins behave.
+	effectMode int
+)
+
+const (
+	// liveEffects performs effects for real.
+	liveEffects effectMode = iota
+
+	// recordEffects performs effects for real, and records them to a cassette.
+	recordEffects
+
+	// replayEffects serves effects from a cassette, without performing them.
+	replayEffects
+)
+
+// NewCassette creates an empty cassette, ready for recording.
+func NewCassette() *Cassette {
+	return &Cassette{}
+}
+
+// LoadCassette reads a cassette previously written with Save.
+func LoadCassette(r io.Reader) (*Cassette, error) {
+	c := &Cassette{}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, fmt.Errorf("invalid cassette: %w", err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette as JSON.
+func (c *Cassette) Save(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// record appends the call and its outcome to the cassette.
+func (c *Cassette) record(fn string, args []byte, result Value, err error) error {
+	call := CassetteCall{
+		Fn:   fn,
+		Args: args,
+	}
+	if err != nil {
+		call.Err = err.Error()
+	} else {
+		resultJSON, marshalErr := MarshalValueJSON(result)
+		if marshalErr != nil {
+			return fmt.Errorf("cannot record result of '%s': %w", fn, marshalErr)
+		}
+		call.Result = resultJSON
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Calls = append(c.Calls, call)
+	return nil
+}
+
+// replay finds the first call with the same function and arguments that hasn't
+// yet been replayed, and returns its outcome.
+func (c *Cassette) replay(fn string, args []byte) (Value, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.played == nil {
+		c.played = map[int]bool{}
+	}
+	for i, call := range c.Calls {
+		if c.played[i] || call.Fn != fn || !sameJSON(call.Args, args) {
+			continue
+		}
+		c.played[i] = true
+		if call.Err != "" {
+			return nil, fmt.Errorf("%s", call.Err)
+		}
+		return UnmarshalValueJSON(call.Result)
+	}
+	return nil, fmt.Errorf("no recording of '%s' with args %s in cassette", fn, args)
+}
+
+// sameJSON checks if the two JSON documents are equal, ignoring whitespace.
+func sameJSON(a, b []byte) bool {
+	var aBuf, bBuf bytes.Buffer
+	if json.Compact(&aBuf, a) != nil || json.Compact(&bBuf, b) != nil {
+		return false
+	}
+	return bytes.Equal(aBuf.Bytes(), bBuf.Bytes())
+}
+
+// RecordEffects performs effectful builtin calls as normal, and records them
+// and their results to the cassette. This applies to all parent and sub
+// contexts.
+func (ec *EvalContext) RecordEffects(c *Cassette) {
+	env := ec.environ()
+	env.effectMode = recordEffects
+	env.cassette = c
+}
+
+// ReplayEffects serves effectful builtin calls from the cassette, rather than
+// performing them. Calls that weren't recorded will fail. This applies to all
+// parent and sub contexts.
+func (ec *EvalContext) ReplayEffects(c *Cassette) {
+	env := ec.environ()
+	env.effectMode = replayEffects
+	env.cassette = c
+}
+
+// SetDryRun makes write-effect builtins (writeFile, exec, httpPost) log what
+// they would do to the writer and return a synthetic success, rather than
+// performing the effect. A nil writer disables dry-run. This applies to all
+// parent and sub contexts.
+func (ec *EvalContext) SetDryRun(w io.Writer) {
+	ec.environ().dryRun = w
+}
+
+// DisableExec makes the builtins that run processes, exec and execPipe, fail.
+// It's meant for embedding scripts that shouldn't be able to run commands. This
+// applies to all parent and sub contexts.
+func (ec *EvalContext) DisableExec() {
+	ec.environ().execDisabled = true
+}
+
+// DryRun indicates if write effects are being logged rather than performed.
+func (ec *EvalContext) DryRun() bool {
+	return ec.environ().dryRun != nil
+}
+
+// replaying indicates if effects are being served from a cassette.
+func (ec *EvalContext) replaying() bool {
+	return ec.environ().effectMode == replayEffects
+}
+
+// effect performs an effectful operation on behalf of the named builtin,
+// recording or replaying it as configured.
+func (ec *EvalContext) effect(
+	fn string, args []Value, perform func() (Value, error),
+) (Value, error) {
+	env := ec.environ()
+	if env.effectMode == liveEffects {
+		return perform()
+	}
+
+	argsJSON, argsErr := MarshalValueJSON(&ListValue{Vals: args})
+	if argsErr != nil {
+		return nil, fmt.Errorf("cannot record args of '%s': %w", fn, argsErr)
+	}
+	if env.effectMode == replayEffects {
+		return env.cassette.replay(fn, argsJSON)
+	}
+
+	v, err := perform()
+	if recordErr := env.cassette.record(fn, argsJSON, v, err); recordErr != nil {
+		return nil, recordErr
+	}
+	return v, err
+}
+
+// writeEffect performs an effect that changes the outside world on behalf of
+// the named builtin. In dry-run mode, the description is logged and the
+// synthetic value returned instead; otherwise it's handled like any other
+// effect.
+func (ec *EvalContext) writeEffect(
+	fn string, args []Value, description string, synthetic Value,
+	perform func() (Value, error),
+) (Value, error) {
+	if w := ec.environ().dryRun; w != nil {
+		fmt.Fprintf(w, "dry-run: %s: %s\n", fn, description)
+		return synthetic, nil
+	}
+	return ec.effect(fn, args, perform)
+}
@@ -0,0 +1,64 @@
+package golisp2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Cassette(t *testing.T) {
+	dir, dirErr := ioutil.TempDir("", "cassette")
+	require.NoError(t, dirErr)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte("hello"), 0644))
+
+	script := `(concat (readFile "` + path + `") (readFile "` + path + `"))`
+
+	t.Run("recordAndReplay", func(t *testing.T) {
+		c := NewCassette()
+		recordEc := BuiltinContext().SubContext(nil)
+		recordEc.RecordEffects(c)
+		recorded := evalStrInContext(t, recordEc, script)
+		assertStringValue(t, recorded, "hellohello")
+		require.Len(t, c.Calls, 2)
+
+		var buf bytes.Buffer
+		require.NoError(t, c.Save(&buf))
+		loaded, loadErr := LoadCassette(&buf)
+		require.NoError(t, loadErr)
+
+		// removing the file shows the replay doesn't touch disk.
+		require.NoError(t, os.Remove(path))
+		defer ioutil.WriteFile(path, []byte("hello"), 0644)
+
+		replayEc := BuiltinContext().SubContext(nil)
+		replayEc.ReplayEffects(loaded)
+		assertStringValue(t, evalStrInContext(t, replayEc, script), "hellohello")
+	})
+
+	t.Run("replayMissing", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.ReplayEffects(NewCassette())
+		err := evalStrInContextToErr(t, ec, `(getEnv "HOME")`)
+		require.Contains(t, err.Error(), "no recording of 'getEnv'")
+	})
+
+	t.Run("replayError", func(t *testing.T) {
+		c := NewCassette()
+		recordEc := BuiltinContext().SubContext(nil)
+		recordEc.RecordEffects(c)
+		recordErr := evalStrInContextToErr(t, recordEc,
+			`(readFile "`+filepath.Join(dir, "missing.txt")+`")`)
+
+		replayEc := BuiltinContext().SubContext(nil)
+		replayEc.ReplayEffects(c)
+		replayErr := evalStrInContextToErr(t, replayEc,
+			`(readFile "`+filepath.Join(dir, "missing.txt")+`")`)
+		require.Equal(t, recordErr.Error(), replayErr.Error())
+	})
+}
@@ -1,6 +1,10 @@
 package golisp2
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 type (
 	// ParseError reflects an error that took place during parsing. It contains
@@ -8,6 +12,9 @@ type (
 	ParseError struct {
 		Msg   string
 		Token ScannedToken
+
+		// excerpt quotes the source the error occurred at; see RuneScanner.Quote.
+		excerpt string
 	}
 
 	// ForbiddenRuneError indicates that an illegal character was found in the
@@ -15,6 +22,21 @@ type (
 	ForbiddenRuneError struct {
 		R   rune
 		Pos ScannerPosition
+
+		// Invalid indicates the source wasn't valid UTF-8 at this point, rather
+		// than containing a forbidden rune. R will be U+FFFD.
+		Invalid bool
+
+		excerpt string
+	}
+
+	// TokenLengthError indicates a token in the source was longer than the
+	// scanner allows.
+	TokenLengthError struct {
+		Max int
+		Pos ScannerPosition
+
+		excerpt string
 	}
 
 	// TypeError is a runtime error when the incorrect type is passed to a
@@ -22,6 +44,8 @@ type (
 	TypeError struct {
 		Actual, Expected string
 		Pos              ScannerPosition
+
+		excerpt string
 	}
 
 	// EvalError is a basic runtime error indicating something went wrong during
@@ -29,6 +53,27 @@ type (
 	EvalError struct {
 		Msg string
 		Pos ScannerPosition
+
+		excerpt string
+	}
+
+	// StackOverflowError indicates calls nested deeper than the maximum depth;
+	// see Options.MaxDepth. Pos is the call that would have exceeded it. Trace
+	// holds the positions of the calls it unwound through, innermost first, up
+	// to maxStackTrace of them; Elided counts the rest.
+	StackOverflowError struct {
+		MaxDepth int
+		Pos      ScannerPosition
+		Trace    []ScannerPosition
+		Elided   int
+
+		excerpt string
+	}
+
+	// MultiError holds several errors that were collected together; e.g. all
+	// the parse errors in a file.
+	MultiError struct {
+		Errs []error
 	}
 
 	// ArgTypeError indicates a mismatch between a given argument value and the
@@ -42,6 +87,31 @@ type (
 		ArgI             int
 		Expected, Actual string
 	}
+
+	// returnSignal is the error a return expression fails with. It unwinds
+	// evaluation to the function the return is in, which then returns Val.
+	// It's only reported as an error if there's no such function.
+	returnSignal struct {
+		Val Value
+		Pos ScannerPosition
+	}
+
+	// loopSignal is the error a break or continue expression fails with. It
+	// unwinds evaluation to the innermost loop, which then stops; or if
+	// Continue is set, moves on to its next iteration.
+	loopSignal struct {
+		Continue bool
+		Pos      ScannerPosition
+	}
+
+	// escapeSignal is the error an escape function created by callEc fails
+	// with. It unwinds evaluation to that call of callEc, which then returns
+	// Val.
+	escapeSignal struct {
+		escape *FuncValue
+		Val    Value
+		Pos    ScannerPosition
+	}
 )
 
 // NewParseError creates a new parse error with the given message and token.
@@ -67,10 +137,15 @@ func NewParseEOFError(msg string, pos ScannerPosition) *ParseError {
 func (pe ParseError) Error() string {
 	// note (bs): I don't think this is a very well-laid out error message, but
 	// it's a place to start at least.
-	msg, token, pos := pe.Msg, pe.Token, pe.Token.Pos
-	return fmt.Sprintf(
-		"Parse error %s for token `%s`: file '%s' at line %d, column %d",
-		msg, token.Value, pos.SourceFile, pos.Row, pos.Col)
+	pos := pe.Token.Pos
+	return formatMessage(ParseErrorMsg, struct {
+		Msg, Token, File string
+		Row, Col         int
+	}{pe.Msg, pe.Token.Value, pos.SourceFile, pos.Row, pos.Col}) + pe.excerpt
+}
+
+func (pe *ParseError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: pe.Token.Pos, End: pe.Token.End}, &pe.excerpt
 }
 
 // NewForbiddenRuneError creates a ForbiddenRuneError for the given rune and
@@ -84,9 +159,28 @@ func NewForbiddenRuneError(r rune, pos ScannerPosition) *ForbiddenRuneError {
 
 // Error returns the informational error string about the parse error.
 func (pe ForbiddenRuneError) Error() string {
-	return fmt.Sprintf(
-		"Forbidden rune '%x' found in scan of '%s' (line %d, col %d)",
-		pe.R, pe.Pos.SourceFile, pe.Pos.Row, pe.Pos.Col)
+	return formatMessage(ForbiddenRuneErrorMsg, struct {
+		Rune     rune
+		Invalid  bool
+		File     string
+		Row, Col int
+	}{pe.R, pe.Invalid, pe.Pos.SourceFile, pe.Pos.Row, pe.Pos.Col}) + pe.excerpt
+}
+
+func (pe *ForbiddenRuneError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: pe.Pos}, &pe.excerpt
+}
+
+func (te TokenLengthError) Error() string {
+	return formatMessage(TokenLengthErrorMsg, struct {
+		Max      int
+		File     string
+		Row, Col int
+	}{te.Max, te.Pos.SourceFile, te.Pos.Row, te.Pos.Col}) + te.excerpt
+}
+
+func (te *TokenLengthError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: te.Pos}, &te.excerpt
 }
 
 // NewTypeError creates a new type error with the actual and expected types at
@@ -100,18 +194,136 @@ func NewTypeError(actual, expected string, pos ScannerPosition) *TypeError {
 }
 
 func (te TypeError) Error() string {
-	return fmt.Sprintf(
-		"Type error: expected '%s', got '%s' (%s:%d)",
-		te.Expected, te.Actual,
-		te.Pos.SourceFile, te.Pos.Row)
+	return formatMessage(TypeErrorMsg, struct {
+		Expected, Actual, File string
+		Row, Col               int
+	}{te.Expected, te.Actual, te.Pos.SourceFile, te.Pos.Row, te.Pos.Col}) + te.excerpt
+}
+
+func (te *TypeError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: te.Pos}, &te.excerpt
 }
 
 func (ee EvalError) Error() string {
-	return fmt.Sprintf("Eval error '%s': '%s' (line %d, col %d)",
-		ee.Msg, ee.Pos.SourceFile, ee.Pos.Row, ee.Pos.Col)
+	return formatMessage(EvalErrorMsg, struct {
+		Msg, File string
+		Row, Col  int
+	}{ee.Msg, ee.Pos.SourceFile, ee.Pos.Row, ee.Pos.Col}) + ee.excerpt
+}
+
+func (ee *EvalError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: ee.Pos}, &ee.excerpt
+}
+
+// maxStackTrace is how many calls a StackOverflowError's trace holds. Past
+// that, the calls of deep recursion are mostly the same few repeated.
+const maxStackTrace = 10
+
+func (se *StackOverflowError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(formatMessage(StackOverflowErrorMsg, struct {
+		MaxDepth int
+		File     string
+		Row, Col int
+	}{se.MaxDepth, se.Pos.SourceFile, se.Pos.Row, se.Pos.Col}))
+	sb.WriteString(se.excerpt)
+	for _, pos := range se.Trace {
+		fmt.Fprintf(&sb, "\n\tcalled from '%s' (line %d, col %d)",
+			pos.SourceFile, pos.Row, pos.Col)
+	}
+	if se.Elided > 0 {
+		fmt.Fprintf(&sb, "\n\t... %d more calls", se.Elided)
+	}
+	return sb.String()
+}
+
+func (se *StackOverflowError) quotedSpan() (SourceSpan, *string) {
+	return SourceSpan{Start: se.Pos}, &se.excerpt
+}
+
+// addStackFrame adds the position of a call the error is unwinding through to
+// the trace, if it's a StackOverflowError.
+func addStackFrame(err error, pos ScannerPosition) {
+	var se *StackOverflowError
+	if !errors.As(err, &se) {
+		return
+	}
+	if len(se.Trace) < maxStackTrace {
+		se.Trace = append(se.Trace, pos)
+	} else {
+		se.Elided++
+	}
 }
 
 func (ate *ArgTypeError) Error() string {
-	return fmt.Sprintf("Arg-type error in '%s' at arg %d: expected '%s', got '%s'",
-		ate.FnName, ate.ArgI, ate.Expected, ate.Actual)
+	return formatMessage(ArgTypeErrorMsg, struct {
+		FnName           string
+		ArgI             int
+		Expected, Actual string
+	}{ate.FnName, ate.ArgI, ate.Expected, ate.Actual})
+}
+
+func (rs *returnSignal) Error() string {
+	return stopSignals(rs).Error()
+}
+
+func (ls *loopSignal) Error() string {
+	return ls.outsideLoop().Error()
+}
+
+// outsideLoop returns the error for the signal having escaped any loop it was
+// in; e.g. by reaching the edge of a function.
+func (ls *loopSignal) outsideLoop() *EvalError {
+	name := "break"
+	if ls.Continue {
+		name = "continue"
+	}
+	return &EvalError{
+		Msg: name + " used outside of a loop",
+		Pos: ls.Pos,
+	}
+}
+
+func (es *escapeSignal) Error() string {
+	return EvalError{
+		Msg: "escape called outside of its callEc",
+		Pos: es.Pos,
+	}.Error()
+}
+
+// isControlSignal indicates the error is a return, break, continue or escape,
+// which should be passed on rather than handled.
+func isControlSignal(err error) bool {
+	var ret *returnSignal
+	var ls *loopSignal
+	var esc *escapeSignal
+	return errors.As(err, &ret) || errors.As(err, &ls) || errors.As(err, &esc)
+}
+
+// stopSignals converts a return, break or continue signal into a plain error,
+// for when it reaches somewhere it can't pass through; e.g. a goroutine. Other
+// errors are returned as is.
+func stopSignals(err error) error {
+	var ret *returnSignal
+	var ls *loopSignal
+	switch {
+	case errors.As(err, &ret):
+		return &EvalError{
+			Msg: "return used outside of a function",
+			Pos: ret.Pos,
+		}
+	case errors.As(err, &ls):
+		return ls.outsideLoop()
+	default:
+		return err
+	}
+}
+
+// Error returns each of the errors, one per line.
+func (me *MultiError) Error() string {
+	msgs := make([]string, 0, len(me.Errs))
+	for _, err := range me.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
 }
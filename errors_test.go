@@ -1,6 +1,9 @@
 package golisp2
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 import "github.com/stretchr/testify/require"
 
@@ -63,3 +66,11 @@ func Test_ArgTypeError(t *testing.T) {
 	}
 	require.Contains(t, err.Error(), "Arg")
 }
+
+func Test_errorSourceExcerpt(t *testing.T) {
+	ts := NewTokenScanner(NewRuneScanner(
+		"excerptErr.l", strings.NewReader("(+ 1\n  (++== 1 2))")))
+	_, err := ParseTokens(ts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "\n\t  (++== 1 2))\n\t   ^~~~")
+}
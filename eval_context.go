@@ -1,46 +1,622 @@
 package golisp2
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 type (
 	// EvalContext is the context on evaluation. It contains a resolvable set of
 	// identifiers->values that can be chained.
 	EvalContext struct {
 		parent *EvalContext
-		vals   map[string]Value
+
+		// vals are guarded by mu, as contexts are shared with the goroutines
+		// started by go expressions.
+		mu   sync.RWMutex
+		vals map[string]Value
+
+		// env is shared between a context and every context derived from it.
+		env *evalEnv
+
+		// callPos is the location of the call a context was created for. Only set
+		// on call contexts; see callContext.
+		callPos ScannerPosition
+		isCall  bool
+
+		// pure restricts evaluation in the context and its sub contexts to pure
+		// functions. See SetPureOnly.
+		pure bool
+
+		// depth is how many function calls the context is nested in.
+		depth int
+
+		// ctx, if set, overrides the environment's go context for the context
+		// and the calls made from it; see Context. Like depth, it follows calls
+		// rather than lexical scope.
+		ctx context.Context
+
+		// scope is the lexical scope the context was created for; nil if none.
+		// See resolveLexical.
+		scope *lexicalScope
+	}
+
+	// evalEnv holds state that is shared by an entire tree of contexts, rather
+	// than being scoped to a single one.
+	evalEnv struct {
+		diagnostics *Diagnostics
+
+		// ctx halts evaluation when cancelled.
+		ctx context.Context
+
+		// deterministic indicates runs must be reproducible: random is seeded,
+		// the clock is frozen, and map iteration is sorted.
+		deterministic bool
+		rand          *rand.Rand
+		now           func() time.Time
+
+		// effectMode controls whether effectful builtins are recorded to or
+		// replayed from the cassette.
+		effectMode effectMode
+		cassette   *Cassette
+
+		// dryRun, if set, is where write effects are logged instead of being
+		// performed.
+		dryRun io.Writer
+
+		// execDisabled makes the builtins that run processes fail.
+		execDisabled bool
+
+		// maxDepth, strict, truthy, sortMaps and ieeeDivision are set from
+		// Options; see SetOptions.
+		maxDepth     int
+		strict       bool
+		truthy       bool
+		sortMaps     bool
+		ieeeDivision bool
+
+		// policy, if set, limits what the effectful builtins may do.
+		policy *Policy
+
+		// stdout and stderr are where printed output, and printed errors, are
+		// written.
+		stdout io.Writer
+		stderr io.Writer
+
+		// bus carries messages published by scripts.
+		bus *Bus
+
+		// hook, if set, is notified of evaluation.
+		hook EvalHook
+
+		// sealed are the identifiers scripts can't redefine. See Seal.
+		sealed map[string]bool
+
+		// resolveLog, if set, is where each identifier resolution is logged. See
+		// SetResolveLog.
+		resolveLogMu sync.Mutex
+		resolveLog   io.Writer
+
+		// shutdownHandlers are the functions registered to run on shutdown.
+		shutdownMu       sync.Mutex
+		shutdownHandlers []shutdownHandler
+
+		// metrics is where measurements about evaluation are reported.
+		metrics Metrics
+
+		// tracer, if set, creates spans for program runs and traced calls.
+		tracer Tracer
+
+		// tests are the script tests declared with deftest.
+		tests []ScriptTest
+
+		// gensyms counts the symbols created by gensym, so each is unique.
+		gensyms uint64
+
+		// warnedDeprecated tracks which deprecated functions have been warned
+		// about, so each is only reported once.
+		warnedMu         sync.Mutex
+		warnedDeprecated map[*FuncValue]bool
 	}
 )
 
 // NewContext returns a new context with no parent. initialVals contains any
 // values that the context should be initialized with; it can be left nil.
 func NewContext(initialVals map[string]Value) *EvalContext {
+	return newContext(initialVals, newEvalEnv())
+}
+
+func newContext(initialVals map[string]Value, env *evalEnv) *EvalContext {
 	vals := map[string]Value{}
 	for k, v := range initialVals {
 		vals[k] = v
 	}
 	return &EvalContext{
 		vals: vals,
+		env:  env,
+	}
+}
+
+func newEvalEnv() *evalEnv {
+	return &evalEnv{
+		diagnostics:      NewDiagnostics(),
+		ctx:              context.Background(),
+		rand:             newLockedRand(time.Now().UnixNano()),
+		now:              time.Now,
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+		bus:              NewBus(),
+		metrics:          nopMetrics{},
+		warnedDeprecated: map[*FuncValue]bool{},
 	}
 }
 
 // SubContext creates a new context with the current context as it's parent.
 func (ec *EvalContext) SubContext(initialVals map[string]Value) *EvalContext {
-	sub := NewContext(initialVals)
+	sub := newContext(initialVals, ec.environ())
 	sub.parent = ec
+	sub.depth = ec.depth
+	sub.ctx = ec.ctx
 	return sub
 }
 
 // Add extends the current context with the provided value.
 func (ec *EvalContext) Add(ident string, val Value) {
+	// call contexts hold no values of their own.
+	for ec.vals == nil && ec.parent != nil {
+		ec = ec.parent
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
 	ec.vals[ident] = val
 }
 
+// Set replaces the value of the ident in the nearest context that defines it.
+// Returns false, and makes no change, if no context defines the ident.
+func (ec *EvalContext) Set(ident string, val Value) bool {
+	for c := ec; c != nil; c = c.parent {
+		c.mu.Lock()
+		_, ok := c.vals[ident]
+		if ok {
+			c.vals[ident] = val
+		}
+		c.mu.Unlock()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Seal forbids scripts from redefining the idents with let, defun or
+// defstruct, or replacing them with set!; e.g. so a script can't swap exec or
+// writeFile for a function of its own. Attempts fail with an error at their
+// position. Block lets, function parameters and loop variables may still
+// shadow sealed idents, as they only affect their own scope. Add and Set from
+// go are unaffected. This applies to all parent and sub contexts, and should be
+// called before evaluation starts.
+func (ec *EvalContext) Seal(idents ...string) {
+	env := ec.environ()
+	sealed := make(map[string]bool, len(env.sealed)+len(idents))
+	for ident := range env.sealed {
+		sealed[ident] = true
+	}
+	for _, ident := range idents {
+		sealed[ident] = true
+	}
+	env.sealed = sealed
+}
+
+// IsSealed indicates if scripts are forbidden from redefining the ident. See
+// Seal.
+func (ec *EvalContext) IsSealed(ident string) bool {
+	return ec.environ().sealed[ident]
+}
+
 // Resolve traverses the expr for the given ident. Will return it if found;
 // otherwise a nil value and "false".
 func (ec *EvalContext) Resolve(ident string) (Value, bool) {
 	if ec == nil {
-		return &NilValue{}, false
+		return Nil, false
+	}
+	if w := ec.environ().resolveLog; w != nil {
+		return ec.resolveLogged(w, ident)
 	}
-	if v, ok := ec.vals[ident]; ok {
+	ec.mu.RLock()
+	v, ok := ec.vals[ident]
+	ec.mu.RUnlock()
+	if ok {
 		return v, true
 	}
 	return ec.parent.Resolve(ident)
 }
+
+// resolveLogged resolves the ident like Resolve, and logs where it was found to
+// w. Contexts are numbered by level, from 0 for ec up to its root. Any
+// definitions in levels above the one found are shadowed by it, and are listed
+// too.
+func (ec *EvalContext) resolveLogged(w io.Writer, ident string) (Value, bool) {
+	var found Value
+	foundLevel, levels := -1, 0
+	shadowed := []int{}
+	for c := ec; c != nil; c = c.parent {
+		c.mu.RLock()
+		v, ok := c.vals[ident]
+		c.mu.RUnlock()
+		if ok {
+			if foundLevel < 0 {
+				found, foundLevel = v, levels
+			} else {
+				shadowed = append(shadowed, levels)
+			}
+		}
+		levels++
+	}
+
+	var msg string
+	switch {
+	case foundLevel < 0:
+		msg = fmt.Sprintf("resolve %s: not found in %d levels", ident, levels)
+	case len(shadowed) == 0:
+		msg = fmt.Sprintf("resolve %s: %s from level %d of %d",
+			ident, TypeName(found), foundLevel, levels)
+	default:
+		msg = fmt.Sprintf("resolve %s: %s from level %d of %d; shadows levels %v",
+			ident, TypeName(found), foundLevel, levels, shadowed)
+	}
+	env := ec.environ()
+	env.resolveLogMu.Lock()
+	fmt.Fprintln(w, msg)
+	env.resolveLogMu.Unlock()
+
+	if foundLevel < 0 {
+		return Nil, false
+	}
+	return found, true
+}
+
+// SetResolveLog logs every identifier resolution to the writer: which level of
+// context it was found in, counting up from 0 for the context it was resolved
+// in, and which definitions further up it shadows. It's meant for debugging
+// surprising scoping. A nil writer disables it. This applies to all parent and
+// sub contexts.
+func (ec *EvalContext) SetResolveLog(w io.Writer) {
+	ec.environ().resolveLog = w
+}
+
+// Bindings returns a copy of the values defined directly in this context; not
+// those of its parents.
+func (ec *EvalContext) Bindings() map[string]Value {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	vals := make(map[string]Value, len(ec.vals))
+	for k, v := range ec.vals {
+		vals[k] = v
+	}
+	return vals
+}
+
+// Diagnostics returns the collector for any warnings raised during
+// evaluation. It is shared with all parent and sub contexts.
+func (ec *EvalContext) Diagnostics() *Diagnostics {
+	return ec.environ().diagnostics
+}
+
+// SetContext sets the go context for evaluation. Once it is cancelled, any
+// further function calls will fail. This applies to all parent and sub
+// contexts.
+func (ec *EvalContext) SetContext(ctx context.Context) {
+	ec.environ().ctx = ctx
+}
+
+// Context returns the go context for evaluation. Defaults to
+// context.Background.
+func (ec *EvalContext) Context() context.Context {
+	if ec.ctx != nil {
+		return ec.ctx
+	}
+	return ec.environ().ctx
+}
+
+// SetDeterministic makes evaluation reproducible: the random source is seeded
+// with the given seed, the clock is frozen at the given instant, maps are
+// iterated in sorted order, and functions marked as nondeterministic are
+// forbidden. This applies to all parent and sub contexts.
+func (ec *EvalContext) SetDeterministic(seed int64, now time.Time) {
+	env := ec.environ()
+	env.deterministic = true
+	env.rand = newLockedRand(seed)
+	env.now = func() time.Time { return now }
+}
+
+// SetStdout sets where printed output is written. A nil writer resets it to
+// os.Stdout. This applies to all parent and sub contexts.
+func (ec *EvalContext) SetStdout(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	ec.environ().stdout = w
+}
+
+// Stdout returns where printed output should be written. Builtins should use
+// this rather than os.Stdout.
+func (ec *EvalContext) Stdout() io.Writer {
+	return ec.environ().stdout
+}
+
+// SetStderr sets where printed errors are written. A nil writer resets it to
+// os.Stderr. This applies to all parent and sub contexts.
+func (ec *EvalContext) SetStderr(w io.Writer) {
+	if w == nil {
+		w = os.Stderr
+	}
+	ec.environ().stderr = w
+}
+
+// Stderr returns where printed errors should be written. Builtins should use
+// this rather than os.Stderr.
+func (ec *EvalContext) Stderr() io.Writer {
+	return ec.environ().stderr
+}
+
+// Deterministic indicates if the context is in deterministic mode.
+func (ec *EvalContext) Deterministic() bool {
+	return ec.environ().deterministic
+}
+
+// Now returns the current time; or the frozen time in deterministic mode.
+// Builtins should use this rather than time.Now.
+func (ec *EvalContext) Now() time.Time {
+	return ec.environ().now()
+}
+
+// Rand returns the source of randomness builtins should use. It is safe for
+// concurrent use.
+func (ec *EvalContext) Rand() *rand.Rand {
+	return ec.environ().rand
+}
+
+// mapKeys returns the keys of the map, in sorted order if the context is
+// deterministic or sorts maps.
+func (ec *EvalContext) mapKeys(m map[string]Value) []string {
+	if ec.Deterministic() || ec.environ().sortMaps {
+		return sortedKeys(m)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// gensym returns a new name with the given prefix, that is unique within the
+// context tree. Names include a '#', so they can't clash with identifiers in
+// source.
+func (ec *EvalContext) gensym(prefix string) string {
+	n := atomic.AddUint64(&ec.environ().gensyms, 1)
+	return fmt.Sprintf("%s#%d", prefix, n)
+}
+
+// CallPos returns the location of the innermost function call being evaluated
+// in this context. Builtins can use this to attach positions to errors and
+// diagnostics.
+func (ec *EvalContext) CallPos() ScannerPosition {
+	for c := ec; c != nil; c = c.parent {
+		if c.isCall {
+			return c.callPos
+		}
+	}
+	return ScannerPosition{}
+}
+
+// warn adds a warning diagnostic at the position of the current call; or, in
+// strict mode, returns it as an error.
+func (ec *EvalContext) warn(msg string) error {
+	return ec.warnAt(msg, ec.CallPos())
+}
+
+// warnDeprecated raises a warning about the call of a deprecated function at
+// the given position. Will only warn once per function, unless strict, when
+// every call fails.
+func (ec *EvalContext) warnDeprecated(fn *FuncValue, pos ScannerPosition) error {
+	env := ec.environ()
+	env.warnedMu.Lock()
+	warned := env.warnedDeprecated[fn]
+	env.warnedDeprecated[fn] = true
+	env.warnedMu.Unlock()
+	if warned && !env.strict {
+		return nil
+	}
+
+	msg := fmt.Sprintf("'%s' is deprecated", fn.Name)
+	if fn.Deprecated.Notice != "" {
+		msg = fmt.Sprintf("%s: %s", msg, fn.Deprecated.Notice)
+	}
+	if fn.Deprecated.Replacement != "" {
+		msg = fmt.Sprintf("%s; use '%s' instead", msg, fn.Deprecated.Replacement)
+	}
+	return ec.warnAt(msg, pos)
+}
+
+// SetPureOnly restricts evaluation in the context, and any sub contexts, to
+// pure functions: calling an impure one, or passing one to a function, fails.
+// Functions defined in the context are considered pure, as they're restricted
+// in turn. This makes it safe to evaluate untrusted expressions, e.g. formulas.
+func (ec *EvalContext) SetPureOnly() {
+	ec.pure = true
+}
+
+// pureOnly indicates if the context only allows pure functions.
+func (ec *EvalContext) pureOnly() bool {
+	for c := ec; c != nil; c = c.parent {
+		if c.pure {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPure returns an error if the context only allows pure functions, and the
+// function is called with, or is itself, an impure one.
+func (ec *EvalContext) checkPure(
+	fn *FuncValue, args []Value, pos ScannerPosition,
+) error {
+	if !ec.pureOnly() {
+		return nil
+	}
+	if !fn.Pure {
+		return &EvalError{
+			Msg: fmt.Sprintf("'%s' is impure, and cannot be called in pure mode",
+				profileName(fn)),
+			Pos: pos,
+		}
+	}
+	for _, arg := range args {
+		if asFn, isFn := arg.(*FuncValue); isFn && !asFn.Pure {
+			return &EvalError{
+				Msg: fmt.Sprintf("'%s' is impure, and cannot be passed in pure mode",
+					profileName(asFn)),
+				Pos: pos,
+			}
+		}
+	}
+	return nil
+}
+
+// callContext creates a lightweight context to pass to a function being called
+// at the given position. It holds no values; adds are passed to the parent.
+func (ec *EvalContext) callContext(pos ScannerPosition) *EvalContext {
+	return &EvalContext{
+		parent:  ec,
+		env:     ec.environ(),
+		callPos: pos,
+		isCall:  true,
+		depth:   ec.depth + 1,
+		ctx:     ec.ctx,
+	}
+}
+
+// withContext creates a context that evaluates like ec, but with the given go
+// context; ec's own, and the rest of the tree's, are unchanged. It holds no
+// values; adds are passed to ec.
+func (ec *EvalContext) withContext(ctx context.Context) *EvalContext {
+	return &EvalContext{
+		parent: ec,
+		env:    ec.environ(),
+		depth:  ec.depth,
+		ctx:    ctx,
+	}
+}
+
+// environ returns the shared environment of the context. Contexts built by
+// hand (rather than NewContext/SubContext) lazily inherit it from their parent.
+func (ec *EvalContext) environ() *evalEnv {
+	if ec == nil {
+		return newEvalEnv()
+	}
+	if ec.env == nil {
+		if ec.parent != nil {
+			ec.env = ec.parent.environ()
+		} else {
+			ec.env = newEvalEnv()
+		}
+	}
+	return ec.env
+}
+
+// suggestIdent searches the context chain for a defined identifier that is a
+// likely misspelling of the given one. Returns the closest match within an edit
+// distance of 2, and whether any was found.
+func (ec *EvalContext) suggestIdent(ident string) (string, bool) {
+	best, bestDist := "", 3
+	for c := ec; c != nil; c = c.parent {
+		c.mu.RLock()
+		names := make([]string, 0, len(c.vals))
+		for name := range c.vals {
+			names = append(names, name)
+		}
+		c.mu.RUnlock()
+		for _, name := range names {
+			if name == ident {
+				continue
+			}
+			d := editDistance(ident, name)
+			// very short identifiers are within two edits of almost
+			// anything, so require the distance to be smaller than the ident itself.
+			if d >= len(ident) {
+				continue
+			}
+			if d < bestDist || (d == bestDist && name < best) {
+				best, bestDist = name, d
+			}
+		}
+	}
+	return best, bestDist <= 2
+}
+
+// editDistance returns the levenshtein distance between the two strings.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+// lockedSource is a random source that is safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+// newLockedRand creates a random generator that is safe for concurrent use,
+// seeded with the seed.
+func newLockedRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{
+		src: rand.NewSource(seed).(rand.Source64),
+	})
+}
+
+func (ls *lockedSource) Int63() int64 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.src.Int63()
+}
+
+func (ls *lockedSource) Uint64() uint64 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.src.Uint64()
+}
+
+func (ls *lockedSource) Seed(seed int64) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.src.Seed(seed)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EvalContext(t *testing.T) {
+
+	t.Run("deterministic", func(t *testing.T) {
+		frozen := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		run := func() []Value {
+			ec := BuiltinContext().SubContext(nil)
+			ec.SetDeterministic(42, frozen)
+			require.True(t, ec.Deterministic())
+			require.Equal(t, frozen, ec.Now())
+			return []Value{
+				evalStrInContext(t, ec, `(random)`),
+				evalStrInContext(t, ec, `(random)`),
+				evalStrInContext(t, ec,
+					`(mapKeys (map "d" 1 "b" 2 "a" 3 "c" 4 "e" 5))`),
+			}
+		}
+		require.Equal(t, run(), run())
+		assertListValue(t, run()[2], []Value{
+			&StringValue{Val: "a"},
+			&StringValue{Val: "b"},
+			&StringValue{Val: "c"},
+			&StringValue{Val: "d"},
+			&StringValue{Val: "e"},
+		})
+	})
+
+	t.Run("nondeterministicFn", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(map[string]Value{
+			"clock": &FuncValue{
+				Name: "clock",
+				Fn: func(ec *EvalContext, vals ...Value) (Value, error) {
+					return &NumberValue{Val: float64(time.Now().Unix())}, nil
+				},
+				Nondeterministic: true,
+			},
+		})
+		evalStrInContext(t, ec, `(clock)`)
+
+		ec.SetDeterministic(1, time.Time{})
+		ts := NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(`(clock)`)))
+		exprs, exprsErr := ParseTokens(ts)
+		require.NoError(t, exprsErr)
+		_, err := exprs[0].Eval(ec)
+		require.IsType(t, (*EvalError)(nil), err)
+		require.Contains(t, err.Error(), "deterministic")
+
+		for _, src := range []string{
+			`(apply clock (list))`,
+			`(listMap (list 1) (fn (x) (clock)))`,
+			`(listMap (list 1) clock)`,
+		} {
+			ts := NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(src)))
+			exprs, exprsErr := ParseTokens(ts)
+			require.NoError(t, exprsErr)
+			_, err := exprs[0].Eval(ec)
+			require.Error(t, err, src)
+			require.Contains(t, err.Error(), "deterministic", src)
+		}
+	})
+
+	t.Run("random", func(t *testing.T) {
+		v := assertAsNum(t, evalStrToVal(t, `(random)`))
+		require.True(t, v.Val >= 0 && v.Val < 1)
+		evalStrToErr(t, `(random 1)`)
+	})
+
+	t.Run("resolveLog", func(t *testing.T) {
+		var log strings.Builder
+		root := NewContext(map[string]Value{"x": &NumberValue{Val: 1}})
+		mid := root.SubContext(map[string]Value{"x": &StringValue{Val: "a"}})
+		leaf := mid.SubContext(nil)
+		leaf.SetResolveLog(&log)
+
+		v, found := leaf.Resolve("x")
+		require.True(t, found)
+		assertStringValue(t, v, "a")
+		_, found = root.Resolve("x")
+		require.True(t, found)
+		_, found = leaf.Resolve("y")
+		require.False(t, found)
+		require.Equal(t, strings.Join([]string{
+			"resolve x: string from level 1 of 3; shadows levels [2]",
+			"resolve x: number from level 0 of 1",
+			"resolve y: not found in 3 levels",
+			"",
+		}, "\n"), log.String())
+
+		leaf.SetResolveLog(nil)
+		leaf.Resolve("x")
+		require.Equal(t, 3, strings.Count(log.String(), "\n"))
+	})
+	t.Run("seal", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.Seal("exec", "writeFile")
+		ec.Seal("point-x")
+		require.True(t, ec.IsSealed("exec"))
+		require.True(t, ec.SubContext(nil).IsSealed("writeFile"))
+		require.False(t, ec.IsSealed("print"))
+
+		err := evalStrInContextToErr(t, ec, `(let exec (fn (cmd) cmd))`)
+		require.Contains(t, err.Error(), "cannot redefine sealed identifier 'exec'")
+		require.Contains(t, err.Error(), "(line 1, col 6)")
+		err = evalStrInContextToErr(t, ec, `(defun writeFile (path s) s)`)
+		require.Contains(t, err.Error(), "sealed identifier 'writeFile'")
+		evalStrInContextToErr(t, ec, `(set! exec 1)`)
+		evalStrInContextToErr(t, ec, `((fn () (let exec 1)))`)
+		evalStrInContextToErr(t, ec, `(defstruct point x y)`)
+		_, defined := ec.Resolve("point")
+		require.False(t, defined)
+
+		// names of its own, and shadowing in a block, are allowed.
+		assertNumValue(t, evalStrInContext(t, ec, `(let execute 1) execute`), 1)
+		assertNumValue(t, evalStrInContext(t, ec, `(let ((exec 2)) exec)`), 2)
+		assertNumValue(t, evalStrInContext(t, ec, `((fn (exec) exec) 3)`), 3)
+	})
+}
@@ -0,0 +1,71 @@
+package golisp2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExecString evaluates the source in a new context of the builtins, and
+// returns the printed form of its last expression's value. It's the simplest
+// way to run a script from Go; see EvalContext.ExecString to run it in a
+// context of your own.
+func ExecString(src string) (string, error) {
+	return BuiltinContext().ExecString(src)
+}
+
+// ExecFile is like ExecString, but evaluates the file at the path. It can be
+// source, or a program compiled by WriteCompiled.
+func ExecFile(path string) (string, error) {
+	return BuiltinContext().ExecFile(path)
+}
+
+// ExecString evaluates the source in a sub context, and returns the printed
+// form of its last expression's value. Nothing the source defines is added to
+// ec. A timeout declared in the source's manifest is honored.
+func (ec *EvalContext) ExecString(src string) (string, error) {
+	prog, err := ParseProgram(
+		NewTokenScanner(NewRuneScanner("exec", strings.NewReader(src))))
+	if err != nil {
+		return "", err
+	}
+	out, err := execProgram(ec, prog)
+	return out, quoteString(err, "exec", src)
+}
+
+// ExecFile is like ExecString, but evaluates the file at the path. Files with
+// the CompiledExt extension are loaded with ReadCompiled.
+func (ec *EvalContext) ExecFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var prog *Program
+	var rs *RuneScanner
+	if filepath.Ext(path) == CompiledExt {
+		prog, err = ReadCompiled(f)
+	} else {
+		rs = NewRuneScanner(path, f)
+		prog, err = ParseProgram(NewTokenScanner(rs))
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not load '%s': %w", path, err)
+	}
+	out, err := execProgram(ec, prog)
+	if err != nil && rs != nil {
+		rs.Quote(err)
+	}
+	return out, err
+}
+
+// execProgram evaluates the program in a sub context of ec, and returns the
+// printed form of its value.
+func execProgram(ec *EvalContext, prog *Program) (string, error) {
+	v, err := prog.Eval(ec.SubContext(nil))
+	if err != nil {
+		return "", err
+	}
+	return v.InspectStr(), nil
+}
@@ -0,0 +1,62 @@
+package golisp2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExecString(t *testing.T) {
+	t.Run("value", func(t *testing.T) {
+		out, err := ExecString(`(let sq (fn (x) (* x x))) (list (sq 3) "a")`)
+		require.NoError(t, err)
+		require.Equal(t, `[9 "a"]`, out)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ExecString(`(+ 1`)
+		require.Error(t, err)
+		_, err = ExecString(`(undefinedFn 1)`)
+		require.Error(t, err)
+	})
+
+	t.Run("baseContext", func(t *testing.T) {
+		ec := BuiltinContext()
+		ec.Add("base", &NumberValue{Val: 10})
+		out, err := ec.ExecString(`(let more 1) (+ base more)`)
+		require.NoError(t, err)
+		require.Equal(t, "11", out)
+		_, defined := ec.Resolve("more")
+		require.False(t, defined)
+	})
+}
+
+func Test_ExecFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "script.l")
+	require.NoError(t, ioutil.WriteFile(src, []byte(`(concat "a" "b")`), 0644))
+	out, err := ExecFile(src)
+	require.NoError(t, err)
+	require.Equal(t, `"ab"`, out)
+
+	prog, err := ParseProgram(NewTokenScanner(NewRuneScanner("script.l", strings.NewReader(`(+ 1 2)`))))
+	require.NoError(t, err)
+	compiled := filepath.Join(dir, "script"+CompiledExt)
+	f, err := os.Create(compiled)
+	require.NoError(t, err)
+	require.NoError(t, prog.WriteCompiled(f))
+	require.NoError(t, f.Close())
+	out, err = ExecFile(compiled)
+	require.NoError(t, err)
+	require.Equal(t, "3", out)
+
+	_, err = ExecFile(filepath.Join(dir, "missing.l"))
+	require.Error(t, err)
+}
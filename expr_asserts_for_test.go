@@ -30,7 +30,21 @@ func evalStrToVal(t *testing.T, str string) Value {
 	return mustEval(t, exprs[0], BuiltinContext())
 }
 
-// evalStrToVal will parse the string, assert that exactly one expression is
+// evalStrInContext will parse the string, evaluate each expression in the
+// given context, and return the value of the last.
+func evalStrInContext(t *testing.T, ec *EvalContext, str string) Value {
+	t.Helper()
+	ts := NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(str)))
+	exprs, exprsErr := ParseTokens(ts)
+	require.NoError(t, exprsErr)
+	var v Value = &NilValue{}
+	for _, e := range exprs {
+		v = mustEval(t, e, ec)
+	}
+	return v
+}
+
+// evalStrToErr will parse the string, assert that exactly one expression is
 // returned, evaluate it, assert it's an error, and return it.
 func evalStrToErr(t *testing.T, str string) error {
 	t.Helper()
@@ -43,6 +57,20 @@ func evalStrToErr(t *testing.T, str string) error {
 	return err
 }
 
+// evalStrInContextToErr will parse the string, assert that exactly one
+// expression is returned, evaluate it in the given context, assert it's an
+// error, and return it.
+func evalStrInContextToErr(t *testing.T, ec *EvalContext, str string) error {
+	t.Helper()
+	ts := NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(str)))
+	exprs, exprsErr := ParseTokens(ts)
+	require.NoError(t, exprsErr)
+	require.Equal(t, len(exprs), 1)
+	_, err := exprs[0].Eval(ec)
+	require.Error(t, err)
+	return err
+}
+
 // parseStrToErr will parse the string, and assert that it results in an error.
 func parseStrToErr(t *testing.T, str string) error {
 	t.Helper()
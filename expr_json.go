@@ -0,0 +1,76 @@
+package golisp2
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalExprJSON converts the expression to JSON, so tools outside of Go can
+// work with the parsed tree. Each expression is an object with a "kind" (e.g.
+// "call", "if", "ident"), its position, and the fields that kind uses; see
+// exprNode. Function literals other than the operators can't be converted.
+func MarshalExprJSON(e Expr) ([]byte, error) {
+	n, err := exprToNode(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(n)
+}
+
+// UnmarshalExprJSON converts JSON written by MarshalExprJSON, or produced by
+// another tool in the same form, back into an expression.
+func UnmarshalExprJSON(b []byte) (Expr, error) {
+	var n exprNode
+	if err := json.Unmarshal(b, &n); err != nil {
+		return nil, err
+	}
+	e, err := nodeToExpr(&n)
+	if err != nil {
+		return nil, err
+	}
+	resolveLexical([]Expr{e})
+	return e, nil
+}
+
+// programJSON is the JSON form of a program.
+type programJSON struct {
+	Manifest map[string]interface{} `json:"manifest"`
+	Exprs    []*exprNode            `json:"exprs"`
+}
+
+// MarshalJSON converts the program to JSON: its manifest's raw header fields,
+// and each of its expressions as MarshalExprJSON would.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	nodes, err := exprsToNodes(p.Exprs)
+	if err != nil {
+		return nil, err
+	}
+	manifest := p.Manifest.Raw
+	if manifest == nil {
+		manifest = map[string]interface{}{}
+	}
+	return json.Marshal(programJSON{
+		Manifest: manifest,
+		Exprs:    nodes,
+	})
+}
+
+// UnmarshalJSON sets the program's manifest and expressions from JSON in the
+// form MarshalJSON writes.
+func (p *Program) UnmarshalJSON(b []byte) error {
+	var pj programJSON
+	if err := json.Unmarshal(b, &pj); err != nil {
+		return err
+	}
+	manifest, err := manifestFromRaw(pj.Manifest)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	exprs, err := nodesToExprs(pj.Exprs)
+	if err != nil {
+		return err
+	}
+	resolveLexical(exprs)
+	p.Manifest, p.Exprs = manifest, exprs
+	return nil
+}
@@ -0,0 +1,77 @@
+package golisp2
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exprJSON(t *testing.T) {
+	t.Run("roundTrip", func(t *testing.T) {
+		prog, err := ParseProgram(NewTokenScanner(NewRuneScanner("json.l", strings.NewReader(`
+			;; gl: {"timeout": "1s"}
+			(defun fact (n) (if (<= n 1) 1 (* n (fact (- n 1)))))
+			(let* ((a (fact 4)) (b :done)) (cond ((> a 20) (list a b)) (else nil)))
+		`))))
+		require.NoError(t, err)
+		data, err := json.Marshal(prog)
+		require.NoError(t, err)
+
+		loaded := &Program{}
+		require.NoError(t, json.Unmarshal(data, loaded))
+		require.Equal(t, prog.Manifest, loaded.Manifest)
+		require.Equal(t, len(prog.Exprs), len(loaded.Exprs))
+		for i := range prog.Exprs {
+			require.Equal(t, prog.Exprs[i].CodeStr(), loaded.Exprs[i].CodeStr())
+			require.Equal(t, prog.Exprs[i].SourceSpan(), loaded.Exprs[i].SourceSpan())
+		}
+		v, err := loaded.Eval(BuiltinContext().SubContext(nil))
+		require.NoError(t, err)
+		require.Equal(t, `[24 :done]`, v.InspectStr())
+	})
+
+	t.Run("form", func(t *testing.T) {
+		data, err := MarshalExprJSON(NewCallExpr(NewIdentLiteral("+"), NewNumberLiteral(1)))
+		require.NoError(t, err)
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &fields))
+		require.Equal(t, "call", fields["kind"])
+		exprs := fields["exprs"].([]interface{})
+		require.Equal(t, 2, len(exprs))
+		require.Equal(t, "ident", exprs[0].(map[string]interface{})["kind"])
+		require.Equal(t, float64(1), exprs[1].(map[string]interface{})["num"])
+	})
+
+	t.Run("produced", func(t *testing.T) {
+		e, err := UnmarshalExprJSON([]byte(`{
+			"kind": "call",
+			"exprs": [
+				{"kind": "op", "val": "*"},
+				{"kind": "number", "num": 6},
+				{"kind": "if", "exprs": [
+					{"kind": "bool", "flag": true},
+					{"kind": "number", "num": 7},
+					{"kind": "nil"}
+				]}
+			]
+		}`))
+		require.NoError(t, err)
+		assertNumValue(t, mustEval(t, e, BuiltinContext()), 42)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, src := range []string{
+			`{"kind": "nope"}`,
+			`{"kind": "op", "val": "?"}`,
+			`{"kind": "call"}`,
+			`{"kind": "let", "exprs": [{"kind": "nil"}]}`,
+			`{"kind": "defstruct", "idents": [{"kind": "number"}]}`,
+			`[1, 2]`,
+		} {
+			_, err := UnmarshalExprJSON([]byte(src))
+			require.Error(t, err, src)
+		}
+	})
+}
@@ -0,0 +1,438 @@
+package golisp2
+
+import "fmt"
+
+// exprNode is the serializable form of an expression: the parsed tree, without
+// the function values of operators, which are looked up again by name when
+// it's converted back.
+//
+// Each kind uses a subset of the fields:
+//
+//   - ident, string, keyword and op: Val.
+//   - number: Num. bool: Flag.
+//   - call: Exprs, the function followed by its arguments.
+//   - if: Exprs, the condition and cases.
+//   - cond: Clauses.
+//   - when: Exprs, the condition; Body; and Flag if negated (unless).
+//   - while: Exprs, the condition; and Body.
+//   - for and dotimes: Idents and Exprs, the binding; and Body.
+//   - fn: Val, the name; Flag if pure; Args, Rest and Body.
+//   - let and set: Idents and Exprs, the binding.
+//   - blockLet: Idents and Exprs, the bindings in order; Body; and Flag if
+//     sequential (let*).
+//   - letValues: Idents; Exprs, the value; and Body.
+//   - defstruct: Idents, the name followed by the fields.
+//   - time, assertError, go and return: Exprs, the expression if there is one.
+//   - deftest: Val, the name; and Body.
+//   - break: Flag if it's a continue.
+//   - methodCall: Idents, the method; Exprs, the object followed by the args.
+//   - defgeneric: Idents, the name followed by the params.
+//   - defmethod: Idents, the name; Val, the type; and Exprs, the fn.
+type exprNode struct {
+	Kind    string           `json:"kind"`
+	Val     string           `json:"val,omitempty"`
+	Num     float64          `json:"num,omitempty"`
+	Flag    bool             `json:"flag,omitempty"`
+	Idents  []*exprNode      `json:"idents,omitempty"`
+	Exprs   []*exprNode      `json:"exprs,omitempty"`
+	Body    []*exprNode      `json:"body,omitempty"`
+	Clauses []condClauseNode `json:"clauses,omitempty"`
+	Args    []argNode        `json:"args,omitempty"`
+	Rest    *argNode         `json:"rest,omitempty"`
+	Pos     ScannerPosition  `json:"pos"`
+	End     ScannerPosition  `json:"end"`
+}
+
+// condClauseNode is the serializable form of a cond clause. Test is nil for
+// an else clause.
+type condClauseNode struct {
+	Test *exprNode   `json:"test,omitempty"`
+	Body []*exprNode `json:"body"`
+}
+
+// argNode is the serializable form of a function argument.
+type argNode struct {
+	Ident   string `json:"ident"`
+	Keyword string `json:"keyword,omitempty"`
+}
+
+// exprsToNodes converts each of the expressions to its serializable form.
+func exprsToNodes(exprs []Expr) ([]*exprNode, error) {
+	nodes := make([]*exprNode, len(exprs))
+	for i, e := range exprs {
+		n, err := exprToNode(e)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// identsToNodes converts each of the identifiers to its serializable form.
+func identsToNodes(idents []*IdentLiteral) []*exprNode {
+	nodes := make([]*exprNode, len(idents))
+	for i, ident := range idents {
+		nodes[i] = &exprNode{Kind: "ident", Val: ident.Val, Pos: ident.Pos, End: ident.End}
+	}
+	return nodes
+}
+
+// exprToNode converts the expression to its serializable form. Returns an
+// error for function literals other than the operators, as their functions
+// can't be serialized.
+func exprToNode(e Expr) (*exprNode, error) {
+	n := &exprNode{Pos: e.SourcePos(), End: e.SourceSpan().End}
+	var err error
+	switch tE := e.(type) {
+	case *IdentLiteral:
+		n.Kind, n.Val = "ident", tE.Val
+	case *NumberLiteral:
+		n.Kind, n.Num = "number", tE.Num
+	case *NilLiteral:
+		n.Kind = "nil"
+	case *StringLiteral:
+		n.Kind, n.Val = "string", tE.Str
+	case *BoolLiteral:
+		n.Kind, n.Flag = "bool", tE.Bool
+	case *KeywordLiteral:
+		n.Kind, n.Val = "keyword", tE.Name
+	case *FuncLiteral:
+		if _, isOp := DefaultOperators.literal(tE.Name, tE.Pos, tE.End); !isOp {
+			return nil, fmt.Errorf("cannot serialize function literal '%s'", tE.Name)
+		}
+		n.Kind, n.Val = "op", tE.Name
+
+	case *CallExpr:
+		n.Kind = "call"
+		n.Exprs, err = exprsToNodes(tE.Exprs)
+	case *IfExpr:
+		n.Kind = "if"
+		cases := []Expr{tE.Cond, tE.Case1}
+		if tE.Case2 != nil {
+			cases = append(cases, tE.Case2)
+		}
+		n.Exprs, err = exprsToNodes(cases)
+	case *CondExpr:
+		n.Kind = "cond"
+		for _, clause := range tE.Clauses {
+			var c condClauseNode
+			if clause.Test != nil {
+				if c.Test, err = exprToNode(clause.Test); err != nil {
+					return nil, err
+				}
+			}
+			if c.Body, err = exprsToNodes(clause.Body); err != nil {
+				return nil, err
+			}
+			n.Clauses = append(n.Clauses, c)
+		}
+	case *WhenExpr:
+		n.Kind, n.Flag = "when", tE.Negate
+		if n.Exprs, err = exprsToNodes([]Expr{tE.Cond}); err == nil {
+			n.Body, err = exprsToNodes(tE.Body)
+		}
+	case *WhileExpr:
+		n.Kind = "while"
+		if n.Exprs, err = exprsToNodes([]Expr{tE.Cond}); err == nil {
+			n.Body, err = exprsToNodes(tE.Body)
+		}
+	case *ForExpr:
+		n.Kind = "for"
+		err = bindingsToNode(n, []LetBinding{tE.Binding}, tE.Body)
+	case *DoTimesExpr:
+		n.Kind = "dotimes"
+		err = bindingsToNode(n, []LetBinding{tE.Binding}, tE.Body)
+	case *FnExpr:
+		n.Kind, n.Val, n.Flag = "fn", tE.Name, tE.Pure
+		for _, arg := range tE.Args {
+			n.Args = append(n.Args, argNode{Ident: arg.Ident, Keyword: arg.Keyword})
+		}
+		if tE.Rest != nil {
+			n.Rest = &argNode{Ident: tE.Rest.Ident, Keyword: tE.Rest.Keyword}
+		}
+		n.Body, err = exprsToNodes(tE.Body)
+	case *LetExpr:
+		n.Kind = "let"
+		err = bindingsToNode(n, []LetBinding{{Ident: tE.Ident, Value: tE.Value}}, nil)
+	case *BlockLetExpr:
+		n.Kind, n.Flag = "blockLet", tE.Sequential
+		err = bindingsToNode(n, tE.Bindings, tE.Body)
+	case *LetValuesExpr:
+		n.Kind = "letValues"
+		n.Idents = identsToNodes(tE.Idents)
+		if n.Exprs, err = exprsToNodes([]Expr{tE.Value}); err == nil {
+			n.Body, err = exprsToNodes(tE.Body)
+		}
+	case *DefStructExpr:
+		n.Kind = "defstruct"
+		n.Idents = identsToNodes(append([]*IdentLiteral{tE.Name}, tE.Fields...))
+	case *SetExpr:
+		n.Kind = "set"
+		err = bindingsToNode(n, []LetBinding{{Ident: tE.Ident, Value: tE.Value}}, nil)
+	case *TimeExpr:
+		n.Kind = "time"
+		n.Exprs, err = exprsToNodes([]Expr{tE.Expr})
+	case *DefTestExpr:
+		n.Kind, n.Val = "deftest", tE.Name
+		n.Body, err = exprsToNodes(tE.Body)
+	case *AssertErrorExpr:
+		n.Kind = "assertError"
+		n.Exprs, err = exprsToNodes([]Expr{tE.Expr})
+	case *ReturnExpr:
+		n.Kind = "return"
+		if tE.Expr != nil {
+			n.Exprs, err = exprsToNodes([]Expr{tE.Expr})
+		}
+	case *BreakExpr:
+		n.Kind, n.Flag = "break", tE.Continue
+	case *GoExpr:
+		n.Kind = "go"
+		n.Exprs, err = exprsToNodes([]Expr{tE.Expr})
+	case *MethodCallExpr:
+		n.Kind = "methodCall"
+		n.Idents = identsToNodes([]*IdentLiteral{tE.Method})
+		n.Exprs, err = exprsToNodes(append([]Expr{tE.Object}, tE.Args...))
+	case *DefGenericExpr:
+		n.Kind = "defgeneric"
+		n.Idents = identsToNodes(append([]*IdentLiteral{tE.Name}, tE.Params...))
+	case *DefMethodExpr:
+		n.Kind, n.Val = "defmethod", tE.Type
+		n.Idents = identsToNodes([]*IdentLiteral{tE.Name})
+		n.Exprs, err = exprsToNodes([]Expr{tE.Fn})
+	default:
+		return nil, fmt.Errorf("cannot serialize expression of type %T", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// bindingsToNode sets the idents, values and body of a node with bindings.
+func bindingsToNode(n *exprNode, bindings []LetBinding, body []Expr) error {
+	values := make([]Expr, len(bindings))
+	for i, b := range bindings {
+		n.Idents = append(n.Idents, identsToNodes([]*IdentLiteral{b.Ident})...)
+		values[i] = b.Value
+	}
+	var err error
+	if n.Exprs, err = exprsToNodes(values); err != nil {
+		return err
+	}
+	n.Body, err = exprsToNodes(body)
+	return err
+}
+
+// nodesToExprs converts each of the nodes back to an expression.
+func nodesToExprs(nodes []*exprNode) ([]Expr, error) {
+	exprs := make([]Expr, len(nodes))
+	for i, n := range nodes {
+		e, err := nodeToExpr(n)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = e
+	}
+	return exprs, nil
+}
+
+// nodesToIdents converts each of the nodes back to an identifier.
+func nodesToIdents(nodes []*exprNode) ([]*IdentLiteral, error) {
+	idents := make([]*IdentLiteral, len(nodes))
+	for i, n := range nodes {
+		if n == nil || n.Kind != "ident" {
+			return nil, fmt.Errorf("invalid expression node: expected an ident")
+		}
+		idents[i] = &IdentLiteral{Val: n.Val, Pos: n.Pos, End: n.End}
+	}
+	return idents, nil
+}
+
+// nodeShape checks that the node has the number of idents and exprs its kind
+// requires. A negative count is not checked.
+func nodeShape(n *exprNode, idents, exprs int) error {
+	if (idents >= 0 && len(n.Idents) != idents) || (exprs >= 0 && len(n.Exprs) != exprs) {
+		return fmt.Errorf("invalid expression node: malformed %s", n.Kind)
+	}
+	return nil
+}
+
+// nodeToExpr converts the node back to an expression. Returns an error if
+// the node is malformed.
+func nodeToExpr(n *exprNode) (Expr, error) {
+	if n == nil {
+		return nil, fmt.Errorf("invalid expression node: missing expression")
+	}
+	idents, err := nodesToIdents(n.Idents)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := nodesToExprs(n.Exprs)
+	if err != nil {
+		return nil, err
+	}
+	body, err := nodesToExprs(n.Body)
+	if err != nil {
+		return nil, err
+	}
+	pos, end := n.Pos, n.End
+
+	switch n.Kind {
+	case "ident":
+		return &IdentLiteral{Val: n.Val, Pos: pos, End: end}, nil
+	case "number":
+		return &NumberLiteral{Num: n.Num, Pos: pos, End: end}, nil
+	case "nil":
+		return &NilLiteral{Pos: pos, End: end}, nil
+	case "string":
+		return &StringLiteral{Str: n.Val, Pos: pos, End: end}, nil
+	case "bool":
+		return &BoolLiteral{Bool: n.Flag, Pos: pos, End: end}, nil
+	case "keyword":
+		return &KeywordLiteral{Name: n.Val, Pos: pos, End: end}, nil
+	case "op":
+		fl, isOp := DefaultOperators.literal(n.Val, pos, end)
+		if !isOp {
+			return nil, fmt.Errorf("invalid expression node: unknown operator '%s'", n.Val)
+		}
+		return fl, nil
+
+	case "call":
+		if len(exprs) == 0 {
+			return nil, fmt.Errorf("invalid expression node: malformed call")
+		}
+		return &CallExpr{Exprs: exprs, Pos: pos, End: end}, nil
+	case "if":
+		if len(exprs) != 2 && len(exprs) != 3 {
+			return nil, fmt.Errorf("invalid expression node: malformed if")
+		}
+		ifE := &IfExpr{Cond: exprs[0], Case1: exprs[1], Pos: pos, End: end}
+		if len(exprs) == 3 {
+			ifE.Case2 = exprs[2]
+		}
+		return ifE, nil
+	case "cond":
+		condE := &CondExpr{Pos: pos, End: end}
+		for _, c := range n.Clauses {
+			var clause CondClause
+			if c.Test != nil {
+				if clause.Test, err = nodeToExpr(c.Test); err != nil {
+					return nil, err
+				}
+			}
+			if clause.Body, err = nodesToExprs(c.Body); err != nil {
+				return nil, err
+			}
+			condE.Clauses = append(condE.Clauses, clause)
+		}
+		return condE, nil
+	case "when":
+		if err := nodeShape(n, 0, 1); err != nil {
+			return nil, err
+		}
+		return &WhenExpr{Cond: exprs[0], Body: body, Negate: n.Flag, Pos: pos, End: end}, nil
+	case "while":
+		if err := nodeShape(n, 0, 1); err != nil {
+			return nil, err
+		}
+		return &WhileExpr{Cond: exprs[0], Body: body, Pos: pos, End: end}, nil
+	case "for", "dotimes":
+		if err := nodeShape(n, 1, 1); err != nil {
+			return nil, err
+		}
+		binding := LetBinding{Ident: idents[0], Value: exprs[0]}
+		if n.Kind == "for" {
+			return &ForExpr{Binding: binding, Body: body, Pos: pos, End: end}, nil
+		}
+		return &DoTimesExpr{Binding: binding, Body: body, Pos: pos, End: end}, nil
+	case "fn":
+		fnE := &FnExpr{Name: n.Val, Pure: n.Flag, Body: body, Pos: pos, End: end}
+		for _, arg := range n.Args {
+			fnE.Args = append(fnE.Args, Arg{Ident: arg.Ident, Keyword: arg.Keyword})
+		}
+		if n.Rest != nil {
+			fnE.Rest = &Arg{Ident: n.Rest.Ident, Keyword: n.Rest.Keyword}
+		}
+		return fnE, nil
+	case "let", "set":
+		if err := nodeShape(n, 1, 1); err != nil {
+			return nil, err
+		}
+		if n.Kind == "let" {
+			return &LetExpr{Ident: idents[0], Value: exprs[0], Pos: pos, End: end}, nil
+		}
+		return &SetExpr{Ident: idents[0], Value: exprs[0], Pos: pos, End: end}, nil
+	case "blockLet":
+		if err := nodeShape(n, len(exprs), -1); err != nil {
+			return nil, err
+		}
+		blockE := &BlockLetExpr{Body: body, Sequential: n.Flag, Pos: pos, End: end}
+		for i, ident := range idents {
+			blockE.Bindings = append(blockE.Bindings, LetBinding{Ident: ident, Value: exprs[i]})
+		}
+		return blockE, nil
+	case "letValues":
+		if err := nodeShape(n, -1, 1); err != nil {
+			return nil, err
+		}
+		return &LetValuesExpr{
+			Idents: idents, Value: exprs[0], Body: body, Pos: pos, End: end,
+		}, nil
+	case "defstruct":
+		if len(idents) == 0 {
+			return nil, fmt.Errorf("invalid expression node: malformed defstruct")
+		}
+		return &DefStructExpr{Name: idents[0], Fields: idents[1:], Pos: pos, End: end}, nil
+	case "time", "assertError", "go":
+		if err := nodeShape(n, 0, 1); err != nil {
+			return nil, err
+		}
+		switch n.Kind {
+		case "time":
+			return &TimeExpr{Expr: exprs[0], Pos: pos, End: end}, nil
+		case "assertError":
+			return &AssertErrorExpr{Expr: exprs[0], Pos: pos, End: end}, nil
+		default:
+			return &GoExpr{Expr: exprs[0], Pos: pos, End: end}, nil
+		}
+	case "deftest":
+		return &DefTestExpr{Name: n.Val, Body: body, Pos: pos, End: end}, nil
+	case "return":
+		if len(exprs) > 1 {
+			return nil, fmt.Errorf("invalid expression node: malformed return")
+		}
+		returnE := &ReturnExpr{Pos: pos, End: end}
+		if len(exprs) == 1 {
+			returnE.Expr = exprs[0]
+		}
+		return returnE, nil
+	case "break":
+		return &BreakExpr{Continue: n.Flag, Pos: pos, End: end}, nil
+	case "methodCall":
+		if err := nodeShape(n, 1, -1); err != nil || len(exprs) == 0 {
+			return nil, fmt.Errorf("invalid expression node: malformed methodCall")
+		}
+		return &MethodCallExpr{
+			Object: exprs[0], Method: idents[0], Args: exprs[1:], Pos: pos, End: end,
+		}, nil
+	case "defgeneric":
+		if len(idents) == 0 {
+			return nil, fmt.Errorf("invalid expression node: malformed defgeneric")
+		}
+		return &DefGenericExpr{Name: idents[0], Params: idents[1:], Pos: pos, End: end}, nil
+	case "defmethod":
+		if err := nodeShape(n, 1, 1); err != nil {
+			return nil, err
+		}
+		fnE, isFn := exprs[0].(*FnExpr)
+		if !isFn {
+			return nil, fmt.Errorf("invalid expression node: malformed defmethod")
+		}
+		return &DefMethodExpr{
+			Name: idents[0], Type: n.Val, Fn: fnE, Pos: pos, End: end,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid expression node: unknown kind '%s'", n.Kind)
+	}
+}
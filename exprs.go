@@ -1,6 +1,7 @@
 package golisp2
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -18,13 +19,17 @@ type (
 
 		// SourcePos returns the location that the expression started in the source.
 		SourcePos() ScannerPosition
+
+		// SourceSpan returns the extent of the expression in the source: from
+		// SourcePos up to the end of its last token.
+		SourceSpan() SourceSpan
 	}
 
 	// CallExpr is a function call. The first expression is treated as a function,
 	// with the remaining elements passed to it.
 	CallExpr struct {
-		Exprs []Expr
-		Pos   ScannerPosition
+		Exprs    []Expr
+		Pos, End ScannerPosition
 	}
 
 	// IfExpr is an if expression. Cond is evaluated: if true, Case1 is
@@ -32,28 +37,229 @@ type (
 	IfExpr struct {
 		Cond         Expr
 		Case1, Case2 Expr
-		Pos          ScannerPosition
+		Pos, End     ScannerPosition
+	}
+
+	// CondExpr is a multi-way conditional. Each clause's test is evaluated in
+	// order; the body of the first that is true is evaluated and returned.
+	CondExpr struct {
+		Clauses  []CondClause
+		Pos, End ScannerPosition
+	}
+
+	// CondClause is a single test/body pair in a cond expression. An else clause
+	// has no test, and always matches.
+	CondClause struct {
+		Test Expr
+		Body []Expr
+	}
+
+	// WhenExpr evaluates its body only if the condition is true; or if Negate is
+	// set (unless), only if it's false.
+	WhenExpr struct {
+		Cond     Expr
+		Body     []Expr
+		Negate   bool
+		Pos, End ScannerPosition
+	}
+
+	// WhileExpr repeatedly evaluates its body for as long as the condition is
+	// true.
+	WhileExpr struct {
+		Cond     Expr
+		Body     []Expr
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
+	}
+
+	// ForExpr evaluates its body once per element of a collection, with the
+	// element bound to the ident. Lists and sequences are iterated in order;
+	// maps by sorted key.
+	ForExpr struct {
+		Binding  LetBinding
+		Body     []Expr
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
+	}
+
+	// DoTimesExpr evaluates its body a fixed number of times, with the ident
+	// bound to the iteration count starting from zero.
+	DoTimesExpr struct {
+		Binding  LetBinding
+		Body     []Expr
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
 	}
 
 	// FnExpr is a function definition expression. It has a set of arguments and a
 	// body, and will evaluate the body with the given arguments when called.
 	FnExpr struct {
+		// Name, if set, is bound to the function itself within its body; so it can
+		// call itself recursively.
+		Name string
+
+		// Pure declares the function free of side effects: its body may only call
+		// pure functions. See FuncValue.Pure.
+		Pure bool
+
 		Args []Arg
-		Body []Expr
-		Pos  ScannerPosition
+
+		// Rest is an optional argument that collects any call arguments beyond
+		// Args into a list. If nil, calls must match Args exactly.
+		Rest *Arg
+
+		Body     []Expr
+		Pos, End ScannerPosition
+
+		// nameScope and scope are the lexical scopes of the context binding the
+		// function's name, and of the context its body is evaluated in.
+		nameScope, scope *lexicalScope
 	}
 
 	// Arg is a single element in a function list.
 	Arg struct {
 		Ident string
+
+		// Keyword, if set, makes this a keyword argument: it's passed by name
+		// (e.g. `:opts val`) after the positional arguments, rather than by
+		// position. It is nil if not passed.
+		Keyword string
 	}
 
 	// LetExpr represents an assignment of a value to an identifier. When
 	// evaluated, adds the value to the evaluation context.
 	LetExpr struct {
+		Ident    *IdentLiteral
+		Value    Expr
+		Pos, End ScannerPosition
+	}
+
+	// BlockLetExpr binds a set of values in a new scope, and evaluates a body
+	// within it. The scope is discarded once the body has been evaluated.
+	BlockLetExpr struct {
+		Bindings []LetBinding
+		Body     []Expr
+
+		// Sequential indicates each binding is evaluated in the scope of the
+		// bindings before it (let*). Otherwise, all are evaluated in the enclosing
+		// scope (let).
+		Sequential bool
+
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
+	}
+
+	// LetValuesExpr binds each of the values an expression returns with values
+	// to an ident, in a new scope, and evaluates a body within it. A single,
+	// plain value can be bound to one ident.
+	LetValuesExpr struct {
+		Idents   []*IdentLiteral
+		Value    Expr
+		Body     []Expr
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
+	}
+
+	// LetBinding is a single ident/value pair in a block let.
+	LetBinding struct {
 		Ident *IdentLiteral
 		Value Expr
-		Pos   ScannerPosition
+	}
+
+	// DefStructExpr declares a struct type. When evaluated, it adds a
+	// constructor named after the struct, an accessor for each field named
+	// `name-field`, and a predicate named `name?` to the context.
+	DefStructExpr struct {
+		Name     *IdentLiteral
+		Fields   []*IdentLiteral
+		Pos, End ScannerPosition
+	}
+
+	// SetExpr represents the mutation of an existing binding. When evaluated,
+	// replaces the value of the ident in the nearest context that defines it.
+	SetExpr struct {
+		Ident    *IdentLiteral
+		Value    Expr
+		Pos, End ScannerPosition
+	}
+
+	// TimeExpr evaluates an expression, and prints how long it took. The value
+	// of the expression is returned.
+	TimeExpr struct {
+		Expr     Expr
+		Pos, End ScannerPosition
+	}
+
+	// DefTestExpr declares a script test. Evaluating it registers the test with
+	// the context, rather than running it; see RunScriptTests.
+	DefTestExpr struct {
+		Name     string
+		Body     []Expr
+		Pos, End ScannerPosition
+	}
+
+	// AssertErrorExpr evaluates an expression that is expected to fail. It
+	// returns the message of the error if it does, and fails itself if not.
+	AssertErrorExpr struct {
+		Expr     Expr
+		Pos, End ScannerPosition
+	}
+
+	// ReturnExpr ends the call of the function it's in early, which returns
+	// the value of Expr; or nil if there is none.
+	ReturnExpr struct {
+		Expr     Expr
+		Pos, End ScannerPosition
+	}
+
+	// BreakExpr stops the innermost loop it's in; or, if Continue is set, skips
+	// to the loop's next iteration.
+	BreakExpr struct {
+		Continue bool
+		Pos, End ScannerPosition
+	}
+
+	// GoExpr evaluates an expression on a new goroutine. It immediately returns
+	// a channel, that receives the expression's value once it's done.
+	GoExpr struct {
+		Expr     Expr
+		Pos, End ScannerPosition
+
+		scope *lexicalScope
+	}
+
+	// DefGenericExpr declares a generic function, whose behavior is defined
+	// separately for each type of its first argument with defmethod. When
+	// evaluated, it binds the function to Name.
+	DefGenericExpr struct {
+		Name     *IdentLiteral
+		Params   []*IdentLiteral
+		Pos, End ScannerPosition
+	}
+
+	// DefMethodExpr defines the method of a generic function that's called
+	// when its first argument is of type Type, as named by typeOf. A method for
+	// the type "any" is called for values of types without a method.
+	DefMethodExpr struct {
+		Name     *IdentLiteral
+		Type     string
+		Fn       *FnExpr
+		Pos, End ScannerPosition
+	}
+
+	// MethodCallExpr calls a method of an object: the function in the object's
+	// slot of the same name, with the object as its first argument, followed by
+	// Args.
+	MethodCallExpr struct {
+		Object   Expr
+		Method   *IdentLiteral
+		Args     []Expr
+		Pos, End ScannerPosition
 	}
 )
 
@@ -67,18 +273,35 @@ func NewCallExpr(exprs ...Expr) *CallExpr {
 }
 
 // Eval will evaluate the expression and return its results.
-func (ce *CallExpr) Eval(ec *EvalContext) (Value, error) {
+func (ce *CallExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(ce)(&v, &err)
 	if len(ce.Exprs) == 0 {
-		return &NilValue{}, nil
+		return Nil, nil
+	}
+	if err := checkHalted(ec, ce.Pos); err != nil {
+		return nil, err
 	}
 
 	fn, fnErr := evalToFunc(ec, ce.Exprs[0])
 	if fnErr != nil {
 		return nil, fnErr
 	}
+	return callFunc(ec, fn, calledName(ce, fn), nil, ce.Exprs[1:], ce.Pos)
+}
+
+// callFunc evaluates the argument expressions, and calls the function with the
+// leading values followed by them. name is what the function was called as, for
+// errors.
+func callFunc(
+	ec *EvalContext, fn *FuncValue, name string, leading []Value, argExprs []Expr,
+	pos ScannerPosition,
+) (Value, error) {
+	if err := ec.checkCallable(fn, pos); err != nil {
+		return nil, err
+	}
 
-	vals := []Value{}
-	for _, expr := range ce.Exprs[1:] {
+	vals := append([]Value{}, leading...)
+	for _, expr := range argExprs {
 		v, err := expr.Eval(ec)
 		if err != nil {
 			// todo (bs): augment with trace
@@ -86,10 +309,92 @@ func (ce *CallExpr) Eval(ec *EvalContext) (Value, error) {
 		}
 		vals = append(vals, v)
 	}
-	callVal, callValErr := fn.Fn(ec, vals...)
+	return invokeFunc(ec, fn, name, vals, pos)
+}
+
+// callValue calls a function value a builtin was passed, such as the function
+// listMap or apply applies, with the arguments. It's checked like a call
+// expression is, so builtins can't be used to get around the depth limit, pure
+// or deterministic mode.
+func (ec *EvalContext) callValue(fn *FuncValue, args ...Value) (Value, error) {
+	pos := ec.CallPos()
+	if err := ec.checkCallable(fn, pos); err != nil {
+		return nil, err
+	}
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return invokeFunc(ec, fn, name, args, pos)
+}
+
+// checkCallable returns an error if the function can't be called at the
+// position at all: calls are nested too deeply, it's deprecated in strict mode,
+// or it's nondeterministic in deterministic mode.
+func (ec *EvalContext) checkCallable(fn *FuncValue, pos ScannerPosition) error {
+	if err := ec.checkDepth(pos); err != nil {
+		return err
+	}
+	if fn.Deprecated != nil {
+		if err := ec.warnDeprecated(fn, pos); err != nil {
+			return err
+		}
+	}
+	// replayed effects are reproducible, so are allowed.
+	if fn.Nondeterministic && ec.Deterministic() && !ec.replaying() {
+		return &EvalError{
+			Msg: fmt.Sprintf(
+				"'%s' cannot be called in deterministic mode", fn.Name),
+			Pos: pos,
+		}
+	}
+	return nil
+}
+
+// invokeFunc calls the function with its argument values, once checkCallable
+// has allowed it.
+func invokeFunc(
+	ec *EvalContext, fn *FuncValue, name string, vals []Value, pos ScannerPosition,
+) (Value, error) {
+	if err := fn.checkArgCount(name, len(vals), pos); err != nil {
+		return nil, err
+	}
+	if err := ec.checkPure(fn, vals, pos); err != nil {
+		return nil, err
+	}
+	if isBuiltin(fn) {
+		ec.metrics().BuiltinCalled(fn.Name)
+	}
+	var callVal Value
+	var callValErr error
+	if fn.Traced {
+		endSpan := ec.startSpan("golisp.call", map[string]string{
+			"golisp.fn":  name,
+			"golisp.pos": spanPos(pos),
+		})
+		callVal, callValErr = ec.hookCall(fn, vals, pos)
+		endSpan(callValErr)
+	} else {
+		callVal, callValErr = ec.hookCall(fn, vals, pos)
+	}
+	if callValErr != nil {
+		addStackFrame(callValErr, pos)
+	}
 	return callVal, callValErr
 }
 
+// calledName returns the best available name for the function being called:
+// the ident it was called through, or else it's registered name.
+func calledName(ce *CallExpr, fn *FuncValue) string {
+	if asIdent, isIdent := ce.Exprs[0].(*IdentLiteral); isIdent {
+		return asIdent.Val
+	}
+	if fn.Name != "" {
+		return fn.Name
+	}
+	return "<anonymous>"
+}
+
 // CodeStr will return the code representation of the call expression.
 func (ce *CallExpr) CodeStr() string {
 	var sb strings.Builder
@@ -109,6 +414,11 @@ func (ce *CallExpr) SourcePos() ScannerPosition {
 	return ce.Pos
 }
 
+// SourceSpan is the extent in source of this expression.
+func (ce *CallExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: ce.Pos, End: ce.End}
+}
+
 // NewIfExpr builds a new if statement with the given condition and cases. The
 // cases may be left nil.
 func NewIfExpr(cond Expr, case1, case2 Expr) *IfExpr {
@@ -127,20 +437,13 @@ func NewIfExpr(cond Expr, case1, case2 Expr) *IfExpr {
 
 // Eval evaluates the if and returns the evaluated contents of the according
 // case.
-func (ie *IfExpr) Eval(ec *EvalContext) (Value, error) {
-	condV, condVErr := ie.Cond.Eval(ec)
-	if condVErr != nil {
-		return nil, condVErr
-	}
-	asBool, isBool := condV.(*BoolValue)
-	if !isBool {
-		return nil, &TypeError{
-			Actual:   fmt.Sprintf("%T", condV),
-			Expected: fmt.Sprintf("%T", (*BoolValue)(nil)),
-			Pos:      ie.Cond.SourcePos(),
-		}
+func (ie *IfExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(ie)(&v, &err)
+	isTrue, err := evalCond(ec, ie.Cond)
+	if err != nil {
+		return nil, err
 	}
-	if asBool.Val {
+	if isTrue {
 		return ie.Case1.Eval(ec)
 	}
 	return ie.Case2.Eval(ec)
@@ -164,6 +467,289 @@ func (ie *IfExpr) SourcePos() ScannerPosition {
 	return ie.Pos
 }
 
+// SourceSpan is the extent in source of this expression.
+func (ie *IfExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: ie.Pos, End: ie.End}
+}
+
+// Eval evaluates the clause tests in order, and returns the evaluated body of
+// the first that's true. Returns nil if none are.
+func (ce *CondExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(ce)(&v, &err)
+	for _, c := range ce.Clauses {
+		if c.Test != nil {
+			isTrue, err := evalCond(ec, c.Test)
+			if err != nil {
+				return nil, err
+			}
+			if !isTrue {
+				continue
+			}
+		}
+		return evalBody(ec, c.Body)
+	}
+	return Nil, nil
+}
+
+// CodeStr will return the code representation of the cond expression.
+func (ce *CondExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(cond")
+	for _, c := range ce.Clauses {
+		sb.WriteString("\n(")
+		if c.Test != nil {
+			sb.WriteString(c.Test.CodeStr())
+		} else {
+			sb.WriteString("else")
+		}
+		for _, e := range c.Body {
+			sb.WriteString(" ")
+			sb.WriteString(e.CodeStr())
+		}
+		sb.WriteString(")")
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (ce *CondExpr) SourcePos() ScannerPosition {
+	return ce.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (ce *CondExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: ce.Pos, End: ce.End}
+}
+
+// Eval evaluates and returns the body if the condition matches; otherwise
+// returns nil.
+func (we *WhenExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(we)(&v, &err)
+	isTrue, err := evalCond(ec, we.Cond)
+	if err != nil {
+		return nil, err
+	}
+	if isTrue == we.Negate {
+		return Nil, nil
+	}
+	return evalBody(ec, we.Body)
+}
+
+// CodeStr will return the code representation of the when/unless expression.
+func (we *WhenExpr) CodeStr() string {
+	var sb strings.Builder
+	if we.Negate {
+		sb.WriteString("(unless ")
+	} else {
+		sb.WriteString("(when ")
+	}
+	sb.WriteString(we.Cond.CodeStr())
+	for _, e := range we.Body {
+		sb.WriteString("\n")
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (we *WhenExpr) SourcePos() ScannerPosition {
+	return we.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (we *WhenExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: we.Pos, End: we.End}
+}
+
+// Eval evaluates the body in a fresh scope for as long as the condition is
+// true. Always returns nil.
+func (we *WhileExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(we)(&v, &err)
+	for {
+		if err := checkHalted(ec, we.Pos); err != nil {
+			return nil, err
+		}
+		isTrue, err := evalCond(ec, we.Cond)
+		if err != nil {
+			return nil, err
+		}
+		if !isTrue {
+			return Nil, nil
+		}
+		iterEc := ec.SubContext(nil)
+		iterEc.scope = we.scope
+		stop, err := evalLoopBody(iterEc, we.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			return Nil, nil
+		}
+	}
+}
+
+// CodeStr will return the code representation of the while expression.
+func (we *WhileExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(while ")
+	sb.WriteString(we.Cond.CodeStr())
+	for _, e := range we.Body {
+		sb.WriteString("\n")
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (we *WhileExpr) SourcePos() ScannerPosition {
+	return we.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (we *WhileExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: we.Pos, End: we.End}
+}
+
+// Eval evaluates the body once per element of the collection, each in a fresh
+// scope with the element bound. Always returns nil.
+func (fe *ForExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(fe)(&v, &err)
+	collV, collErr := fe.Binding.Value.Eval(ec)
+	if collErr != nil {
+		return nil, collErr
+	}
+	var elems *SeqValue
+	switch tV := collV.(type) {
+	case *ListValue:
+		elems = NewListSeq(tV)
+	case *SeqValue:
+		elems = tV
+	case *MapValue:
+		keys := &ListValue{Vals: make([]Value, 0, len(tV.Vals))}
+		for _, k := range sortedKeys(tV.Vals) {
+			keys.Vals = append(keys.Vals, &StringValue{Val: k})
+		}
+		elems = NewListSeq(keys)
+	default:
+		return nil, &TypeError{
+			Actual:   fmt.Sprintf("%T", collV),
+			Expected: fmt.Sprintf("%T", (*ListValue)(nil)),
+			Pos:      fe.Binding.Value.SourcePos(),
+		}
+	}
+
+	iter := elems.Iter()
+	for {
+		if err := checkHalted(ec, fe.Pos); err != nil {
+			return nil, err
+		}
+		elem, ok, err := iter(ec)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		iterEc := ec.SubContext(map[string]Value{
+			fe.Binding.Ident.Val: elem,
+		})
+		iterEc.scope = fe.scope
+		stop, err := evalLoopBody(iterEc, fe.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+	}
+	return Nil, nil
+}
+
+// CodeStr will return the code representation of the for expression.
+func (fe *ForExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("(for (%s %s)",
+		fe.Binding.Ident.Val, fe.Binding.Value.CodeStr()))
+	for _, e := range fe.Body {
+		sb.WriteString("\n")
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (fe *ForExpr) SourcePos() ScannerPosition {
+	return fe.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (fe *ForExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: fe.Pos, End: fe.End}
+}
+
+// Eval evaluates the body the given number of times, each in a fresh scope
+// with the iteration count bound. Always returns nil.
+func (dte *DoTimesExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(dte)(&v, &err)
+	countV, countErr := dte.Binding.Value.Eval(ec)
+	if countErr != nil {
+		return nil, countErr
+	}
+	asNum, isNum := countV.(*NumberValue)
+	if !isNum {
+		return nil, &TypeError{
+			Actual:   fmt.Sprintf("%T", countV),
+			Expected: fmt.Sprintf("%T", (*NumberValue)(nil)),
+			Pos:      dte.Binding.Value.SourcePos(),
+		}
+	}
+
+	for i := 0; float64(i) < asNum.Val; i++ {
+		if err := checkHalted(ec, dte.Pos); err != nil {
+			return nil, err
+		}
+		iterEc := ec.SubContext(map[string]Value{
+			dte.Binding.Ident.Val: NewNumberValue(float64(i)),
+		})
+		iterEc.scope = dte.scope
+		stop, err := evalLoopBody(iterEc, dte.Body)
+		if err != nil {
+			return nil, err
+		}
+		if stop {
+			break
+		}
+	}
+	return Nil, nil
+}
+
+// CodeStr will return the code representation of the dotimes expression.
+func (dte *DoTimesExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("(dotimes (%s %s)",
+		dte.Binding.Ident.Val, dte.Binding.Value.CodeStr()))
+	for _, e := range dte.Body {
+		sb.WriteString("\n")
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (dte *DoTimesExpr) SourcePos() ScannerPosition {
+	return dte.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (dte *DoTimesExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: dte.Pos, End: dte.End}
+}
+
 // NewFnExpr builds a new function expression with the given arguments and body.
 func NewFnExpr(args []Arg, body []Expr) *FnExpr {
 	return &FnExpr{
@@ -175,54 +761,172 @@ func NewFnExpr(args []Arg, body []Expr) *FnExpr {
 // Eval returns an evaluate-able function value. Note that this does *not*
 // execute the function; it must be evaluated within a call to be actually
 // executed.
-func (fe *FnExpr) Eval(parentEc *EvalContext) (Value, error) {
+func (fe *FnExpr) Eval(parentEc *EvalContext) (v Value, err error) {
+	defer parentEc.hookExpr(fe)(&v, &err)
 
 	// ques (bs): how should stack traces work here? At this point, for full
 	// traces (rather than just "origination errors")
 
-	fn := func(_ *EvalContext, vals ...Value) (Value, error) {
-		if len(fe.Args) != len(vals) {
+	fv := &FuncValue{
+		Name: fe.Name,
+		Pure: fe.Pure || parentEc.pureOnly(),
+		def:  fe,
+	}
+	scopeEc := parentEc
+	if fe.Name != "" {
+		scopeEc = parentEc.SubContext(map[string]Value{
+			fe.Name: fv,
+		})
+		scopeEc.scope = fe.nameScope
+	}
+
+	positional, keywords := fe.Args, []Arg(nil)
+	for i, arg := range fe.Args {
+		if arg.Keyword != "" {
+			positional, keywords = fe.Args[:i], fe.Args[i:]
+			break
+		}
+	}
+	fv.Params = make([]string, 0, len(fe.Args)+1)
+	for _, arg := range positional {
+		fv.Params = append(fv.Params, arg.Ident)
+	}
+	for _, arg := range keywords {
+		fv.Params = append(fv.Params, ":"+arg.Keyword)
+	}
+	fv.MinArgs, fv.MaxArgs = len(positional), len(positional)+2*len(keywords)
+	if fe.Rest != nil {
+		fv.Params = append(fv.Params, fe.Rest.Ident)
+		fv.MaxArgs = -1
+	}
+
+	fv.Fn = func(callEc *EvalContext, vals ...Value) (Value, error) {
+		if fe.Rest == nil && keywords == nil && len(positional) != len(vals) {
 
 			// todo (bs): add pos information.
-			return nil, fmt.Errorf("expected %d arguments in call; got %d",
-				len(fe.Args), len(vals))
+			return nil, errors.New(formatMessage(ArgCountMsg, struct {
+				Expected, Actual int
+			}{len(positional), len(vals)}))
+		}
+		if len(vals) < len(positional) {
+			return nil, errors.New(formatMessage(MinArgCountMsg, struct {
+				Expected, Actual int
+			}{len(positional), len(vals)}))
 		}
 
-		evalEc := parentEc.SubContext(nil)
-		for i, arg := range fe.Args {
+		evalEc := scopeEc.SubContext(nil)
+		evalEc.pure = fe.Pure
+		evalEc.scope = fe.scope
+		if callEc != nil {
+			evalEc.depth = callEc.depth
+			evalEc.ctx = callEc.ctx
+		}
+		for i, arg := range positional {
 			evalEc.Add(arg.Ident, vals[i])
 		}
+		if keywords != nil {
+			if err := bindKeywordArgs(evalEc, keywords, vals[len(positional):]); err != nil {
+				return nil, err
+			}
+		}
+		if fe.Rest != nil {
+			restVals := make([]Value, len(vals)-len(positional))
+			copy(restVals, vals[len(positional):])
+			evalEc.Add(fe.Rest.Ident, &ListValue{
+				Vals: restVals,
+			})
+		}
 
 		var evalV Value
 		for _, e := range fe.Body {
 			v, err := e.Eval(evalEc)
 			if err != nil {
+				var ret *returnSignal
+				if errors.As(err, &ret) {
+					return ret.Val, nil
+				}
+				var ls *loopSignal
+				if errors.As(err, &ls) {
+					return nil, ls.outsideLoop()
+				}
 				// todo (bs): add pos information
 				return nil, err
 			}
 			evalV = v
 		}
 		if evalV == nil {
-			evalV = &NilValue{}
+			evalV = Nil
 		}
 		return evalV, nil
 	}
 
-	return &FuncValue{
-		Fn: fn,
-	}, nil
+	return fv, nil
+}
+
+// bindKeywordArgs adds the keyword arguments to the context from the given
+// `:key value` pairs. Any that aren't passed are bound to nil.
+func bindKeywordArgs(ec *EvalContext, keywords []Arg, vals []Value) error {
+	passed := map[string]Value{}
+	for i := 0; i < len(vals); i += 2 {
+		asKeyword, isKeyword := vals[i].(*KeywordValue)
+		if !isKeyword {
+			return errors.New(formatMessage(KeywordArgMsg, struct {
+				Actual string
+			}{vals[i].InspectStr()}))
+		}
+		if i+1 >= len(vals) {
+			return errors.New(formatMessage(KeywordArgValueMsg, struct {
+				Keyword string
+			}{asKeyword.Val}))
+		}
+		passed[asKeyword.Val] = vals[i+1]
+	}
+	for _, arg := range keywords {
+		v, isPassed := passed[arg.Keyword]
+		if !isPassed {
+			v = Nil
+		}
+		delete(passed, arg.Keyword)
+		ec.Add(arg.Ident, v)
+	}
+	for k := range passed {
+		return errors.New(formatMessage(UnknownKeywordArgMsg, struct {
+			Keyword string
+		}{k}))
+	}
+	return nil
 }
 
 // CodeStr will return the code representation of the fn expression.
 func (fe *FnExpr) CodeStr() string {
 	var sb strings.Builder
-	sb.WriteString("(fn (")
+	sb.WriteString("(fn ")
+	if fe.Name != "" {
+		sb.WriteString(fe.Name)
+		sb.WriteString(" ")
+	}
+	if fe.Pure {
+		sb.WriteString(":pure ")
+	}
+	sb.WriteString("(")
 	for i, a := range fe.Args {
 		if i > 0 {
 			sb.WriteString(" ")
 		}
+		if a.Keyword != "" {
+			sb.WriteString(":")
+			sb.WriteString(a.Keyword)
+			sb.WriteString(" ")
+		}
 		sb.WriteString(a.Ident)
 	}
+	if fe.Rest != nil {
+		if len(fe.Args) > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(". ")
+		sb.WriteString(fe.Rest.Ident)
+	}
 	sb.WriteString(")\n")
 
 	for _, e := range fe.Body {
@@ -237,15 +941,32 @@ func (fe *FnExpr) SourcePos() ScannerPosition {
 	return fe.Pos
 }
 
+// SourceSpan is the extent in source of this expression.
+func (fe *FnExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: fe.Pos, End: fe.End}
+}
+
 // Eval will assign the underlying value to the ident on the context, and return
 // the value.
-func (le *LetExpr) Eval(ec *EvalContext) (Value, error) {
+func (le *LetExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(le)(&v, &err)
 	identStr := le.Ident.Val
-	v, err := le.Value.Eval(ec)
+	if err := checkSealed(ec, identStr, le.Ident.Pos); err != nil {
+		return nil, err
+	}
+	v, err = le.Value.Eval(ec)
 	if err != nil {
 		// todo (bs): maybe add pos information
 		return nil, err
 	}
+	if builtin, isBuiltin := builtinFns[identStr]; isBuiltin {
+		if prev, _ := ec.Resolve(identStr); prev == Value(builtin) {
+			err := ec.warnAt(fmt.Sprintf("let shadows builtin '%s'", identStr), le.Pos)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	ec.Add(identStr, v)
 	return v, nil
 }
@@ -260,8 +981,736 @@ func (le *LetExpr) SourcePos() ScannerPosition {
 	return le.Pos
 }
 
+// SourceSpan is the extent in source of this expression.
+func (le *LetExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: le.Pos, End: le.End}
+}
+
+// Eval binds the values in a new sub-context, and evaluates the body within it.
+// Returns the value of the last body expression.
+func (ble *BlockLetExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(ble)(&v, &err)
+	var blockEc *EvalContext
+	if ble.Sequential {
+		blockEc = ec.SubContext(nil)
+		blockEc.scope = ble.scope
+		for _, b := range ble.Bindings {
+			v, err := b.Value.Eval(blockEc)
+			if err != nil {
+				return nil, err
+			}
+			blockEc.Add(b.Ident.Val, v)
+		}
+	} else {
+		vals := make(map[string]Value, len(ble.Bindings))
+		for _, b := range ble.Bindings {
+			v, err := b.Value.Eval(ec)
+			if err != nil {
+				return nil, err
+			}
+			vals[b.Ident.Val] = v
+		}
+		blockEc = ec.SubContext(vals)
+		blockEc.scope = ble.scope
+	}
+	return evalBody(blockEc, ble.Body)
+}
+
+// CodeStr will return the code representation of the block let expression.
+func (ble *BlockLetExpr) CodeStr() string {
+	var sb strings.Builder
+	if ble.Sequential {
+		sb.WriteString("(let* (")
+	} else {
+		sb.WriteString("(let (")
+	}
+	for i, b := range ble.Bindings {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(fmt.Sprintf("(%s %s)", b.Ident.Val, b.Value.CodeStr()))
+	}
+	sb.WriteString(")\n")
+	for _, e := range ble.Body {
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (ble *BlockLetExpr) SourcePos() ScannerPosition {
+	return ble.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (ble *BlockLetExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: ble.Pos, End: ble.End}
+}
+
+// Eval evaluates the value, binds each of its values, and evaluates the body.
+// Fails if the number of values doesn't match the number of idents.
+func (lve *LetValuesExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(lve)(&v, &err)
+	valsV, err := lve.Value.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	results := []Value{valsV}
+	if asValues, isValues := valsV.(*ValuesValue); isValues {
+		results = asValues.Vals
+	}
+	if len(results) != len(lve.Idents) {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("letValues expects %d values; got %d",
+				len(lve.Idents), len(results)),
+			Pos: lve.Value.SourcePos(),
+		}
+	}
+	vals := make(map[string]Value, len(lve.Idents))
+	for i, ident := range lve.Idents {
+		vals[ident.Val] = results[i]
+	}
+	bodyEc := ec.SubContext(vals)
+	bodyEc.scope = lve.scope
+	return evalBody(bodyEc, lve.Body)
+}
+
+// CodeStr will return the code representation of the letValues expression.
+func (lve *LetValuesExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(letValues ((")
+	for i, ident := range lve.Idents {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(ident.Val)
+	}
+	sb.WriteString(fmt.Sprintf(") %s)\n", lve.Value.CodeStr()))
+	for _, e := range lve.Body {
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (lve *LetValuesExpr) SourcePos() ScannerPosition {
+	return lve.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (lve *LetValuesExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: lve.Pos, End: lve.End}
+}
+
+// Eval adds the struct's constructor, accessors and predicate to the context.
+// Returns the constructor.
+func (dse *DefStructExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(dse)(&v, &err)
+	st := &StructType{
+		Name: dse.Name.Val,
+	}
+	for _, f := range dse.Fields {
+		st.Fields = append(st.Fields, f.Val)
+	}
+	defined := []string{st.Name, st.Name + "?"}
+	for _, f := range st.Fields {
+		defined = append(defined, fmt.Sprintf("%s-%s", st.Name, f))
+	}
+	for _, name := range defined {
+		if err := checkSealed(ec, name, dse.Name.Pos); err != nil {
+			return nil, err
+		}
+	}
+
+	constructor := &FuncValue{
+		Name:    st.Name,
+		Params:  st.Fields,
+		MinArgs: len(st.Fields),
+		MaxArgs: len(st.Fields),
+		Pure:    true,
+		def:     dse,
+		Fn: func(_ *EvalContext, vals ...Value) (Value, error) {
+			if len(vals) != len(st.Fields) {
+				return nil, errors.New(formatMessage(ArgCountMsg, struct {
+					Expected, Actual int
+				}{len(st.Fields), len(vals)}))
+			}
+			fieldVals := make([]Value, len(vals))
+			copy(fieldVals, vals)
+			return &StructValue{
+				Type: st,
+				Vals: fieldVals,
+			}, nil
+		},
+	}
+	ec.Add(st.Name, constructor)
+
+	for i, f := range st.Fields {
+		i, accessorName := i, fmt.Sprintf("%s-%s", st.Name, f)
+		ec.Add(accessorName, &FuncValue{
+			Name:    accessorName,
+			Params:  []string{st.Name},
+			MinArgs: 1,
+			MaxArgs: 1,
+			Pure:    true,
+			def:     dse,
+			Fn: func(_ *EvalContext, vals ...Value) (Value, error) {
+				var v Value
+				err := ArgMapperValues(vals...).
+					ReadValue(&v).
+					Complete()
+				if err != nil {
+					return nil, err
+				}
+				asStruct, isStruct := v.(*StructValue)
+				if !isStruct || asStruct.Type != st {
+					return nil, fmt.Errorf(
+						"%s expects a %s, got %s", accessorName, st.Name, TypeName(v))
+				}
+				return asStruct.Vals[i], nil
+			},
+		})
+	}
+
+	predicateName := st.Name + "?"
+	ec.Add(predicateName, &FuncValue{
+		Name:    predicateName,
+		Params:  []string{"val"},
+		MinArgs: 1,
+		MaxArgs: 1,
+		Pure:    true,
+		def:     dse,
+		Fn: func(_ *EvalContext, vals ...Value) (Value, error) {
+			var v Value
+			err := ArgMapperValues(vals...).
+				ReadValue(&v).
+				Complete()
+			if err != nil {
+				return nil, err
+			}
+			asStruct, isStruct := v.(*StructValue)
+			return NewBoolValue(isStruct && asStruct.Type == st), nil
+		},
+	})
+
+	return constructor, nil
+}
+
+// CodeStr will return the code representation of the defstruct expression.
+func (dse *DefStructExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(defstruct ")
+	sb.WriteString(dse.Name.Val)
+	for _, f := range dse.Fields {
+		sb.WriteString(" ")
+		sb.WriteString(f.Val)
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (dse *DefStructExpr) SourcePos() ScannerPosition {
+	return dse.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (dse *DefStructExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: dse.Pos, End: dse.End}
+}
+
+// Eval will replace the value of the ident in the nearest context that defines
+// it, and return the value. It's an error if the ident is not defined.
+func (se *SetExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(se)(&v, &err)
+	identStr := se.Ident.Val
+	if err := checkSealed(ec, identStr, se.Ident.Pos); err != nil {
+		return nil, err
+	}
+	v, err = se.Value.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	if !ec.Set(identStr, v) {
+		msg := fmt.Sprintf("cannot set! undefined identifier '%s'", identStr)
+		if suggestion, ok := ec.suggestIdent(identStr); ok {
+			msg = fmt.Sprintf("%s; %s", msg, formatMessage(
+				DidYouMeanMsg, struct{ Suggestion string }{suggestion}))
+		}
+		return nil, &EvalError{
+			Msg: msg,
+			Pos: se.Pos,
+		}
+	}
+	return v, nil
+}
+
+// CodeStr will return the code representation of the set expression.
+func (se *SetExpr) CodeStr() string {
+	return fmt.Sprintf("(set! %s %s)", se.Ident.Val, se.Value.CodeStr())
+}
+
+// SourcePos is the location in source this expression came from.
+func (se *SetExpr) SourcePos() ScannerPosition {
+	return se.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (se *SetExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: se.Pos, End: se.End}
+}
+
+// Eval evaluates the expression, printing the elapsed time to stdout. Time is
+// measured with the context's clock; so it is always zero in deterministic mode.
+func (te *TimeExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(te)(&v, &err)
+	start := ec.Now()
+	v, err = te.Expr.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(ec.Stdout(), "elapsed: %s\n", ec.Now().Sub(start))
+	return v, nil
+}
+
+// CodeStr will return the code representation of the time expression.
+func (te *TimeExpr) CodeStr() string {
+	return fmt.Sprintf("(time %s)", te.Expr.CodeStr())
+}
+
+// SourcePos is the location in source this expression came from.
+func (te *TimeExpr) SourcePos() ScannerPosition {
+	return te.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (te *TimeExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: te.Pos, End: te.End}
+}
+
+// Eval registers the test with the context.
+func (dte *DefTestExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(dte)(&v, &err)
+	ec.addScriptTest(ScriptTest{
+		Name: dte.Name,
+		Body: dte.Body,
+		Pos:  dte.Pos,
+	})
+	return Nil, nil
+}
+
+// CodeStr will return the code representation of the test declaration.
+func (dte *DefTestExpr) CodeStr() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(deftest %q", dte.Name)
+	for _, e := range dte.Body {
+		sb.WriteString(" ")
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (dte *DefTestExpr) SourcePos() ScannerPosition {
+	return dte.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (dte *DefTestExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: dte.Pos, End: dte.End}
+}
+
+// Eval evaluates the expression, and returns the message of the error it
+// failed with. Fails if the expression doesn't.
+func (aee *AssertErrorExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(aee)(&v, &err)
+	exprV, exprErr := aee.Expr.Eval(ec)
+	if isControlSignal(exprErr) {
+		return nil, exprErr
+	}
+	if exprErr == nil {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("assertion failed: expected an error; got %s",
+				InspectBounded(exprV, DefaultInspectOptions)),
+			Pos: aee.Pos,
+		}
+	}
+	if err := checkHalted(ec, aee.Pos); err != nil {
+		return nil, err
+	}
+	return &StringValue{
+		Val: exprErr.Error(),
+	}, nil
+}
+
+// CodeStr will return the code representation of the assertion.
+func (aee *AssertErrorExpr) CodeStr() string {
+	return fmt.Sprintf("(assertError %s)", aee.Expr.CodeStr())
+}
+
+// SourcePos is the location in source this expression came from.
+func (aee *AssertErrorExpr) SourcePos() ScannerPosition {
+	return aee.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (aee *AssertErrorExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: aee.Pos, End: aee.End}
+}
+
+// Eval evaluates the expression, and unwinds to the enclosing function with
+// its value.
+func (re *ReturnExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(re)(&v, &err)
+	var retV Value = Nil
+	if re.Expr != nil {
+		if retV, err = re.Expr.Eval(ec); err != nil {
+			return nil, err
+		}
+	}
+	return nil, &returnSignal{
+		Val: retV,
+		Pos: re.Pos,
+	}
+}
+
+// CodeStr will return the code representation of the return expression.
+func (re *ReturnExpr) CodeStr() string {
+	if re.Expr == nil {
+		return "(return)"
+	}
+	return fmt.Sprintf("(return %s)", re.Expr.CodeStr())
+}
+
+// SourcePos is the location in source this expression came from.
+func (re *ReturnExpr) SourcePos() ScannerPosition {
+	return re.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (re *ReturnExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: re.Pos, End: re.End}
+}
+
+// Eval unwinds to the innermost loop, which stops or continues.
+func (be *BreakExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(be)(&v, &err)
+	return nil, &loopSignal{
+		Continue: be.Continue,
+		Pos:      be.Pos,
+	}
+}
+
+// CodeStr will return the code representation of the break expression.
+func (be *BreakExpr) CodeStr() string {
+	if be.Continue {
+		return "(continue)"
+	}
+	return "(break)"
+}
+
+// SourcePos is the location in source this expression came from.
+func (be *BreakExpr) SourcePos() ScannerPosition {
+	return be.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (be *BreakExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: be.Pos, End: be.End}
+}
+
+// Eval starts evaluating the expression on a new goroutine, and returns the
+// channel its result will be sent on. If it fails, the channel is closed with
+// the error; so receiving from it fails too.
+func (ge *GoExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(ge)(&v, &err)
+	if err := checkHalted(ec, ge.Pos); err != nil {
+		return nil, err
+	}
+	result := newChanValue(1)
+	sub := ec.SubContext(nil)
+	sub.scope = ge.scope
+	go func() {
+		v, err := ge.Expr.Eval(sub)
+		if err != nil {
+			result.closeWithErr(stopSignals(err))
+			return
+		}
+		result.ch <- v
+		result.closeWithErr(nil)
+	}()
+	return result, nil
+}
+
+// CodeStr will return the code representation of the go expression.
+func (ge *GoExpr) CodeStr() string {
+	return fmt.Sprintf("(go %s)", ge.Expr.CodeStr())
+}
+
+// SourcePos is the location in source this expression came from.
+func (ge *GoExpr) SourcePos() ScannerPosition {
+	return ge.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (ge *GoExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: ge.Pos, End: ge.End}
+}
+
+// Eval creates the generic function, without any methods, and binds it.
+func (dge *DefGenericExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(dge)(&v, &err)
+	if err := checkSealed(ec, dge.Name.Val, dge.Name.Pos); err != nil {
+		return nil, err
+	}
+	params := make([]string, 0, len(dge.Params))
+	for _, p := range dge.Params {
+		params = append(params, p.Val)
+	}
+	fn := newGenericFn(dge.Name.Val, params)
+	fn.def = dge
+	ec.Add(dge.Name.Val, fn)
+	return fn, nil
+}
+
+// CodeStr will return the code representation of the defgeneric expression.
+func (dge *DefGenericExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(defgeneric ")
+	sb.WriteString(dge.Name.Val)
+	sb.WriteString(" (")
+	for i, p := range dge.Params {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(p.Val)
+	}
+	sb.WriteString("))\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (dge *DefGenericExpr) SourcePos() ScannerPosition {
+	return dge.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (dge *DefGenericExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: dge.Pos, End: dge.End}
+}
+
+// Eval adds the method to the generic function it names. The method must take
+// the same number of arguments as the generic function.
+func (dme *DefMethodExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(dme)(&v, &err)
+	genericV, _ := ec.Resolve(dme.Name.Val)
+	generic, isFn := genericV.(*FuncValue)
+	if !isFn || generic.generic == nil {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf(
+				"'%s' is not a generic function; declare it with defgeneric", dme.Name.Val),
+			Pos: dme.Name.Pos,
+		}
+	}
+	if len(dme.Fn.Args) != len(generic.generic.params) {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("method of '%s' must take %s; takes %d",
+				dme.Name.Val, describeArity(len(generic.Params), len(generic.Params)),
+				len(dme.Fn.Args)),
+			Pos: dme.Pos,
+		}
+	}
+	methodV, err := dme.Fn.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	// the method isn't bound to the name itself, so calls to it from
+	// within the method still dispatch.
+	method := methodV.(*FuncValue)
+	method.Name = dme.Name.Val
+	generic.generic.define(dme.Type, method)
+	return generic, nil
+}
+
+// CodeStr will return the code representation of the defmethod expression.
+func (dme *DefMethodExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(defmethod ")
+	sb.WriteString(dme.Name.Val)
+	sb.WriteString(" (")
+	for i, a := range dme.Fn.Args {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(a.Ident)
+		if i == 0 {
+			sb.WriteString(" :")
+			sb.WriteString(dme.Type)
+		}
+	}
+	sb.WriteString(")\n")
+	for _, e := range dme.Fn.Body {
+		sb.WriteString(e.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (dme *DefMethodExpr) SourcePos() ScannerPosition {
+	return dme.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (dme *DefMethodExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: dme.Pos, End: dme.End}
+}
+
+// Eval looks up the method in the object, or its prototypes, and calls it.
+func (me *MethodCallExpr) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(me)(&v, &err)
+	if err := checkHalted(ec, me.Pos); err != nil {
+		return nil, err
+	}
+	objV, err := me.Object.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	obj, isObj := objV.(*ObjectValue)
+	if !isObj {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf(
+				"cannot call method '%s' of %s; only objects have methods",
+				me.Method.Val, TypeName(objV)),
+			Pos: me.Object.SourcePos(),
+		}
+	}
+	methodV, hasMethod := obj.Get(me.Method.Val)
+	if !hasMethod {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("object has no method '%s'", me.Method.Val),
+			Pos: me.Method.Pos,
+		}
+	}
+	method, isFn := methodV.(*FuncValue)
+	if !isFn {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf(
+				"'%s' is a %s, not a method", me.Method.Val, TypeName(methodV)),
+			Pos: me.Method.Pos,
+		}
+	}
+	return callFunc(ec, method, me.Method.Val, []Value{obj}, me.Args, me.Pos)
+}
+
+// CodeStr will return the code representation of the method call.
+func (me *MethodCallExpr) CodeStr() string {
+	var sb strings.Builder
+	sb.WriteString("(: ")
+	sb.WriteString(me.Object.CodeStr())
+	sb.WriteString(" ")
+	sb.WriteString(me.Method.CodeStr())
+	for _, a := range me.Args {
+		sb.WriteString(" ")
+		sb.WriteString(a.CodeStr())
+	}
+	sb.WriteString(")\n")
+	return sb.String()
+}
+
+// SourcePos is the location in source this expression came from.
+func (me *MethodCallExpr) SourcePos() ScannerPosition {
+	return me.Pos
+}
+
+// SourceSpan is the extent in source of this expression.
+func (me *MethodCallExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: me.Pos, End: me.End}
+}
+
+// evalCond evaluates a conditional expression, which must result in a bool;
+// unless the context is truthy (see Options.Truthy).
+func evalCond(ec *EvalContext, cond Expr) (bool, error) {
+	condV, condVErr := cond.Eval(ec)
+	if condVErr != nil {
+		return false, condVErr
+	}
+	if ec.environ().truthy {
+		switch tV := condV.(type) {
+		case *NilValue:
+			return false, nil
+		case *BoolValue:
+			return tV.Val, nil
+		default:
+			return true, nil
+		}
+	}
+	asBool, isBool := condV.(*BoolValue)
+	if !isBool {
+		return false, &TypeError{
+			Actual:   fmt.Sprintf("%T", condV),
+			Expected: fmt.Sprintf("%T", (*BoolValue)(nil)),
+			Pos:      cond.SourcePos(),
+		}
+	}
+	return asBool.Val, nil
+}
+
+// checkHalted returns an error if the context's evaluation has been cancelled
+// or has timed out.
+func checkHalted(ec *EvalContext, pos ScannerPosition) error {
+	if ctxErr := ec.Context().Err(); ctxErr != nil {
+		return &EvalError{
+			Msg: fmt.Sprintf("evaluation halted: %s", ctxErr),
+			Pos: pos,
+		}
+	}
+	return nil
+}
+
+// evalBody evaluates each of the expressions in order, and returns the value
+// of the last; or nil if there are none.
+func evalBody(ec *EvalContext, body []Expr) (Value, error) {
+	var evalV Value = Nil
+	for _, e := range body {
+		v, err := e.Eval(ec)
+		if err != nil {
+			return nil, err
+		}
+		evalV = v
+	}
+	return evalV, nil
+}
+
+// checkSealed returns an error if the ident is sealed against being redefined.
+// See EvalContext.Seal.
+func checkSealed(ec *EvalContext, ident string, pos ScannerPosition) error {
+	if !ec.IsSealed(ident) {
+		return nil
+	}
+	return &EvalError{
+		Msg: fmt.Sprintf("cannot redefine sealed identifier '%s'", ident),
+		Pos: pos,
+	}
+}
+
+// evalLoopBody evaluates one iteration of a loop's body, and returns whether
+// the loop should stop. A break stops it, and a continue ends the iteration
+// early.
+func evalLoopBody(ec *EvalContext, body []Expr) (bool, error) {
+	_, err := evalBody(ec, body)
+	var ls *loopSignal
+	if errors.As(err, &ls) {
+		return !ls.Continue, nil
+	}
+	return false, err
+}
+
 // evalToFunc will evaluate the given expression, expecting a function. Will
-// return a well-formed error i
+// return a well-formed error if the expression does not resolve to a function.
 func evalToFunc(evalCtx *EvalContext, expr Expr) (*FuncValue, error) {
 	var val Value
 	switch v := expr.(type) {
@@ -269,11 +1718,15 @@ func evalToFunc(evalCtx *EvalContext, expr Expr) (*FuncValue, error) {
 		// In the case of idents, manually inspect to see if it's nil. This is to
 		// make errors more obvious in the case of a function simply being an
 		// undefined name.
-		identVal, hasIdent := evalCtx.Resolve(v.Val)
+		identVal, hasIdent := v.resolve(evalCtx)
 		if !hasIdent {
+			msg := formatMessage(UndefinedFnMsg, struct{ Ident string }{v.Val})
+			if suggestion, ok := evalCtx.suggestIdent(v.Val); ok {
+				msg = fmt.Sprintf("%s; %s", msg, formatMessage(
+					DidYouMeanMsg, struct{ Suggestion string }{suggestion}))
+			}
 			return nil, &EvalError{
-				Msg: fmt.Sprintf(
-					"undefined identifier '%s' cannot be used as function", v.Val),
+				Msg: msg,
 				Pos: v.SourcePos(),
 			}
 		}
@@ -155,6 +155,35 @@ func Test_fnExpr(t *testing.T) {
 	assertNumValue(t, v, 5)
 }
 
+func Test_returnExpr(t *testing.T) {
+
+	t.Run("early", func(t *testing.T) {
+		ec := BuiltinContext()
+		evalStrInContext(t, ec, `
+			(defun sign (n)
+				(if (< n 0) (return -1))
+				(if (== n 0) (return))
+				1)`)
+		assertNumValue(t, evalStrInContext(t, ec, `(sign -4)`), -1)
+		assertNilValue(t, evalStrInContext(t, ec, `(sign 0)`))
+		assertNumValue(t, evalStrInContext(t, ec, `(sign 4)`), 1)
+	})
+
+	t.Run("nestedFn", func(t *testing.T) {
+		assertListValue(t, evalStrToVal(t, `
+			((fn ()
+				(listMap (list 1 2) (fn (n) (return (* n 10)) 0))))`),
+			[]Value{&NumberValue{Val: 10}, &NumberValue{Val: 20}})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := evalStrToErr(t, `(return 1)`)
+		require.Contains(t, err.Error(), "return used outside of a function")
+		parseStrToErr(t, `(fn () (return 1 2))`)
+		assertNumValue(t, evalStrToVal(t, `((fn () (assertError (return 1)) 2))`), 1)
+	})
+}
+
 func Test_CodeStr(t *testing.T) {
 
 	// printAndReparse is a helper that converts the expression to string, parses
@@ -211,6 +240,32 @@ func Test_CodeStr(t *testing.T) {
 		assertNumValue(t, mustEval(t, reparsedExpr, nil), 2)
 	})
 
+	t.Run("cond", func(t *testing.T) {
+		baseAST := &CondExpr{
+			Clauses: []CondClause{
+				{
+					Test: NewBoolLiteral(false),
+					Body: []Expr{NewNumberLiteral(1)},
+				},
+				{
+					Body: []Expr{NewNumberLiteral(2), NewNumberLiteral(3)},
+				},
+			},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 3)
+	})
+
+	t.Run("unless", func(t *testing.T) {
+		baseAST := &WhenExpr{
+			Cond:   NewBoolLiteral(false),
+			Body:   []Expr{NewNumberLiteral(1)},
+			Negate: true,
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 1)
+	})
+
 	t.Run("let", func(t *testing.T) {
 		baseAST := &LetExpr{
 			Ident: NewIdentLiteral("value"),
@@ -224,6 +279,81 @@ func Test_CodeStr(t *testing.T) {
 		assertNumValue(t, ctxVal, 2)
 	})
 
+	t.Run("blockLet", func(t *testing.T) {
+		baseAST := &BlockLetExpr{
+			Bindings: []LetBinding{
+				{Ident: NewIdentLiteral("a"), Value: NewNumberLiteral(2)},
+				{Ident: NewIdentLiteral("b"), Value: NewNumberLiteral(3)},
+			},
+			Body: []Expr{
+				NewCallExpr(
+					NewIdentLiteral("add"),
+					NewIdentLiteral("a"),
+					NewIdentLiteral("b"),
+				),
+			},
+			Sequential: true,
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		require.True(t, reparsedExpr.(*BlockLetExpr).Sequential)
+		v := mustEval(t, reparsedExpr, BuiltinContext().SubContext(map[string]Value{
+			"add": &FuncValue{Fn: addFn},
+		}))
+		assertNumValue(t, v, 5)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		baseAST := &SetExpr{
+			Ident: NewIdentLiteral("value"),
+			Value: NewNumberLiteral(3),
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		ec := BuiltinContext()
+		ec.Add("value", &NumberValue{Val: 1})
+		sub := ec.SubContext(nil)
+		mustEval(t, reparsedExpr, sub)
+		ctxVal, _ := ec.Resolve("value")
+		assertNumValue(t, ctxVal, 3)
+	})
+
+	t.Run("loops", func(t *testing.T) {
+		loopBody := []Expr{
+			&SetExpr{
+				Ident: NewIdentLiteral("total"),
+				Value: NewCallExpr(
+					NewIdentLiteral("+"),
+					NewIdentLiteral("total"),
+					NewIdentLiteral("x"),
+				),
+			},
+		}
+		for _, baseAST := range []Expr{
+			&ForExpr{
+				Binding: LetBinding{
+					Ident: NewIdentLiteral("x"),
+					Value: NewCallExpr(NewIdentLiteral("range"), NewNumberLiteral(4)),
+				},
+				Body: loopBody,
+			},
+			&DoTimesExpr{
+				Binding: LetBinding{
+					Ident: NewIdentLiteral("x"),
+					Value: NewNumberLiteral(4),
+				},
+				Body: loopBody,
+			},
+		} {
+			reparsedExpr := printAndReparse(t, baseAST)
+			require.IsType(t, baseAST, reparsedExpr)
+			ec := BuiltinContext().SubContext(map[string]Value{
+				"total": &NumberValue{Val: 0},
+			})
+			mustEval(t, reparsedExpr, ec)
+			total, _ := ec.Resolve("total")
+			assertNumValue(t, total, 6)
+		}
+	})
+
 	t.Run("fn", func(t *testing.T) {
 		baseAST := NewCallExpr(
 			NewFnExpr(
@@ -248,4 +378,250 @@ func Test_CodeStr(t *testing.T) {
 		}))
 		assertNumValue(t, v, 6)
 	})
+
+	t.Run("defstruct", func(t *testing.T) {
+		baseAST := &DefStructExpr{
+			Name:   NewIdentLiteral("point"),
+			Fields: []*IdentLiteral{NewIdentLiteral("x"), NewIdentLiteral("y")},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		ec := BuiltinContext().SubContext(nil)
+		mustEval(t, reparsedExpr, ec)
+		assertNumValue(t, evalStrInContext(t, ec, `(point-y (point 1 2))`), 2)
+	})
+
+	t.Run("namedFn", func(t *testing.T) {
+		fnAST := NewFnExpr(
+			[]Arg{{Ident: "n"}},
+			[]Expr{
+				NewIfExpr(
+					NewCallExpr(NewIdentLiteral("<="), NewIdentLiteral("n"), NewNumberLiteral(0)),
+					NewNumberLiteral(0),
+					NewCallExpr(
+						NewIdentLiteral("countdown"),
+						NewCallExpr(NewIdentLiteral("-"), NewIdentLiteral("n"), NewNumberLiteral(1)),
+					),
+				),
+			},
+		)
+		fnAST.Name = "countdown"
+		reparsedExpr := printAndReparse(t, NewCallExpr(fnAST, NewNumberLiteral(3)))
+		assertNumValue(t, mustEval(t, reparsedExpr, BuiltinContext()), 0)
+	})
+
+	t.Run("fnRest", func(t *testing.T) {
+		fnAST := NewFnExpr(
+			[]Arg{{Ident: "a"}},
+			[]Expr{
+				NewCallExpr(NewIdentLiteral("len"), NewIdentLiteral("rest")),
+			},
+		)
+		fnAST.Rest = &Arg{Ident: "rest"}
+		baseAST := NewCallExpr(
+			fnAST,
+			NewNumberLiteral(5),
+			NewNumberLiteral(1),
+			NewNumberLiteral(2),
+		)
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 2)
+	})
+
+	t.Run("time", func(t *testing.T) {
+		baseAST := &TimeExpr{
+			Expr: NewCallExpr(NewIdentLiteral("+"), NewNumberLiteral(1), NewNumberLiteral(2)),
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 3)
+	})
+
+	t.Run("go", func(t *testing.T) {
+		baseAST := NewCallExpr(NewIdentLiteral("recv"), &GoExpr{
+			Expr: NewCallExpr(NewIdentLiteral("+"), NewNumberLiteral(1), NewNumberLiteral(2)),
+		})
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, BuiltinContext()), 3)
+	})
+
+	t.Run("return", func(t *testing.T) {
+		baseAST := NewCallExpr(NewFnExpr(nil, []Expr{
+			&ReturnExpr{Expr: NewNumberLiteral(1)},
+			NewNumberLiteral(2),
+		}))
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 1)
+	})
+
+	t.Run("letValues", func(t *testing.T) {
+		baseAST := &LetValuesExpr{
+			Idents: []*IdentLiteral{NewIdentLiteral("q"), NewIdentLiteral("r")},
+			Value: NewCallExpr(NewIdentLiteral("divmod"),
+				NewNumberLiteral(7), NewNumberLiteral(2)),
+			Body: []Expr{
+				NewCallExpr(NewIdentLiteral("+"), NewIdentLiteral("q"), NewIdentLiteral("r")),
+			},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, BuiltinContext()), 4)
+	})
+
+	t.Run("break", func(t *testing.T) {
+		baseAST := &WhileExpr{
+			Cond: NewBoolLiteral(true),
+			Body: []Expr{&BreakExpr{Continue: false}},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNilValue(t, mustEval(t, reparsedExpr, nil))
+		require.Equal(t, "(continue)", (&BreakExpr{Continue: true}).CodeStr())
+	})
+
+	t.Run("methodCall", func(t *testing.T) {
+		baseAST := &MethodCallExpr{
+			Object: NewCallExpr(NewIdentLiteral("object"), NewCallExpr(
+				NewIdentLiteral("map"),
+				NewStringLiteral("inc"),
+				NewFnExpr([]Arg{{Ident: "self"}, {Ident: "n"}}, []Expr{
+					NewCallExpr(NewIdentLiteral("+"), NewIdentLiteral("n"), NewNumberLiteral(1)),
+				}))),
+			Method: NewIdentLiteral("inc"),
+			Args:   []Expr{NewNumberLiteral(2)},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, nil), 3)
+	})
+
+	t.Run("generics", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		genericAST := &DefGenericExpr{
+			Name:   NewIdentLiteral("scale"),
+			Params: []*IdentLiteral{NewIdentLiteral("x"), NewIdentLiteral("factor")},
+		}
+		mustEval(t, printAndReparse(t, genericAST), ec)
+		methodAST := &DefMethodExpr{
+			Name: NewIdentLiteral("scale"),
+			Type: "number",
+			Fn: NewFnExpr([]Arg{{Ident: "x"}, {Ident: "factor"}}, []Expr{
+				NewCallExpr(NewIdentLiteral("*"), NewIdentLiteral("x"), NewIdentLiteral("factor")),
+			}),
+		}
+		mustEval(t, printAndReparse(t, methodAST), ec)
+		assertNumValue(t, evalStrInContext(t, ec, `(scale 2 3)`), 6)
+	})
+
+	t.Run("fnKeywords", func(t *testing.T) {
+		fnAST := NewFnExpr(
+			[]Arg{{Ident: "a"}, {Ident: "b", Keyword: "scale"}, {Ident: "c", Keyword: "offset"}},
+			[]Expr{
+				NewCallExpr(
+					NewIdentLiteral("+"),
+					NewCallExpr(NewIdentLiteral("*"), NewIdentLiteral("a"), NewIdentLiteral("b")),
+					NewIdentLiteral("c"),
+				),
+			},
+		)
+		baseAST := NewCallExpr(
+			fnAST,
+			NewNumberLiteral(5),
+			NewKeywordLiteral("offset"),
+			NewNumberLiteral(1),
+			NewKeywordLiteral("scale"),
+			NewNumberLiteral(2),
+		)
+		reparsedExpr := printAndReparse(t, baseAST)
+		assertNumValue(t, mustEval(t, reparsedExpr, BuiltinContext()), 11)
+	})
+
+	t.Run("pureFn", func(t *testing.T) {
+		baseAST := &FnExpr{
+			Name: "f",
+			Pure: true,
+			Args: []Arg{{Ident: "a"}},
+			Body: []Expr{NewIdentLiteral("a")},
+		}
+		reparsedExpr := printAndReparse(t, baseAST)
+		require.True(t, reparsedExpr.(*FnExpr).Pure)
+	})
+}
+
+func Test_keywordArgs(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `(let f (fn (a :opts o) (if (isNil o) a (mapGet o :b))))`)
+
+	assertNumValue(t, evalStrInContext(t, ec, `(f 1)`), 1)
+	assertNumValue(t, evalStrInContext(t, ec, `(f 1 :opts (map :b 2))`), 2)
+
+	err := evalStrInContextToErr(t, ec, `(f 1 :other 2)`)
+	require.Contains(t, err.Error(), "unknown keyword argument ':other'")
+	err = evalStrInContextToErr(t, ec, `(f 1 :opts)`)
+	require.Contains(t, err.Error(), "':opts' is missing a value")
+	err = evalStrInContextToErr(t, ec, `(f 1 2)`)
+	require.Contains(t, err.Error(), "expected a keyword argument")
+
+	_, parseErr := ParseTokens(NewTokenScanner(NewRuneScanner("kw.l",
+		strings.NewReader(`(fn (:opts o a) a)`))))
+	require.Error(t, parseErr)
+	_, parseErr = ParseTokens(NewTokenScanner(NewRuneScanner("kw.l",
+		strings.NewReader(`(fn (:opts o . rest) o)`))))
+	require.Error(t, parseErr)
+}
+
+func Test_pureFns(t *testing.T) {
+
+	t.Run("declared", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+			(defun double :pure (n) (* n 2))
+			(defun noisy :pure (n) (print n))`)
+		double, _ := ec.Resolve("double")
+		require.True(t, assertAsFunc(t, double).Pure)
+		assertNumValue(t, evalStrInContext(t, ec, `(double 2)`), 4)
+
+		err := evalStrInContextToErr(t, ec, `(noisy 1)`)
+		require.Contains(t, err.Error(), "'print' is impure, and cannot be called in pure mode")
+		parseStrToErr(t, `(fn :other (a) a)`)
+	})
+
+	t.Run("pureOnly", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(defun impure (n) n)`)
+		formulas := ec.SubContext(nil)
+		formulas.SetPureOnly()
+
+		assertNumValue(t, evalStrInContext(t, formulas,
+			`(listReduce 0 (listMap (list 1 2 3) (fn (v) (* v v))) +)`), 14)
+		assertNumValue(t, evalStrInContext(t, formulas,
+			`((compose (partial + 1) len) (list 1 2))`), 3)
+
+		err := evalStrInContextToErr(t, formulas, `(print 1)`)
+		require.Contains(t, err.Error(), "'print' is impure, and cannot be called in pure mode")
+		err = evalStrInContextToErr(t, formulas, `(impure 1)`)
+		require.Contains(t, err.Error(), "'impure' is impure")
+		err = evalStrInContextToErr(t, formulas, `(listMap (list 1) print)`)
+		require.Contains(t, err.Error(), "'print' is impure, and cannot be passed in pure mode")
+
+		// the parent context is unrestricted.
+		assertNilValue(t, evalStrInContext(t, ec, `(print 1)`))
+	})
+}
+
+func Test_undefinedFnSuggestion(t *testing.T) {
+
+	t.Run("closeMatch", func(t *testing.T) {
+		err := evalStrToErr(t, `(listMpa (list 1 2) (fn (v) v))`)
+		require.IsType(t, (*EvalError)(nil), err)
+		require.Contains(t, err.Error(), "did you mean 'listMap'?")
+	})
+
+	t.Run("noMatch", func(t *testing.T) {
+		err := evalStrToErr(t, `(qwertyuiop 1 2)`)
+		require.IsType(t, (*EvalError)(nil), err)
+		require.NotContains(t, err.Error(), "did you mean")
+	})
+
+	t.Run("editDistance", func(t *testing.T) {
+		require.Equal(t, 0, editDistance("abc", "abc"))
+		require.Equal(t, 1, editDistance("abc", "abd"))
+		require.Equal(t, 2, editDistance("listMpa", "listMap"))
+		require.Equal(t, 3, editDistance("", "abc"))
+	})
 }
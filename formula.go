@@ -0,0 +1,121 @@
+package golisp2
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// The limits placed on formulas evaluated with EvalFormula.
+const (
+	// MaxFormulaLen is the longest formula source accepted, in bytes.
+	MaxFormulaLen = 4096
+
+	// MaxFormulaExprs is the most expressions a formula can be made of.
+	MaxFormulaExprs = 512
+
+	// FormulaTimeout is how long a formula may take to evaluate.
+	FormulaTimeout = 100 * time.Millisecond
+)
+
+// formulaBuiltins are the builtins available to formulas, along with the
+// operators. All are pure, and take time proportional to their arguments.
+var formulaBuiltins = []string{
+	"concat", "strEq", "not", "and", "or", "mod", "pow",
+	"list", "listGet", "len", "listFilter", "listMap", "listReduce",
+	"map", "mapGet", "mapKeys", "mapValues",
+	"typeOf", "isNil", "isNumber", "isString", "isBool", "isList", "isMap",
+	"toString", "toNumber", "toBool",
+}
+
+// EvalFormula evaluates a single expression, such as a spreadsheet formula,
+// with the given variables in scope. It is meant for evaluating expressions
+// from untrusted users, so is constrained:
+//
+//   - only the operators, conditionals, and a set of pure builtins over
+//     strings, lists and maps are available.
+//   - nothing can be defined: functions, let, set!, defstruct and loops are
+//     all rejected, before anything is evaluated.
+//   - the formula is limited in length, and in how long it can take to
+//     evaluate. See MaxFormulaLen, MaxFormulaExprs and FormulaTimeout.
+func EvalFormula(expr string, vars map[string]Value) (Value, error) {
+	if len(expr) > MaxFormulaLen {
+		return nil, fmt.Errorf(
+			"formula is %d bytes; the most allowed is %d", len(expr), MaxFormulaLen)
+	}
+	exprs, err := ParseString("formula", expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) != 1 {
+		return nil, fmt.Errorf("formula must be a single expression; got %d", len(exprs))
+	}
+	count := 0
+	if err := checkFormula(exprs[0], &count); err != nil {
+		return nil, err
+	}
+
+	builtins := make(map[string]Value, len(formulaBuiltins))
+	for _, name := range formulaBuiltins {
+		builtins[name] = builtinFns[name]
+	}
+	ec := NewContext(builtins).SubContext(vars)
+	ec.SetPureOnly()
+	ctx, cancel := context.WithTimeout(context.Background(), FormulaTimeout)
+	defer cancel()
+	ec.SetContext(ctx)
+	v, err := exprs[0].Eval(ec)
+	return v, quoteString(err, "formula", expr)
+}
+
+// checkFormula returns an error if the expression uses a form formulas can't,
+// or if there are more than MaxFormulaExprs expressions in it. count is the
+// number of expressions seen so far.
+func checkFormula(e Expr, count *int) error {
+	*count++
+	if *count > MaxFormulaExprs {
+		return &EvalError{
+			Msg: fmt.Sprintf("formula has more than %d expressions", MaxFormulaExprs),
+			Pos: e.SourcePos(),
+		}
+	}
+
+	var subExprs []Expr
+	switch tE := e.(type) {
+	case *NumberLiteral, *StringLiteral, *BoolLiteral, *NilLiteral,
+		*KeywordLiteral, *IdentLiteral, *FuncLiteral:
+
+	case *CallExpr:
+		subExprs = tE.Exprs
+
+	case *IfExpr:
+		subExprs = []Expr{tE.Cond, tE.Case1}
+		if tE.Case2 != nil {
+			subExprs = append(subExprs, tE.Case2)
+		}
+
+	case *CondExpr:
+		for _, clause := range tE.Clauses {
+			if clause.Test != nil {
+				subExprs = append(subExprs, clause.Test)
+			}
+			subExprs = append(subExprs, clause.Body...)
+		}
+
+	case *WhenExpr:
+		subExprs = append([]Expr{tE.Cond}, tE.Body...)
+
+	default:
+		return &EvalError{
+			Msg: "formulas can only contain calls, conditionals and values",
+			Pos: e.SourcePos(),
+		}
+	}
+
+	for _, sub := range subExprs {
+		if err := checkFormula(sub, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
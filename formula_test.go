@@ -0,0 +1,66 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EvalFormula(t *testing.T) {
+	vars := map[string]Value{
+		"price": &NumberValue{Val: 12},
+		"qty":   &NumberValue{Val: 3},
+		"items": &ListValue{Vals: []Value{
+			&NumberValue{Val: 1},
+			&NumberValue{Val: 2},
+		}},
+	}
+
+	t.Run("eval", func(t *testing.T) {
+		v, err := EvalFormula(`(* price qty)`, vars)
+		require.NoError(t, err)
+		assertNumValue(t, v, 36)
+
+		v, err = EvalFormula(`(if (> price 10) "high" "low")`, vars)
+		require.NoError(t, err)
+		assertStringValue(t, v, "high")
+
+		v, err = EvalFormula(`(listReduce 0 items +)`, vars)
+		require.NoError(t, err)
+		assertNumValue(t, v, 3)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		for _, src := range []string{
+			`(let x 1)`,
+			`(defun f () 1)`,
+			`(fn () (print 1))`,
+			`(listMap items (fn (v) v))`,
+			`(while true 1)`,
+			`(defstruct p x)`,
+			`(set! price 1)`,
+		} {
+			_, err := EvalFormula(src, vars)
+			require.Error(t, err, src)
+			require.Contains(t, err.Error(),
+				"formulas can only contain calls, conditionals and values", src)
+		}
+
+		_, err := EvalFormula(`(print 1)`, vars)
+		require.Contains(t, err.Error(), "undefined identifier 'print'")
+		_, err = EvalFormula(`(readFile "/etc/passwd")`, vars)
+		require.Error(t, err)
+
+		_, err = EvalFormula(`1 2`, vars)
+		require.Contains(t, err.Error(), "formula must be a single expression; got 2")
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		_, err := EvalFormula(strings.Repeat(" ", MaxFormulaLen)+"1", vars)
+		require.Contains(t, err.Error(), "formula is 4097 bytes")
+
+		_, err = EvalFormula("(+"+strings.Repeat(" 1", MaxFormulaExprs)+")", vars)
+		require.Contains(t, err.Error(), "formula has more than 512 expressions")
+	})
+}
@@ -0,0 +1,93 @@
+//go:build go1.18
+// +build go1.18
+
+package golisp2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets are run with e.g. `go test -fuzz FuzzParse`. Without
+// -fuzz, they run only on the seed corpus.
+
+// fuzzSeeds adds the conformance cases, the examples, and inputs that have
+// been fragile in the scanner to the seed corpus.
+func fuzzSeeds(f *testing.F) {
+	for _, pattern := range []string{"testdata/conformance/*.l", "examples/*.l"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, file := range files {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(src))
+		}
+	}
+	for _, src := range []string{
+		``, `(`, `)`, `"`, `(+ 1 2)`, `1.5`, `.5`, `1.`, `1..2`, `-1`, `- 1`,
+		`(-1)`, `(<=1 2)`, `(>= 1 2)`, `==`, `(+-1)`, `:kw`, `:`, `'x`, "\xff",
+		"(a \x00 b)", `"unterminated`, `(let x "a\"b")`, `;comment`, `(fn (a) a)`,
+	} {
+		f.Add(src)
+	}
+}
+
+func parseFuzzSrc(src string) ([]Expr, error) {
+	return ParseString("fuzz.l", src)
+}
+
+// FuzzTokenize checks that scanning any input terminates without panicking.
+func FuzzTokenize(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		ts := NewTokenScanner(NewRuneScanner("fuzz.l", strings.NewReader(src)))
+		for i := 0; !ts.Done(); i++ {
+			if i > len(src)+1 {
+				t.Fatalf("scanner didn't finish after %d tokens", i)
+			}
+			ts.Advance()
+		}
+	})
+}
+
+// FuzzParse checks that parsing any input doesn't panic.
+func FuzzParse(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		_, _ = parseFuzzSrc(src)
+	})
+}
+
+// FuzzParseAndPrint checks that the code of anything that parses re-parses, to
+// code that's the same.
+func FuzzParseAndPrint(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		exprs, err := parseFuzzSrc(src)
+		if err != nil {
+			return
+		}
+		code := exprsCode(exprs)
+		reparsed, err := parseFuzzSrc(code)
+		if err != nil {
+			t.Fatalf("code of %q doesn't parse: %q: %v", src, code, err)
+		}
+		if recode := exprsCode(reparsed); recode != code {
+			t.Fatalf("code of %q changed when re-parsed: %q, then %q", src, code, recode)
+		}
+	})
+}
+
+func exprsCode(exprs []Expr) string {
+	codes := make([]string, len(exprs))
+	for i, e := range exprs {
+		codes[i] = e.CodeStr()
+	}
+	return strings.Join(codes, "\n")
+}
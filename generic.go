@@ -0,0 +1,65 @@
+package golisp2
+
+import (
+	"fmt"
+	"sync"
+)
+
+// anyMethodType is the type a generic function's fallback method is defined
+// for; it's called for values that no other method handles.
+const anyMethodType = "any"
+
+// genericFn is a function declared with defgeneric, that dispatches on the
+// type of its first argument to the methods defined for it with defmethod.
+type genericFn struct {
+	name   string
+	params []string
+
+	mu      sync.RWMutex
+	methods map[string]*FuncValue
+}
+
+// newGenericFn creates a generic function without any methods, and the
+// function value that calls it.
+func newGenericFn(name string, params []string) *FuncValue {
+	g := &genericFn{
+		name:    name,
+		params:  params,
+		methods: map[string]*FuncValue{},
+	}
+	return &FuncValue{
+		Name:    name,
+		Params:  params,
+		MinArgs: len(params),
+		MaxArgs: len(params),
+		Fn:      g.call,
+		generic: g,
+	}
+}
+
+// define sets the method called for values of the type, replacing any
+// previous one.
+func (g *genericFn) define(typeName string, method *FuncValue) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.methods[typeName] = method
+}
+
+// call calls the method for the type of the first argument, or the fallback
+// method if there isn't one.
+func (g *genericFn) call(ec *EvalContext, vals ...Value) (Value, error) {
+	if len(vals) == 0 {
+		return nil, fmt.Errorf("'%s' expects at least 1 argument to dispatch on", g.name)
+	}
+	typeName := TypeName(vals[0])
+	g.mu.RLock()
+	method, hasMethod := g.methods[typeName]
+	if !hasMethod {
+		method, hasMethod = g.methods[anyMethodType]
+	}
+	g.mu.RUnlock()
+	if !hasMethod {
+		return nil, fmt.Errorf("'%s' has no method for %s", g.name, typeName)
+	}
+	return method.Fn(ec, vals...)
+}
@@ -0,0 +1,63 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generics(t *testing.T) {
+
+	t.Run("dispatch", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		  (defgeneric show (x))
+		  (defmethod show (x :number) "a number")
+		  (defmethod show (x :list)
+		    (listReduce "" x (fn (acc e) (concat acc "[" (show e) "]"))))
+		  (defstruct point x y)
+		  (defmethod show (p :point) "a point")
+		  (defmethod show (x :any) "something")`)
+		assertStringValue(t, evalStrInContext(t, ec, `(show 1)`), "a number")
+		assertStringValue(t, evalStrInContext(t, ec, `(show (point 1 2))`), "a point")
+		assertStringValue(t, evalStrInContext(t, ec, `(show "s")`), "something")
+		// methods can dispatch again on their parts.
+		assertStringValue(t,
+			evalStrInContext(t, ec, `(show (list 1 (point 1 2) "s"))`),
+			"[a number][a point][something]")
+
+		// redefining a method replaces it.
+		evalStrInContext(t, ec, `(defmethod show (x :number) "still a number")`)
+		assertStringValue(t, evalStrInContext(t, ec, `(show 1)`), "still a number")
+	})
+
+	t.Run("params", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		  (defgeneric scale (x factor))
+		  (defmethod scale (x :number factor) (* x factor))
+		  (defmethod scale (xs :list factor)
+		    (listMap xs (fn (x) (scale x factor))))`)
+		assertNumValue(t, evalStrInContext(t, ec, `(scale 2 3)`), 6)
+		assertListValue(t, evalStrInContext(t, ec, `(scale (list 1 2) 2)`),
+			[]Value{&NumberValue{Val: 2}, &NumberValue{Val: 4}})
+		evalStrInContextToErr(t, ec, `(scale 2)`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(defgeneric show (x)) (defun plain (x) x)`)
+		err := evalStrInContextToErr(t, ec, `(show 1)`)
+		require.Contains(t, err.Error(), "'show' has no method for number")
+		err = evalStrInContextToErr(t, ec, `(defmethod plain (x :number) x)`)
+		require.Contains(t, err.Error(), "'plain' is not a generic function")
+		err = evalStrInContextToErr(t, ec, `(defmethod show (x :number y) x)`)
+		require.Contains(t, err.Error(), "method of 'show' must take 1 argument; takes 2")
+
+		parseStrToErr(t, `(defgeneric show ())`)
+		parseStrToErr(t, `(defgeneric show (x :key y))`)
+		parseStrToErr(t, `(defmethod show (x) x)`)
+		parseStrToErr(t, `(defmethod show (x y :number) x)`)
+		parseStrToErr(t, `(defmethod show (x :number :list) x)`)
+	})
+}
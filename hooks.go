@@ -0,0 +1,72 @@
+package golisp2
+
+type (
+	// EvalHook is notified as expressions are evaluated, and as functions are
+	// called. Embedders can implement it to build profilers, tracers and
+	// coverage tools. Embed NopEvalHook to only implement some of the methods.
+	//
+	// Hooks are called on the goroutine doing the evaluation, so should be quick.
+	// Scripts using go expressions evaluate on several goroutines at once, so
+	// hooks used with them must be safe for concurrent use.
+	EvalHook interface {
+		// OnEnterExpr is called before an expression is evaluated.
+		OnEnterExpr(e Expr)
+
+		// OnExitExpr is called after an expression is evaluated, with the value it
+		// evaluated to or the error it failed with.
+		OnExitExpr(e Expr, v Value, err error)
+
+		// OnCall is called when a call expression calls a function, after its
+		// arguments have been evaluated.
+		OnCall(fn *FuncValue, args []Value, pos ScannerPosition)
+
+		// OnReturn is called when a function called by a call expression returns.
+		OnReturn(fn *FuncValue, v Value, err error)
+	}
+
+	// NopEvalHook is an EvalHook that ignores everything.
+	NopEvalHook struct{}
+)
+
+func (NopEvalHook) OnEnterExpr(e Expr)                                      {}
+func (NopEvalHook) OnExitExpr(e Expr, v Value, err error)                   {}
+func (NopEvalHook) OnCall(fn *FuncValue, args []Value, pos ScannerPosition) {}
+func (NopEvalHook) OnReturn(fn *FuncValue, v Value, err error)              {}
+
+// SetEvalHook sets the hook notified of evaluation. A nil hook removes it. This
+// applies to all parent and sub contexts.
+func (ec *EvalContext) SetEvalHook(h EvalHook) {
+	ec.environ().hook = h
+}
+
+// nopExitExpr is returned by hookExpr when there's no hook.
+func nopExitExpr(*Value, *error) {}
+
+// hookExpr notifies the hook that the expression is being entered, and returns
+// a function that notifies it the expression has been exited with the given
+// result. Expressions call it as `defer ec.hookExpr(e)(&v, &err)`.
+func (ec *EvalContext) hookExpr(e Expr) func(*Value, *error) {
+	h := ec.environ().hook
+	if h == nil {
+		return nopExitExpr
+	}
+	h.OnEnterExpr(e)
+	return func(v *Value, err *error) {
+		h.OnExitExpr(e, *v, *err)
+	}
+}
+
+// hookCall calls the function with the arguments, notifying the hook of the
+// call and its return.
+func (ec *EvalContext) hookCall(
+	fn *FuncValue, args []Value, pos ScannerPosition,
+) (Value, error) {
+	h := ec.environ().hook
+	if h == nil {
+		return fn.Fn(ec.callContext(pos), args...)
+	}
+	h.OnCall(fn, args, pos)
+	v, err := fn.Fn(ec.callContext(pos), args...)
+	h.OnReturn(fn, v, err)
+	return v, err
+}
@@ -0,0 +1,81 @@
+package golisp2
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHook records each event it is notified of.
+type recordingHook struct {
+	events []string
+}
+
+func (rh *recordingHook) OnEnterExpr(e Expr) {
+	rh.events = append(rh.events, "enter "+e.CodeStr())
+}
+
+func (rh *recordingHook) OnExitExpr(e Expr, v Value, err error) {
+	if err != nil {
+		rh.events = append(rh.events, "exit "+e.CodeStr()+" !")
+		return
+	}
+	rh.events = append(rh.events, "exit "+e.CodeStr()+" = "+v.InspectStr())
+}
+
+func (rh *recordingHook) OnCall(fn *FuncValue, args []Value, pos ScannerPosition) {
+	rh.events = append(rh.events, fmt.Sprintf("call %s %d", fn.Name, len(args)))
+}
+
+func (rh *recordingHook) OnReturn(fn *FuncValue, v Value, err error) {
+	rh.events = append(rh.events, "return "+fn.Name)
+}
+
+func Test_EvalHook(t *testing.T) {
+
+	t.Run("events", func(t *testing.T) {
+		hook := &recordingHook{}
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetEvalHook(hook)
+		evalStrInContext(t, ec, `(not true)`)
+		require.Equal(t, []string{
+			"enter (not true)\n",
+			"enter true",
+			"exit true = true",
+			"call not 1",
+			"return not",
+			"exit (not true)\n = false",
+		}, hook.events)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		hook := &recordingHook{}
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetEvalHook(hook)
+		require.Error(t, evalStrInContextToErr(t, ec, `(car 1)`))
+		require.Equal(t, "exit (car 1.000000)\n !", hook.events[len(hook.events)-1])
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		calls := 0
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetEvalHook(&countingHook{calls: &calls})
+		evalStrInContext(t, ec, `(defun f (n) (if (< n 1) 0 (f (- n 1)))) (f 3)`)
+		require.Equal(t, 11, calls)
+
+		ec.SetEvalHook(nil)
+		evalStrInContext(t, ec, `(f 3)`)
+		require.Equal(t, 11, calls)
+	})
+}
+
+// countingHook counts calls, and ignores everything else.
+type countingHook struct {
+	NopEvalHook
+	calls *int
+}
+
+func (ch *countingHook) OnCall(*FuncValue, []Value, ScannerPosition) {
+	*ch.calls++
+}
@@ -0,0 +1,137 @@
+package golisp2
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// EvalStringWith parses and evaluates the source, and returns the value of its
+// last expression. The vars are converted with ValueFromGo, and bound in a sub
+// context that only lasts for the evaluation; so neither they, nor anything
+// the source defines, are added to ec.
+//
+// It's meant for hosts that evaluate small snippets, like templates or
+// conditions, against values they already have.
+func (ec *EvalContext) EvalStringWith(
+	src string, vars map[string]interface{},
+) (Value, error) {
+	vals, err := bindingsFromGo(vars)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := ParseString("eval", src)
+	if err != nil {
+		return nil, err
+	}
+	sub := ec.SubContext(vals)
+	var v Value = Nil
+	for _, e := range exprs {
+		if v, err = e.Eval(sub); err != nil {
+			return nil, quoteString(err, "eval", src)
+		}
+	}
+	return v, nil
+}
+
+// bindingsFromGo converts each of the go values with ValueFromGo.
+func bindingsFromGo(vars map[string]interface{}) (map[string]Value, error) {
+	vals := make(map[string]Value, len(vars))
+	for name, v := range vars {
+		asVal, err := ValueFromGo(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not bind '%s': %w", name, err)
+		}
+		vals[name] = asVal
+	}
+	return vals, nil
+}
+
+// ValueFromGo converts a go value into a value: bools, strings, and every kind
+// of number convert to their counterparts; slices and arrays to lists; maps
+// with string keys to maps; times to times; and nil to nil. Values are passed
+// through as is, and pointers are followed. Anything else, e.g. a struct, is
+// converted through its JSON encoding.
+func ValueFromGo(v interface{}) (Value, error) {
+	if asVal, isVal := v.(Value); isVal {
+		return asVal, nil
+	}
+	return valueFromReflect(reflect.ValueOf(v))
+}
+
+// valueFromReflect converts the reflected go value into a value. See
+// ValueFromGo.
+func valueFromReflect(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return Nil, nil
+	}
+	if rv.CanInterface() {
+		switch tV := rv.Interface().(type) {
+		case Value:
+			return tV, nil
+		case time.Time:
+			return &TimeValue{Val: tV}, nil
+		}
+	}
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return Nil, nil
+		}
+		return valueFromReflect(rv.Elem())
+	case reflect.Bool:
+		return NewBoolValue(rv.Bool()), nil
+	case reflect.String:
+		return &StringValue{Val: rv.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &NumberValue{Val: float64(rv.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return &NumberValue{Val: float64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &NumberValue{Val: rv.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Nil, nil
+		}
+		vals := make([]Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			e, err := valueFromReflect(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, e)
+		}
+		return &ListValue{Vals: vals}, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert %s: map keys must be strings", rv.Type())
+		}
+		if rv.IsNil() {
+			return Nil, nil
+		}
+		vals := make(map[string]Value, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, err := valueFromReflect(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			vals[iter.Key().String()] = e
+		}
+		return &MapValue{Vals: vals}, nil
+	case reflect.Func, reflect.Chan, reflect.Complex64, reflect.Complex128,
+		reflect.UnsafePointer:
+		return nil, fmt.Errorf("cannot convert %s to a value", rv.Type())
+	default:
+		if !rv.CanInterface() {
+			return nil, fmt.Errorf("cannot convert unexported %s to a value", rv.Type())
+		}
+		b, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to a value: %w", rv.Type(), err)
+		}
+		return UnmarshalValueJSON(b)
+	}
+}
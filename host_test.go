@@ -0,0 +1,84 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EvalStringWith(t *testing.T) {
+
+	t.Run("vars", func(t *testing.T) {
+		ec := BuiltinContext()
+		v, err := ec.EvalStringWith(`(if (> age 17) (concat name " is an adult") name)`,
+			map[string]interface{}{
+				"name": "Sam",
+				"age":  uint8(30),
+			})
+		require.NoError(t, err)
+		assertStringValue(t, v, "Sam is an adult")
+
+		// the bindings don't outlive the evaluation.
+		v, err = ec.EvalStringWith(`(let x 2) (* x scale)`,
+			map[string]interface{}{"scale": 1.5})
+		require.NoError(t, err)
+		assertNumValue(t, v, 3)
+		_, hasX := ec.Resolve("x")
+		require.False(t, hasX)
+		_, hasScale := ec.Resolve("scale")
+		require.False(t, hasScale)
+
+		v, err = ec.EvalStringWith(`(+ 1 2)`, nil)
+		require.NoError(t, err)
+		assertNumValue(t, v, 3)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ec := BuiltinContext()
+		_, err := ec.EvalStringWith(`(+ 1`, nil)
+		require.IsType(t, (*ParseError)(nil), err)
+		_, err = ec.EvalStringWith(`(car x)`, map[string]interface{}{"x": 1})
+		require.Error(t, err)
+		_, err = ec.EvalStringWith(`x`, map[string]interface{}{"x": func() {}})
+		require.Contains(t, err.Error(), "could not bind 'x'")
+	})
+}
+
+func Test_ValueFromGo(t *testing.T) {
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	n := 4
+
+	cases := []struct {
+		in       interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{"s", `"s"`},
+		{-3, "-3"},
+		{&n, "4"},
+		{[]string{"a", "b"}, `["a" "b"]`},
+		{[2]float64{1.5, 2}, "[1.500000 2]"},
+		{map[string]interface{}{"a": []int{1}, "b": nil}, "{ a:[1] b:nil }"},
+		{point{X: 1, Y: 2}, "{ x:1 y:2 }"},
+		{&StringValue{Val: "v"}, `"v"`},
+		{[]Value{&NumberValue{Val: 1}}, "[1]"},
+	}
+	for _, c := range cases {
+		v, err := ValueFromGo(c.in)
+		require.NoError(t, err)
+		require.Equal(t, c.expected, v.InspectStr())
+	}
+
+	for _, bad := range []interface{}{
+		map[int]string{1: "a"},
+		make(chan int),
+		complex(1, 2),
+	} {
+		_, err := ValueFromGo(bad)
+		require.Error(t, err)
+	}
+}
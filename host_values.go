@@ -0,0 +1,167 @@
+package golisp2
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// hostResource is a Go resource held by a host handle, and how to release it.
+// It doesn't reference the handle, so registries can track it without keeping
+// the handle alive.
+type hostResource struct {
+	val     interface{}
+	release func(interface{})
+
+	once   sync.Once
+	closed int32
+
+	// registry tracks the resource until it's released; nil if none does.
+	registry *HostRegistry
+	id       uint64
+}
+
+// close releases the resource, if it hasn't been already.
+func (r *hostResource) close() {
+	r.once.Do(func() {
+		atomic.StoreInt32(&r.closed, 1)
+		if r.registry != nil {
+			r.registry.remove(r.id)
+		}
+		r.release(r.val)
+	})
+}
+
+// NewHostValue wraps the Go value in a handle that can be passed to scripts.
+func NewHostValue(v interface{}) *HostValue {
+	return &HostValue{Val: v}
+}
+
+// NewHostResource wraps a Go resource, such as a connection, in a handle that
+// can be passed to scripts. release is called with the resource exactly once:
+// when the handle is closed by Close or hostClose, or otherwise once the
+// handle has been garbage collected; so a script that drops a handle without
+// closing it doesn't hold the resource forever. release may be called on any
+// goroutine.
+func NewHostResource(v interface{}, release func(interface{})) *HostValue {
+	return newHostResource(v, release, nil)
+}
+
+// newHostResource creates a handle to the resource, tracked by the registry if
+// it isn't nil.
+func newHostResource(
+	v interface{}, release func(interface{}), registry *HostRegistry,
+) *HostValue {
+	res := &hostResource{
+		val:      v,
+		release:  release,
+		registry: registry,
+	}
+	if registry != nil {
+		registry.add(res)
+	}
+	hv := &HostValue{Val: v, res: res}
+	runtime.SetFinalizer(hv, func(hv *HostValue) {
+		hv.res.close()
+	})
+	return hv
+}
+
+// Close releases the handle's resource now, rather than once it's garbage
+// collected. Closing a handle again, or one without a resource, does nothing.
+func (hv *HostValue) Close() {
+	if hv.res == nil {
+		return
+	}
+	hv.res.close()
+	runtime.SetFinalizer(hv, nil)
+}
+
+// Closed indicates if the handle's resource has been released. Host functions
+// should check it before using the resource.
+func (hv *HostValue) Closed() bool {
+	return hv.res != nil && atomic.LoadInt32(&hv.res.closed) == 1
+}
+
+// HostRegistry tracks the resources of the handles it creates until they're
+// released. It only references the resources, not the handles; so it doesn't
+// stop a leaked handle from being collected, and its resource released. Long
+// running hosts can use it to see how many resources scripts hold, and to
+// release all of them on shutdown.
+type HostRegistry struct {
+	mu     sync.Mutex
+	nextID uint64
+	live   map[uint64]*hostResource
+}
+
+// NewHostRegistry creates a registry that tracks no resources.
+func NewHostRegistry() *HostRegistry {
+	return &HostRegistry{
+		live: map[uint64]*hostResource{},
+	}
+}
+
+// NewResource creates a handle to the resource, as NewHostResource does, that
+// the registry tracks until it's released.
+func (r *HostRegistry) NewResource(
+	v interface{}, release func(interface{}),
+) *HostValue {
+	return newHostResource(v, release, r)
+}
+
+// Len returns the number of tracked resources that haven't been released.
+func (r *HostRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.live)
+}
+
+// CloseAll releases every tracked resource that hasn't been already. Handles
+// to them report being closed.
+func (r *HostRegistry) CloseAll() {
+	r.mu.Lock()
+	live := make([]*hostResource, 0, len(r.live))
+	for _, res := range r.live {
+		live = append(live, res)
+	}
+	r.mu.Unlock()
+	for _, res := range live {
+		res.close()
+	}
+}
+
+// add starts tracking the resource.
+func (r *HostRegistry) add(res *hostResource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	res.id = r.nextID
+	r.live[res.id] = res
+}
+
+// remove stops tracking the resource with the id.
+func (r *HostRegistry) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.live, id)
+}
+
+// hostCloseFn releases the resource of a host handle, and returns nil. Scripts
+// should close handles they're done with, rather than relying on them being
+// collected.
+func hostCloseFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	hv, isHost := v.(*HostValue)
+	if !isHost {
+		return nil, fmt.Errorf("hostClose expects a host value; got %s", TypeName(v))
+	}
+	hv.Close()
+	return Nil, nil
+}
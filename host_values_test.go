@@ -0,0 +1,67 @@
+package golisp2
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_hostValues(t *testing.T) {
+	t.Run("close", func(t *testing.T) {
+		released := 0
+		hv := NewHostResource("conn", func(v interface{}) {
+			require.Equal(t, "conn", v)
+			released++
+		})
+		ec := BuiltinContext().SubContext(map[string]Value{"conn": hv})
+		assertBoolValue(t, evalStrInContext(t, ec, `(isHost conn)`), true)
+		require.Equal(t, "<host string>", hv.InspectStr())
+		require.False(t, hv.Closed())
+
+		assertNilValue(t, evalStrInContext(t, ec, `(hostClose conn)`))
+		require.True(t, hv.Closed())
+		hv.Close()
+		require.Equal(t, 1, released)
+
+		evalStrInContextToErr(t, ec, `(hostClose 1)`)
+		NewHostValue(1).Close()
+	})
+
+	t.Run("collected", func(t *testing.T) {
+		var released int32
+		reg := NewHostRegistry()
+		func() {
+			reg.NewResource("leaked", func(interface{}) {
+				atomic.AddInt32(&released, 1)
+			})
+		}()
+		require.Equal(t, 1, reg.Len())
+
+		// the registry doesn't keep the leaked handle alive.
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&released) == 0 && time.Now().Before(deadline) {
+			runtime.GC()
+			time.Sleep(time.Millisecond)
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&released))
+		require.Equal(t, 0, reg.Len())
+	})
+
+	t.Run("closeAll", func(t *testing.T) {
+		released := 0
+		reg := NewHostRegistry()
+		handles := []*HostValue{
+			reg.NewResource(1, func(interface{}) { released++ }),
+			reg.NewResource(2, func(interface{}) { released++ }),
+		}
+		handles[0].Close()
+		require.Equal(t, 1, reg.Len())
+		reg.CloseAll()
+		require.Equal(t, 0, reg.Len())
+		require.Equal(t, 2, released)
+		require.True(t, handles[1].Closed())
+	})
+}
@@ -0,0 +1,187 @@
+package golisp2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type (
+	// InspectOptions bounds how much of a value is written when inspecting it,
+	// so huge or deeply nested values can be printed without stalling.
+	InspectOptions struct {
+		// MaxDepth is how many levels of nested lists, maps, cells and structs are
+		// written.
+		// Deeper ones are elided as `[…]`. Zero means no limit.
+		MaxDepth int
+
+		// MaxLen is how many elements of each list, map or cell chain are written.
+		// The rest are elided as `…(+N more)`. Zero means no limit.
+		MaxLen int
+	}
+
+	// inspectWriter writes the bounded representation of values, retaining the
+	// first error encountered.
+	inspectWriter struct {
+		w    *bufio.Writer
+		opts InspectOptions
+		err  error
+	}
+)
+
+// DefaultInspectOptions are the bounds used when printing values.
+var DefaultInspectOptions = InspectOptions{
+	MaxDepth: 16,
+	MaxLen:   100,
+}
+
+// WriteInspect writes the human-readable representation of the value to w,
+// within the given bounds. Unbounded, this matches InspectStr.
+func WriteInspect(w io.Writer, v Value, opts InspectOptions) error {
+	iw := &inspectWriter{
+		w:    bufio.NewWriter(w),
+		opts: opts,
+	}
+	iw.write(v, 1)
+	if iw.err != nil {
+		return iw.err
+	}
+	return iw.w.Flush()
+}
+
+// InspectBounded returns the human-readable representation of the value,
+// within the given bounds.
+func InspectBounded(v Value, opts InspectOptions) string {
+	var sb strings.Builder
+	// writes to a strings.Builder can't fail.
+	_ = WriteInspect(&sb, v, opts)
+	return sb.String()
+}
+
+func (iw *inspectWriter) write(v Value, depth int) {
+	if iw.err != nil {
+		return
+	}
+	switch tV := v.(type) {
+	case *ListValue:
+		if iw.tooDeep(depth) {
+			iw.str("[…]")
+			return
+		}
+		iw.str("[")
+		for i, e := range tV.Vals {
+			if iw.tooLong(i, len(tV.Vals)) {
+				break
+			}
+			if i > 0 {
+				iw.str(" ")
+			}
+			iw.write(e, depth+1)
+		}
+		iw.str("]")
+	case *MapValue:
+		if iw.tooDeep(depth) {
+			iw.str("{…}")
+			return
+		}
+		iw.str("{")
+		for i, k := range sortedKeys(tV.Vals) {
+			if iw.tooLong(i, len(tV.Vals)) {
+				break
+			}
+			iw.str(" ")
+			iw.str(k)
+			iw.str(":")
+			iw.write(tV.Vals[k], depth+1)
+		}
+		iw.str(" }")
+	case *CellValue:
+		if iw.tooDeep(depth) {
+			iw.str("(…)")
+			return
+		}
+		vals, tail := tV.chainVals()
+		iw.str("(")
+		elided := false
+		for i, e := range vals {
+			if elided = iw.tooLong(i, len(vals)); elided {
+				break
+			}
+			if i > 0 {
+				iw.str(" ")
+			}
+			iw.write(e, depth+1)
+		}
+		if _, isNil := tail.(*NilValue); !isNil && !elided {
+			iw.str(" . ")
+			iw.write(tail, depth+1)
+		}
+		iw.str(")")
+	case *StructValue:
+		if iw.tooDeep(depth) {
+			iw.str(tV.Type.Name)
+			iw.str("{…}")
+			return
+		}
+		iw.str(tV.Type.Name)
+		iw.str("{")
+		for i, f := range tV.Type.Fields {
+			if iw.tooLong(i, len(tV.Type.Fields)) {
+				break
+			}
+			if i > 0 {
+				iw.str(" ")
+			}
+			iw.str(f)
+			iw.str(":")
+			iw.write(tV.Vals[i], depth+1)
+		}
+		iw.str("}")
+	case *TableValue:
+		iw.str("table[")
+		iw.str(strings.Join(tV.Columns, " "))
+		iw.str("]")
+		if iw.tooDeep(depth) {
+			iw.str("[…]")
+			return
+		}
+		for i, r := range tV.Rows {
+			if iw.tooLong(i, len(tV.Rows)) {
+				break
+			}
+			iw.str("[")
+			for j, e := range r {
+				if j > 0 {
+					iw.str(" ")
+				}
+				iw.write(e, depth+1)
+			}
+			iw.str("]")
+		}
+	default:
+		iw.str(v.InspectStr())
+	}
+}
+
+// tooDeep checks if a container at the given depth should be elided.
+func (iw *inspectWriter) tooDeep(depth int) bool {
+	return iw.opts.MaxDepth > 0 && depth > iw.opts.MaxDepth
+}
+
+// tooLong checks if the i-th of n elements is past the length limit; if so,
+// it writes the elision for the remaining elements.
+func (iw *inspectWriter) tooLong(i, n int) bool {
+	if iw.opts.MaxLen <= 0 || i < iw.opts.MaxLen {
+		return false
+	}
+	iw.str(fmt.Sprintf(" …(+%d more)", n-i))
+	return true
+}
+
+func (iw *inspectWriter) str(s string) {
+	if iw.err != nil {
+		return
+	}
+	_, iw.err = iw.w.WriteString(s)
+}
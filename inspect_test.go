@@ -0,0 +1,59 @@
+package golisp2
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteInspect(t *testing.T) {
+
+	t.Run("unbounded", func(t *testing.T) {
+		for _, src := range []string{
+			`(list 1 "a" (list true nil))`,
+			`(map "b" (list 1 2) "a" (map "c" 3))`,
+			`(cons 1 (cons 2 nil))`,
+			`(cons 1 2)`,
+			`(cons 1 (cons 2 3))`,
+			`(repeat 1)`,
+		} {
+			v := evalStrToVal(t, src)
+			require.Equal(t, v.InspectStr(), InspectBounded(v, InspectOptions{}))
+		}
+	})
+
+	t.Run("maxLen", func(t *testing.T) {
+		opts := InspectOptions{MaxLen: 3}
+		require.Equal(t, "[0 1 2 …(+7 more)]",
+			InspectBounded(evalStrToVal(t, `(range 10)`), opts))
+		require.Equal(t, "[0 1 2]",
+			InspectBounded(evalStrToVal(t, `(range 3)`), opts))
+		require.Equal(t, "{ a:1 b:2 c:3 …(+1 more) }",
+			InspectBounded(evalStrToVal(t, `(map "a" 1 "b" 2 "c" 3 "d" 4)`), opts))
+		require.Equal(t, "(1 2 3 …(+1 more))",
+			InspectBounded(evalStrToVal(t, `(cellsFromList (list 1 2 3 4))`), opts))
+		require.Equal(t, "(1 2 . 3)",
+			InspectBounded(evalStrToVal(t, `(cons 1 (cons 2 3))`), opts))
+	})
+
+	t.Run("maxDepth", func(t *testing.T) {
+		opts := InspectOptions{MaxDepth: 2}
+		require.Equal(t, "[1 [2 […]]]",
+			InspectBounded(evalStrToVal(t, `(list 1 (list 2 (list 3)))`), opts))
+		require.Equal(t, "{ a:{…} }",
+			InspectBounded(evalStrToVal(t, `(map "a" (map "b" (map "c" 1)))`),
+				InspectOptions{MaxDepth: 1}))
+	})
+
+	t.Run("huge", func(t *testing.T) {
+		vals := make([]Value, 1000000)
+		for i := range vals {
+			vals[i] = &NumberValue{Val: float64(i)}
+		}
+		var buf bytes.Buffer
+		err := WriteInspect(&buf, &ListValue{Vals: vals}, DefaultInspectOptions)
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "…(+999900 more)]")
+	})
+}
@@ -0,0 +1,69 @@
+package golisp2
+
+import (
+	"errors"
+	"io"
+)
+
+// Interpreter evaluates scripts read from sources, one top-level expression at
+// a time: each is evaluated as soon as it has been read, so output appears
+// while the rest of the source is still being written. Definitions persist in
+// its context between runs.
+type Interpreter struct {
+	ec *EvalContext
+}
+
+// stdinSourceName is the name sources are reported under when they don't have
+// one of their own.
+const stdinSourceName = "<stdin>"
+
+// NewInterpreter creates an interpreter that evaluates in the context. If nil,
+// it evaluates in a new sub context of the builtins.
+func NewInterpreter(ec *EvalContext) *Interpreter {
+	if ec == nil {
+		ec = BuiltinContext().SubContext(nil)
+	}
+	return &Interpreter{
+		ec: ec,
+	}
+}
+
+// Context returns the context the interpreter evaluates in.
+func (in *Interpreter) Context() *EvalContext {
+	return in.ec
+}
+
+// SetPolicy limits what the scripts the interpreter runs may do. See
+// EvalContext.SetPolicy.
+func (in *Interpreter) SetPolicy(p Policy) {
+	in.ec.SetPolicy(p)
+}
+
+// Run reads and evaluates the expressions in r in turn, and returns the value
+// of the last. Stops at the first parse or evaluation error; expressions before
+// it will already have been evaluated.
+//
+// The source is reported under its name if it has one (e.g. it's an *os.File),
+// or as "<stdin>" otherwise.
+func (in *Interpreter) Run(r io.Reader) (Value, error) {
+	name := stdinSourceName
+	if named, ok := r.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+	rs := NewRuneScanner(name, r)
+	es := NewExprScanner(NewTokenScanner(rs))
+	var last Value = Nil
+	for {
+		e, err := es.Next()
+		if errors.Is(err, io.EOF) {
+			return last, nil
+		} else if err != nil {
+			return nil, err
+		}
+		v, err := e.Eval(in.ec)
+		if err != nil {
+			return nil, rs.Quote(err)
+		}
+		last = v
+	}
+}
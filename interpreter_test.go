@@ -0,0 +1,133 @@
+package golisp2
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lineWriter sends each line written to it to a channel.
+type lineWriter struct {
+	lines chan string
+	buf   strings.Builder
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			lw.lines <- lw.buf.String()
+			lw.buf.Reset()
+			continue
+		}
+		lw.buf.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+func Test_ExprScanner(t *testing.T) {
+
+	newScanner := func(src string) *ExprScanner {
+		return NewExprScanner(NewTokenScanner(
+			NewRuneScanner("scan.l", strings.NewReader(src))))
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		es := newScanner("(let x 2)\nx 3\n(+ x\n  4)")
+		codes := []string{}
+		for {
+			e, err := es.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			codes = append(codes, e.CodeStr())
+		}
+		require.Equal(t, 4, len(codes))
+		require.Equal(t, "x", codes[1])
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := newScanner("  ; nothing\n").Next()
+		require.Equal(t, io.EOF, err)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		es := newScanner("(+ 1 2) )")
+		_, err := es.Next()
+		require.NoError(t, err)
+		_, err = es.Next()
+		require.IsType(t, (*ParseError)(nil), err)
+		_, err2 := es.Next()
+		require.Equal(t, err, err2)
+
+		_, err = newScanner("(+ 1").Next()
+		require.IsType(t, (*ParseError)(nil), err)
+	})
+}
+
+func Test_Interpreter(t *testing.T) {
+
+	t.Run("run", func(t *testing.T) {
+		in := NewInterpreter(nil)
+		v, err := in.Run(strings.NewReader("(let x 2)\n(+ x 3)"))
+		require.NoError(t, err)
+		assertNumValue(t, v, 5)
+
+		// definitions persist between runs.
+		v, err = in.Run(strings.NewReader("(* x 10)"))
+		require.NoError(t, err)
+		assertNumValue(t, v, 20)
+
+		v, err = in.Run(strings.NewReader(""))
+		require.NoError(t, err)
+		assertNilValue(t, v)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		in := NewInterpreter(nil)
+		_, err := in.Run(strings.NewReader("(let x 2)\n(car 1)\n(let y 3)"))
+		require.Error(t, err)
+		_, hasY := in.Context().Resolve("y")
+		require.False(t, hasY)
+		x, _ := in.Context().Resolve("x")
+		assertNumValue(t, x, 2)
+
+		_, err = in.Run(strings.NewReader("(let z 1) (+ 1"))
+		require.IsType(t, (*ParseError)(nil), err)
+		z, _ := in.Context().Resolve("z")
+		assertNumValue(t, z, 1)
+	})
+
+	t.Run("incremental", func(t *testing.T) {
+		out := &lineWriter{lines: make(chan string)}
+		in := NewInterpreter(nil)
+		in.Context().SetStdout(out)
+		r, w := io.Pipe()
+		done := make(chan error)
+		go func() {
+			_, err := in.Run(r)
+			done <- err
+		}()
+
+		expectOut := func(expected string) {
+			t.Helper()
+			select {
+			case s := <-out.lines:
+				require.Equal(t, expected, s)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for '%s'", expected)
+			}
+		}
+
+		// each expression is evaluated before the next is written.
+		w.Write([]byte("(print \"first\")\n"))
+		expectOut(`"first"`)
+		w.Write([]byte("(print \"second\")\n"))
+		expectOut(`"second"`)
+		w.Close()
+		require.NoError(t, <-done)
+	})
+}
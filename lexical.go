@@ -0,0 +1,223 @@
+package golisp2
+
+// Lexical addressing. Resolving an identifier normally looks it up in each
+// context from the innermost out; in a deeply nested closure or a hot loop that
+// is a map lookup per frame on every evaluation. Once parsed, expressions are
+// given a resolution pass that works out, for each identifier bound by an
+// enclosing function, let, loop or go expression, how many contexts out it's
+// bound in: its lexical address. Evaluating the identifier then steps straight
+// to that context, and looks it up there alone.
+//
+// This only skips the lookups in the contexts between: values are still stored
+// by name, in each context's map, rather than in slots. Globals and builtins
+// aren't addressed, as they're bound outside any scope the pass knows. So the
+// gain is modest; around 10% for identifiers bound a few functions out, in a
+// hot loop (see BenchmarkLexicalResolve).
+//
+// Contexts can be created that the pass doesn't know about (e.g. by a tree
+// built or rewritten by hand), so each context records the scope it was
+// created for, and an address is only used if the context it leads to is the
+// one expected. If it isn't, or the name isn't bound there (yet), the
+// identifier is resolved the usual way.
+
+// lexicalScope is a context a binding form creates, as seen by the resolution
+// pass. Contexts created for the scope are tagged with it.
+type lexicalScope struct {
+	// names are those bound in the scope: by the form itself, or by the let,
+	// defstruct and defgeneric expressions evaluated directly within it.
+	names map[string]bool
+}
+
+// lexicalResolver assigns lexical addresses to the identifiers in an
+// expression tree.
+type lexicalResolver struct {
+	// scopes are the enclosing scopes, innermost last. Contexts beyond the
+	// outermost aren't known, so identifiers bound in them aren't addressed.
+	scopes []*lexicalScope
+}
+
+// resolveLexical assigns lexical addresses to the identifiers in the
+// expressions, replacing any they had. It must be done before the expressions
+// are evaluated, as it modifies them.
+func resolveLexical(exprs []Expr) {
+	rs := &lexicalResolver{}
+	rs.exprs(exprs)
+}
+
+// newLexicalScope creates a scope binding the names, and the names declared
+// in the body.
+func newLexicalScope(names []string, body []Expr) *lexicalScope {
+	ls := &lexicalScope{names: map[string]bool{}}
+	for _, name := range names {
+		ls.names[name] = true
+	}
+	for _, e := range body {
+		ls.declare(e)
+	}
+	return ls
+}
+
+// declare adds the names the expression binds in the scope it's evaluated in:
+// those of any let, defstruct or defgeneric in it that isn't in a nested scope.
+func (ls *lexicalScope) declare(e Expr) {
+	Walk(e, func(e Expr) bool {
+		switch tE := e.(type) {
+		case *LetExpr:
+			ls.names[tE.Ident.Val] = true
+		case *DefStructExpr:
+			ls.names[tE.Name.Val] = true
+			ls.names[tE.Name.Val+"?"] = true
+			for _, f := range tE.Fields {
+				ls.names[tE.Name.Val+"-"+f.Val] = true
+			}
+		case *DefGenericExpr:
+			ls.names[tE.Name.Val] = true
+		case *FnExpr, *GoExpr, *DefTestExpr:
+			return false
+		case *BlockLetExpr:
+			if !tE.Sequential {
+				for _, b := range tE.Bindings {
+					ls.declare(b.Value)
+				}
+			}
+			return false
+		case *LetValuesExpr:
+			ls.declare(tE.Value)
+			return false
+		case *WhileExpr:
+			ls.declare(tE.Cond)
+			return false
+		case *ForExpr:
+			ls.declare(tE.Binding.Value)
+			return false
+		case *DoTimesExpr:
+			ls.declare(tE.Binding.Value)
+			return false
+		}
+		return true
+	})
+}
+
+func (rs *lexicalResolver) exprs(exprs []Expr) {
+	for _, e := range exprs {
+		rs.expr(e)
+	}
+}
+
+// inScope resolves the expressions within the scope.
+func (rs *lexicalResolver) inScope(ls *lexicalScope, exprs ...Expr) {
+	rs.scopes = append(rs.scopes, ls)
+	rs.exprs(exprs)
+	rs.scopes = rs.scopes[:len(rs.scopes)-1]
+}
+
+// ident sets the address of the identifier to the innermost scope binding it;
+// or clears it, if none does.
+func (rs *lexicalResolver) ident(il *IdentLiteral) {
+	il.scope, il.depth = nil, 0
+	for i := len(rs.scopes) - 1; i >= 0; i-- {
+		if rs.scopes[i].names[il.Val] {
+			il.scope, il.depth = rs.scopes[i], len(rs.scopes)-1-i
+			return
+		}
+	}
+}
+
+func (rs *lexicalResolver) expr(e Expr) {
+	switch tE := e.(type) {
+	case *IdentLiteral:
+		rs.ident(tE)
+
+	case *FnExpr:
+		tE.nameScope = nil
+		if tE.Name != "" {
+			tE.nameScope = newLexicalScope([]string{tE.Name}, nil)
+			rs.scopes = append(rs.scopes, tE.nameScope)
+			defer func() { rs.scopes = rs.scopes[:len(rs.scopes)-1] }()
+		}
+		params := make([]string, 0, len(tE.Args)+1)
+		for _, arg := range tE.Args {
+			params = append(params, arg.Ident)
+		}
+		if tE.Rest != nil {
+			params = append(params, tE.Rest.Ident)
+		}
+		tE.scope = newLexicalScope(params, tE.Body)
+		rs.inScope(tE.scope, tE.Body...)
+
+	case *BlockLetExpr:
+		names := make([]string, len(tE.Bindings))
+		values := make([]Expr, len(tE.Bindings))
+		for i, b := range tE.Bindings {
+			names[i], values[i] = b.Ident.Val, b.Value
+		}
+		if tE.Sequential {
+			tE.scope = newLexicalScope(names, append(values, tE.Body...))
+			rs.inScope(tE.scope, append(values, tE.Body...)...)
+		} else {
+			rs.exprs(values)
+			tE.scope = newLexicalScope(names, tE.Body)
+			rs.inScope(tE.scope, tE.Body...)
+		}
+
+	case *LetValuesExpr:
+		rs.expr(tE.Value)
+		names := make([]string, len(tE.Idents))
+		for i, ident := range tE.Idents {
+			names[i] = ident.Val
+		}
+		tE.scope = newLexicalScope(names, tE.Body)
+		rs.inScope(tE.scope, tE.Body...)
+
+	case *WhileExpr:
+		rs.expr(tE.Cond)
+		tE.scope = newLexicalScope(nil, tE.Body)
+		rs.inScope(tE.scope, tE.Body...)
+
+	case *ForExpr:
+		rs.expr(tE.Binding.Value)
+		tE.scope = newLexicalScope([]string{tE.Binding.Ident.Val}, tE.Body)
+		rs.inScope(tE.scope, tE.Body...)
+
+	case *DoTimesExpr:
+		rs.expr(tE.Binding.Value)
+		tE.scope = newLexicalScope([]string{tE.Binding.Ident.Val}, tE.Body)
+		rs.inScope(tE.scope, tE.Body...)
+
+	case *GoExpr:
+		tE.scope = newLexicalScope(nil, []Expr{tE.Expr})
+		rs.inScope(tE.scope, tE.Expr)
+
+	case *DefTestExpr:
+		// tests are run later, in a context of their own.
+		outer := rs.scopes
+		rs.scopes = nil
+		rs.exprs(tE.Body)
+		rs.scopes = outer
+
+	default:
+		for _, child := range subExprs(e) {
+			rs.expr(child)
+		}
+	}
+}
+
+// resolveAt looks up the identifier in the context the given number of
+// contexts out, if that's the context of the scope. Returns false if it isn't,
+// or the identifier isn't bound there.
+func (ec *EvalContext) resolveAt(depth int, scope *lexicalScope, ident string) (Value, bool) {
+	if ec.environ().resolveLog != nil {
+		return nil, false
+	}
+	c := ec
+	for i := 0; i < depth && c != nil; i++ {
+		c = c.parent
+	}
+	if c == nil || c.scope != scope {
+		return nil, false
+	}
+	c.mu.RLock()
+	v, ok := c.vals[ident]
+	c.mu.RUnlock()
+	return v, ok
+}
@@ -0,0 +1,174 @@
+package golisp2
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_resolveLexical(t *testing.T) {
+	parse := func(t *testing.T, src string) []Expr {
+		exprs, err := ParseString("lexical.l", src)
+		require.NoError(t, err)
+		return exprs
+	}
+	addresses := func(exprs []Expr) map[string][]int {
+		depths := map[string][]int{}
+		for _, e := range exprs {
+			Walk(e, func(e Expr) bool {
+				if il, isIdent := e.(*IdentLiteral); isIdent {
+					depth := -1
+					if il.scope != nil {
+						depth = il.depth
+					}
+					depths[il.Val] = append(depths[il.Val], depth)
+				}
+				return true
+			})
+		}
+		return depths
+	}
+
+	t.Run("addresses", func(t *testing.T) {
+		exprs := parse(t, `
+			(let top 1)
+			(fn (a) (let b a) (fn (c) (+ a b c top)))`)
+		require.Equal(t, map[string][]int{
+			"a":   {0, 1},
+			"b":   {1},
+			"c":   {0},
+			"top": {-1},
+		}, addresses(exprs))
+	})
+
+	t.Run("parallelLet", func(t *testing.T) {
+		// the values of a parallel let are outside its scope; let*'s aren't.
+		exprs := parse(t, `(fn (x) (let ((x 1) (y x)) y) (let* ((z 1) (w z)) w))`)
+		require.Equal(t, map[string][]int{
+			"x": {0},
+			"y": {0},
+			"z": {0},
+			"w": {0},
+		}, addresses(exprs))
+	})
+}
+
+func Test_lexicalEval(t *testing.T) {
+	t.Run("closures", func(t *testing.T) {
+		ec := BuiltinContext()
+		evalStrInContext(t, ec, `
+			(let counter (fn (start)
+				(let n start)
+				(fn () (set! n (+ n 1)) n)))
+			(let c (counter 10))
+			(c)`)
+		assertNumValue(t, evalStrInContext(t, ec, `(c)`), 12)
+	})
+
+	t.Run("shadowing", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `
+			((fn (x)
+				(let ((x (* x 10)))
+					((fn (x) (+ x 1)) x)))
+			 2)`), 21)
+	})
+
+	t.Run("bindingAfterUse", func(t *testing.T) {
+		// y is bound in the function's scope, but only after the first use, which
+		// must find the outer y.
+		ec := BuiltinContext()
+		evalStrInContext(t, ec, `(let y 1)`)
+		assertNumValue(t, evalStrInContext(t, ec, `
+			((fn ()
+				(let before y)
+				(let y 2)
+				(+ before y)))`), 3)
+	})
+
+	t.Run("loops", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `
+			((fn (n)
+				(let total 0)
+				(dotimes (i n)
+					(let sq (* i i))
+					(set! total (+ total sq)))
+				(let j 0)
+				(while (< j n)
+					(set! total (+ total j))
+					(set! j (+ j 1)))
+				total)
+			 4)`), 20)
+	})
+
+	t.Run("namedRecursion", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `
+			((fn fact (n) (if (< n 2) 1 (* n (fact (- n 1))))) 5)`), 120)
+	})
+
+	t.Run("handBuilt", func(t *testing.T) {
+		// an expression that hasn't been resolved falls back to dynamic lookup.
+		e := &CallExpr{Exprs: []Expr{
+			&FnExpr{
+				Args: []Arg{{Ident: "a"}},
+				Body: []Expr{&IdentLiteral{Val: "a"}},
+			},
+			&NumberLiteral{Num: 7},
+		}}
+		assertNumValue(t, mustEval(t, e, BuiltinContext()), 7)
+	})
+
+	t.Run("resolveLog", func(t *testing.T) {
+		ec := BuiltinContext()
+		var log bytes.Buffer
+		ec.SetResolveLog(&log)
+		assertNumValue(t, evalStrInContext(t, ec, `((fn (a) a) 3)`), 3)
+		require.Contains(t, log.String(), "a")
+	})
+}
+
+// BenchmarkLexicalResolve compares evaluating identifiers bound several
+// functions out, in a hot loop, with and without lexical addresses.
+func BenchmarkLexicalResolve(b *testing.B) {
+	src := `
+		((fn (a)
+			((fn (b)
+				((fn (c)
+					((fn (d)
+						(let total 0)
+						(dotimes (i 1000)
+							(set! total (+ total a b c d i)))
+						total) 4)) 3)) 2)) 1)`
+	run := func(b *testing.B, exprs []Expr) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ec := BuiltinContext().SubContext(nil)
+			for _, e := range exprs {
+				if _, err := e.Eval(ec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("addressed", func(b *testing.B) {
+		exprs, err := ParseString("bench.l", src)
+		require.NoError(b, err)
+		run(b, exprs)
+	})
+
+	b.Run("dynamic", func(b *testing.B) {
+		exprs, err := ParseString("bench.l", src)
+		require.NoError(b, err)
+		for _, e := range exprs {
+			Walk(e, func(e Expr) bool {
+				if il, isIdent := e.(*IdentLiteral); isIdent {
+					il.scope, il.depth = nil, 0
+				}
+				return true
+			})
+		}
+		run(b, exprs)
+	})
+}
@@ -10,35 +10,49 @@ type (
 		// "compound lookups"; e.g. "Foo.Bar.A"; in which case I think this should
 		// not just be a string. Arguably, that should have it's own datatype
 		// anyway.
-		Val string
-		Pos ScannerPosition
+		Val      string
+		Pos, End ScannerPosition
+
+		// scope and depth are the identifier's lexical address: it's bound in
+		// the context of scope, depth contexts out. scope is nil if it isn't
+		// known. See resolveLexical.
+		scope *lexicalScope
+		depth int
 	}
 
 	// NumberLiteral is a representation of a number literal within the
 	// interpreted environment.
 	NumberLiteral struct {
-		Num float64
-		Pos ScannerPosition
+		Num      float64
+		Pos, End ScannerPosition
 	}
 
 	// NilLiteral is a representation of an null literal within the interpreted
 	// environment.
 	NilLiteral struct {
-		Pos ScannerPosition
+		Pos, End ScannerPosition
 	}
 
 	// StringLiteral is a representation of a string literal within the
 	// interpreted environment.
 	StringLiteral struct {
-		Str string
-		Pos ScannerPosition
+		Str      string
+		Pos, End ScannerPosition
 	}
 
 	// BoolLiteral is a representation of a boolean literal within the interpreted
 	// environment.
 	BoolLiteral struct {
-		Bool bool
-		Pos  ScannerPosition
+		Bool     bool
+		Pos, End ScannerPosition
+	}
+
+	// KeywordLiteral is a representation of a keyword literal within the
+	// interpreted environment.
+	KeywordLiteral struct {
+		// Name is the keyword without the leading colon.
+		Name     string
+		Pos, End ScannerPosition
 	}
 
 	// FuncLiteral is a representation of a basic function declaration/assignment
@@ -50,7 +64,10 @@ type (
 		// Fn is the function body the function value references.
 		Fn func(*EvalContext, ...Value) (Value, error)
 
-		Pos ScannerPosition
+		// Pure marks the function as having no side effects.
+		Pure bool
+
+		Pos, End ScannerPosition
 	}
 )
 
@@ -69,14 +86,26 @@ func NewIdentLiteral(ident string) *IdentLiteral {
 // should be a "severe error" that bubbles back and most likely halts execution.
 // It's *possible* the right way to handle that is by creating a modified value
 // interface that can directly support the notion of error.
-func (iv *IdentLiteral) Eval(ec *EvalContext) (Value, error) {
-	v, ok := ec.Resolve(iv.Val)
+func (iv *IdentLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(iv)(&v, &err)
+	v, ok := iv.resolve(ec)
 	if !ok {
-		return &NilValue{}, nil
+		return Nil, nil
 	}
 	return v, nil
 }
 
+// resolve looks up the identifier's value in the context; directly at its
+// lexical address, if it has one that's valid in the context.
+func (iv *IdentLiteral) resolve(ec *EvalContext) (Value, bool) {
+	if iv.scope != nil {
+		if v, ok := ec.resolveAt(iv.depth, iv.scope, iv.Val); ok {
+			return v, true
+		}
+	}
+	return ec.Resolve(iv.Val)
+}
+
 // CodeStr will return the code representation of the ident value.
 func (iv *IdentLiteral) CodeStr() string {
 	return iv.Val
@@ -87,6 +116,11 @@ func (iv *IdentLiteral) SourcePos() ScannerPosition {
 	return iv.Pos
 }
 
+// SourceSpan is the extent in source of this value.
+func (iv *IdentLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: iv.Pos, End: iv.End}
+}
+
 // NewNumberLiteral instantiates a new number literal with the given value.
 func NewNumberLiteral(v float64) *NumberLiteral {
 	return &NumberLiteral{
@@ -95,10 +129,9 @@ func NewNumberLiteral(v float64) *NumberLiteral {
 }
 
 // Eval just returns itself.
-func (nv *NumberLiteral) Eval(*EvalContext) (Value, error) {
-	return &NumberValue{
-		Val: nv.Num,
-	}, nil
+func (nv *NumberLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(nv)(&v, &err)
+	return NewNumberValue(nv.Num), nil
 }
 
 // CodeStr will return the code representation of the number value.
@@ -114,16 +147,22 @@ func (nv *NumberLiteral) SourcePos() ScannerPosition {
 	return nv.Pos
 }
 
+// SourceSpan is the extent in source of this value.
+func (nv *NumberLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: nv.Pos, End: nv.End}
+}
+
 // NewNilLiteral creates a new nil value.
 func NewNilLiteral() *NilLiteral {
 	return &NilLiteral{}
 }
 
 // Eval returns the nil value.
-func (nv *NilLiteral) Eval(*EvalContext) (Value, error) {
+func (nv *NilLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(nv)(&v, &err)
 	// note (bs): not sure about this. In general, I feel like eval needs to be
 	// more intelligent
-	return &NilValue{}, nil
+	return Nil, nil
 }
 
 // CodeStr will return the code representation of the nil value.
@@ -136,6 +175,11 @@ func (nv *NilLiteral) SourcePos() ScannerPosition {
 	return nv.Pos
 }
 
+// SourceSpan is the extent in source of this value.
+func (nv *NilLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: nv.Pos, End: nv.End}
+}
+
 // NewStringLiteral creates a new string literal from the given string.
 func NewStringLiteral(str string) *StringLiteral {
 	return &StringLiteral{
@@ -144,7 +188,8 @@ func NewStringLiteral(str string) *StringLiteral {
 }
 
 // Eval returns the string value.
-func (sv *StringLiteral) Eval(*EvalContext) (Value, error) {
+func (sv *StringLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(sv)(&v, &err)
 	return &StringValue{
 		Val: sv.Str,
 	}, nil
@@ -162,6 +207,11 @@ func (sv *StringLiteral) SourcePos() ScannerPosition {
 	return sv.Pos
 }
 
+// SourceSpan is the extent in source of this value.
+func (sv *StringLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: sv.Pos, End: sv.End}
+}
+
 // NewBoolLiteral creates a bool literal with the given value.
 func NewBoolLiteral(v bool) *BoolLiteral {
 	return &BoolLiteral{
@@ -170,10 +220,9 @@ func NewBoolLiteral(v bool) *BoolLiteral {
 }
 
 // Eval returns the bool value.
-func (bv *BoolLiteral) Eval(*EvalContext) (Value, error) {
-	return &BoolValue{
-		Val: bv.Bool,
-	}, nil
+func (bv *BoolLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(bv)(&v, &err)
+	return NewBoolValue(bv.Bool), nil
 }
 
 // CodeStr will return the code representation of the boolean value.
@@ -189,6 +238,41 @@ func (bv *BoolLiteral) SourcePos() ScannerPosition {
 	return bv.Pos
 }
 
+// SourceSpan is the extent in source of this value.
+func (bv *BoolLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: bv.Pos, End: bv.End}
+}
+
+// NewKeywordLiteral creates a keyword literal with the given name.
+func NewKeywordLiteral(name string) *KeywordLiteral {
+	return &KeywordLiteral{
+		Name: name,
+	}
+}
+
+// Eval returns the keyword value.
+func (kl *KeywordLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(kl)(&v, &err)
+	return &KeywordValue{
+		Val: kl.Name,
+	}, nil
+}
+
+// CodeStr will return the code representation of the keyword value.
+func (kl *KeywordLiteral) CodeStr() string {
+	return ":" + kl.Name
+}
+
+// SourcePos is the location in source this value came from.
+func (kl *KeywordLiteral) SourcePos() ScannerPosition {
+	return kl.Pos
+}
+
+// SourceSpan is the extent in source of this value.
+func (kl *KeywordLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: kl.Pos, End: kl.End}
+}
+
 // NewFuncLiteral creates a function literal with the given value.
 func NewFuncLiteral(
 	name string,
@@ -200,9 +284,12 @@ func NewFuncLiteral(
 }
 
 // Eval evaluates the function using the provided context.
-func (fv *FuncLiteral) Eval(ec *EvalContext) (Value, error) {
+func (fv *FuncLiteral) Eval(ec *EvalContext) (v Value, err error) {
+	defer ec.hookExpr(fv)(&v, &err)
 	return &FuncValue{
-		Fn: fv.Fn,
+		Name: fv.Name,
+		Fn:   fv.Fn,
+		Pure: fv.Pure,
 	}, nil
 }
 
@@ -215,3 +302,8 @@ func (fv *FuncLiteral) CodeStr() string {
 func (fv *FuncLiteral) SourcePos() ScannerPosition {
 	return fv.Pos
 }
+
+// SourceSpan is the extent in source of this value.
+func (fv *FuncLiteral) SourceSpan() SourceSpan {
+	return SourceSpan{Start: fv.Pos, End: fv.End}
+}
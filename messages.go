@@ -0,0 +1,172 @@
+package golisp2
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+type (
+	// MessageCode identifies a message that can be localized. The message text
+	// for a code is a text/template, executed against a struct of the fields
+	// documented on the code.
+	MessageCode string
+
+	// MessageCatalog maps message codes to their template text.
+	MessageCatalog map[MessageCode]string
+)
+
+const (
+	// ParseErrorMsg is the text of a ParseError. Fields: Msg, Token, File, Row,
+	// Col.
+	ParseErrorMsg MessageCode = "ParseError"
+
+	// ForbiddenRuneErrorMsg is the text of a ForbiddenRuneError. Fields: Rune,
+	// Invalid, File, Row, Col.
+	ForbiddenRuneErrorMsg MessageCode = "ForbiddenRuneError"
+
+	// TokenLengthErrorMsg is the text of a TokenLengthError. Fields: Max, File,
+	// Row, Col.
+	TokenLengthErrorMsg MessageCode = "TokenLengthError"
+
+	// TypeErrorMsg is the text of a TypeError. Fields: Expected, Actual, File,
+	// Row, Col.
+	TypeErrorMsg MessageCode = "TypeError"
+
+	// EvalErrorMsg is the text of an EvalError. Fields: Msg, File, Row, Col.
+	EvalErrorMsg MessageCode = "EvalError"
+
+	// StackOverflowErrorMsg is the text of a StackOverflowError, before its
+	// trace. Fields: MaxDepth, File, Row, Col.
+	StackOverflowErrorMsg MessageCode = "StackOverflowError"
+
+	// ArgTypeErrorMsg is the text of an ArgTypeError. Fields: FnName, ArgI,
+	// Expected, Actual.
+	ArgTypeErrorMsg MessageCode = "ArgTypeError"
+
+	// UndefinedFnMsg is the message when an undefined identifier is called.
+	// Fields: Ident.
+	UndefinedFnMsg MessageCode = "UndefinedFn"
+
+	// DidYouMeanMsg is appended to messages about undefined identifiers when a
+	// similar one exists. Fields: Suggestion.
+	DidYouMeanMsg MessageCode = "DidYouMean"
+
+	// ArgCountMsg is the message when a function is called with the wrong
+	// number of arguments. Fields: Expected, Actual.
+	ArgCountMsg MessageCode = "ArgCount"
+
+	// CallArgCountMsg is the message when a function is called with a number
+	// of arguments it doesn't accept. Fields: Name, Expected, Actual.
+	CallArgCountMsg MessageCode = "CallArgCount"
+
+	// MinArgCountMsg is the message when a function with a rest argument is
+	// called with too few arguments. Fields: Expected, Actual.
+	MinArgCountMsg MessageCode = "MinArgCount"
+
+	// KeywordArgMsg is the message when a value is passed where a keyword
+	// argument was expected. Fields: Actual.
+	KeywordArgMsg MessageCode = "KeywordArg"
+
+	// KeywordArgValueMsg is the message when a keyword argument is passed
+	// without a value. Fields: Keyword.
+	KeywordArgValueMsg MessageCode = "KeywordArgValue"
+
+	// UnknownKeywordArgMsg is the message when a function is passed a keyword
+	// argument it doesn't declare. Fields: Keyword.
+	UnknownKeywordArgMsg MessageCode = "UnknownKeywordArg"
+)
+
+// DefaultMessageCatalog contains the default (english) text of all messages.
+var DefaultMessageCatalog = MessageCatalog{
+	ParseErrorMsg: "Parse error {{.Msg}} for token `{{.Token}}`: " +
+		"file '{{.File}}' at line {{.Row}}, column {{.Col}}",
+	ForbiddenRuneErrorMsg: "{{if .Invalid}}Invalid UTF-8{{else}}" +
+		"Forbidden rune '{{printf \"%x\" .Rune}}'{{end}} found in " +
+		"scan of '{{.File}}' (line {{.Row}}, col {{.Col}})",
+	TokenLengthErrorMsg: "Token longer than {{.Max}} bytes found in scan of " +
+		"'{{.File}}' (line {{.Row}}, col {{.Col}})",
+	TypeErrorMsg: "Type error: expected '{{.Expected}}', got '{{.Actual}}' " +
+		"({{.File}}:{{.Row}})",
+	EvalErrorMsg: "Eval error '{{.Msg}}': '{{.File}}' " +
+		"(line {{.Row}}, col {{.Col}})",
+	StackOverflowErrorMsg: "Stack overflow: calls nested deeper than the " +
+		"maximum depth of {{.MaxDepth}}: '{{.File}}' (line {{.Row}}, col {{.Col}})",
+	ArgTypeErrorMsg: "Arg-type error in '{{.FnName}}' at arg {{.ArgI}}: " +
+		"expected '{{.Expected}}', got '{{.Actual}}'",
+	UndefinedFnMsg: "undefined identifier '{{.Ident}}' cannot be used " +
+		"as function",
+	DidYouMeanMsg:   "did you mean '{{.Suggestion}}'?",
+	ArgCountMsg:     "expected {{.Expected}} arguments in call; got {{.Actual}}",
+	MinArgCountMsg:  "expected at least {{.Expected}} arguments in call; got {{.Actual}}",
+	CallArgCountMsg: "{{.Name}}: expected {{.Expected}}; got {{.Actual}}",
+	KeywordArgMsg:   "expected a keyword argument in call; got {{.Actual}}",
+	KeywordArgValueMsg: "keyword argument ':{{.Keyword}}' is missing " +
+		"a value",
+	UnknownKeywordArgMsg: "unknown keyword argument ':{{.Keyword}}'",
+}
+
+var (
+	messagesMu sync.RWMutex
+	messages   = mustCompileCatalog(DefaultMessageCatalog)
+	defaults   = messages
+)
+
+// SetMessageCatalog replaces the text used for messages. Codes missing from
+// the catalog will continue to use the default text. Returns an error if any
+// of the templates are invalid, in which case the current catalog is kept.
+func SetMessageCatalog(catalog MessageCatalog) error {
+	compiled, err := compileCatalog(catalog)
+	if err != nil {
+		return err
+	}
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	messages = compiled
+	return nil
+}
+
+// formatMessage renders the message for the code with the given data.
+func formatMessage(code MessageCode, data interface{}) string {
+	messagesMu.RLock()
+	tmpl, hasTmpl := messages[code]
+	messagesMu.RUnlock()
+	if hasTmpl {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, data); err == nil {
+			return sb.String()
+		}
+	}
+	// fall back to the default text if the custom template fails.
+	var sb strings.Builder
+	if err := defaults[code].Execute(&sb, data); err != nil {
+		return fmt.Sprintf("%s: %+v", code, data)
+	}
+	return sb.String()
+}
+
+// compileCatalog parses all the templates in the catalog, filling in any
+// missing codes with the defaults.
+func compileCatalog(catalog MessageCatalog) (map[MessageCode]*template.Template, error) {
+	compiled := map[MessageCode]*template.Template{}
+	for code, text := range DefaultMessageCatalog {
+		if custom, hasCustom := catalog[code]; hasCustom {
+			text = custom
+		}
+		tmpl, err := template.New(string(code)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message for '%s': %w", code, err)
+		}
+		compiled[code] = tmpl
+	}
+	return compiled, nil
+}
+
+func mustCompileCatalog(catalog MessageCatalog) map[MessageCode]*template.Template {
+	compiled, err := compileCatalog(catalog)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
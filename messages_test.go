@@ -0,0 +1,66 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MessageCatalog(t *testing.T) {
+	pos := ScannerPosition{
+		SourceFile: "msgs.l",
+		Col:        3,
+		Row:        4,
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		require.Equal(t,
+			"Eval error 'boom': 'msgs.l' (line 4, col 3)",
+			EvalError{Msg: "boom", Pos: pos}.Error())
+		require.Equal(t,
+			"Forbidden rune '0' found in scan of 'msgs.l' (line 4, col 3)",
+			NewForbiddenRuneError(0, pos).Error())
+		require.Equal(t,
+			"Arg-type error in 'add' at arg 2: expected 'number', got 'nil'",
+			(&ArgTypeError{
+				FnName: "add", ArgI: 2, Expected: "number", Actual: "nil",
+			}).Error())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		defer SetMessageCatalog(nil)
+		err := SetMessageCatalog(MessageCatalog{
+			TypeErrorMsg: "Typfehler: erwartet '{{.Expected}}', " +
+				"erhalten '{{.Actual}}' ({{.File}}:{{.Row}})",
+			UndefinedFnMsg: "unbekannter Bezeichner '{{.Ident}}'",
+		})
+		require.NoError(t, err)
+
+		require.Equal(t,
+			"Typfehler: erwartet 'number', erhalten 'string' (msgs.l:4)",
+			NewTypeError("string", "number", pos).Error())
+		evalErr := evalStrToErr(t, `(qwertyuiop 1)`)
+		require.Contains(t, evalErr.Error(), "unbekannter Bezeichner 'qwertyuiop'")
+
+		// codes not in the custom catalog keep their default text.
+		require.Contains(t, EvalError{Msg: "boom", Pos: pos}.Error(), "Eval error")
+	})
+
+	t.Run("invalidTemplate", func(t *testing.T) {
+		defer SetMessageCatalog(nil)
+		err := SetMessageCatalog(MessageCatalog{
+			EvalErrorMsg: "{{.Msg",
+		})
+		require.Error(t, err)
+		require.Contains(t, EvalError{Msg: "boom", Pos: pos}.Error(), "Eval error")
+	})
+
+	t.Run("failedExecutionFallsBack", func(t *testing.T) {
+		defer SetMessageCatalog(nil)
+		err := SetMessageCatalog(MessageCatalog{
+			EvalErrorMsg: "{{.NoSuchField}}",
+		})
+		require.NoError(t, err)
+		require.Contains(t, EvalError{Msg: "boom", Pos: pos}.Error(), "Eval error")
+	})
+}
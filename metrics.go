@@ -0,0 +1,86 @@
+package golisp2
+
+import (
+	"errors"
+	"time"
+)
+
+type (
+	// Metrics receives measurements about evaluation. Hosts running many scripts
+	// can implement it to bind to a metrics library; e.g. as Prometheus counters
+	// and histograms. All labels are low-cardinality strings.
+	//
+	// Implementations must be safe for concurrent use.
+	Metrics interface {
+		// EvalStarted is called when a program begins evaluating.
+		EvalStarted()
+
+		// EvalFinished is called when a program finishes evaluating, with how long
+		// it took.
+		EvalFinished(d time.Duration)
+
+		// EvalFailed is called when a program fails, with the kind of error it
+		// failed with; e.g. "TypeError".
+		EvalFailed(kind string)
+
+		// BuiltinCalled is called each time a builtin function is called, with
+		// it's name.
+		BuiltinCalled(name string)
+	}
+
+	// nopMetrics is a Metrics that discards all measurements.
+	nopMetrics struct{}
+)
+
+func (nopMetrics) EvalStarted()                 {}
+func (nopMetrics) EvalFinished(d time.Duration) {}
+func (nopMetrics) EvalFailed(kind string)       {}
+func (nopMetrics) BuiltinCalled(name string)    {}
+
+// SetMetrics sets where measurements about evaluation are reported. A nil
+// metrics discards them. This applies to all parent and sub contexts.
+func (ec *EvalContext) SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	ec.environ().metrics = m
+}
+
+// metrics returns where measurements about evaluation should be reported.
+func (ec *EvalContext) metrics() Metrics {
+	return ec.environ().metrics
+}
+
+// errorKind returns a short label for the type of the error, for use in
+// metrics.
+func errorKind(err error) string {
+	var (
+		parseErr   *ParseError
+		runeErr    *ForbiddenRuneError
+		lengthErr  *TokenLengthError
+		typeErr    *TypeError
+		evalErr    *EvalError
+		argTypeErr *ArgTypeError
+	)
+	switch {
+	case errors.As(err, &parseErr):
+		return "ParseError"
+	case errors.As(err, &runeErr):
+		return "ForbiddenRuneError"
+	case errors.As(err, &lengthErr):
+		return "TokenLengthError"
+	case errors.As(err, &typeErr):
+		return "TypeError"
+	case errors.As(err, &evalErr):
+		return "EvalError"
+	case errors.As(err, &argTypeErr):
+		return "ArgTypeError"
+	default:
+		return "Error"
+	}
+}
+
+// isBuiltin indicates if the function is one of the builtins.
+func isBuiltin(fn *FuncValue) bool {
+	return fn.builtin
+}
@@ -0,0 +1,82 @@
+package golisp2
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetrics is a Metrics that keeps everything reported to it.
+type recordingMetrics struct {
+	mu       sync.Mutex
+	started  int
+	finished int
+	failed   []string
+	builtins map[string]int
+}
+
+func (rm *recordingMetrics) EvalStarted() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.started++
+}
+
+func (rm *recordingMetrics) EvalFinished(d time.Duration) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.finished++
+}
+
+func (rm *recordingMetrics) EvalFailed(kind string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.failed = append(rm.failed, kind)
+}
+
+func (rm *recordingMetrics) BuiltinCalled(name string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.builtins == nil {
+		rm.builtins = map[string]int{}
+	}
+	rm.builtins[name]++
+}
+
+func Test_Metrics(t *testing.T) {
+	evalProgram := func(t *testing.T, ec *EvalContext, src string) error {
+		t.Helper()
+		prog, err := ParseProgram(NewTokenScanner(
+			NewRuneScanner("program.l", strings.NewReader(src))))
+		require.NoError(t, err)
+		_, err = prog.Eval(ec)
+		return err
+	}
+
+	m := &recordingMetrics{}
+	ec := BuiltinContext().SubContext(nil)
+	ec.SetMetrics(m)
+
+	require.NoError(t, evalProgram(t, ec, `
+	(let f (fn (s) (concat s s)))
+	(len (f "a"))
+	(f "b")`))
+	require.Equal(t, 1, m.started)
+	require.Equal(t, 1, m.finished)
+	require.Empty(t, m.failed)
+	require.Equal(t, map[string]int{"concat": 2, "len": 1}, m.builtins)
+
+	require.Error(t, evalProgram(t, ec, `(undefinedFn)`))
+	require.Error(t, evalProgram(t, ec, `(if 1 2)`))
+	require.Error(t, evalProgram(t, ec, `(len 1)`))
+	require.Equal(t, 4, m.started)
+	require.Equal(t, 4, m.finished)
+	require.Equal(t, []string{"EvalError", "TypeError", "Error"}, m.failed)
+
+	// a nil metrics should fall back to discarding measurements.
+	ec.SetMetrics(nil)
+	require.NoError(t, evalProgram(t, ec, `(len "a")`))
+	require.Equal(t, 4, m.started)
+}
@@ -0,0 +1,108 @@
+package golisp2
+
+import (
+	"io"
+	"time"
+)
+
+// Options configure how a tree of contexts evaluates. The zero Options are the
+// defaults: output goes to os.Stdout and os.Stderr, calls may nest
+// DefaultMaxDepth deep, warnings don't fail evaluation, conditions must be
+// bools, maps are iterated in any order, dividing by zero fails, and every
+// effect is allowed.
+type Options struct {
+	// MaxDepth is how deeply function calls may nest before evaluation fails
+	// with a StackOverflowError. Zero for DefaultMaxDepth; negative for no
+	// limit, in which case deep enough recursion crashes the process.
+	MaxDepth int
+
+	// Stdout and Stderr are where printed output, and printed errors, are
+	// written. If nil, os.Stdout and os.Stderr.
+	Stdout, Stderr io.Writer
+
+	// Strict makes warnings errors: e.g. calling a deprecated function, or a
+	// let shadowing a builtin, fails rather than adding a diagnostic.
+	Strict bool
+
+	// Truthy lets conditions be any value, rather than only bools: nil and
+	// false are false, and everything else is true.
+	Truthy bool
+
+	// SortMaps iterates maps in sorted key order. Deterministic implies it.
+	SortMaps bool
+
+	// IEEEDivision makes dividing by zero follow IEEE 754, producing an
+	// infinity or NaN, rather than failing. See isInf and isNaN.
+	IEEEDivision bool
+
+	// Deterministic makes runs reproducible; see SetDeterministic. Seed seeds
+	// random, and Clock is the instant the clock is frozen at.
+	Deterministic bool
+	Seed          int64
+	Clock         time.Time
+
+	// Policy, if set, limits what effectful builtins may do; see SetPolicy.
+	Policy *Policy
+}
+
+// SetOptions configures evaluation in the context, replacing any previous
+// configuration of the same settings. This applies to all parent and sub
+// contexts.
+func (ec *EvalContext) SetOptions(o Options) {
+	env := ec.environ()
+	env.maxDepth = o.MaxDepth
+	env.strict = o.Strict
+	env.truthy = o.Truthy
+	env.sortMaps = o.SortMaps
+	env.ieeeDivision = o.IEEEDivision
+	ec.SetStdout(o.Stdout)
+	ec.SetStderr(o.Stderr)
+	if o.Deterministic {
+		ec.SetDeterministic(o.Seed, o.Clock)
+	} else {
+		env.deterministic = false
+		env.rand = newLockedRand(time.Now().UnixNano())
+		env.now = time.Now
+	}
+	if o.Policy != nil {
+		ec.SetPolicy(*o.Policy)
+	} else {
+		env.policy = nil
+	}
+}
+
+// SetOptions configures how the interpreter evaluates. See
+// EvalContext.SetOptions.
+func (in *Interpreter) SetOptions(o Options) {
+	in.ec.SetOptions(o)
+}
+
+// DefaultMaxDepth is how deeply function calls may nest when Options.MaxDepth
+// is zero. It's well short of the depth that overflows the Go stack.
+const DefaultMaxDepth = 10000
+
+// checkDepth returns an error if a call at the position would nest deeper than
+// the maximum depth.
+func (ec *EvalContext) checkDepth(pos ScannerPosition) error {
+	maxDepth := ec.environ().maxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if maxDepth < 0 || ec.depth < maxDepth {
+		return nil
+	}
+	return &StackOverflowError{
+		MaxDepth: maxDepth,
+		Pos:      pos,
+	}
+}
+
+// warnAt adds a warning diagnostic at the position; or, in strict mode,
+// returns it as an error instead.
+func (ec *EvalContext) warnAt(msg string, pos ScannerPosition) error {
+	if ec.environ().strict {
+		return &EvalError{Msg: msg, Pos: pos}
+	}
+	ec.Diagnostics().Warn(msg, pos)
+	return nil
+}
@@ -0,0 +1,148 @@
+package golisp2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Options(t *testing.T) {
+	defineDepth := `(defun depth (n) (if (== n 0) 0 (+ 1 (depth (- n 1)))))`
+
+	t.Run("defaults", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{})
+		require.Equal(t, os.Stdout, ec.Stdout())
+		require.Equal(t, os.Stderr, ec.Stderr())
+		require.False(t, ec.Deterministic())
+
+		// calls nest up to the default limit.
+		evalStrInContext(t, ec, defineDepth)
+		assertNumValue(t, evalStrInContext(t, ec, `(depth 50)`), 50)
+		err := evalStrInContextToErr(t, ec, fmt.Sprintf(`(depth %d)`, DefaultMaxDepth))
+		require.IsType(t, &StackOverflowError{}, err)
+		// conditions must be bools.
+		evalStrInContextToErr(t, ec, `(if 1 2 3)`)
+		// warnings are only diagnostics.
+		assertNumValue(t, evalStrInContext(t, ec, `(listGet (list 1 2) 0.5)`), 1)
+		require.Equal(t, 1, len(ec.Diagnostics().All()))
+	})
+
+	t.Run("maxDepth", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{MaxDepth: 20})
+		evalStrInContext(t, ec, defineDepth)
+		err := evalStrInContextToErr(t, ec, `(depth 50)`)
+		require.Contains(t, err.Error(), "maximum depth of 20")
+		assertNumValue(t, evalStrInContext(t, ec, `(depth 10)`), 10)
+
+		ec.SetOptions(Options{MaxDepth: -1})
+		assertNumValue(t, evalStrInContext(t, ec, `(depth 20000)`), 20000)
+	})
+
+	t.Run("stackOverflow", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{MaxDepth: 100})
+		evalStrInContext(t, ec, defineDepth)
+		err := evalStrInContextToErr(t, ec, "\n(depth 500)")
+		var se *StackOverflowError
+		require.True(t, errors.As(err, &se))
+		require.Equal(t, 100, se.MaxDepth)
+		require.Equal(t, 1, se.Pos.Row)
+		require.Len(t, se.Trace, maxStackTrace)
+		require.Equal(t, 100-maxStackTrace, se.Elided)
+		require.Contains(t, err.Error(), "... 90 more calls")
+
+		// errors that aren't overflows aren't traced.
+		evalStrInContext(t, ec, `(defun fail (n) (if (== n 0) (car 1) (fail (- n 1))))`)
+		err = evalStrInContextToErr(t, ec, `(fail 5)`)
+		require.NotContains(t, err.Error(), "called from")
+	})
+
+	t.Run("writers", func(t *testing.T) {
+		var out, errOut bytes.Buffer
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{Stdout: &out, Stderr: &errOut})
+		evalStrInContext(t, ec, `(print "hi") (printErr "oops")`)
+		require.Contains(t, out.String(), "hi")
+		require.Contains(t, errOut.String(), "oops")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(map[string]Value{
+			"old": NewDeprecatedFunc("old", func(*EvalContext, ...Value) (Value, error) {
+				return &NilValue{}, nil
+			}, Deprecation{}),
+		})
+		ec.SetOptions(Options{Strict: true})
+		err := evalStrInContextToErr(t, ec, `(listGet (list 1 2) 0.5)`)
+		require.Contains(t, err.Error(), "truncated")
+		evalStrInContextToErr(t, ec, `(old)`)
+		evalStrInContextToErr(t, ec, `(old)`)
+		evalStrInContextToErr(t, ec, `(let car 1)`)
+	})
+
+	t.Run("truthy", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{Truthy: true})
+		assertNumValue(t, evalStrInContext(t, ec, `(if 0 1 2)`), 1)
+		assertNumValue(t, evalStrInContext(t, ec, `(if nil 1 2)`), 2)
+		assertNumValue(t, evalStrInContext(t, ec, `(if false 1 2)`), 2)
+		assertNumValue(t, evalStrInContext(t, ec, `(cond ((list) 1) (else 2))`), 1)
+	})
+
+	t.Run("ieeeDivision", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{IEEEDivision: true})
+		require.Equal(t, True, evalStrInContext(t, ec, `(isInf (/ 1 0))`))
+		require.Equal(t, True, evalStrInContext(t, ec, `(isInf (/ -1 0))`))
+		require.Equal(t, True, evalStrInContext(t, ec, `(isNaN (/ 0 0))`))
+		require.Equal(t, True, evalStrInContext(t, ec, `(isNaN (% 1 0))`))
+		require.Equal(t, True, evalStrInContext(t, ec, `(isInf (// 1 0))`))
+		require.Equal(t, True, evalStrInContext(t, ec,
+			`(letValues ((q r) (divmod 1 0)) (and (isInf q) (isNaN r)))`))
+
+		ec.SetOptions(Options{})
+		evalStrInContextToErr(t, ec, `(/ 1 0)`)
+		evalStrInContextToErr(t, ec, `(divmod 1 0)`)
+	})
+
+	t.Run("sortMaps", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{SortMaps: true})
+		for i := 0; i < 5; i++ {
+			keys := evalStrInContext(t, ec, `(mapKeys (map "c" 1 "a" 2 "b" 3))`)
+			require.Equal(t, `["a" "b" "c"]`, keys.InspectStr())
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{Deterministic: true, Seed: 1, Clock: clock})
+		require.True(t, ec.Deterministic())
+		require.Equal(t, clock, ec.Now())
+
+		// options replace the previous configuration.
+		ec.SetOptions(Options{})
+		require.False(t, ec.Deterministic())
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetOptions(Options{Policy: &Policy{}})
+		err := evalStrInContextToErr(t, ec, `(getEnv "HOME")`)
+		require.True(t, strings.Contains(err.Error(), "policy forbids"))
+
+		in := NewInterpreter(ec)
+		in.SetOptions(Options{})
+		_, err = in.Run(strings.NewReader(`(getEnv "HOME")`))
+		require.NoError(t, err)
+	})
+}
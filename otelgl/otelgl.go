@@ -0,0 +1,54 @@
+// Package otelgl adapts an OpenTelemetry tracer for use by golisp2, so script
+// runs and traced function calls appear in the host's distributed traces.
+//
+// It's a separate module so the interpreter itself doesn't depend on
+// OpenTelemetry.
+package otelgl
+
+import (
+	"context"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// tracer wraps an OpenTelemetry tracer as a golisp2.Tracer.
+	tracer struct {
+		t trace.Tracer
+	}
+
+	// span wraps an OpenTelemetry span as a golisp2.Span.
+	span struct {
+		s trace.Span
+	}
+)
+
+// NewTracer wraps the OpenTelemetry tracer. Pass the result to
+// EvalContext.SetTracer; spans are parented to any span in the context given to
+// EvalContext.SetContext.
+func NewTracer(t trace.Tracer) golisp2.Tracer {
+	return &tracer{t: t}
+}
+
+func (t *tracer) Start(
+	ctx context.Context, name string,
+) (context.Context, golisp2.Span) {
+	spanCtx, s := t.t.Start(ctx, name)
+	return spanCtx, &span{s: s}
+}
+
+func (s *span) SetAttribute(key, value string) {
+	s.s.SetAttributes(attribute.String(key, value))
+}
+
+func (s *span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.s.End()
+}
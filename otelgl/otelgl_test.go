@@ -0,0 +1,39 @@
+package otelgl
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bennettjames/go-compiler-experiments/golisp2"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_NewTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	hostCtx, hostSpan := provider.Tracer("host").Start(context.Background(), "host")
+	ec := golisp2.BuiltinContext().SubContext(nil)
+	ec.SetContext(hostCtx)
+	ec.SetTracer(NewTracer(provider.Tracer("golisp")))
+
+	prog, err := golisp2.ParseProgram(golisp2.NewTokenScanner(golisp2.NewRuneScanner(
+		"script.l", strings.NewReader(`
+		(let double (trace (fn (x) (concat x x))))
+		(double "a")`))))
+	require.NoError(t, err)
+	_, err = prog.Eval(ec)
+	require.NoError(t, err)
+	hostSpan.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	call, run, host := spans[0], spans[1], spans[2]
+	require.Equal(t, "golisp.call", call.Name())
+	require.Equal(t, "golisp.run", run.Name())
+	require.Equal(t, run.SpanContext().SpanID(), call.Parent().SpanID())
+	require.Equal(t, host.SpanContext().SpanID(), run.Parent().SpanID())
+}
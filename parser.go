@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 )
 
 // ParseTokens reads in the tokens, and converts them to a set of expressions.
@@ -12,18 +13,164 @@ import (
 func ParseTokens(ts *TokenScanner) ([]Expr, error) {
 	ts.Advance() // initializes the scan
 	exprs, exprsErr := maybeParseExprs(ts)
-	if exprsErr != nil {
-		return nil, exprsErr
-	}
+	// a failure reading the source will usually surface as a parse
+	// error too, but it's the more useful one to report.
 	if ts.Err() != nil && !errors.Is(ts.Err(), io.EOF) {
 		return nil, fmt.Errorf("problem reading source: %w", ts.Err())
 	}
+	if exprsErr != nil {
+		// read the rest of the line so the error can quote all of it.
+		ts.st.src.drainLine()
+		return nil, ts.st.src.Quote(exprsErr)
+	}
 	if !ts.Done() {
-		return nil, NewParseEOFError("parse ended before EOF", ts.Pos())
+		return nil, ts.st.src.Quote(NewParseEOFError("parse ended before EOF", ts.Pos()))
+	}
+	resolveLexical(exprs)
+	return exprs, nil
+}
+
+// ParseString parses the source into a set of expressions. The name is the
+// file name positions in the source are reported with.
+func ParseString(name, src string) ([]Expr, error) {
+	return ParseReader(name, strings.NewReader(src))
+}
+
+// ParseReader reads all of the source from r, and parses it into a set of
+// expressions. The name is the file name positions are reported with.
+func ParseReader(name string, r io.Reader) ([]Expr, error) {
+	return ParseTokens(NewTokenScanner(NewRuneScanner(name, r)))
+}
+
+// ParseExpr parses source that must be a single expression.
+func ParseExpr(name, src string) (Expr, error) {
+	exprs, err := ParseString(name, src)
+	if err != nil {
+		return nil, err
+	}
+	if len(exprs) != 1 {
+		return nil, fmt.Errorf("expected a single expression; got %d", len(exprs))
+	}
+	return exprs[0], nil
+}
+
+// ParseTokensRecovering reads in the tokens and converts them to a set of
+// expressions, like ParseTokens; but doesn't stop at the first parse error.
+// After an error, it skips ahead to the close paren of the top-level expression
+// the error was in, and continues from there. Returns every expression that was
+// parsed, and a *MultiError of all the errors if there were any.
+func ParseTokensRecovering(ts *TokenScanner) ([]Expr, error) {
+	ts.Advance() // initializes the scan
+	exprs := []Expr{}
+	errs := []error{}
+	for ts.Token() != nil {
+		startToken := ts.Token()
+		if startToken.Typ == CloseParenTT {
+			errs = append(errs, NewParseError("unexpected close paren", *startToken))
+			ts.Advance()
+			continue
+		}
+		ts.depth = 0
+		if startToken.Typ == OpenParenTT {
+			ts.depth = 1
+		}
+
+		e, err := maybeParseExpr(ts)
+		if err == nil {
+			exprs = append(exprs, e)
+			continue
+		}
+		errs = append(errs, err)
+		if startToken.Typ == OpenParenTT {
+			for ts.Token() != nil && ts.depth > 0 {
+				ts.Advance()
+			}
+			ts.Advance() // the close paren of the expression
+		} else if ts.Token() == startToken {
+			// the error was in a lone token that wasn't consumed.
+			ts.Advance()
+		}
+	}
+	if ts.Err() != nil && !errors.Is(ts.Err(), io.EOF) {
+		errs = append(errs, fmt.Errorf("problem reading source: %w", ts.Err()))
+	}
+	resolveLexical(exprs)
+	if len(errs) > 0 {
+		return exprs, ts.st.src.Quote(&MultiError{Errs: errs})
 	}
 	return exprs, nil
 }
 
+// ExprScanner reads top-level expressions from a token scanner one at a time,
+// rather than all at once like ParseTokens. Each expression can be evaluated
+// as soon as it's read, before the source that follows it is available; e.g.
+// when the source is piped in on stdin. Its rune scanner only retains the
+// source of the last expression read, which errors evaluating it can be quoted
+// from; see RuneScanner.Quote.
+type ExprScanner struct {
+	ts      *TokenScanner
+	started bool
+	err     error
+}
+
+// NewExprScanner creates an ExprScanner reading from the token scanner, which
+// should not have been advanced yet.
+func NewExprScanner(ts *TokenScanner) *ExprScanner {
+	return &ExprScanner{
+		ts: ts,
+	}
+}
+
+// Next reads the next top-level expression. Returns io.EOF once the source is
+// exhausted. After any other error, the scan is stopped, and every later call
+// returns the same error.
+func (es *ExprScanner) Next() (Expr, error) {
+	if es.err != nil {
+		return nil, es.err
+	}
+	if !es.started {
+		es.ts.Advance() // initializes the scan
+		es.started = true
+	}
+	if t := es.ts.Token(); t != nil {
+		es.ts.st.src.forgetBefore(t.Pos.Row)
+	}
+	e, err := es.next()
+	if err != nil {
+		es.err = err
+		return nil, err
+	}
+	resolveLexical([]Expr{e})
+	return e, nil
+}
+
+func (es *ExprScanner) next() (Expr, error) {
+	ts := es.ts
+	startToken := ts.Token()
+	if startToken == nil {
+		if ts.Err() != nil && !errors.Is(ts.Err(), io.EOF) {
+			return nil, fmt.Errorf("problem reading source: %w", ts.Err())
+		}
+		return nil, io.EOF
+	}
+	if startToken.Typ == CloseParenTT {
+		ts.st.src.drainLine()
+		return nil, ts.st.src.Quote(NewParseError("unexpected close paren", *startToken))
+	}
+	e, err := maybeParseExpr(ts)
+	if err != nil {
+		// ts.Err is only consulted on failure, as it reads ahead to
+		// the next token; which may not have been written yet.
+		if ts.Err() != nil && !errors.Is(ts.Err(), io.EOF) {
+			return nil, fmt.Errorf("problem reading source: %w", ts.Err())
+		}
+		// read the rest of the line so the error can quote all of it.
+		ts.st.src.drainLine()
+		return nil, ts.st.src.Quote(err)
+	}
+	return e, nil
+}
+
 // maybeParseExprs will read as many expressions as it can, until it hits EOF or
 // a close boundary character.
 func maybeParseExprs(ts *TokenScanner) ([]Expr, error) {
@@ -60,13 +207,16 @@ func maybeParseExpr(ts *TokenScanner) (Expr, error) {
 		return parseIdentValue(nextToken)
 	case OpTT:
 		ts.Advance()
-		return parseOpValue(nextToken)
+		return parseOpValue(ts, nextToken)
 	case NumberTT:
 		ts.Advance()
 		return parseNumberValue(nextToken)
 	case StringTT:
 		ts.Advance()
 		return parseStringValue(nextToken)
+	case KeywordTT:
+		ts.Advance()
+		return parseKeywordValue(nextToken)
 	default:
 		return nil, NewParseError("invalid token", nextToken)
 	}
@@ -92,28 +242,17 @@ func tryParseCall(ts *TokenScanner) (Expr, error) {
 	}
 	nextToken := *maybeNextToken
 	if nextToken.Typ == IdentTT {
-		// note (bs): strongly consider making this a data structure; will make
-		// rejecting usages of reserved words as idents much easier
-		switch nextToken.Value {
-		case "if":
-			return tryParseIfTail(ts)
-		case "fn":
-			return tryParseFnTail(ts)
-		case "let":
-			return tryParseLetTail(ts)
-		case "defun":
-			panic("defun not implemented")
-		case "import":
-			panic("import not implemented")
+		if parse, isForm := ts.specialForms().lookup(nextToken.Value); isForm {
+			return parse(ts)
 		}
 	}
 
-	return tryParseCallTail(ts)
+	return tryParseCallTail(ts, startToken)
 }
 
 // tryParseCallTail will try to trace a function call. This assumes the first
 // paren has already been parsed.
-func tryParseCallTail(ts *TokenScanner) (Expr, error) {
+func tryParseCallTail(ts *TokenScanner, startToken ScannedToken) (Expr, error) {
 	bodyExprs, bodyExprsErr := maybeParseExprs(ts)
 	if bodyExprsErr != nil {
 		return nil, bodyExprsErr
@@ -123,6 +262,8 @@ func tryParseCallTail(ts *TokenScanner) (Expr, error) {
 	}
 	return &CallExpr{
 		Exprs: bodyExprs,
+		Pos:   startToken.Pos,
+		End:   ts.lastEnd,
 	}, nil
 }
 
@@ -133,6 +274,7 @@ func parseStringValue(token ScannedToken) (*StringLiteral, error) {
 		return &StringLiteral{
 			Str: "",
 			Pos: token.Pos,
+			End: token.End,
 		}, nil
 	}
 	leadI, tailI := 0, len(v)
@@ -145,33 +287,46 @@ func parseStringValue(token ScannedToken) (*StringLiteral, error) {
 	return &StringLiteral{
 		Str: v[leadI:tailI],
 		Pos: token.Pos,
+		End: token.End,
 	}, nil
 }
 
-// parseIdentValue converts the ident token to an ident value.
-func parseIdentValue(token ScannedToken) (Expr, error) {
-	// todo (bs): this should search for certain reserved words, and reject them.
-	// e.g. any of the "structural builtins" like if, defun, let, etc.
+// parseKeywordValue converts the keyword token to a keyword value.
+func parseKeywordValue(token ScannedToken) (*KeywordLiteral, error) {
+	return &KeywordLiteral{
+		Name: strings.TrimPrefix(token.Value, ":"),
+		Pos:  token.Pos,
+		End:  token.End,
+	}, nil
+}
 
+// parseIdentValue converts the ident token to an ident value. Reserved words
+// (see ReservedWords) are accepted here, so that they can be reported by the
+// forms that bind them.
+func parseIdentValue(token ScannedToken) (Expr, error) {
 	switch token.Value {
 	case "nil":
 		return &NilLiteral{
 			Pos: token.Pos,
+			End: token.End,
 		}, nil
 	case "true":
 		return &BoolLiteral{
 			Bool: true,
 			Pos:  token.Pos,
+			End:  token.End,
 		}, nil
 	case "false":
 		return &BoolLiteral{
 			Bool: false,
 			Pos:  token.Pos,
+			End:  token.End,
 		}, nil
 	default:
 		return &IdentLiteral{
 			Val: token.Value,
 			Pos: token.Pos,
+			End: token.End,
 		}, nil
 	}
 }
@@ -191,30 +346,15 @@ func parseNumberValue(token ScannedToken) (*NumberLiteral, error) {
 	return &NumberLiteral{
 		Num: f,
 		Pos: token.Pos,
+		End: token.End,
 	}, nil
 }
 
 // parseOpValue converts the operator token to a function value. If the operator
-// isn't supported, an error is returned.
-func parseOpValue(token ScannedToken) (*FuncLiteral, error) {
-	// note (bs): this should probably exist as a discrete value
-	opMap := map[string]func(*EvalContext, ...Value) (Value, error){
-		"+":  addFn,
-		"-":  subFn,
-		"*":  multFn,
-		"/":  divFn,
-		"==": eqNumFn,
-		"<":  ltNumFn,
-		">":  gtNumFn,
-		"<=": lteNumFn,
-		">=": gteNumFn,
-	}
-	if fn, ok := opMap[token.Value]; ok {
-		return &FuncLiteral{
-			Name: token.Value,
-			Fn:   fn,
-			Pos:  token.Pos,
-		}, nil
+// isn't registered, returns an error.
+func parseOpValue(ts *TokenScanner, token ScannedToken) (*FuncLiteral, error) {
+	if fl, ok := ts.operators().literal(token.Value, token.Pos, token.End); ok {
+		return fl, nil
 	}
 	return nil, NewParseError("unrecognized operator", token)
 }
@@ -260,6 +400,7 @@ func tryParseIfTail(ts *TokenScanner) (Expr, error) {
 		Case1: wrapNilExpr(case1),
 		Case2: wrapNilExpr(case2),
 		Pos:   startToken.Pos,
+		End:   ts.lastEnd,
 	}, nil
 }
 
@@ -276,7 +417,127 @@ func tryParseFnTail(ts *TokenScanner) (Expr, error) {
 	}
 	ts.Advance()
 
-	args, argsErr := tryParseFnArgs(ts)
+	name := ""
+	if maybeName := ts.Token(); maybeName != nil && maybeName.Typ == IdentTT {
+		if err := checkBindable(ts, *maybeName, "fn"); err != nil {
+			return nil, err
+		}
+		name = maybeName.Value
+		ts.Advance()
+	}
+	return tryParseFnBody(ts, name, startToken)
+}
+
+// tryParseDefunTail will complete the parse of a defun statement where the open
+// paren has already been scanned. `(defun f (args) body)` is parsed as
+// `(let f (fn f (args) body))`, so the function can call itself.
+func tryParseDefunTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in defun statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "defun" {
+		return nil, NewParseError("tryParseDefunTail called on non-defun", startToken)
+	}
+	ts.Advance()
+
+	maybeName := ts.Token()
+	if maybeName == nil {
+		return nil, NewParseEOFError("parse ended in defun statement", ts.Pos())
+	}
+	nameToken := *maybeName
+	if nameToken.Typ != IdentTT {
+		return nil, NewParseError("defun expects a function name", nameToken)
+	}
+	if err := checkBindable(ts, nameToken, "defun"); err != nil {
+		return nil, err
+	}
+	ts.Advance()
+
+	fnExpr, fnErr := tryParseFnBody(ts, nameToken.Value, startToken)
+	if fnErr != nil {
+		return nil, fnErr
+	}
+	return &LetExpr{
+		Ident: &IdentLiteral{
+			Val: nameToken.Value,
+			Pos: nameToken.Pos,
+			End: nameToken.End,
+		},
+		Value: fnExpr,
+		Pos:   startToken.Pos,
+		End:   ts.lastEnd,
+	}, nil
+}
+
+// tryParseDefStructTail will complete the parse of a defstruct statement where
+// the open paren has already been scanned.
+func tryParseDefStructTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in defstruct statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "defstruct" {
+		return nil, NewParseError(
+			"tryParseDefStructTail called on non-defstruct", startToken)
+	}
+	ts.Advance()
+
+	structExprs, structExprsErr := maybeParseExprs(ts)
+	if structExprsErr != nil {
+		return nil, structExprsErr
+	}
+	if len(structExprs) == 0 {
+		return nil, NewParseError("defstruct expects a struct name", startToken)
+	}
+	idents := make([]*IdentLiteral, 0, len(structExprs))
+	seen := map[string]bool{}
+	for i, e := range structExprs {
+		asIdent, isIdent := e.(*IdentLiteral)
+		if !isIdent {
+			return nil, NewParseError(
+				"defstruct expects only idents for the name and fields", startToken)
+		}
+		if err := checkBindable(ts, tokenOfIdent(asIdent), "defstruct"); err != nil {
+			return nil, err
+		}
+		if i > 0 && seen[asIdent.Val] {
+			return nil, NewParseError(
+				fmt.Sprintf("defstruct has duplicate field '%s'", asIdent.Val),
+				startToken)
+		}
+		seen[asIdent.Val] = true
+		idents = append(idents, asIdent)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &DefStructExpr{
+		Name:   idents[0],
+		Fields: idents[1:],
+		Pos:    startToken.Pos,
+		End:    ts.lastEnd,
+	}, nil
+}
+
+// tryParseFnBody parses the arguments and body of a function, and the close
+// paren that ends it. The arguments may be preceded by a `:pure` annotation.
+func tryParseFnBody(
+	ts *TokenScanner, name string, startToken ScannedToken,
+) (*FnExpr, error) {
+	pure := false
+	if maybeAnnotation := ts.Token(); maybeAnnotation != nil &&
+		maybeAnnotation.Typ == KeywordTT {
+		if maybeAnnotation.Value != ":pure" {
+			return nil, NewParseError("unknown function annotation", *maybeAnnotation)
+		}
+		pure = true
+		ts.Advance()
+	}
+	args, rest, argsErr := tryParseFnArgs(ts)
 	if argsErr != nil {
 		return nil, argsErr
 	}
@@ -289,53 +550,128 @@ func tryParseFnTail(ts *TokenScanner) (Expr, error) {
 	}
 
 	return &FnExpr{
+		Name: name,
+		Pure: pure,
 		Args: args,
+		Rest: rest,
 		Body: bodyExprs,
 		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
 	}, nil
 }
 
 // tryParseFnArgs will attempt to parse a set of function arguments from the
-// scanner. If a valid set of arguments are not found, an error is returned.
-func tryParseFnArgs(ts *TokenScanner) ([]Arg, error) {
+// scanner. If a valid set of arguments are not found, an error is returned. If
+// the arguments end with a rest argument (`. ident`), it is returned
+// separately; otherwise it will be nil. Keyword arguments (`:key ident`) must
+// follow all positional ones, and can't be combined with a rest argument.
+func tryParseFnArgs(ts *TokenScanner) ([]Arg, *Arg, error) {
 	if err := expectCallOpen(ts); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	args := []Arg{}
+	hasKeywords := false
 	for {
 		maybeNextToken := ts.Token()
 		if maybeNextToken == nil {
 			// todo (bs): add proper parse error info here
-			return nil, NewParseEOFError("file ended in function args", ts.Pos())
+			return nil, nil, NewParseEOFError("file ended in function args", ts.Pos())
 		}
 		nextToken := *maybeNextToken
 		ts.Advance()
 		switch nextToken.Typ {
 		case IdentTT:
+			if hasKeywords {
+				return nil, nil, NewParseError(
+					"positional args must come before keyword args", nextToken)
+			}
+			if err := checkBindable(ts, nextToken, "fn"); err != nil {
+				return nil, nil, err
+			}
 			args = append(args, Arg{
 				Ident: nextToken.Value,
 			})
+		case KeywordTT:
+			maybeIdentToken := ts.Token()
+			if maybeIdentToken == nil {
+				return nil, nil, NewParseEOFError("file ended in function args", ts.Pos())
+			}
+			identToken := *maybeIdentToken
+			if identToken.Typ != IdentTT {
+				return nil, nil, NewParseError(
+					"keyword arg must be followed by an ident", identToken)
+			}
+			if err := checkBindable(ts, identToken, "fn"); err != nil {
+				return nil, nil, err
+			}
+			ts.Advance()
+			hasKeywords = true
+			args = append(args, Arg{
+				Ident:   identToken.Value,
+				Keyword: strings.TrimPrefix(nextToken.Value, ":"),
+			})
+		case DotTT:
+			if hasKeywords {
+				return nil, nil, NewParseError(
+					"keyword args can't be combined with a rest arg", nextToken)
+			}
+			rest, restErr := tryParseRestArg(ts)
+			if restErr != nil {
+				return nil, nil, restErr
+			}
+			return args, rest, nil
 		case CloseParenTT:
-			return args, nil
+			return args, nil, nil
 		default:
-			return nil, NewParseError("args can only contain idents", nextToken)
+			return nil, nil, NewParseError("args can only contain idents", nextToken)
 		}
 	}
 }
 
+// tryParseRestArg parses the rest argument of a function argument list, and
+// the close paren that must follow it. Assumes the dot has already been read.
+func tryParseRestArg(ts *TokenScanner) (*Arg, error) {
+	maybeNextToken := ts.Token()
+	if maybeNextToken == nil {
+		return nil, NewParseEOFError("file ended in function args", ts.Pos())
+	}
+	nextToken := *maybeNextToken
+	if nextToken.Typ != IdentTT {
+		return nil, NewParseError("rest argument must be an ident", nextToken)
+	}
+	if err := checkBindable(ts, nextToken, "fn"); err != nil {
+		return nil, err
+	}
+	ts.Advance()
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+	return &Arg{
+		Ident: nextToken.Value,
+	}, nil
+}
+
 // tryParseLetTail will complete the parse of a let statement where the open
-// paren has already been scanned.
+// paren has already been scanned. A let whose first argument is a list of
+// bindings, or any let*, is parsed as a block let.
 func tryParseLetTail(ts *TokenScanner) (Expr, error) {
 	maybeStartToken := ts.Token()
 	if maybeStartToken == nil {
 		return nil, NewParseEOFError("parse ended in let statement", ts.Pos())
 	}
 	startToken := *maybeStartToken
-	if startToken.Typ != IdentTT || startToken.Value != "let" {
+	if startToken.Typ != IdentTT ||
+		(startToken.Value != "let" && startToken.Value != "let*") {
 		return nil, NewParseError("tryParseLetTail called on non-let", startToken)
 	}
 	ts.Advance()
 
+	maybeNextToken := ts.Token()
+	isBlock := maybeNextToken != nil && maybeNextToken.Typ == OpenParenTT
+	if isBlock || startToken.Value == "let*" {
+		return tryParseBlockLetTail(ts, startToken)
+	}
+
 	letExprs, letExprsErr := maybeParseExprs(ts)
 	if letExprsErr != nil {
 		return nil, letExprsErr
@@ -350,6 +686,9 @@ func tryParseLetTail(ts *TokenScanner) (Expr, error) {
 		return nil, NewParseError(
 			"let expects an ident as first argument", startToken)
 	}
+	if err := checkBindable(ts, tokenOfIdent(asIdent), "let"); err != nil {
+		return nil, err
+	}
 	val := letExprs[1]
 	if err := expectCallClose(ts); err != nil {
 		return nil, err
@@ -359,6 +698,745 @@ func tryParseLetTail(ts *TokenScanner) (Expr, error) {
 		Ident: asIdent,
 		Value: val,
 		Pos:   startToken.Pos,
+		End:   ts.lastEnd,
+	}, nil
+}
+
+// tryParseBlockLetTail will complete the parse of a block let, where the let
+// itself has already been scanned.
+func tryParseBlockLetTail(ts *TokenScanner, startToken ScannedToken) (Expr, error) {
+	if err := expectCallOpen(ts); err != nil {
+		return nil, err
+	}
+	bindings := []LetBinding{}
+	for {
+		maybeNextToken := ts.Token()
+		if maybeNextToken == nil {
+			return nil, NewParseEOFError("file ended in let bindings", ts.Pos())
+		}
+		if maybeNextToken.Typ == CloseParenTT {
+			ts.Advance()
+			break
+		}
+		binding, bindingErr := tryParseBinding(ts, "let")
+		if bindingErr != nil {
+			return nil, bindingErr
+		}
+		bindings = append(bindings, binding)
+	}
+
+	bodyExprs, bodyExprsErr := maybeParseExprs(ts)
+	if bodyExprsErr != nil {
+		return nil, bodyExprsErr
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &BlockLetExpr{
+		Bindings:   bindings,
+		Body:       bodyExprs,
+		Sequential: startToken.Value == "let*",
+		Pos:        startToken.Pos,
+		End:        ts.lastEnd,
+	}, nil
+}
+
+// tryParseBinding parses a single `(ident value)` binding, as used by block let
+// and the loop forms. The form name is used in errors.
+func tryParseBinding(ts *TokenScanner, form string) (LetBinding, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return LetBinding{}, NewParseEOFError(
+			fmt.Sprintf("file ended in %s binding", form), ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if err := expectCallOpen(ts); err != nil {
+		return LetBinding{}, err
+	}
+	bindingExprs, bindingExprsErr := maybeParseExprs(ts)
+	if bindingExprsErr != nil {
+		return LetBinding{}, bindingExprsErr
+	}
+	if len(bindingExprs) != 2 {
+		return LetBinding{}, NewParseError(
+			fmt.Sprintf("%s binding expects 2 elements, got %d",
+				form, len(bindingExprs)), startToken)
+	}
+	asIdent, isIdent := bindingExprs[0].(*IdentLiteral)
+	if !isIdent {
+		return LetBinding{}, NewParseError(
+			fmt.Sprintf("%s binding expects an ident as first element", form),
+			startToken)
+	}
+	if err := checkBindable(ts, tokenOfIdent(asIdent), form); err != nil {
+		return LetBinding{}, err
+	}
+	if err := expectCallClose(ts); err != nil {
+		return LetBinding{}, err
+	}
+	return LetBinding{
+		Ident: asIdent,
+		Value: bindingExprs[1],
+	}, nil
+}
+
+// tryParseLetValuesTail will complete the parse of a letValues statement; e.g.
+// `(letValues ((q r) (divmod 7 2)) q)`.
+func tryParseLetValuesTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in letValues statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "letValues" {
+		return nil, NewParseError("tryParseLetValuesTail called on non-letValues", startToken)
+	}
+	ts.Advance()
+
+	if err := expectCallOpen(ts); err != nil {
+		return nil, err
+	}
+	if err := expectCallOpen(ts); err != nil {
+		return nil, err
+	}
+	idents := []*IdentLiteral{}
+	seen := map[string]bool{}
+	for {
+		maybeNextToken := ts.Token()
+		if maybeNextToken == nil {
+			return nil, NewParseEOFError("file ended in letValues idents", ts.Pos())
+		}
+		nextToken := *maybeNextToken
+		if nextToken.Typ == CloseParenTT {
+			ts.Advance()
+			break
+		}
+		if nextToken.Typ != IdentTT {
+			return nil, NewParseError("letValues expects only idents to bind", nextToken)
+		}
+		if err := checkBindable(ts, nextToken, "letValues"); err != nil {
+			return nil, err
+		}
+		if seen[nextToken.Value] {
+			return nil, NewParseError(
+				fmt.Sprintf("letValues binds '%s' more than once", nextToken.Value),
+				nextToken)
+		}
+		seen[nextToken.Value] = true
+		idents = append(idents, &IdentLiteral{
+			Val: nextToken.Value,
+			Pos: nextToken.Pos,
+			End: nextToken.End,
+		})
+		ts.Advance()
+	}
+	if len(idents) == 0 {
+		return nil, NewParseError("letValues expects at least one ident", startToken)
+	}
+	valueExprs, valueExprsErr := maybeParseExprs(ts)
+	if valueExprsErr != nil {
+		return nil, valueExprsErr
+	}
+	if len(valueExprs) != 1 {
+		return nil, NewParseError(
+			fmt.Sprintf("letValues binding expects 1 value, got %d", len(valueExprs)),
+			startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	bodyExprs, bodyExprsErr := maybeParseExprs(ts)
+	if bodyExprsErr != nil {
+		return nil, bodyExprsErr
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &LetValuesExpr{
+		Idents: idents,
+		Value:  valueExprs[0],
+		Body:   bodyExprs,
+		Pos:    startToken.Pos,
+		End:    ts.lastEnd,
+	}, nil
+}
+
+// tryParseCondTail will complete the parse of a cond statement where the open
+// paren has already been scanned.
+func tryParseCondTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in cond statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "cond" {
+		return nil, NewParseError("tryParseCondTail called on non-cond", startToken)
+	}
+	ts.Advance()
+
+	clauses := []CondClause{}
+	for {
+		maybeNextToken := ts.Token()
+		if maybeNextToken == nil {
+			return nil, NewParseEOFError("file ended in cond clauses", ts.Pos())
+		}
+		nextToken := *maybeNextToken
+		if nextToken.Typ == CloseParenTT {
+			ts.Advance()
+			break
+		}
+		if len(clauses) > 0 && clauses[len(clauses)-1].Test == nil {
+			return nil, NewParseError("else must be the last cond clause", nextToken)
+		}
+		if err := expectCallOpen(ts); err != nil {
+			return nil, err
+		}
+		clauseExprs, clauseExprsErr := maybeParseExprs(ts)
+		if clauseExprsErr != nil {
+			return nil, clauseExprsErr
+		}
+		if len(clauseExprs) == 0 {
+			return nil, NewParseError("cond clause must have a test", nextToken)
+		}
+		if err := expectCallClose(ts); err != nil {
+			return nil, err
+		}
+		clause := CondClause{
+			Test: clauseExprs[0],
+			Body: clauseExprs[1:],
+		}
+		if asIdent, isIdent := clause.Test.(*IdentLiteral); isIdent &&
+			asIdent.Val == "else" {
+			clause.Test = nil
+		}
+		clauses = append(clauses, clause)
+	}
+
+	return &CondExpr{
+		Clauses: clauses,
+		Pos:     startToken.Pos,
+		End:     ts.lastEnd,
+	}, nil
+}
+
+// tryParseWhenTail will complete the parse of a when or unless statement where
+// the open paren has already been scanned.
+func tryParseWhenTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in when statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT ||
+		(startToken.Value != "when" && startToken.Value != "unless") {
+		return nil, NewParseError("tryParseWhenTail called on non-when", startToken)
+	}
+	ts.Advance()
+
+	whenExprs, whenExprsErr := maybeParseExprs(ts)
+	if whenExprsErr != nil {
+		return nil, whenExprsErr
+	}
+	if len(whenExprs) == 0 {
+		return nil, NewParseError(
+			fmt.Sprintf("%s statement must have condition", startToken.Value),
+			startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &WhenExpr{
+		Cond:   whenExprs[0],
+		Body:   whenExprs[1:],
+		Negate: startToken.Value == "unless",
+		Pos:    startToken.Pos,
+		End:    ts.lastEnd,
+	}, nil
+}
+
+// tryParseWhileTail will complete the parse of a while loop where the open
+// paren has already been scanned.
+func tryParseWhileTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in while statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "while" {
+		return nil, NewParseError("tryParseWhileTail called on non-while", startToken)
+	}
+	ts.Advance()
+
+	whileExprs, whileExprsErr := maybeParseExprs(ts)
+	if whileExprsErr != nil {
+		return nil, whileExprsErr
+	}
+	if len(whileExprs) == 0 {
+		return nil, NewParseError("while statement must have condition", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &WhileExpr{
+		Cond: whileExprs[0],
+		Body: whileExprs[1:],
+		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
+	}, nil
+}
+
+// tryParseTimeTail will complete the parse of a time statement where the open
+// paren has already been scanned.
+func tryParseTimeTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in time statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "time" {
+		return nil, NewParseError("tryParseTimeTail called on non-time", startToken)
+	}
+	ts.Advance()
+
+	timeExprs, timeExprsErr := maybeParseExprs(ts)
+	if timeExprsErr != nil {
+		return nil, timeExprsErr
+	}
+	if len(timeExprs) != 1 {
+		return nil, NewParseError("time statement expects one expression", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &TimeExpr{
+		Expr: timeExprs[0],
+		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
+	}, nil
+}
+
+// tryParseDefTestTail will complete the parse of a deftest statement where the
+// open paren has already been scanned. The name may be a string or an ident.
+func tryParseDefTestTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in deftest statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "deftest" {
+		return nil, NewParseError("tryParseDefTestTail called on non-deftest", startToken)
+	}
+	ts.Advance()
+
+	testExprs, testExprsErr := maybeParseExprs(ts)
+	if testExprsErr != nil {
+		return nil, testExprsErr
+	}
+	if len(testExprs) == 0 {
+		return nil, NewParseError("deftest expects a test name", startToken)
+	}
+	var name string
+	switch tE := testExprs[0].(type) {
+	case *StringLiteral:
+		name = tE.Str
+	case *IdentLiteral:
+		name = tE.Val
+	default:
+		return nil, NewParseError(
+			"deftest expects a string or ident as the test name", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &DefTestExpr{
+		Name: name,
+		Body: testExprs[1:],
+		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
+	}, nil
+}
+
+// tryParseAssertErrorTail will complete the parse of an assertError statement
+// where the open paren has already been scanned.
+func tryParseAssertErrorTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in assertError statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "assertError" {
+		return nil, NewParseError(
+			"tryParseAssertErrorTail called on non-assertError", startToken)
+	}
+	ts.Advance()
+
+	assertExprs, assertExprsErr := maybeParseExprs(ts)
+	if assertExprsErr != nil {
+		return nil, assertExprsErr
+	}
+	if len(assertExprs) != 1 {
+		return nil, NewParseError("assertError expects one expression", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &AssertErrorExpr{
+		Expr: assertExprs[0],
+		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
+	}, nil
+}
+
+// tryParseGoTail will complete the parse of a go expression; e.g.
+// `(go (httpGet url))`.
+func tryParseGoTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in go statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "go" {
+		return nil, NewParseError("tryParseGoTail called on non-go", startToken)
+	}
+	ts.Advance()
+
+	goExprs, goExprsErr := maybeParseExprs(ts)
+	if goExprsErr != nil {
+		return nil, goExprsErr
+	}
+	if len(goExprs) != 1 {
+		return nil, NewParseError("go expects one expression", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &GoExpr{
+		Expr: goExprs[0],
+		Pos:  startToken.Pos,
+		End:  ts.lastEnd,
+	}, nil
+}
+
+// tryParseDefGenericTail will complete the parse of a defgeneric statement;
+// e.g. `(defgeneric show (x))`.
+func tryParseDefGenericTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in defgeneric statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "defgeneric" {
+		return nil, NewParseError("tryParseDefGenericTail called on non-defgeneric", startToken)
+	}
+	ts.Advance()
+
+	name, nameErr := parseDefName(ts, "defgeneric")
+	if nameErr != nil {
+		return nil, nameErr
+	}
+	args, rest, argsErr := tryParseFnArgs(ts)
+	if argsErr != nil {
+		return nil, argsErr
+	}
+	if len(args) == 0 {
+		return nil, NewParseError("defgeneric expects at least one parameter", startToken)
+	}
+	params := make([]*IdentLiteral, 0, len(args))
+	for _, a := range args {
+		if a.Keyword != "" || rest != nil {
+			return nil, NewParseError(
+				"defgeneric only accepts positional parameters", startToken)
+		}
+		params = append(params, &IdentLiteral{Val: a.Ident})
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &DefGenericExpr{
+		Name:   name,
+		Params: params,
+		Pos:    startToken.Pos,
+		End:    ts.lastEnd,
+	}, nil
+}
+
+// tryParseDefMethodTail will complete the parse of a defmethod statement; e.g.
+// `(defmethod show (x :list) body)`. The first parameter is followed by the
+// type the method is for; any others are positional.
+func tryParseDefMethodTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in defmethod statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "defmethod" {
+		return nil, NewParseError("tryParseDefMethodTail called on non-defmethod", startToken)
+	}
+	ts.Advance()
+
+	name, nameErr := parseDefName(ts, "defmethod")
+	if nameErr != nil {
+		return nil, nameErr
+	}
+	if err := expectCallOpen(ts); err != nil {
+		return nil, err
+	}
+	args := []Arg{}
+	typeName := ""
+	for {
+		maybeNextToken := ts.Token()
+		if maybeNextToken == nil {
+			return nil, NewParseEOFError("file ended in method args", ts.Pos())
+		}
+		nextToken := *maybeNextToken
+		ts.Advance()
+		if nextToken.Typ == CloseParenTT {
+			break
+		}
+		switch {
+		case nextToken.Typ == IdentTT:
+			if len(args) == 1 && typeName == "" {
+				return nil, NewParseError(
+					"defmethod expects a type after the first parameter", nextToken)
+			}
+			args = append(args, Arg{Ident: nextToken.Value})
+		case nextToken.Typ == KeywordTT && len(args) == 1 && typeName == "":
+			typeName = strings.TrimPrefix(nextToken.Value, ":")
+		default:
+			return nil, NewParseError(
+				"defmethod expects its parameters, with a type after the first", nextToken)
+		}
+	}
+	if typeName == "" {
+		return nil, NewParseError(
+			"defmethod expects a type after the first parameter", startToken)
+	}
+	bodyExprs, bodyExprsErr := maybeParseExprs(ts)
+	if bodyExprsErr != nil {
+		return nil, bodyExprsErr
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &DefMethodExpr{
+		Name: name,
+		Type: typeName,
+		Fn: &FnExpr{
+			Args: args,
+			Body: bodyExprs,
+			Pos:  startToken.Pos,
+			End:  ts.lastEnd,
+		},
+		Pos: startToken.Pos,
+		End: ts.lastEnd,
+	}, nil
+}
+
+// parseDefName reads the name a def statement defines.
+func parseDefName(ts *TokenScanner, form string) (*IdentLiteral, error) {
+	maybeName := ts.Token()
+	if maybeName == nil {
+		return nil, NewParseEOFError(
+			fmt.Sprintf("parse ended in %s statement", form), ts.Pos())
+	}
+	nameToken := *maybeName
+	if nameToken.Typ != IdentTT {
+		return nil, NewParseError(fmt.Sprintf("%s expects a name", form), nameToken)
+	}
+	if err := checkBindable(ts, nameToken, form); err != nil {
+		return nil, err
+	}
+	ts.Advance()
+	return &IdentLiteral{
+		Val: nameToken.Value,
+		Pos: nameToken.Pos,
+		End: nameToken.End,
+	}, nil
+}
+
+// tryParseMethodCallTail will complete the parse of a method call; e.g.
+// `(: counter add 2)`.
+func tryParseMethodCallTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in method call", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != ":" {
+		return nil, NewParseError("tryParseMethodCallTail called on non-method call", startToken)
+	}
+	ts.Advance()
+
+	callExprs, callExprsErr := maybeParseExprs(ts)
+	if callExprsErr != nil {
+		return nil, callExprsErr
+	}
+	if len(callExprs) < 2 {
+		return nil, NewParseError("method call expects an object and a method name", startToken)
+	}
+	method, isIdent := callExprs[1].(*IdentLiteral)
+	if !isIdent {
+		return nil, NewParseError("method call expects a method name", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &MethodCallExpr{
+		Object: callExprs[0],
+		Method: method,
+		Args:   callExprs[2:],
+		Pos:    startToken.Pos,
+		End:    ts.lastEnd,
+	}, nil
+}
+
+// tryParseReturnTail will complete the parse of a return expression; e.g.
+// `(return x)`, or `(return)`.
+func tryParseReturnTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in return statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "return" {
+		return nil, NewParseError("tryParseReturnTail called on non-return", startToken)
+	}
+	ts.Advance()
+
+	retExprs, retExprsErr := maybeParseExprs(ts)
+	if retExprsErr != nil {
+		return nil, retExprsErr
+	}
+	if len(retExprs) > 1 {
+		return nil, NewParseError("return expects at most one expression", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	re := &ReturnExpr{
+		Pos: startToken.Pos,
+		End: ts.lastEnd,
+	}
+	if len(retExprs) == 1 {
+		re.Expr = retExprs[0]
+	}
+	return re, nil
+}
+
+// tryParseBreakTail will complete the parse of a break or continue expression;
+// e.g. `(break)`.
+func tryParseBreakTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in break statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT ||
+		(startToken.Value != "break" && startToken.Value != "continue") {
+		return nil, NewParseError("tryParseBreakTail called on non-break", startToken)
+	}
+	ts.Advance()
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+	return &BreakExpr{
+		Continue: startToken.Value == "continue",
+		Pos:      startToken.Pos,
+		End:      ts.lastEnd,
+	}, nil
+}
+
+// tryParseForTail will complete the parse of a for or dotimes loop where the
+// open paren has already been scanned.
+func tryParseForTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in loop statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT ||
+		(startToken.Value != "for" && startToken.Value != "dotimes") {
+		return nil, NewParseError("tryParseForTail called on non-loop", startToken)
+	}
+	ts.Advance()
+
+	binding, bindingErr := tryParseBinding(ts, startToken.Value)
+	if bindingErr != nil {
+		return nil, bindingErr
+	}
+	bodyExprs, bodyExprsErr := maybeParseExprs(ts)
+	if bodyExprsErr != nil {
+		return nil, bodyExprsErr
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	if startToken.Value == "dotimes" {
+		return &DoTimesExpr{
+			Binding: binding,
+			Body:    bodyExprs,
+			Pos:     startToken.Pos,
+			End:     ts.lastEnd,
+		}, nil
+	}
+	return &ForExpr{
+		Binding: binding,
+		Body:    bodyExprs,
+		Pos:     startToken.Pos,
+		End:     ts.lastEnd,
+	}, nil
+}
+
+// tryParseSetTail will complete the parse of a set! statement where the open
+// paren has already been scanned.
+func tryParseSetTail(ts *TokenScanner) (Expr, error) {
+	maybeStartToken := ts.Token()
+	if maybeStartToken == nil {
+		return nil, NewParseEOFError("parse ended in set! statement", ts.Pos())
+	}
+	startToken := *maybeStartToken
+	if startToken.Typ != IdentTT || startToken.Value != "set!" {
+		return nil, NewParseError("tryParseSetTail called on non-set!", startToken)
+	}
+	ts.Advance()
+
+	setExprs, setExprsErr := maybeParseExprs(ts)
+	if setExprsErr != nil {
+		return nil, setExprsErr
+	}
+	if len(setExprs) != 2 {
+		return nil, NewParseError(
+			fmt.Sprintf("set! expects 2 arguments, got %d",
+				len(setExprs)), startToken)
+	}
+	asIdent, isIdent := setExprs[0].(*IdentLiteral)
+	if !isIdent {
+		return nil, NewParseError(
+			"set! expects an ident as first argument", startToken)
+	}
+	if err := expectCallClose(ts); err != nil {
+		return nil, err
+	}
+
+	return &SetExpr{
+		Ident: asIdent,
+		Value: setExprs[1],
+		Pos:   startToken.Pos,
+		End:   ts.lastEnd,
 	}, nil
 }
 
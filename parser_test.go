@@ -1,6 +1,8 @@
 package golisp2
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -10,18 +12,197 @@ func Test_ParseTokens(t *testing.T) {
 
 	t.Run("basic", func(t *testing.T) {
 		assertNumValue(t, evalStrToVal(t, "; hello there\n(+ 1 2)"), 3)
+		assertNumValue(t, evalStrToVal(t, "(+ 1 2) ; trailing comment"), 3)
 	})
 
 	t.Run("fn", func(t *testing.T) {
 		assertNumValue(t, evalStrToVal(t, `((fn (x) (+ x x)) 5)`), 10)
 	})
 
+	t.Run("fnRest", func(t *testing.T) {
+		assertListValue(t,
+			evalStrToVal(t, `((fn (a . rest) rest) 1 2 3)`),
+			[]Value{&NumberValue{Val: 2}, &NumberValue{Val: 3}})
+		assertListValue(t,
+			evalStrToVal(t, `((fn (a . rest) rest) 1)`),
+			[]Value{})
+		assertNumValue(t,
+			evalStrToVal(t, `((fn (. rest) (len rest)) 1 2 3 4)`), 4)
+		err := evalStrToErr(t, `((fn (a b . rest) rest) 1)`)
+		require.Contains(t, err.Error(), "at least 2")
+	})
+
 	t.Run("if", func(t *testing.T) {
 		assertNumValue(t, evalStrToVal(t, `(if (== 1 2) (+ 5 5) (+ 10 10))`), 20)
 		assertNilValue(t, evalStrToVal(t, `(if (== 1 2) (+ 5 5))`))
 		assertNilValue(t, evalStrToVal(t, `(if (== 1 1))`))
 	})
 
+	t.Run("cond", func(t *testing.T) {
+		classify := `
+		(let classify (fn (n)
+		  (cond
+		    ((< n 0) "negative")
+		    ((== n 0) "ignored" "zero")
+		    (else "positive"))))`
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, classify)
+		assertStringValue(t, evalStrInContext(t, ec, `(classify -5)`), "negative")
+		assertStringValue(t, evalStrInContext(t, ec, `(classify 0)`), "zero")
+		assertStringValue(t, evalStrInContext(t, ec, `(classify 5)`), "positive")
+
+		assertNilValue(t, evalStrToVal(t, `(cond ((== 1 2) 1))`))
+		assertNilValue(t, evalStrToVal(t, `(cond)`))
+		evalStrToErr(t, `(cond (1 2))`)
+	})
+
+	t.Run("when", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(when (== 1 1) 1 2)`), 2)
+		assertNilValue(t, evalStrToVal(t, `(when (== 1 2) 1 2)`))
+		assertNilValue(t, evalStrToVal(t, `(unless (== 1 1) 1 2)`))
+		assertNumValue(t, evalStrToVal(t, `(unless (== 1 2) 1)`), 1)
+		evalStrToErr(t, `(when "abc" 1)`)
+	})
+
+	t.Run("while", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		assertNumValue(t, evalStrInContext(t, ec, `
+		(let i 0)
+		(let total 0)
+		(while (< i 5)
+		  (let next (+ i 1))
+		  (set! total (+ total i))
+		  (set! i next))
+		total`), 10)
+		_, isDefined := ec.Resolve("next")
+		require.False(t, isDefined)
+		evalStrToErr(t, `(while 1)`)
+
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		haltedEc := BuiltinContext().SubContext(nil)
+		haltedEc.SetContext(cancelled)
+		err := evalStrInContextToErr(t, haltedEc, `(while true)`)
+		require.Contains(t, err.Error(), "evaluation halted")
+	})
+
+	t.Run("for", func(t *testing.T) {
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let total 0)
+		(for (x (list 1 2 3))
+		  (set! total (+ total x)))
+		total`), 6)
+		assertStringValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let keys "")
+		(for (k (map "b" 1 "a" 2))
+		  (set! keys (concat keys k)))
+		keys`), "ab")
+		evalStrToErr(t, `(for (x 5) x)`)
+		parseStrToErr(t, `(for x (list 1))`)
+	})
+
+	t.Run("dotimes", func(t *testing.T) {
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let total 0)
+		(dotimes (i 4)
+		  (set! total (+ total i)))
+		total`), 6)
+		evalStrToErr(t, `(dotimes (i "a"))`)
+	})
+
+	t.Run("breakContinue", func(t *testing.T) {
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let total 0)
+		(for (x (list 1 2 3 4 5))
+		  (if (== x 2) (continue))
+		  (when (== x 4) (break))
+		  (set! total (+ total x)))
+		total`), 4)
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let i 0)
+		(while true
+		  (set! i (+ i 1))
+		  (when (> i 2) (break)))
+		i`), 3)
+		assertNumValue(t, evalStrInContext(t, BuiltinContext().SubContext(nil), `
+		(let total 0)
+		(dotimes (i 3)
+		  (dotimes (j 3)
+		    (when (> j i) (break))
+		    (set! total (+ total 1))))
+		total`), 6)
+
+		err := evalStrToErr(t, `(break)`)
+		require.Contains(t, err.Error(), "break used outside of a loop")
+		err = evalStrToErr(t, `(dotimes (i 2) ((fn () (continue))))`)
+		require.Contains(t, err.Error(), "continue used outside of a loop")
+		err = evalStrToErr(t, `(dotimes (i 2) (recv (go (break))))`)
+		require.Contains(t, err.Error(), "break used outside of a loop")
+		parseStrToErr(t, `(break 1)`)
+	})
+
+	t.Run("letValues", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		(defun minMax (xs)
+		  (values (listReduce (listGet xs 0) xs (fn (a b) (if (< a b) a b)))
+		          (listReduce (listGet xs 0) xs (fn (a b) (if (> a b) a b)))))`)
+		assertListValue(t, evalStrInContext(t, ec, `
+		(letValues ((lo hi) (minMax (list 3 1 4 1 5)))
+		  (list lo hi))`), []Value{&NumberValue{Val: 1}, &NumberValue{Val: 5}})
+		assertNumValue(t, evalStrInContext(t, ec, `(letValues ((x) 4) x)`), 4)
+		_, isDefined := ec.Resolve("lo")
+		require.False(t, isDefined)
+
+		err := evalStrToErr(t, `(letValues ((a b c) (values 1 2)) a)`)
+		require.Contains(t, err.Error(), "letValues expects 3 values; got 2")
+		parseStrToErr(t, `(letValues (a (values 1)) a)`)
+		parseStrToErr(t, `(letValues (() (values)) 1)`)
+		parseStrToErr(t, `(letValues ((a a) (values 1 2)) a)`)
+		parseStrToErr(t, `(letValues ((a 1) (values 1 2)) a)`)
+	})
+
+	t.Run("defun", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		(defun fact (n)
+		  (if (<= n 1) 1 (* n (fact (- n 1)))))
+		(defun isEven (n) (if (== n 0) true (isOdd (- n 1))))
+		(defun isOdd (n) (if (== n 0) false (isEven (- n 1))))`)
+		assertNumValue(t, evalStrInContext(t, ec, `(fact 5)`), 120)
+		assertBoolValue(t, evalStrInContext(t, ec, `(isEven 10)`), true)
+		require.Equal(t, "fact", assertAsFunc(t, evalStrInContext(t, ec, `fact`)).Name)
+		parseStrToErr(t, `(defun (n) n)`)
+		parseStrToErr(t, `(defun f n)`)
+	})
+
+	t.Run("namedFn", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `
+		((fn sum (n) (if (== n 0) 0 (+ n (sum (- n 1))))) 4)`), 10)
+		evalStrToErr(t, `((fn (n) (if (== n 0) 0 (+ n (sum (- n 1))))) 4)`)
+	})
+
+	t.Run("defstruct", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		(defstruct point x y)
+		(defstruct size x y)
+		(let p (point 1 2))`)
+		assertNumValue(t, evalStrInContext(t, ec, `(point-x p)`), 1)
+		assertNumValue(t, evalStrInContext(t, ec, `(point-y p)`), 2)
+		assertBoolValue(t, evalStrInContext(t, ec, `(point? p)`), true)
+		assertBoolValue(t, evalStrInContext(t, ec, `(size? p)`), false)
+		assertBoolValue(t, evalStrInContext(t, ec, `(point? (map "x" 1))`), false)
+		assertStringValue(t, evalStrInContext(t, ec, `(typeOf p)`), "point")
+		require.Equal(t, "point{x:1 y:2}", evalStrInContext(t, ec, `p`).InspectStr())
+
+		evalStrInContextToErr(t, ec, `(point 1)`)
+		evalStrInContextToErr(t, ec, `(size-x p)`)
+		parseStrToErr(t, `(defstruct)`)
+		parseStrToErr(t, `(defstruct point x x)`)
+		parseStrToErr(t, `(defstruct point "x")`)
+	})
+
 	t.Run("str", func(t *testing.T) {
 		assertStringValue(t, evalStrToVal(t, `(concat "abc" "efg")`), "abcefg")
 	})
@@ -38,6 +219,50 @@ func Test_ParseTokens(t *testing.T) {
 		 5)`), 20)
 	})
 
+	t.Run("blockLet", func(t *testing.T) {
+		assertNumValue(t, evalStrToVal(t, `(let ((a 1) (b 2)) (+ a b))`), 3)
+		assertNilValue(t, evalStrToVal(t, `(let ())`))
+
+		// bindings are evaluated in the enclosing scope, and don't leak out of
+		// the block.
+		ec := BuiltinContext().SubContext(nil)
+		assertNumValue(t, evalStrInContext(t, ec, `
+		(let a 10)
+		(let ((a 1) (b a)) (+ a b))`), 11)
+		a, _ := ec.Resolve("a")
+		assertNumValue(t, a, 10)
+		_, hasB := ec.Resolve("b")
+		require.False(t, hasB)
+	})
+
+	t.Run("blockLet*", func(t *testing.T) {
+		assertNumValue(t,
+			evalStrToVal(t, `(let* ((a 1) (b (+ a 1))) (* a b))`), 2)
+	})
+
+	t.Run("set!", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+		(let makeCounter (fn ()
+		  (let count 0)
+		  (fn ()
+		    (set! count (+ count 1)))))
+		(let counter (makeCounter))
+		(counter)
+		(counter)`)
+		assertNumValue(t, evalStrInContext(t, ec, `(counter)`), 3)
+		assertNumValue(t, evalStrInContext(t, ec, `((makeCounter))`), 1)
+
+		// set! mutates the existing binding rather than shadowing it.
+		assertNumValue(t, evalStrInContext(t, ec, `
+		(let x 1)
+		((fn () (set! x 5)))
+		x`), 5)
+
+		err := evalStrToErr(t, `(set! undefinedThing 1)`)
+		require.IsType(t, (*EvalError)(nil), err)
+	})
+
 	t.Run("operators", func(t *testing.T) {
 		t.Run("+", func(t *testing.T) {
 			assertNumValue(t, evalStrToVal(t, `(+ 1 1)`), 2)
@@ -103,6 +328,9 @@ func Test_ParseTokens(t *testing.T) {
 			parseStrToErr(t, `(fn "abc")`)
 			parseStrToErr(t, `(fn (a b 1))`)
 			parseStrToErr(t, `(fn (a b`)
+			parseStrToErr(t, `(fn (a . ) a)`)
+			parseStrToErr(t, `(fn (a . b c) a)`)
+			parseStrToErr(t, `(fn (a . 1) a)`)
 		})
 
 		t.Run("invalidLet", func(t *testing.T) {
@@ -110,6 +338,30 @@ func Test_ParseTokens(t *testing.T) {
 			parseStrToErr(t, `(let `)
 			parseStrToErr(t, `(let a)`)
 			parseStrToErr(t, `(let 1 a)`)
+			parseStrToErr(t, `(let* a 1)`)
+			parseStrToErr(t, `(let ((a)) a)`)
+			parseStrToErr(t, `(let ((1 2)) a)`)
+			parseStrToErr(t, `(let (a 1) a)`)
+			parseStrToErr(t, `(let ((a 1) a)`)
+		})
+
+		t.Run("invalidSet", func(t *testing.T) {
+			parseStrToErr(t, `(set!)`)
+			parseStrToErr(t, `(set! a)`)
+			parseStrToErr(t, `(set! 1 a)`)
+			parseStrToErr(t, `(set! a 1 2)`)
+		})
+
+		t.Run("invalidCond", func(t *testing.T) {
+			parseStrToErr(t, `(cond ())`)
+			parseStrToErr(t, `(cond a)`)
+			parseStrToErr(t, `(cond (else 1) ((== 1 1) 2))`)
+			parseStrToErr(t, `(cond (a 1)`)
+		})
+
+		t.Run("invalidWhen", func(t *testing.T) {
+			parseStrToErr(t, `(when)`)
+			parseStrToErr(t, `(unless)`)
 		})
 
 		t.Run("invalidIf", func(t *testing.T) {
@@ -117,3 +369,237 @@ func Test_ParseTokens(t *testing.T) {
 		})
 	})
 }
+
+func Test_ParseString(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		exprs, err := ParseString("a.l", `(+ 1 2) b`)
+		require.NoError(t, err)
+		require.Len(t, exprs, 2)
+		require.Equal(t, "a.l", exprs[1].SourcePos().SourceFile)
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		exprs, err := ParseReader("b.l", strings.NewReader(`(list 1`))
+		require.Error(t, err)
+		require.Nil(t, exprs)
+	})
+
+	t.Run("expr", func(t *testing.T) {
+		e, err := ParseExpr("c.l", `(+ 1 2)`)
+		require.NoError(t, err)
+		assertNumValue(t, mustEval(t, e, BuiltinContext()), 3)
+
+		_, err = ParseExpr("c.l", `1 2`)
+		require.EqualError(t, err, "expected a single expression; got 2")
+		_, err = ParseExpr("c.l", ``)
+		require.Error(t, err)
+	})
+}
+
+func Test_reservedWords(t *testing.T) {
+	words := ReservedWords()
+	require.Contains(t, words, "if")
+	require.Contains(t, words, "nil")
+	require.True(t, IsReservedWord("defun"))
+	require.False(t, IsReservedWord("car"))
+
+	// every special form is reserved, so none can be bound.
+	for form := range NewSpecialFormRegistry().forms {
+		if form == ":" {
+			continue
+		}
+		_, err := ParseString("reserved.l", "(let "+form+" 1)")
+		require.Error(t, err, form)
+	}
+
+	for _, src := range []string{
+		`(let if 1)`,
+		`(let ((x 1) (fn 2)) x)`,
+		`(let* ((when 1)) when)`,
+		`(fn (a while) a)`,
+		`(fn (a :opt if) a)`,
+		`(fn (a . go) a)`,
+		`(fn return (a) a)`,
+		`(defun let (a) a)`,
+		`(for (defun (list 1)) 1)`,
+		`(dotimes (break 3) 1)`,
+		`(letValues ((q true) (divmod 7 2)) q)`,
+		`(defstruct point x time)`,
+		`(defgeneric deftest (x))`,
+	} {
+		_, err := ParseString("reserved.l", src)
+		asParseErr, isParseErr := err.(*ParseError)
+		require.True(t, isParseErr, src)
+		require.Contains(t, asParseErr.Msg, "reserved word", src)
+	}
+
+	_, err := ParseString("reserved.l", `(let timeout 1) (fn (iffy) iffy)`)
+	require.NoError(t, err)
+}
+
+// twiceExpr is a custom special form, that evaluates its expression twice.
+type twiceExpr struct {
+	expr     Expr
+	pos, end ScannerPosition
+}
+
+func (te *twiceExpr) Eval(ec *EvalContext) (Value, error) {
+	v1, err := te.expr.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	v2, err := te.expr.Eval(ec)
+	if err != nil {
+		return nil, err
+	}
+	return &ListValue{Vals: []Value{v1, v2}}, nil
+}
+
+func (te *twiceExpr) CodeStr() string {
+	return "(twice " + te.expr.CodeStr() + ")"
+}
+
+func (te *twiceExpr) SourcePos() ScannerPosition {
+	return te.pos
+}
+
+func (te *twiceExpr) SourceSpan() SourceSpan {
+	return SourceSpan{Start: te.pos, End: te.end}
+}
+
+func Test_SpecialFormRegistry(t *testing.T) {
+	forms := NewSpecialFormRegistry()
+	require.NoError(t, forms.Register("twice", func(ts *TokenScanner) (Expr, error) {
+		start, exprs, err := ParseFormArgs(ts)
+		if err != nil {
+			return nil, err
+		}
+		if len(exprs) != 1 {
+			return nil, NewParseError("twice expects 1 expression", start)
+		}
+		return &twiceExpr{expr: exprs[0], pos: start.Pos, end: exprs[0].SourceSpan().End}, nil
+	}))
+	require.Error(t, forms.Register("if", nil))
+	require.True(t, forms.IsReservedWord("twice"))
+	require.False(t, IsReservedWord("twice"))
+
+	parse := func(src string) ([]Expr, error) {
+		ts := NewTokenScanner(NewRuneScanner("forms.l", strings.NewReader(src)))
+		ts.SetSpecialForms(forms)
+		return ParseTokens(ts)
+	}
+
+	exprs, err := parse(`(let n 0) (twice (set! n (+ n 1)))`)
+	require.NoError(t, err)
+	ec := BuiltinContext()
+	mustEval(t, exprs[0], ec)
+	require.Equal(t, "[1 2]", mustEval(t, exprs[1], ec).InspectStr())
+	reparsed, err := parse(exprs[1].CodeStr())
+	require.NoError(t, err)
+	require.IsType(t, &twiceExpr{}, reparsed[0])
+
+	_, err = parse(`(twice 1 2)`)
+	require.Error(t, err)
+	_, err = parse(`(let twice 1)`)
+	require.Error(t, err)
+
+	// other parses don't see the form.
+	exprs, err = ParseString("forms.l", `(twice 1)`)
+	require.NoError(t, err)
+	require.IsType(t, &CallExpr{}, exprs[0])
+
+	_, err = ParseString("forms.l", `(import "lib")`)
+	require.Error(t, err)
+}
+
+func Test_OperatorRegistry(t *testing.T) {
+	ops := NewOperatorRegistry()
+	require.NoError(t, ops.Register("++", &FuncValue{Fn: concatFn, Pure: true}))
+	require.Error(t, ops.Register("+", &FuncValue{Fn: concatFn}))
+	require.Error(t, ops.Register("+a", &FuncValue{Fn: concatFn}))
+	require.Error(t, ops.Register("&", nil))
+	require.Contains(t, ops.Operators(), "++")
+	require.NotContains(t, DefaultOperators.Operators(), "++")
+
+	parse := func(src string) ([]Expr, error) {
+		ts := NewTokenScanner(NewRuneScanner("ops.l", strings.NewReader(src)))
+		ts.SetOperators(ops)
+		return ParseTokens(ts)
+	}
+	exprs, err := parse(`(++ "a" "b") (listReduce "" (list "c" "d") ++)`)
+	require.NoError(t, err)
+	ec := BuiltinContext()
+	require.Equal(t, `"ab"`, mustEval(t, exprs[0], ec).InspectStr())
+	require.Equal(t, `"cd"`, mustEval(t, exprs[1], ec).InspectStr())
+
+	_, err = ParseString("ops.l", `(++ "a" "b")`)
+	require.Error(t, err)
+
+	// the built-in operators are values, too.
+	assertNumValue(t, evalStrToVal(t, `(listReduce 0 (list 1 2 3) +)`), 6)
+}
+
+func Test_ParseTokensRecovering(t *testing.T) {
+	parse := func(src string) ([]Expr, error) {
+		return ParseTokensRecovering(NewTokenScanner(
+			NewRuneScanner("recover.l", strings.NewReader(src))))
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		exprs, err := parse(`(+ 1 2) a`)
+		require.NoError(t, err)
+		require.Len(t, exprs, 2)
+	})
+
+	t.Run("multipleErrors", func(t *testing.T) {
+		exprs, err := parse(`
+			(let a 1)
+			(if)
+			(let (a 1) (list (a) a))
+			(+ a 2)
+			)
+			(fn (1) 1)
+			"unterminated
+			(- a 1)`)
+		require.Len(t, exprs, 3)
+		require.Equal(t, "a", exprs[0].(*LetExpr).Ident.Val)
+		require.Equal(t, 5, exprs[1].SourcePos().Row)
+		require.Equal(t, 9, exprs[2].SourcePos().Row)
+
+		asMulti, isMulti := err.(*MultiError)
+		require.True(t, isMulti)
+		rows := []int{}
+		for _, e := range asMulti.Errs {
+			rows = append(rows, e.(*ParseError).Token.Pos.Row)
+		}
+		require.Equal(t, []int{3, 4, 6, 7, 8}, rows)
+		require.Equal(t, 5, strings.Count(err.Error(), "Parse error"))
+	})
+
+	t.Run("unclosed", func(t *testing.T) {
+		exprs, err := parse(`(+ 1 2) (list 1 (+ 2`)
+		require.Len(t, exprs, 1)
+		require.Len(t, err.(*MultiError).Errs, 1)
+	})
+}
+
+func Test_sourceSpans(t *testing.T) {
+	ts := NewTokenScanner(NewRuneScanner(
+		"spans.l", strings.NewReader("(if true\n  \"yes\" (f 12))")))
+	exprs, err := ParseTokens(ts)
+	require.NoError(t, err)
+	require.Len(t, exprs, 1)
+
+	pos := func(row, col, offset int) ScannerPosition {
+		return ScannerPosition{SourceFile: "spans.l", Row: row, Col: col, Offset: offset}
+	}
+	ifExpr := exprs[0].(*IfExpr)
+	require.Equal(t, SourceSpan{Start: pos(1, 2, 1), End: pos(2, 16, 24)},
+		ifExpr.SourceSpan())
+	require.Equal(t, SourceSpan{Start: pos(1, 5, 4), End: pos(1, 9, 8)},
+		ifExpr.Cond.SourceSpan())
+	require.Equal(t, SourceSpan{Start: pos(2, 3, 11), End: pos(2, 8, 16)},
+		ifExpr.Case1.SourceSpan())
+	require.Equal(t, SourceSpan{Start: pos(2, 9, 17), End: pos(2, 15, 23)},
+		ifExpr.Case2.SourceSpan())
+}
@@ -0,0 +1,487 @@
+package golisp2
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Plotting built-ins. A chart is either written to the file named by the
+// "file" option, as SVG or PNG depending on its extension; or, if there's no
+// file, drawn as ASCII to stdout. Note PNGs have no text: no title or axis
+// labels.
+
+type (
+	// chart is the data and options of a plot, independent of how it's drawn.
+	chart struct {
+		bar   bool
+		title string
+
+		// xs and ys are the coordinates of each point. Bars have a label for each
+		// rather than an x.
+		xs, ys []float64
+		labels []string
+
+		width, height int
+	}
+
+	// chartArea maps data coordinates onto a rectangle of pixels or cells,
+	// with y increasing downwards.
+	chartArea struct {
+		left, top, width, height float64
+		minX, maxX, minY, maxY   float64
+	}
+)
+
+const (
+	defaultChartWidth   = 640
+	defaultChartHeight  = 400
+	defaultASCIIWidth   = 60
+	defaultASCIIHeight  = 15
+	chartMargin         = 40
+	chartMarginWithText = 60
+)
+
+// plotLineFn plots a line through the points in data: either a list of
+// numbers, which are plotted against their index; or a list of [x y] pairs.
+// The optional map of options accepts "title", "file", "width" and "height".
+func plotLineFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var data *ListValue
+	var maybeOpts Value
+	err := ArgMapperValues(vals...).
+		ReadList(&data).
+		MaybeReadValue(&maybeOpts).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	c := &chart{}
+	for i, v := range data.Vals {
+		switch tV := v.(type) {
+		case *NumberValue:
+			c.xs = append(c.xs, float64(i))
+			c.ys = append(c.ys, tV.Val)
+		case *ListValue:
+			x, xOk := listNumber(tV, 0)
+			y, yOk := listNumber(tV, 1)
+			if !xOk || !yOk || len(tV.Vals) != 2 {
+				return nil, fmt.Errorf(
+					"plotLine expects points to be [x y] pairs of numbers; got %s",
+					v.InspectStr())
+			}
+			c.xs = append(c.xs, x)
+			c.ys = append(c.ys, y)
+		default:
+			return nil, fmt.Errorf(
+				"plotLine expects a list of numbers or [x y] pairs; got %s", TypeName(v))
+		}
+	}
+	return plot(ec, "plotLine", vals, c, maybeOpts)
+}
+
+// plotBarFn plots a bar for each value in data: either a list of numbers,
+// labelled by their index; a map from label to number; or a list of
+// [label number] pairs. Takes the same options as plotLine.
+func plotBarFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var data, maybeOpts Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&data).
+		MaybeReadValue(&maybeOpts).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	c := &chart{bar: true}
+	switch tData := data.(type) {
+	case *MapValue:
+		for _, k := range sortedKeys(tData.Vals) {
+			asNum, isNum := tData.Vals[k].(*NumberValue)
+			if !isNum {
+				return nil, fmt.Errorf(
+					"plotBar expects the value of '%s' to be a number; got %s",
+					k, TypeName(tData.Vals[k]))
+			}
+			c.labels = append(c.labels, k)
+			c.ys = append(c.ys, asNum.Val)
+		}
+	case *ListValue:
+		for i, v := range tData.Vals {
+			switch tV := v.(type) {
+			case *NumberValue:
+				c.labels = append(c.labels, strconv.Itoa(i))
+				c.ys = append(c.ys, tV.Val)
+			case *ListValue:
+				y, yOk := listNumber(tV, 1)
+				if !yOk || len(tV.Vals) != 2 {
+					return nil, fmt.Errorf(
+						"plotBar expects bars to be [label number] pairs; got %s",
+						v.InspectStr())
+				}
+				c.labels = append(c.labels, chartLabel(tV.Vals[0]))
+				c.ys = append(c.ys, y)
+			default:
+				return nil, fmt.Errorf(
+					"plotBar expects a list of numbers or [label number] pairs; got %s",
+					TypeName(v))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("plotBar expects a list or map; got %s", TypeName(data))
+	}
+	return plot(ec, "plotBar", vals, c, maybeOpts)
+}
+
+// plot applies the options to the chart, and draws it to the file they name or
+// to stdout.
+func plot(
+	ec *EvalContext, fnName string, args []Value, c *chart, maybeOpts Value,
+) (Value, error) {
+	file := ""
+	if maybeOpts != nil {
+		opts, isMap := maybeOpts.(*MapValue)
+		if !isMap {
+			return nil, fmt.Errorf(
+				"%s expects options to be a map; got %s", fnName, TypeName(maybeOpts))
+		}
+		for k, v := range opts.Vals {
+			var ok bool
+			switch k {
+			case "title":
+				var s *StringValue
+				s, ok = v.(*StringValue)
+				if ok {
+					c.title = s.Val
+				}
+			case "file":
+				var s *StringValue
+				s, ok = v.(*StringValue)
+				if ok {
+					file = s.Val
+				}
+			case "width", "height":
+				var n *NumberValue
+				n, ok = v.(*NumberValue)
+				ok = ok && n.Val >= 1
+				if ok && k == "width" {
+					c.width = int(n.Val)
+				} else if ok {
+					c.height = int(n.Val)
+				}
+			default:
+				return nil, fmt.Errorf("%s has no option '%s'", fnName, k)
+			}
+			if !ok {
+				return nil, fmt.Errorf(
+					"%s got an invalid value for option '%s': %s", fnName, k, v.InspectStr())
+			}
+		}
+	}
+
+	if file == "" {
+		if err := writeASCIIChart(ec.Stdout(), c); err != nil {
+			return nil, err
+		}
+		return Nil, nil
+	}
+
+	var buf bytes.Buffer
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".svg":
+		writeSVGChart(&buf, c)
+	case ".png":
+		if err := writePNGChart(&buf, c); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(
+			"%s can only write .svg or .png files; got '%s'", fnName, file)
+	}
+	if err := ec.checkPolicyPath(fnName, writeFileAction, file); err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf("would write a chart to %s", file)
+	return ec.writeEffect(fnName, args, description, Nil,
+		func() (Value, error) {
+			if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+				return nil, fmt.Errorf("%s failed: %w", fnName, err)
+			}
+			return Nil, nil
+		})
+}
+
+// listNumber returns the i-th element of the list, if it's a number.
+func listNumber(l *ListValue, i int) (float64, bool) {
+	if i >= len(l.Vals) {
+		return 0, false
+	}
+	asNum, isNum := l.Vals[i].(*NumberValue)
+	if !isNum {
+		return 0, false
+	}
+	return asNum.Val, true
+}
+
+// chartLabel is the text a value is labelled with on a chart.
+func chartLabel(v Value) string {
+	if asStr, isStr := v.(*StringValue); isStr {
+		return asStr.Val
+	}
+	return v.InspectStr()
+}
+
+// chartNumber formats a number for an axis or bar label.
+func chartNumber(n float64) string {
+	return strconv.FormatFloat(n, 'g', 4, 64)
+}
+
+// size returns the width and height of the chart, using the defaults for any
+// not set.
+func (c *chart) size(defaultWidth, defaultHeight int) (int, int) {
+	w, h := c.width, c.height
+	if w == 0 {
+		w = defaultWidth
+	}
+	if h == 0 {
+		h = defaultHeight
+	}
+	return w, h
+}
+
+// area returns the data ranges of the chart, mapped onto the rectangle. Bars
+// always include zero.
+func (c *chart) area(left, top, width, height float64) chartArea {
+	a := chartArea{
+		left: left, top: top, width: width, height: height,
+		minX: math.Inf(1), maxX: math.Inf(-1),
+		minY: math.Inf(1), maxY: math.Inf(-1),
+	}
+	if c.bar {
+		a.minX, a.maxX = 0, float64(len(c.ys))
+		a.minY, a.maxY = 0, 0
+	}
+	for i, y := range c.ys {
+		if !c.bar {
+			a.minX, a.maxX = math.Min(a.minX, c.xs[i]), math.Max(a.maxX, c.xs[i])
+		}
+		a.minY, a.maxY = math.Min(a.minY, y), math.Max(a.maxY, y)
+	}
+	if len(c.ys) == 0 {
+		a.minX, a.maxX, a.minY, a.maxY = 0, 1, 0, 1
+	}
+	// a flat range would divide by zero.
+	if a.maxX == a.minX {
+		a.minX, a.maxX = a.minX-1, a.maxX+1
+	}
+	if a.maxY == a.minY {
+		a.minY, a.maxY = a.minY-1, a.maxY+1
+	}
+	return a
+}
+
+// x returns the horizontal position of the data coordinate.
+func (a chartArea) x(x float64) float64 {
+	return a.left + (x-a.minX)/(a.maxX-a.minX)*a.width
+}
+
+// y returns the vertical position of the data coordinate.
+func (a chartArea) y(y float64) float64 {
+	return a.top + (a.maxY-y)/(a.maxY-a.minY)*a.height
+}
+
+// writeSVGChart draws the chart as an SVG document.
+func writeSVGChart(w io.Writer, c *chart) {
+	width, height := c.size(defaultChartWidth, defaultChartHeight)
+	m := float64(chartMarginWithText)
+	a := c.area(m, m, float64(width)-2*m, float64(height)-2*m)
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`+"\n",
+		width, height)
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	if c.title != "" {
+		fmt.Fprintf(w, `<text x="%d" y="%g" text-anchor="middle" font-size="16">%s</text>`+"\n",
+			width/2, m/2, html.EscapeString(c.title))
+	}
+	fmt.Fprintf(w, `<path d="M%g %g V%g H%g" stroke="black" fill="none"/>`+"\n",
+		a.left, a.top, a.top+a.height, a.left+a.width)
+	fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="end" font-size="12">%s</text>`+"\n",
+		a.left-4, a.top+4, chartNumber(a.maxY))
+	fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="end" font-size="12">%s</text>`+"\n",
+		a.left-4, a.top+a.height+4, chartNumber(a.minY))
+
+	if c.bar {
+		slot := a.width / float64(len(c.ys))
+		for i, y := range c.ys {
+			top, bottom := math.Min(a.y(y), a.y(0)), math.Max(a.y(y), a.y(0))
+			fmt.Fprintf(w, `<rect x="%g" y="%g" width="%g" height="%g" fill="steelblue"/>`+"\n",
+				a.x(float64(i))+slot*0.1, top, slot*0.8, bottom-top)
+			fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="middle" font-size="12">%s</text>`+"\n",
+				a.x(float64(i))+slot/2, a.top+a.height+16, html.EscapeString(c.labels[i]))
+		}
+	} else {
+		points := make([]string, len(c.ys))
+		for i, y := range c.ys {
+			points[i] = fmt.Sprintf("%g,%g", a.x(c.xs[i]), a.y(y))
+		}
+		fmt.Fprintf(w, `<polyline points="%s" stroke="steelblue" stroke-width="2" fill="none"/>`+"\n",
+			strings.Join(points, " "))
+		fmt.Fprintf(w, `<text x="%g" y="%g" font-size="12">%s</text>`+"\n",
+			a.left, a.top+a.height+16, chartNumber(a.minX))
+		fmt.Fprintf(w, `<text x="%g" y="%g" text-anchor="end" font-size="12">%s</text>`+"\n",
+			a.left+a.width, a.top+a.height+16, chartNumber(a.maxX))
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// writePNGChart draws the chart as a PNG image.
+func writePNGChart(w io.Writer, c *chart) error {
+	width, height := c.size(defaultChartWidth, defaultChartHeight)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	black := color.RGBA{A: 255}
+	blue := color.RGBA{R: 70, G: 130, B: 180, A: 255}
+	fillRect(img, 0, 0, width, height, white)
+
+	m := float64(chartMargin)
+	a := c.area(m, m, float64(width)-2*m, float64(height)-2*m)
+	left, bottom := int(a.left), int(a.top+a.height)
+	drawLine(img, left, int(a.top), left, bottom, black)
+	drawLine(img, left, bottom, int(a.left+a.width), bottom, black)
+
+	if c.bar {
+		slot := a.width / float64(len(c.ys))
+		for i, y := range c.ys {
+			top, base := math.Min(a.y(y), a.y(0)), math.Max(a.y(y), a.y(0))
+			x := a.x(float64(i)) + slot*0.1
+			fillRect(img, int(x), int(top), int(x+slot*0.8), int(base), blue)
+		}
+	} else {
+		for i := 1; i < len(c.ys); i++ {
+			drawLine(img,
+				int(a.x(c.xs[i-1])), int(a.y(c.ys[i-1])),
+				int(a.x(c.xs[i])), int(a.y(c.ys[i])), blue)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// fillRect fills the rectangle from (x0, y0) up to (x1, y1).
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// drawLine draws a line between the points, using Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := absInt(x1-x0), -absInt(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x0 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// writeASCIIChart draws the chart as text. Bars are drawn horizontally, one
+// per line; lines as a scatter of points.
+func writeASCIIChart(w io.Writer, c *chart) error {
+	width, height := c.size(defaultASCIIWidth, defaultASCIIHeight)
+	var sb strings.Builder
+	if c.title != "" {
+		sb.WriteString(c.title + "\n")
+	}
+
+	if c.bar {
+		labelLen := 0
+		for _, l := range c.labels {
+			labelLen = maxInt(labelLen, len(l))
+		}
+		maxY := 0.0
+		for _, y := range c.ys {
+			maxY = math.Max(maxY, y)
+		}
+		for i, y := range c.ys {
+			n := 0
+			if maxY > 0 && y > 0 {
+				n = int(math.Round(y / maxY * float64(width)))
+			}
+			bar := ""
+			if n > 0 {
+				bar = strings.Repeat("#", n) + " "
+			}
+			fmt.Fprintf(&sb, "%*s | %s%s\n", labelLen, c.labels[i], bar, chartNumber(y))
+		}
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	a := c.area(0, 0, float64(width-1), float64(height-1))
+	grid := make([][]byte, height)
+	for i := range grid {
+		grid[i] = bytes.Repeat([]byte{' '}, width)
+	}
+	for i, y := range c.ys {
+		col := int(math.Round(a.x(c.xs[i])))
+		row := int(math.Round(a.y(y)))
+		grid[row][col] = '*'
+	}
+	maxLabel, minLabel := chartNumber(a.maxY), chartNumber(a.minY)
+	labelLen := maxInt(len(maxLabel), len(minLabel))
+	for i, row := range grid {
+		label := ""
+		switch i {
+		case 0:
+			label = maxLabel
+		case height - 1:
+			label = minLabel
+		}
+		fmt.Fprintf(&sb, "%*s |%s\n", labelLen, label, strings.TrimRight(string(row), " "))
+	}
+	fmt.Fprintf(&sb, "%*s +%s\n", labelLen, "", strings.Repeat("-", width))
+	minX, maxX := chartNumber(a.minX), chartNumber(a.maxX)
+	gap := maxInt(1, width-len(minX)-len(maxX))
+	fmt.Fprintf(&sb, "%*s  %s%s%s\n", labelLen, "", minX, strings.Repeat(" ", gap), maxX)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
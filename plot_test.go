@@ -0,0 +1,88 @@
+package golisp2
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_plotFns(t *testing.T) {
+
+	t.Run("asciiBar", func(t *testing.T) {
+		var out bytes.Buffer
+		ec := BuiltinContext()
+		ec.SetStdout(&out)
+		assertNilValue(t, evalStrInContext(t, ec,
+			`(plotBar (map "b" 4 "a" 2 "c" 0) (map "title" "counts" "width" 8))`))
+		require.Equal(t, "counts\na | #### 2\nb | ######## 4\nc | 0\n", out.String())
+
+		out.Reset()
+		evalStrInContext(t, ec, `(plotBar (list (list "x" 1) (list "yy" 2)) (map "width" 2))`)
+		require.Equal(t, " x | # 1\nyy | ## 2\n", out.String())
+	})
+
+	t.Run("asciiLine", func(t *testing.T) {
+		var out bytes.Buffer
+		ec := BuiltinContext()
+		ec.SetStdout(&out)
+		evalStrInContext(t, ec,
+			`(plotLine (list (list 0 0) (list 2 10) (list 4 0)) (map "width" 5 "height" 3))`)
+		require.Equal(t, strings.Join([]string{
+			"10 |  *",
+			"   |",
+			" 0 |*   *",
+			"   +-----",
+			"    0   4",
+			"",
+		}, "\n"), out.String())
+	})
+
+	t.Run("files", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "plot")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		ec := BuiltinContext()
+		ec.Add("dir", &StringValue{Val: dir})
+
+		evalStrInContext(t, ec,
+			`(plotLine (list 1 3 2) (map "title" "a < b" "file" (concat dir "/line.svg")))`)
+		svg, err := ioutil.ReadFile(filepath.Join(dir, "line.svg"))
+		require.NoError(t, err)
+		require.Contains(t, string(svg), "<polyline")
+		require.Contains(t, string(svg), "a &lt; b")
+
+		evalStrInContext(t, ec,
+			`(plotBar (list 1 -2) (map "file" (concat dir "/bar.png") "width" 100 "height" 50))`)
+		f, err := os.Open(filepath.Join(dir, "bar.png"))
+		require.NoError(t, err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		require.NoError(t, err)
+		require.Equal(t, 100, img.Bounds().Dx())
+		require.Equal(t, 50, img.Bounds().Dy())
+	})
+
+	t.Run("dryRun", func(t *testing.T) {
+		var log bytes.Buffer
+		ec := BuiltinContext()
+		ec.SetDryRun(&log)
+		evalStrInContext(t, ec, `(plotBar (list 1) (map "file" "never.svg"))`)
+		require.Contains(t, log.String(), "plotBar: would write a chart to never.svg")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		evalStrToErr(t, `(plotLine (list "a"))`)
+		evalStrToErr(t, `(plotLine (list (list 1)))`)
+		evalStrToErr(t, `(plotBar (map "a" "b"))`)
+		evalStrToErr(t, `(plotBar 1)`)
+		evalStrToErr(t, `(plotBar (list 1) (map "color" "red"))`)
+		evalStrToErr(t, `(plotBar (list 1) (map "width" 0))`)
+		evalStrToErr(t, `(plotBar (list 1) (map "file" "chart.gif"))`)
+	})
+}
@@ -0,0 +1,176 @@
+package golisp2
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policy limits what the effectful builtins may do, so hosts can run scripts
+// they don't trust. The zero policy allows nothing; every builtin that reads or
+// writes files, uses the network, runs processes or reads the environment
+// fails instead.
+type Policy struct {
+	// AllowFileRead permits readFile.
+	AllowFileRead bool
+
+	// AllowFileWrite permits writeFile, and plots written to files.
+	AllowFileWrite bool
+
+	// AllowNetwork permits httpGet, httpPost and httpServe.
+	AllowNetwork bool
+
+	// AllowExec permits exec and execPipe.
+	AllowExec bool
+
+	// AllowEnv permits getEnv.
+	AllowEnv bool
+
+	// PathPrefixes, if set, are the only directories files may be read from or
+	// written to. Symlinks are followed before paths are compared, so they can't
+	// be used to escape them.
+	PathPrefixes []string
+}
+
+// policyAction is something a policy may forbid.
+type policyAction int
+
+const (
+	readFileAction policyAction = iota
+	writeFileAction
+	networkAction
+	execAction
+	envAction
+)
+
+// String describes the action, as it's reported in errors.
+func (a policyAction) String() string {
+	switch a {
+	case readFileAction:
+		return "reading files"
+	case writeFileAction:
+		return "writing files"
+	case networkAction:
+		return "using the network"
+	case execAction:
+		return "running processes"
+	case envAction:
+		return "reading the environment"
+	default:
+		return "unknown"
+	}
+}
+
+// UnrestrictedPolicy returns a policy that allows everything.
+func UnrestrictedPolicy() Policy {
+	return Policy{
+		AllowFileRead:  true,
+		AllowFileWrite: true,
+		AllowNetwork:   true,
+		AllowExec:      true,
+		AllowEnv:       true,
+	}
+}
+
+// allows indicates if the policy permits the action.
+func (p *Policy) allows(action policyAction) bool {
+	switch action {
+	case readFileAction:
+		return p.AllowFileRead
+	case writeFileAction:
+		return p.AllowFileWrite
+	case networkAction:
+		return p.AllowNetwork
+	case execAction:
+		return p.AllowExec
+	case envAction:
+		return p.AllowEnv
+	default:
+		return false
+	}
+}
+
+// allowsPath indicates if the path is within one of the policy's prefixes.
+func (p *Policy) allowsPath(path string) bool {
+	if len(p.PathPrefixes) == 0 {
+		return true
+	}
+	resolved, err := resolvePolicyPath(path)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range p.PathPrefixes {
+		resolvedPrefix, err := resolvePolicyPath(prefix)
+		if err != nil {
+			continue
+		}
+		if resolved == resolvedPrefix ||
+			strings.HasPrefix(resolved, resolvedPrefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePolicyPath returns the absolute path, with any symlinks in it
+// followed. The path itself needn't exist, as long as its directory does; a
+// file may be about to be written.
+func resolvePolicyPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		return resolved, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(abs)), nil
+}
+
+// SetPolicy limits what the effectful builtins may do. By default, there's no
+// policy, and everything is allowed. This applies to all parent and sub
+// contexts.
+func (ec *EvalContext) SetPolicy(p Policy) {
+	p.PathPrefixes = append([]string(nil), p.PathPrefixes...)
+	ec.environ().policy = &p
+}
+
+// checkPolicy returns an error if the policy forbids the builtin from performing
+// the action.
+func (ec *EvalContext) checkPolicy(fnName string, action policyAction) error {
+	p := ec.environ().policy
+	if p == nil || p.allows(action) {
+		return nil
+	}
+	return &EvalError{
+		Msg: fmt.Sprintf("policy forbids '%s' from %s", fnName, action),
+		Pos: ec.CallPos(),
+	}
+}
+
+// checkPolicyPath returns an error if the policy forbids the builtin from
+// performing the action on the file at path.
+func (ec *EvalContext) checkPolicyPath(
+	fnName string, action policyAction, path string,
+) error {
+	if err := ec.checkPolicy(fnName, action); err != nil {
+		return err
+	}
+	p := ec.environ().policy
+	if p == nil || p.allowsPath(path) {
+		return nil
+	}
+	return &EvalError{
+		Msg: fmt.Sprintf(
+			"policy forbids '%s' from using '%s'; it's outside the allowed paths",
+			fnName, path),
+		Pos: ec.CallPos(),
+	}
+}
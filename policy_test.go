@@ -0,0 +1,78 @@
+package golisp2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Policy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	inside := filepath.Join(dir, "inside.txt")
+	require.NoError(t, ioutil.WriteFile(inside, []byte("hi"), 0644))
+
+	run := func(p Policy, src string) (Value, error) {
+		in := NewInterpreter(nil)
+		in.SetPolicy(p)
+		return in.Run(strings.NewReader(src))
+	}
+
+	t.Run("denied", func(t *testing.T) {
+		for _, src := range []string{
+			`(readFile "` + inside + `")`,
+			`(writeFile "` + inside + `" "x")`,
+			`(httpGet "http://localhost:1")`,
+			`(httpPost "http://localhost:1" "text/plain" "x")`,
+			`(httpServe "localhost:0" (fn (req) "x"))`,
+			`(exec "echo" "a")`,
+			`(getEnv "HOME")`,
+		} {
+			_, err := run(Policy{}, src)
+			require.Error(t, err, src)
+			require.Contains(t, err.Error(), "policy forbids", src)
+		}
+		// pure builtins are unaffected.
+		v, err := run(Policy{}, `(+ 1 2)`)
+		require.NoError(t, err)
+		assertNumValue(t, v, 3)
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		v, err := run(Policy{AllowFileRead: true}, `(readFile "`+inside+`")`)
+		require.NoError(t, err)
+		assertStringValue(t, v, "hi")
+
+		v, err = run(UnrestrictedPolicy(), `(exec "echo" "a")`)
+		require.NoError(t, err)
+		assertStringValue(t, assertAsMap(t, v).Vals["stdout"], "a\n")
+		_, err = run(Policy{AllowFileRead: true}, `(exec "echo" "a")`)
+		require.Contains(t, err.Error(), "policy forbids 'exec' from running processes")
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		p := Policy{AllowFileRead: true, AllowFileWrite: true, PathPrefixes: []string{dir}}
+		_, err := run(p, `(writeFile "`+filepath.Join(dir, "new.txt")+`" "x")`)
+		require.NoError(t, err)
+		_, err = run(p, `(readFile "`+inside+`")`)
+		require.NoError(t, err)
+
+		_, err = run(p, `(readFile "`+dir+`-other/a.txt")`)
+		require.Contains(t, err.Error(), "outside the allowed paths")
+		_, err = run(p, `(readFile "`+filepath.Join(dir, "..", "a.txt")+`")`)
+		require.Contains(t, err.Error(), "outside the allowed paths")
+
+		// symlinks can't be used to escape the prefixes.
+		outside, err := ioutil.TempDir("", "policy-outside")
+		require.NoError(t, err)
+		defer os.RemoveAll(outside)
+		require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+		_, err = run(p, `(writeFile "`+filepath.Join(dir, "link", "a.txt")+`" "x")`)
+		require.Contains(t, err.Error(), "outside the allowed paths")
+	})
+}
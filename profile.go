@@ -0,0 +1,225 @@
+package golisp2
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// Profiler is an EvalHook that measures where evaluation spends its time:
+	// how often each function is called and how long it takes, which functions
+	// call which, and how many expressions are evaluated on each line.
+	//
+	// Set it on a context with SetEvalHook, then write a report once evaluation
+	// is done. It isn't safe for concurrent use.
+	Profiler struct {
+		now func() time.Time
+
+		stack []profileFrame
+		funcs map[string]*FuncProfile
+		edges map[profileEdge]int
+		lines map[profileLine]int
+
+		// active counts the frames on the stack for each function, so the time
+		// of recursive calls is only counted once.
+		active map[string]int
+
+		// tailCalls are the positions of the call sites in tail position; see
+		// MarkTailCalls.
+		tailCalls map[ScannerPosition]bool
+	}
+
+	// FuncProfile is the profile of calls to a single function.
+	FuncProfile struct {
+		Name  string
+		Calls int
+
+		// TailCalls is how many of the calls were made from tail position. It's
+		// only counted for call sites given to MarkTailCalls.
+		TailCalls int
+
+		// Total is the time spent in the function, including in the functions it
+		// called; Self excludes them.
+		Total, Self time.Duration
+	}
+
+	profileFrame struct {
+		name     string
+		tail     bool
+		start    time.Time
+		children time.Duration
+	}
+
+	profileEdge struct {
+		caller, callee string
+	}
+
+	profileLine struct {
+		file string
+		row  int
+	}
+)
+
+// profileTopLevel is the caller recorded for calls made outside any function.
+const profileTopLevel = "<top>"
+
+// NewProfiler creates a profiler with no measurements.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		now:    time.Now,
+		funcs:  map[string]*FuncProfile{},
+		edges:  map[profileEdge]int{},
+		lines:  map[profileLine]int{},
+		active: map[string]int{},
+
+		tailCalls: map[ScannerPosition]bool{},
+	}
+}
+
+// MarkTailCalls records that the calls are in tail position, so calls made from
+// them are counted in the profile. See TailCalls.
+func (p *Profiler) MarkTailCalls(calls []*CallExpr) {
+	for _, ce := range calls {
+		p.tailCalls[ce.Pos] = true
+	}
+}
+
+// OnEnterExpr counts the evaluation against the expression's line.
+func (p *Profiler) OnEnterExpr(e Expr) {
+	pos := e.SourcePos()
+	p.lines[profileLine{file: pos.SourceFile, row: pos.Row}]++
+}
+
+// OnExitExpr does nothing; expressions are only counted.
+func (p *Profiler) OnExitExpr(e Expr, v Value, err error) {}
+
+// OnCall starts timing the call.
+func (p *Profiler) OnCall(fn *FuncValue, args []Value, pos ScannerPosition) {
+	name := profileName(fn)
+	caller := profileTopLevel
+	if len(p.stack) > 0 {
+		caller = p.stack[len(p.stack)-1].name
+	}
+	p.edges[profileEdge{caller: caller, callee: name}]++
+	p.active[name]++
+	p.stack = append(p.stack, profileFrame{
+		name:  name,
+		tail:  p.tailCalls[pos],
+		start: p.now(),
+	})
+}
+
+// OnReturn finishes timing the call.
+func (p *Profiler) OnReturn(fn *FuncValue, v Value, err error) {
+	if len(p.stack) == 0 {
+		return
+	}
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	elapsed := p.now().Sub(frame.start)
+
+	fp := p.funcs[frame.name]
+	if fp == nil {
+		fp = &FuncProfile{Name: frame.name}
+		p.funcs[frame.name] = fp
+	}
+	fp.Calls++
+	if frame.tail {
+		fp.TailCalls++
+	}
+	fp.Self += elapsed - frame.children
+	p.active[frame.name]--
+	if p.active[frame.name] == 0 {
+		fp.Total += elapsed
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+// Funcs returns the profile of each function that was called, ordered by the
+// time spent in them, most first.
+func (p *Profiler) Funcs() []FuncProfile {
+	fps := make([]FuncProfile, 0, len(p.funcs))
+	for _, fp := range p.funcs {
+		fps = append(fps, *fp)
+	}
+	sort.Slice(fps, func(i, j int) bool {
+		if fps[i].Self != fps[j].Self {
+			return fps[i].Self > fps[j].Self
+		}
+		return fps[i].Name < fps[j].Name
+	})
+	return fps
+}
+
+// WriteReport writes the flat profile, the call graph, and the lines with the
+// most evaluations.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	var sb strings.Builder
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	sb.WriteString("Flat profile:\n")
+	fmt.Fprintf(&sb, "  %8s %8s %12s %12s  %s\n",
+		"calls", "tail", "self(ms)", "total(ms)", "function")
+	for _, fp := range p.Funcs() {
+		fmt.Fprintf(&sb, "  %8d %8d %12.3f %12.3f  %s\n",
+			fp.Calls, fp.TailCalls, ms(fp.Self), ms(fp.Total), fp.Name)
+	}
+
+	sb.WriteString("\nCall graph:\n")
+	edges := make([]profileEdge, 0, len(p.edges))
+	for e := range p.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].caller != edges[j].caller {
+			return edges[i].caller < edges[j].caller
+		}
+		return edges[i].callee < edges[j].callee
+	})
+	for i, e := range edges {
+		if i == 0 || edges[i-1].caller != e.caller {
+			fmt.Fprintf(&sb, "  %s\n", e.caller)
+		}
+		fmt.Fprintf(&sb, "    -> %-20s %d\n", e.callee, p.edges[e])
+	}
+
+	sb.WriteString("\nHot lines:\n")
+	lines := make([]profileLine, 0, len(p.lines))
+	for l := range p.lines {
+		lines = append(lines, l)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		ci, cj := p.lines[lines[i]], p.lines[lines[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		if lines[i].file != lines[j].file {
+			return lines[i].file < lines[j].file
+		}
+		return lines[i].row < lines[j].row
+	})
+	if len(lines) > 10 {
+		lines = lines[:10]
+	}
+	for _, l := range lines {
+		fmt.Fprintf(&sb, "  %8d  %s:%d\n", p.lines[l], l.file, l.row)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// profileName returns the name a function is reported under.
+func profileName(fn *FuncValue) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
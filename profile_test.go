@@ -0,0 +1,51 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Profiler(t *testing.T) {
+	// each reading of the clock advances it by a millisecond.
+	var clock time.Time
+	p := NewProfiler()
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+
+	ec := BuiltinContext().SubContext(nil)
+	ec.SetEvalHook(p)
+	exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(`
+		(defun countdown (n) (if (< n 1) 0 (countdown (- n 1))))
+		(countdown 2)`))))
+	require.NoError(t, err)
+	p.MarkTailCalls(TailCalls(exprs))
+	for _, e := range exprs {
+		mustEval(t, e, ec)
+	}
+
+	funcs := map[string]FuncProfile{}
+	for _, fp := range p.Funcs() {
+		funcs[fp.Name] = fp
+	}
+	require.Equal(t, 3, funcs["countdown"].Calls)
+	require.Equal(t, 2, funcs["countdown"].TailCalls)
+	require.Equal(t, 0, funcs["<"].TailCalls)
+	require.Equal(t, 3, funcs["<"].Calls)
+	require.Equal(t, 2, funcs["-"].Calls)
+	require.Equal(t, 3*time.Millisecond, funcs["<"].Self)
+	// recursive calls are only counted once in the total.
+	require.Equal(t, 15*time.Millisecond, funcs["countdown"].Total)
+	require.Equal(t, 10*time.Millisecond, funcs["countdown"].Self)
+
+	var report strings.Builder
+	require.NoError(t, p.WriteReport(&report))
+	require.Contains(t, report.String(), "Flat profile:")
+	require.Contains(t, report.String(), "  <top>\n    -> countdown            1\n")
+	require.Contains(t, report.String(), "    -> countdown            2\n")
+	require.Contains(t, report.String(), "testfile:3")
+}
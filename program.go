@@ -0,0 +1,234 @@
+package golisp2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	// Program is a parsed script: the manifest it declares in its header, and
+	// its top-level expressions.
+	Program struct {
+		Manifest Manifest
+		Exprs    []Expr
+
+		// KeepGoing makes a failing expression not stop evaluation: its error is
+		// recorded, and the remaining expressions are still evaluated. All the
+		// errors are returned together at the end.
+		KeepGoing bool
+	}
+
+	// Manifest is the metadata a script declares about itself, through comments
+	// of the form `;; gl: {"timeout": "5s"}` before any code. Hosts can consult
+	// it before deciding whether and how to run the script.
+	Manifest struct {
+		// Timeout is the longest the script expects to run for. Zero if unset.
+		Timeout time.Duration
+
+		// Permissions lists the capabilities the script requires.
+		Permissions []string
+
+		// Raw contains every field of the header, including any that aren't
+		// otherwise recognized.
+		Raw map[string]interface{}
+	}
+
+	// Script is a compiled script: parsed once, and then run any number of
+	// times. It's immutable, so can be run concurrently.
+	Script struct {
+		prog *Program
+
+		// src is the source the script was compiled from, so errors running it
+		// can quote it.
+		src string
+	}
+)
+
+// manifestPrefix marks a leading comment as a manifest header.
+const manifestPrefix = "gl:"
+
+// ParseProgram reads in the tokens, and converts them to a program. Returns
+// any parse errors encountered, including invalid manifest headers.
+func ParseProgram(ts *TokenScanner) (*Program, error) {
+	exprs, exprsErr := ParseTokens(ts)
+	if exprsErr != nil {
+		return nil, exprsErr
+	}
+	manifest, manifestErr := parseManifest(ts.LeadingComments())
+	if manifestErr != nil {
+		return nil, manifestErr
+	}
+	return &Program{
+		Manifest: manifest,
+		Exprs:    exprs,
+	}, nil
+}
+
+// Compile parses the source into a script. Returns any parse errors, including
+// invalid manifest headers.
+func Compile(src string) (*Script, error) {
+	prog, err := ParseProgram(
+		NewTokenScanner(NewRuneScanner("script", strings.NewReader(src))))
+	if err != nil {
+		return nil, err
+	}
+	return &Script{
+		prog: prog,
+		src:  src,
+	}, nil
+}
+
+// Manifest returns the manifest the script declares in its header. It must
+// not be modified.
+func (s *Script) Manifest() Manifest {
+	return s.prog.Manifest
+}
+
+// RequiredCapabilities returns the capabilities the script may use. See
+// RequiredCapabilities.
+func (s *Script) RequiredCapabilities() []string {
+	return RequiredCapabilities(s.prog.Exprs)
+}
+
+// Run evaluates the script, and returns the value of its last expression. Each
+// run is in a new context of the builtins, with the vars bound (see
+// ValueFromGo); nothing defined by one run is visible to another. The run is
+// halted once ctx is done, or once the manifest's timeout elapses.
+func (s *Script) Run(ctx context.Context, vars map[string]interface{}) (Value, error) {
+	vals, err := bindingsFromGo(vars)
+	if err != nil {
+		return nil, err
+	}
+	ec := BuiltinContext().SubContext(vals)
+	ec.SetContext(ctx)
+	v, err := s.prog.Eval(ec)
+	return v, quoteString(err, "script", s.src)
+}
+
+// Eval evaluates each of the program's expressions in order, and returns the
+// value of the last. If the manifest declares a timeout, evaluation will be
+// halted with an error once it elapses. See KeepGoing for how failures are
+// handled.
+func (p *Program) Eval(ec *EvalContext) (v Value, err error) {
+	metrics := ec.metrics()
+	metrics.EvalStarted()
+	start := time.Now()
+	var spanAttrs map[string]string
+	if len(p.Exprs) > 0 {
+		spanAttrs = map[string]string{
+			"golisp.source": p.Exprs[0].SourcePos().SourceFile,
+		}
+	}
+	endSpan := ec.startSpan("golisp.run", spanAttrs)
+	defer func() {
+		endSpan(err)
+		metrics.EvalFinished(time.Since(start))
+		if err != nil {
+			metrics.EvalFailed(errorKind(err))
+		}
+	}()
+
+	if p.Manifest.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(ec.Context(), p.Manifest.Timeout)
+		defer cancel()
+		ec = ec.withContext(ctx)
+	}
+
+	var lastV Value = Nil
+	errs := []error{}
+	for _, e := range p.Exprs {
+		v, err := e.Eval(ec)
+		if err != nil {
+			errs = append(errs, err)
+			// once halted, every remaining expression would just fail
+			// the same way.
+			if !p.KeepGoing || ec.Context().Err() != nil {
+				break
+			}
+			continue
+		}
+		lastV = v
+	}
+	switch len(errs) {
+	case 0:
+		return lastV, nil
+	case 1:
+		return nil, errs[0]
+	default:
+		return nil, &MultiError{Errs: errs}
+	}
+}
+
+// parseManifest builds a manifest out of the leading comments of a source.
+// Comments that aren't manifest headers are ignored; if there are several
+// headers their fields are merged.
+func parseManifest(comments []ScannedToken) (Manifest, error) {
+	manifest := Manifest{
+		Raw: map[string]interface{}{},
+	}
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimLeft(c.Value, ";"))
+		if !strings.HasPrefix(text, manifestPrefix) {
+			continue
+		}
+		fields := map[string]interface{}{}
+		err := json.Unmarshal([]byte(text[len(manifestPrefix):]), &fields)
+		if err != nil {
+			return Manifest{}, NewParseError(
+				fmt.Sprintf("invalid manifest header [err=%s]", err), c)
+		}
+		for k, v := range fields {
+			manifest.Raw[k] = v
+		}
+		if err := manifest.applyFields(fields); err != nil {
+			return Manifest{}, NewParseError(err.Error(), c)
+		}
+	}
+	return manifest, nil
+}
+
+// manifestFromRaw rebuilds a manifest from its raw header fields.
+func manifestFromRaw(raw map[string]interface{}) (Manifest, error) {
+	manifest := Manifest{
+		Raw: map[string]interface{}{},
+	}
+	for k, v := range raw {
+		manifest.Raw[k] = v
+	}
+	if err := manifest.applyFields(manifest.Raw); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// applyFields sets the recognized fields of the manifest from a decoded header.
+func (m *Manifest) applyFields(fields map[string]interface{}) error {
+	if rawTimeout, hasTimeout := fields["timeout"]; hasTimeout {
+		asStr, isStr := rawTimeout.(string)
+		if !isStr {
+			return fmt.Errorf("manifest timeout must be a duration string")
+		}
+		timeout, err := time.ParseDuration(asStr)
+		if err != nil {
+			return fmt.Errorf("invalid manifest timeout [err=%s]", err)
+		}
+		m.Timeout = timeout
+	}
+	if rawPerms, hasPerms := fields["permissions"]; hasPerms {
+		asList, isList := rawPerms.([]interface{})
+		if !isList {
+			return fmt.Errorf("manifest permissions must be a list of strings")
+		}
+		for _, p := range asList {
+			asStr, isStr := p.(string)
+			if !isStr {
+				return fmt.Errorf("manifest permissions must be a list of strings")
+			}
+			m.Permissions = append(m.Permissions, asStr)
+		}
+	}
+	return nil
+}
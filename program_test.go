@@ -0,0 +1,172 @@
+package golisp2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseProgram(t *testing.T) {
+
+	parseProgram := func(t *testing.T, src string) (*Program, error) {
+		t.Helper()
+		return ParseProgram(NewTokenScanner(
+			NewRuneScanner("program.l", strings.NewReader(src))))
+	}
+
+	t.Run("manifest", func(t *testing.T) {
+		prog, err := parseProgram(t, `
+;; gl: {"timeout": "5s", "permissions": ["read"]}
+; just a comment
+;; gl: {"author": "me"}
+(+ 1 2)`)
+		require.NoError(t, err)
+		require.Equal(t, 5*time.Second, prog.Manifest.Timeout)
+		require.Equal(t, []string{"read"}, prog.Manifest.Permissions)
+		require.Equal(t, "me", prog.Manifest.Raw["author"])
+		require.Equal(t, 1, len(prog.Exprs))
+	})
+
+	t.Run("noManifest", func(t *testing.T) {
+		prog, err := parseProgram(t, "(+ 1 2)\n;; gl: {\"timeout\": \"5s\"}")
+		require.NoError(t, err)
+		require.Equal(t, time.Duration(0), prog.Manifest.Timeout)
+		require.Equal(t, 0, len(prog.Manifest.Raw))
+	})
+
+	t.Run("invalidManifest", func(t *testing.T) {
+		_, err := parseProgram(t, ";; gl: {\"timeout\": \n(+ 1 2)")
+		require.IsType(t, (*ParseError)(nil), err)
+		_, err = parseProgram(t, ";; gl: {\"timeout\": \"soon\"}\n(+ 1 2)")
+		require.IsType(t, (*ParseError)(nil), err)
+		_, err = parseProgram(t, ";; gl: {\"permissions\": [1]}\n(+ 1 2)")
+		require.IsType(t, (*ParseError)(nil), err)
+	})
+
+	t.Run("eval", func(t *testing.T) {
+		prog, err := parseProgram(t, "(let x 2)\n(+ x 3)")
+		require.NoError(t, err)
+		v, err := prog.Eval(BuiltinContext().SubContext(nil))
+		require.NoError(t, err)
+		assertNumValue(t, v, 5)
+	})
+
+	t.Run("keepGoing", func(t *testing.T) {
+		prog, err := parseProgram(t, `
+(let checked 0)
+(car 1)
+(set! checked (+ checked 1))
+(cdr 2)
+(set! checked (+ checked 1))`)
+		require.NoError(t, err)
+
+		ec := BuiltinContext().SubContext(nil)
+		_, err = prog.Eval(ec)
+		require.Error(t, err)
+		_, isMulti := err.(*MultiError)
+		require.False(t, isMulti)
+		checked, _ := ec.Resolve("checked")
+		assertNumValue(t, checked, 0)
+
+		prog.KeepGoing = true
+		ec = BuiltinContext().SubContext(nil)
+		_, err = prog.Eval(ec)
+		asMulti, isMulti := err.(*MultiError)
+		require.True(t, isMulti)
+		require.Len(t, asMulti.Errs, 2)
+		checked, _ = ec.Resolve("checked")
+		assertNumValue(t, checked, 2)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		prog, err := parseProgram(t, `
+;; gl: {"timeout": "10ms"}
+(while true nil)`)
+		require.NoError(t, err)
+		ec := BuiltinContext().SubContext(nil)
+		_, err = prog.Eval(ec)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "deadline exceeded")
+		require.Equal(t, context.Background(), ec.Context())
+	})
+
+	t.Run("concurrentTimeouts", func(t *testing.T) {
+		// each run's timeout applies to it alone; not to the shared context.
+		base := BuiltinContext()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				out, err := base.ExecString(";; gl: {\"timeout\": \"1s\"}\n(let x 1)\n(+ x 1)")
+				require.NoError(t, err)
+				require.Equal(t, "2", out)
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, context.Background(), base.Context())
+	})
+
+	t.Run("timeoutDefines", func(t *testing.T) {
+		prog, err := parseProgram(t, `
+;; gl: {"timeout": "1s"}
+(let defined 1)`)
+		require.NoError(t, err)
+		ec := BuiltinContext().SubContext(nil)
+		_, err = prog.Eval(ec)
+		require.NoError(t, err)
+		v, _ := ec.Resolve("defined")
+		assertNumValue(t, v, 1)
+	})
+}
+
+func Test_Script(t *testing.T) {
+
+	t.Run("run", func(t *testing.T) {
+		s, err := Compile(`(let total (* price qty)) (if (> total 100) "large" "small")`)
+		require.NoError(t, err)
+		v, err := s.Run(context.Background(), map[string]interface{}{"price": 30, "qty": 4})
+		require.NoError(t, err)
+		assertStringValue(t, v, "large")
+		v, err = s.Run(context.Background(), map[string]interface{}{"price": 30, "qty": 1})
+		require.NoError(t, err)
+		assertStringValue(t, v, "small")
+
+		_, err = s.Run(context.Background(), nil)
+		require.Error(t, err)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		s, err := Compile(`(defun sq (n) (* n n)) (let x (sq n)) x`)
+		require.NoError(t, err)
+		errs := make(chan error)
+		for i := 0; i < 20; i++ {
+			go func(i int) {
+				v, err := s.Run(context.Background(), map[string]interface{}{"n": i})
+				if err == nil && v.(*NumberValue).Val != float64(i*i) {
+					err = fmt.Errorf("expected %d; got %s", i*i, v.InspectStr())
+				}
+				errs <- err
+			}(i)
+		}
+		for i := 0; i < 20; i++ {
+			require.NoError(t, <-errs)
+		}
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		s, err := Compile(";; gl: {\"timeout\": \"10ms\"}\n(while true 1)")
+		require.NoError(t, err)
+		require.Equal(t, 10*time.Millisecond, s.Manifest().Timeout)
+		_, err = s.Run(context.Background(), nil)
+		require.Error(t, err)
+
+		_, err = Compile(`(+ 1`)
+		require.IsType(t, (*ParseError)(nil), err)
+	})
+}
@@ -0,0 +1,521 @@
+package golisp2
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Queries select values out of nested lists and maps; e.g.
+// `items[?price > 10].name` is the name of each item that costs more than 10.
+// A query is a path of steps, each applied to the result of the last:
+//
+//   - `name` or `.name` gets the field of a map or struct.
+//   - `[i]` gets an element of a list; negative indices count from the end.
+//   - `[*]` projects each element of a list, or each value of a map.
+//   - `[?cond]` projects each element that matches the condition.
+//
+// After a projection, the remaining steps are applied to each projected value,
+// and the query returns a list of those that aren't nil. Projections are
+// flattened, rather than nested. Otherwise, the query returns a single value;
+// nil if there's nothing at the path.
+//
+// Conditions compare paths relative to the element (`price`, `dims.w`, or `@`
+// for the element itself) with each other or with literal numbers, strings
+// (quoted with ' or "), true, false and nil; using ==, !=, <, <=, > and >=.
+// They can be combined with &&, || and parentheses. A path on its own tests
+// that the value isn't nil or false.
+
+type (
+	// query is a parsed query.
+	query struct {
+		steps []queryStep
+	}
+
+	// queryStep is a single step of a query path.
+	queryStep struct {
+		kind  queryStepKind
+		field string
+		index int
+		cond  queryCond
+	}
+
+	queryStepKind int
+
+	// queryCond is the condition of a filter step.
+	queryCond interface {
+		test(v Value) bool
+	}
+
+	// queryOperand is one side of a comparison.
+	queryOperand interface {
+		value(v Value) Value
+	}
+
+	queryCompare struct {
+		op          string
+		left, right queryOperand
+	}
+
+	queryTruthy struct {
+		operand queryOperand
+	}
+
+	queryAnd struct {
+		left, right queryCond
+	}
+
+	queryOr struct {
+		left, right queryCond
+	}
+
+	queryPath struct {
+		steps []queryStep
+	}
+
+	queryLiteral struct {
+		v Value
+	}
+
+	// queryParser parses a query from its source.
+	queryParser struct {
+		src string
+		pos int
+	}
+)
+
+const (
+	fieldQueryStep queryStepKind = iota
+	indexQueryStep
+	wildcardQueryStep
+	filterQueryStep
+)
+
+// queryFn selects values out of the data with a query. See query.
+func queryFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var data Value
+	var src *StringValue
+	err := ArgMapperValues(vals...).
+		ReadValue(&data).
+		ReadString(&src).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	q, err := parseQuery(src.Val)
+	if err != nil {
+		return nil, err
+	}
+	return q.eval(data), nil
+}
+
+// parseQuery parses the query source.
+func parseQuery(src string) (*query, error) {
+	p := &queryParser{src: src}
+	steps, err := p.path(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected '%c'", p.src[p.pos])
+	}
+	return &query{steps: steps}, nil
+}
+
+// eval applies the query to the data.
+func (q *query) eval(data Value) Value {
+	vals := []Value{data}
+	projected := false
+	for _, step := range q.steps {
+		next := []Value{}
+		for _, v := range vals {
+			switch step.kind {
+			case fieldQueryStep:
+				next = append(next, queryField(v, step.field))
+			case indexQueryStep:
+				next = append(next, queryIndex(v, step.index))
+			case wildcardQueryStep:
+				next = append(next, queryElems(v)...)
+			case filterQueryStep:
+				for _, elem := range queryElems(v) {
+					if step.cond.test(elem) {
+						next = append(next, elem)
+					}
+				}
+			}
+		}
+		if step.kind == wildcardQueryStep || step.kind == filterQueryStep {
+			projected = true
+		}
+		if projected {
+			kept := next[:0]
+			for _, v := range next {
+				if _, isNil := v.(*NilValue); !isNil {
+					kept = append(kept, v)
+				}
+			}
+			next = kept
+		}
+		vals = next
+	}
+	if projected {
+		return &ListValue{
+			Vals: vals,
+		}
+	}
+	return vals[0]
+}
+
+// queryField returns the field of a map or struct, or nil if there isn't one.
+func queryField(v Value, name string) Value {
+	switch tV := v.(type) {
+	case *MapValue:
+		if fieldV, ok := tV.Vals[name]; ok {
+			return fieldV
+		}
+	case *StructValue:
+		for i, f := range tV.Type.Fields {
+			if f == name {
+				return tV.Vals[i]
+			}
+		}
+	}
+	return Nil
+}
+
+// queryIndex returns the element of a list, or nil if there isn't one.
+func queryIndex(v Value, i int) Value {
+	asList, isList := v.(*ListValue)
+	if !isList {
+		return Nil
+	}
+	if i < 0 {
+		i += len(asList.Vals)
+	}
+	if i < 0 || i >= len(asList.Vals) {
+		return Nil
+	}
+	return asList.Vals[i]
+}
+
+// queryElems returns the elements of a list, or the values of a map in the
+// order of their keys.
+func queryElems(v Value) []Value {
+	switch tV := v.(type) {
+	case *ListValue:
+		return tV.Vals
+	case *MapValue:
+		keys := make([]string, 0, len(tV.Vals))
+		for k := range tV.Vals {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		elems := make([]Value, 0, len(keys))
+		for _, k := range keys {
+			elems = append(elems, tV.Vals[k])
+		}
+		return elems
+	default:
+		return nil
+	}
+}
+
+func (qc *queryCompare) test(v Value) bool {
+	l, r := qc.left.value(v), qc.right.value(v)
+	switch qc.op {
+	case "==":
+		return valuesEqual(l, r)
+	case "!=":
+		return !valuesEqual(l, r)
+	}
+	var cmp int
+	lNum, lIsNum := l.(*NumberValue)
+	rNum, rIsNum := r.(*NumberValue)
+	lStr, lIsStr := l.(*StringValue)
+	rStr, rIsStr := r.(*StringValue)
+	switch {
+	case lIsNum && rIsNum:
+		if lNum.Val < rNum.Val {
+			cmp = -1
+		} else if lNum.Val > rNum.Val {
+			cmp = 1
+		}
+	case lIsStr && rIsStr:
+		cmp = strings.Compare(lStr.Val, rStr.Val)
+	default:
+		// values of different types aren't ordered.
+		return false
+	}
+	switch qc.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func (qt *queryTruthy) test(v Value) bool {
+	switch tV := qt.operand.value(v).(type) {
+	case *NilValue:
+		return false
+	case *BoolValue:
+		return tV.Val
+	default:
+		return true
+	}
+}
+
+func (qa *queryAnd) test(v Value) bool {
+	return qa.left.test(v) && qa.right.test(v)
+}
+
+func (qo *queryOr) test(v Value) bool {
+	return qo.left.test(v) || qo.right.test(v)
+}
+
+func (qp *queryPath) value(v Value) Value {
+	return (&query{steps: qp.steps}).eval(v)
+}
+
+func (ql *queryLiteral) value(v Value) Value {
+	return ql.v
+}
+
+// path parses a sequence of steps. Projections are only allowed at the top
+// level; not within conditions.
+func (p *queryParser) path(allowProjections bool) ([]queryStep, error) {
+	steps := []queryStep{}
+	p.skipSpace()
+	if p.peekIdentStart() {
+		steps = append(steps, queryStep{kind: fieldQueryStep, field: p.ident()})
+	}
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '.':
+			p.pos++
+			if !p.peekIdentStart() {
+				return nil, p.errorf("expected a field name")
+			}
+			steps = append(steps, queryStep{kind: fieldQueryStep, field: p.ident()})
+		case '[':
+			p.pos++
+			step, err := p.bracket(allowProjections)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		default:
+			return steps, nil
+		}
+	}
+	return steps, nil
+}
+
+// bracket parses the step within brackets, where the open bracket has already
+// been consumed.
+func (p *queryParser) bracket(allowProjections bool) (queryStep, error) {
+	p.skipSpace()
+	var step queryStep
+	switch {
+	case p.pos < len(p.src) && (p.src[p.pos] == '*' || p.src[p.pos] == '?'):
+		if !allowProjections {
+			return step, p.errorf("projections can't be used in conditions")
+		}
+		if p.src[p.pos] == '*' {
+			p.pos++
+			step.kind = wildcardQueryStep
+		} else {
+			p.pos++
+			cond, err := p.or()
+			if err != nil {
+				return step, err
+			}
+			step.kind, step.cond = filterQueryStep, cond
+		}
+	default:
+		start := p.pos
+		if p.pos < len(p.src) && p.src[p.pos] == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		i, err := strconv.Atoi(p.src[start:p.pos])
+		if err != nil {
+			p.pos = start
+			return step, p.errorf("expected an index, '*' or '?'")
+		}
+		step.kind, step.index = indexQueryStep, i
+	}
+	p.skipSpace()
+	if !p.consume("]") {
+		return step, p.errorf("expected ']'")
+	}
+	return step, nil
+}
+
+func (p *queryParser) or() (queryCond, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("||"); p.skipSpace() {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) and() (queryCond, error) {
+	left, err := p.compare()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpace(); p.consume("&&"); p.skipSpace() {
+		right, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) compare() (queryCond, error) {
+	p.skipSpace()
+	if p.consume("(") {
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return cond, nil
+	}
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			right, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return &queryCompare{op: op, left: left, right: right}, nil
+		}
+	}
+	return &queryTruthy{operand: left}, nil
+}
+
+func (p *queryParser) operand() (queryOperand, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("expected a value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '@':
+		p.pos++
+		if p.peekIdentStart() {
+			return nil, p.errorf("expected '.' or '[' after '@'")
+		}
+		steps, err := p.path(false)
+		if err != nil {
+			return nil, err
+		}
+		return &queryPath{steps: steps}, nil
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(p.src[p.pos+1:], c)
+		if end < 0 {
+			return nil, p.errorf("unterminated string")
+		}
+		s := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return &queryLiteral{v: &StringValue{Val: s}}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' ||
+			(p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number")
+		}
+		return &queryLiteral{v: &NumberValue{Val: f}}, nil
+	case p.peekIdentStart():
+		start := p.pos
+		switch p.ident() {
+		case "true":
+			return &queryLiteral{v: True}, nil
+		case "false":
+			return &queryLiteral{v: False}, nil
+		case "nil":
+			return &queryLiteral{v: Nil}, nil
+		}
+		p.pos = start
+		steps, err := p.path(false)
+		if err != nil {
+			return nil, err
+		}
+		return &queryPath{steps: steps}, nil
+	default:
+		return nil, p.errorf("unexpected '%c'", c)
+	}
+}
+
+// ident consumes a field name.
+func (p *queryParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c != '_' && c != '-' && !(c >= 'a' && c <= 'z') &&
+			!(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// peekIdentStart indicates if a field name starts at the current position.
+func (p *queryParser) peekIdentStart() bool {
+	if p.pos >= len(p.src) {
+		return false
+	}
+	c := p.src[p.pos]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// consume advances past the string if it's at the current position.
+func (p *queryParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid query '%s' at offset %d: %s",
+		p.src, p.pos, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,44 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_query(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `
+		(defstruct dims w h)
+		(let data (map
+			"store" "north"
+			"items" (list
+				(map "name" "pen" "price" 2 "tags" (list "office"))
+				(map "name" "lamp" "price" 12 "dims" (dims 3 4))
+				(map "name" "desk" "price" 150 "dims" (dims 20 10) "sale" true))))`)
+	query := func(q string) string {
+		t.Helper()
+		return evalStrInContext(t, ec, `(query data "`+q+`")`).InspectStr()
+	}
+
+	require.Equal(t, `"north"`, query("store"))
+	require.Equal(t, `nil`, query("missing.field"))
+	require.Equal(t, `"pen"`, query("items[0].name"))
+	require.Equal(t, `"desk"`, query("items[-1].name"))
+	require.Equal(t, `nil`, query("items[3]"))
+	require.Equal(t, `"office"`, query("items[0].tags[0]"))
+
+	require.Equal(t, `["pen" "lamp" "desk"]`, query("items[*].name"))
+	require.Equal(t, `[3 20]`, query("items[*].dims.w"))
+	require.Equal(t, `["lamp" "desk"]`, query("items[?price>10].name"))
+	require.Equal(t, `["lamp"]`, query("items[?price > 10 && price < 100].name"))
+	require.Equal(t, `["pen" "desk"]`, query("items[?name == 'pen' || sale].name"))
+	require.Equal(t, `["desk"]`, query("items[?(dims.w >= 10) && sale == true].name"))
+	require.Equal(t, `["office"]`, query("items[*].tags[*]"))
+	require.Equal(t, `["office"]`, query("items[0].tags[?@ == 'office']"))
+
+	for _, bad := range []string{"items[", "items[?price >]", "items[x]", "a..b", "items[?@name]"} {
+		err := evalStrInContextToErr(t, ec, `(query data "`+bad+`")`)
+		require.Contains(t, err.Error(), "invalid query '"+bad+"'")
+	}
+}
@@ -3,6 +3,7 @@ package golisp2
 import (
 	"bufio"
 	"io"
+	"unicode/utf8"
 )
 
 type (
@@ -12,16 +13,48 @@ type (
 		r   rune
 		pos ScannerPosition
 		buf *bufio.Reader
+
+		// text retains what has been read of the source, so errors can quote it.
+		// See Quote.
+		text *sourceText
+
+		// registered indicates text is retained in a SourceRegistry, so all of it
+		// must be kept.
+		registered bool
+
+		// started indicates the first rune has been read.
+		started bool
+
+		// lenientEncoding passes invalid UTF-8 through as replacement runes, rather
+		// than failing the scan.
+		lenientEncoding bool
+
+		// tabWidth is the number of columns a tab advances to the next stop.
+		tabWidth int
+
+		// offset is the byte offset of the next rune to be read.
+		offset int
 	}
 
 	// ScannerPosition contains location information for runes and tokens.
 	ScannerPosition struct {
-		SourceFile string
-		Col, Row   int
+		SourceFile string `json:"file"`
+		Col        int    `json:"col"`
+		Row        int    `json:"row"`
+
+		// Offset is the byte offset from the start of the source.
+		Offset int `json:"offset"`
+	}
+
+	// SourceSpan is the extent of a token or expression in the source. End is
+	// the position just past its last rune.
+	SourceSpan struct {
+		Start, End ScannerPosition
 	}
 )
 
-// NewRuneScanner initializes a RuneScanner around the given string.
+// NewRuneScanner initializes a RuneScanner around the given string. The source
+// text is retained by the scanner as it is read, so errors can quote it.
 func NewRuneScanner(srcName string, src io.Reader) *RuneScanner {
 	return &RuneScanner{
 		buf: bufio.NewReader(src),
@@ -29,6 +62,64 @@ func NewRuneScanner(srcName string, src io.Reader) *RuneScanner {
 			SourceFile: srcName,
 			Row:        1,
 		},
+		text:     newSourceText(srcName),
+		tabWidth: 1,
+	}
+}
+
+// SetSourceRegistry also retains the scanned text in the registry, under the
+// source's name, so it can be looked up later. All of it is then kept, for as
+// long as the registry is. Should be called before the first call to Advance.
+func (rs *RuneScanner) SetSourceRegistry(sr *SourceRegistry) {
+	if sr == nil {
+		return
+	}
+	sr.register(rs.text)
+	rs.registered = true
+}
+
+// Quote adds an excerpt of the source to the error, showing where it occurred,
+// if it's a positioned error from this source and the scanner still retains
+// the line; as is its message if it's a MultiError. Errors read by the scanner
+// are quoted already. Returns the error, for convenience.
+//
+// The scanner retains all of the source it has read, unless it's read by an
+// ExprScanner; which only keeps the lines of the last expression it returned,
+// so long running streams don't grow without bound.
+func (rs *RuneScanner) Quote(err error) error {
+	quoteError(err, rs.text.lookup)
+	return err
+}
+
+// forgetBefore discards the retained source before the given row, unless
+// it's retained in a registry.
+func (rs *RuneScanner) forgetBefore(row int) {
+	if rs.text != nil && !rs.registered {
+		rs.text.forgetBefore(row)
+	}
+}
+
+// SetLenientEncoding controls how invalid UTF-8 in the source is handled. By
+// default, it fails the scan with a ForbiddenRuneError. If lenient, each invalid
+// byte is instead read as the replacement rune U+FFFD. Should be called before
+// the first call to Advance.
+func (rs *RuneScanner) SetLenientEncoding(lenient bool) {
+	rs.lenientEncoding = lenient
+}
+
+// SetTabWidth sets how many columns a tab counts for in reported positions; a
+// tab moves the column to the next multiple of the width. Defaults to 1, where
+// tabs are counted like any other rune. Should be called before the first call
+// to Advance.
+func (rs *RuneScanner) SetTabWidth(width int) {
+	if width < 1 {
+		width = 1
+	}
+	rs.tabWidth = width
+	if rs.text != nil {
+		rs.text.mu.Lock()
+		rs.text.tabWidth = width
+		rs.text.mu.Unlock()
 	}
 }
 
@@ -42,30 +133,78 @@ func (rs *RuneScanner) Advance() {
 	if rs.err != nil {
 		return
 	}
-	r, _, err := rs.buf.ReadRune()
+	r, size, err := rs.buf.ReadRune()
+	if !rs.started {
+		rs.started = true
+		// A leading byte order mark is written by some editors; it's not part of
+		// the source.
+		if err == nil && r == '\uFEFF' {
+			rs.offset += size
+			r, size, err = rs.buf.ReadRune()
+		}
+	}
 	if err != nil {
 		rs.err = err
 		rs.r = 0
 		return
 	}
 
-	if rs.r == '\n' {
+	switch rs.r {
+	case '\n':
 		rs.pos.Row++
 		rs.pos.Col = 1
-	} else {
+	case '\t':
+		rs.pos.Col += rs.tabWidth - (rs.pos.Col-1)%rs.tabWidth
+	default:
 		rs.pos.Col++
 	}
+	rs.pos.Offset = rs.offset
+	rs.offset += size
+
+	// A windows line ending is read as a single newline, so it doesn't count
+	// towards the column of anything.
+	if r == '\r' {
+		if next, nextSize, nextErr := rs.buf.ReadRune(); nextErr == nil {
+			if next == '\n' {
+				r = next
+				rs.offset += nextSize
+			} else {
+				rs.buf.UnreadRune()
+			}
+		}
+	}
 
 	// note (bs): consider expanding the range of forbidden runes. Other things
 	// like replacement chars and certain control characters can cause trouble as
 	// well.
 	if r == 0 {
 		rs.r = 0
-		rs.err = NewForbiddenRuneError(r, rs.pos)
+		rs.err = rs.Quote(NewForbiddenRuneError(r, rs.pos))
+		return
+	}
+	if r == utf8.RuneError && size == 1 && !rs.lenientEncoding {
+		rs.r = 0
+		rs.err = rs.Quote(&ForbiddenRuneError{
+			R:       r,
+			Pos:     rs.pos,
+			Invalid: true,
+		})
 		return
 	}
 
 	rs.r = r
+	if rs.text != nil {
+		rs.text.WriteRune(r)
+	}
+}
+
+// drainLine reads the remainder of the current line, so the retained text
+// contains the whole of it. Used when scanning is abandoned part way through a
+// line, e.g. on a parse error.
+func (rs *RuneScanner) drainLine() {
+	for !rs.Done() && rs.r != '\n' {
+		rs.Advance()
+	}
 }
 
 // Pos returns the current location of the scanner relative to it's source.
@@ -40,6 +40,59 @@ func Test_RuneScanner(t *testing.T) {
 		require.Equal(t, io.EOF, rs.Err())
 	})
 
+	t.Run("tabWidth", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("a\tb\t\tc"))
+		rs.SetTabWidth(4)
+		expected := []struct {
+			r   rune
+			col int
+		}{
+			{'a', 1},
+			{'\t', 2},
+			{'b', 5},
+			{'\t', 6},
+			{'\t', 9},
+			{'c', 13},
+		}
+		for _, e := range expected {
+			rs.Advance()
+			require.Equal(t, e.r, rs.Rune())
+			require.Equal(t, e.col, rs.Pos().Col)
+		}
+	})
+
+	t.Run("crlf", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("a\r\nb\rc"))
+		expected := []struct {
+			r                rune
+			col, row, offset int
+		}{
+			{'a', 1, 1, 0},
+			{'\n', 2, 1, 1},
+			{'b', 1, 2, 3},
+			{'\r', 2, 2, 4},
+			{'c', 3, 2, 5},
+		}
+		for _, e := range expected {
+			rs.Advance()
+			require.Equal(t, e.r, rs.Rune())
+			require.Equal(t, e.col, rs.Pos().Col)
+			require.Equal(t, e.row, rs.Pos().Row)
+			require.Equal(t, e.offset, rs.Pos().Offset)
+		}
+		rs.Advance()
+		require.True(t, rs.Done())
+	})
+
+	t.Run("byteOffsets", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("\uFEFFé😊x"))
+		offsets := []int{3, 5, 9}
+		for _, o := range offsets {
+			rs.Advance()
+			require.Equal(t, o, rs.Pos().Offset)
+		}
+	})
+
 	t.Run("forbiddenChar", func(t *testing.T) {
 		rs := NewRuneScanner(fName, strings.NewReader("\x00abc"))
 		rs.Advance()
@@ -53,4 +106,48 @@ func Test_RuneScanner(t *testing.T) {
 			Row:        1,
 		}, asForbidden.Pos)
 	})
+
+	t.Run("byteOrderMark", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("\uFEFFab\uFEFF"))
+		rs.Advance()
+		require.Equal(t, 'a', rs.Rune())
+		require.Equal(t, 1, rs.Pos().Col)
+		rs.Advance()
+		require.Equal(t, 'b', rs.Rune())
+
+		// only a leading mark is skipped.
+		rs.Advance()
+		require.Equal(t, '\uFEFF', rs.Rune())
+	})
+
+	t.Run("invalidEncoding", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("ab\xffc"))
+		rs.Advance()
+		rs.Advance()
+		require.NoError(t, rs.Err())
+		rs.Advance()
+		asForbidden, isForbidden := rs.Err().(*ForbiddenRuneError)
+		require.True(t, isForbidden)
+		require.True(t, asForbidden.Invalid)
+		require.Equal(t, 3, asForbidden.Pos.Col)
+		require.Contains(t, asForbidden.Error(), "Invalid UTF-8")
+	})
+
+	t.Run("replacementRune", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("\uFFFD"))
+		rs.Advance()
+		require.NoError(t, rs.Err())
+		require.Equal(t, '\uFFFD', rs.Rune())
+	})
+
+	t.Run("lenientEncoding", func(t *testing.T) {
+		rs := NewRuneScanner(fName, strings.NewReader("a\xffc"))
+		rs.SetLenientEncoding(true)
+		rs.Advance()
+		rs.Advance()
+		require.NoError(t, rs.Err())
+		require.Equal(t, '\uFFFD', rs.Rune())
+		rs.Advance()
+		require.Equal(t, 'c', rs.Rune())
+	})
 }
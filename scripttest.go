@@ -0,0 +1,129 @@
+package golisp2
+
+import (
+	"fmt"
+)
+
+type (
+	// ScriptTest is a test declared in a script with deftest.
+	ScriptTest struct {
+		Name string
+		Body []Expr
+		Pos  ScannerPosition
+	}
+
+	// ScriptTestResult is the outcome of running a script test. Err is nil if
+	// the test passed.
+	ScriptTestResult struct {
+		Name string
+		Pos  ScannerPosition
+		Err  error
+	}
+)
+
+// addScriptTest registers a test declared by deftest.
+func (ec *EvalContext) addScriptTest(t ScriptTest) {
+	env := ec.environ()
+	env.tests = append(env.tests, t)
+}
+
+// ScriptTests returns the tests that have been declared in the context.
+func (ec *EvalContext) ScriptTests() []ScriptTest {
+	return append([]ScriptTest{}, ec.environ().tests...)
+}
+
+// RunScriptTests runs each test the expressions declare, and returns their
+// results in the order they were declared.
+//
+// Tests are isolated from one another: each runs in a new context from
+// newContext, after the expressions have been evaluated in it afresh. Fails if
+// evaluating the expressions does, as no test could then be run.
+func RunScriptTests(
+	exprs []Expr, newContext func() *EvalContext,
+) ([]ScriptTestResult, error) {
+	setup := func() (*EvalContext, []ScriptTest, error) {
+		ec := newContext()
+		for _, e := range exprs {
+			if _, err := e.Eval(ec); err != nil {
+				return nil, nil, err
+			}
+		}
+		return ec, ec.ScriptTests(), nil
+	}
+
+	ec, tests, err := setup()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ScriptTestResult, 0, len(tests))
+	for i, t := range tests {
+		if i > 0 {
+			var setupTests []ScriptTest
+			ec, setupTests, err = setup()
+			if err != nil {
+				return nil, err
+			}
+			if len(setupTests) != len(tests) {
+				return nil, fmt.Errorf("tests were declared inconsistently between runs")
+			}
+		}
+		results = append(results, ScriptTestResult{
+			Name: t.Name,
+			Pos:  t.Pos,
+			Err:  runScriptTest(ec, t),
+		})
+	}
+	return results, nil
+}
+
+// runScriptTest evaluates the body of the test in a sub context.
+func runScriptTest(ec *EvalContext, t ScriptTest) error {
+	sub := ec.SubContext(nil)
+	for _, e := range t.Body {
+		if _, err := e.Eval(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assertEqFn fails unless the two values are equal. Lists, maps and structs are
+// compared by their contents.
+func assertEqFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var actual, expected Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&actual).
+		ReadValue(&expected).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if !valuesEqual(actual, expected) {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("assertion failed: expected %s; got %s",
+				InspectBounded(expected, DefaultInspectOptions),
+				InspectBounded(actual, DefaultInspectOptions)),
+			Pos: ec.CallPos(),
+		}
+	}
+	return Nil, nil
+}
+
+// assertTrueFn fails unless the value is true.
+func assertTrueFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var v Value
+	err := ArgMapperValues(vals...).
+		ReadValue(&v).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	if asBool, isBool := v.(*BoolValue); !isBool || !asBool.Val {
+		return nil, &EvalError{
+			Msg: fmt.Sprintf("assertion failed: expected true; got %s",
+				InspectBounded(v, DefaultInspectOptions)),
+			Pos: ec.CallPos(),
+		}
+	}
+	return Nil, nil
+}
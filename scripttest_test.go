@@ -0,0 +1,67 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_assertions(t *testing.T) {
+	assertNilValue(t, evalStrToVal(t, `(assertEq (list 1 "a" (list true)) (list 1 "a" (list true)))`))
+	assertNilValue(t, evalStrToVal(t, `(assertEq (map "a" 1) (map "a" 1))`))
+	assertNilValue(t, evalStrToVal(t, `(assertTrue (== 1 1))`))
+
+	err := evalStrToErr(t, `(assertEq (list 1 2) (list 1 3))`)
+	require.Contains(t, err.Error(), "assertion failed: expected [1 3]; got [1 2]")
+	err = evalStrToErr(t, `(assertTrue 1)`)
+	require.Contains(t, err.Error(), "assertion failed: expected true; got 1")
+
+	assertStringValue(t,
+		evalStrToVal(t, `(assertError (car 1))`),
+		evalStrToErr(t, `(car 1)`).Error())
+	err = evalStrToErr(t, `(assertError (+ 1 2))`)
+	require.Contains(t, err.Error(), "assertion failed: expected an error; got 3")
+
+	parseStrToErr(t, `(assertError)`)
+	parseStrToErr(t, `(deftest)`)
+	parseStrToErr(t, `(deftest 1 (assertTrue true))`)
+}
+
+func Test_RunScriptTests(t *testing.T) {
+	src := `
+		(let counter 0)
+		(deftest increments
+			(set! counter (+ counter 1))
+			(assertEq counter 1))
+		(deftest "is isolated"
+			(set! counter (+ counter 1))
+			(assertEq counter 1))
+		(deftest fails
+			(assertEq counter 2))`
+	ts := NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(src)))
+	exprs, err := ParseTokens(ts)
+	require.NoError(t, err)
+
+	results, err := RunScriptTests(exprs, func() *EvalContext {
+		return BuiltinContext().SubContext(nil)
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, "increments", results[0].Name)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "is isolated", results[1].Name)
+	require.NoError(t, results[1].Err)
+	require.Equal(t, "fails", results[2].Name)
+	require.Equal(t, 9, results[2].Pos.Row)
+	require.Error(t, results[2].Err)
+	require.Contains(t, results[2].Err.Error(), "expected 2; got 0")
+
+	ts = NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(`(car 1 2)`)))
+	exprs, err = ParseTokens(ts)
+	require.NoError(t, err)
+	_, err = RunScriptTests(exprs, func() *EvalContext {
+		return BuiltinContext().SubContext(nil)
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package golisp2
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// shutdownHandler is a function registered with onShutdown, along with the
+// context it was registered in.
+type shutdownHandler struct {
+	fn *FuncValue
+	ec *EvalContext
+}
+
+// Shutdown runs the handlers scripts registered with onShutdown, most recently
+// registered first, and then forgets them. Hosts should call it once a run
+// ends; including when it's been cancelled, e.g. on SIGTERM.
+//
+// The handlers run in a context that expires after the timeout, so one that
+// hangs is halted rather than blocking shutdown. Every handler is run even if
+// some fail; their errors are returned together.
+func (ec *EvalContext) Shutdown(timeout time.Duration) error {
+	env := ec.environ()
+	env.shutdownMu.Lock()
+	handlers := env.shutdownHandlers
+	env.shutdownHandlers = nil
+	env.shutdownMu.Unlock()
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	// the run's own context is likely cancelled already, so the
+	// handlers get a fresh one. It's set on the handlers' own contexts rather
+	// than the shared environment, which goroutines the run started may still
+	// be reading.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := []error{}
+	for i := len(handlers) - 1; i >= 0; i-- {
+		h := handlers[i]
+		handlerEc := h.ec.SubContext(nil)
+		handlerEc.ctx = ctx
+		if _, err := handlerEc.callValue(h.fn); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown handler failed: %w", err))
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return &MultiError{Errs: errs}
+	}
+}
+
+// onShutdownFn registers a function to be run when the host shuts down the
+// run. See EvalContext.Shutdown.
+func onShutdownFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	env := ec.environ()
+	env.shutdownMu.Lock()
+	defer env.shutdownMu.Unlock()
+	env.shutdownHandlers = append(env.shutdownHandlers, shutdownHandler{
+		fn: asFn,
+		ec: ec,
+	})
+	return Nil, nil
+}
@@ -0,0 +1,69 @@
+package golisp2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Shutdown(t *testing.T) {
+
+	t.Run("handlers", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		ec.SetContext(ctx)
+		evalStrInContext(t, ec, `
+			(let order nil)
+			(onShutdown (fn () (set! order (cons "first" order))))
+			(onShutdown (fn () (set! order (cons "second" order))))`)
+		cancel()
+
+		require.NoError(t, ec.Shutdown(time.Second))
+		order, _ := ec.Resolve("order")
+		require.Equal(t, `("first" "second")`, order.InspectStr())
+		require.Equal(t, ctx, ec.Context())
+
+		// handlers only run once.
+		evalStrInContext(t, ec, `(set! order nil)`)
+		require.NoError(t, ec.Shutdown(time.Second))
+		order, _ = ec.Resolve("order")
+		assertNilValue(t, order)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `
+			(let ran false)
+			(onShutdown (fn () (set! ran true)))
+			(onShutdown (fn () (car 1)))`)
+		err := ec.Shutdown(time.Second)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "shutdown handler failed")
+		ran, _ := ec.Resolve("ran")
+		assertBoolValue(t, ran, true)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ec := BuiltinContext().SubContext(nil)
+		evalStrInContext(t, ec, `(onShutdown (fn () (while true nil)))`)
+		err := ec.Shutdown(10 * time.Millisecond)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "deadline exceeded")
+	})
+
+	t.Run("runContext", func(t *testing.T) {
+		// handlers run after the run's context is cancelled, without changing it
+		// for anything else still running.
+		runCtx, cancelRun := context.WithCancel(context.Background())
+		ec := BuiltinContext().SubContext(nil)
+		ec.SetContext(runCtx)
+		evalStrInContext(t, ec, `(let ran false) (onShutdown (fn () (sleep 1) (set! ran true)))`)
+		cancelRun()
+		require.NoError(t, ec.Shutdown(time.Second))
+		require.Equal(t, runCtx, ec.Context())
+		v, _ := ec.Resolve("ran")
+		assertBoolValue(t, v, true)
+	})
+}
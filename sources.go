@@ -0,0 +1,261 @@
+package golisp2
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type (
+	// SourceRegistry retains the text of scanned sources, keyed by source name,
+	// so hosts can look up their lines later. Scanners only record into one if
+	// it's set with RuneScanner.SetSourceRegistry. It is safe for concurrent use.
+	SourceRegistry struct {
+		mu    sync.RWMutex
+		files map[string]*sourceText
+	}
+
+	// sourceText is the text of a single source, by line, from firstRow up to
+	// as far as it has been read by a scanner.
+	sourceText struct {
+		mu sync.Mutex
+
+		// name is the name of the source, which positions in it are reported
+		// with.
+		name string
+
+		// firstRow is the row of the first of lines.
+		firstRow int
+
+		// lines are the complete lines read, without their line endings.
+		lines []string
+
+		// cur is the line being read.
+		cur strings.Builder
+
+		// tabWidth is the tab width the scanner reported columns with.
+		tabWidth int
+	}
+
+	// sourceQuoter is implemented by errors that can quote the source they
+	// occurred at in their message. quotedSpan returns the span of source the
+	// error occurred at, and the excerpt of it the error holds.
+	sourceQuoter interface {
+		quotedSpan() (SourceSpan, *string)
+	}
+)
+
+// NewSourceRegistry creates an empty source registry.
+func NewSourceRegistry() *SourceRegistry {
+	return &SourceRegistry{
+		files: map[string]*sourceText{},
+	}
+}
+
+// Line returns the given line (1-indexed) of the named source, if it has been
+// retained.
+func (sr *SourceRegistry) Line(srcName string, row int) (string, bool) {
+	return sr.text(srcName).line(row)
+}
+
+// Excerpt returns the line of source the position refers to, followed by a
+// caret under the position's column. Returns an empty string if the source
+// isn't known.
+func (sr *SourceRegistry) Excerpt(pos ScannerPosition) string {
+	return sr.ExcerptSpan(SourceSpan{Start: pos})
+}
+
+// ExcerptSpan is like Excerpt, but underlines the whole span rather than just
+// marking its start. A span running past the end of its first line is
+// underlined to the end of that line.
+func (sr *SourceRegistry) ExcerptSpan(span SourceSpan) string {
+	return sr.text(span.Start.SourceFile).excerptSpan(span)
+}
+
+// text returns the retained text of the named source; nil if there is none.
+func (sr *SourceRegistry) text(srcName string) *sourceText {
+	if sr == nil {
+		return nil
+	}
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return sr.files[srcName]
+}
+
+// Quote adds an excerpt of the source to the error where it occurred, like
+// RuneScanner.Quote, if the source is retained in the registry. Returns the
+// error, for convenience.
+func (sr *SourceRegistry) Quote(err error) error {
+	quoteError(err, sr.text)
+	return err
+}
+
+// register retains the text under its name, replacing anything previously
+// retained under it.
+func (sr *SourceRegistry) register(text *sourceText) {
+	sr.mu.Lock()
+	sr.files[text.name] = text
+	sr.mu.Unlock()
+}
+
+// newSourceText creates an empty source text, for a scanner to write to.
+func newSourceText(name string) *sourceText {
+	return &sourceText{
+		name:     name,
+		firstRow: 1,
+		tabWidth: 1,
+	}
+}
+
+// sourceTextOf creates a source text holding the whole of src.
+func sourceTextOf(name, src string) *sourceText {
+	st := newSourceText(name)
+	for _, r := range src {
+		st.WriteRune(r)
+	}
+	return st
+}
+
+// lookup returns the text if it's of the named source; nil if not.
+func (st *sourceText) lookup(srcName string) *sourceText {
+	if st == nil || st.name != srcName {
+		return nil
+	}
+	return st
+}
+
+// WriteRune appends the rune to the retained text.
+func (st *sourceText) WriteRune(r rune) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if r == '\n' {
+		st.lines = append(st.lines, strings.TrimSuffix(st.cur.String(), "\r"))
+		st.cur.Reset()
+		return
+	}
+	st.cur.WriteRune(r)
+}
+
+// forgetBefore discards the lines before the given row.
+func (st *sourceText) forgetBefore(row int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	n := row - st.firstRow
+	if n <= 0 {
+		return
+	}
+	if n > len(st.lines) {
+		n = len(st.lines)
+	}
+	st.lines = append([]string{}, st.lines[n:]...)
+	st.firstRow += n
+}
+
+// line returns the given line (1-indexed) of the text, if it's retained.
+func (st *sourceText) line(row int) (string, bool) {
+	if st == nil {
+		return "", false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	i := row - st.firstRow
+	switch {
+	case i < 0 || i > len(st.lines):
+		return "", false
+	case i == len(st.lines):
+		return strings.TrimSuffix(st.cur.String(), "\r"), true
+	default:
+		return st.lines[i], true
+	}
+}
+
+// excerptSpan returns the line of the text the span starts on, followed by a
+// line underlining the span; or an empty string if the line isn't retained.
+func (st *sourceText) excerptSpan(span SourceSpan) string {
+	pos := span.Start
+	if st == nil {
+		return ""
+	}
+	line, hasLine := st.line(pos.Row)
+	if !hasLine {
+		return ""
+	}
+	endCol := pos.Col + 1
+	if span.End.Row > pos.Row {
+		endCol = utf8.RuneCountInString(line) + 1
+	} else if span.End.Row == pos.Row && span.End.Col > endCol {
+		endCol = span.End.Col
+	}
+	st.mu.Lock()
+	tabWidth := st.tabWidth
+	st.mu.Unlock()
+	var caret strings.Builder
+	col, marked := 1, false
+	for _, r := range line {
+		if col >= endCol {
+			break
+		}
+		var mark rune
+		switch {
+		case col >= pos.Col && !marked:
+			mark, marked = '^', true
+		case col >= pos.Col:
+			mark = '~'
+		case r == '\t':
+			// keep tabs so the caret lines up regardless of the reader's tab width.
+			mark = '\t'
+		default:
+			mark = ' '
+		}
+		if r == '\t' {
+			col += tabWidth - (col-1)%tabWidth
+		} else {
+			col++
+		}
+		caret.WriteRune(mark)
+	}
+	if !marked {
+		if col < pos.Col {
+			// the position is past the end of the line, so the text must be of a
+			// different source with the same name.
+			return ""
+		}
+		caret.WriteRune('^')
+	}
+	return "\n\t" + line + "\n\t" + caret.String()
+}
+
+// quoteString adds an excerpt of src, the source of the given name, to the
+// error where it occurred. Returns the error.
+func quoteString(err error, name, src string) error {
+	if err != nil {
+		quoteError(err, sourceTextOf(name, src).lookup)
+	}
+	return err
+}
+
+// quoteError adds an excerpt of the source to the error, and each of the
+// errors in it if it's a MultiError, where they occurred. text returns the
+// retained text of the named source, if any. Errors that already hold an
+// excerpt are left as they are.
+func quoteError(err error, text func(srcName string) *sourceText) {
+	if err == nil {
+		return
+	}
+	var multi *MultiError
+	if errors.As(err, &multi) {
+		for _, e := range multi.Errs {
+			quoteError(e, text)
+		}
+		return
+	}
+	var quoter sourceQuoter
+	if !errors.As(err, &quoter) {
+		return
+	}
+	span, excerpt := quoter.quotedSpan()
+	if *excerpt == "" {
+		*excerpt = text(span.Start.SourceFile).excerptSpan(span)
+	}
+}
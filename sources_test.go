@@ -0,0 +1,127 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SourceRegistry(t *testing.T) {
+
+	scanAll := func(rs *RuneScanner) {
+		for !rs.Done() {
+			rs.Advance()
+		}
+	}
+
+	t.Run("line", func(t *testing.T) {
+		sr := NewSourceRegistry()
+		rs := NewRuneScanner("lines.l", strings.NewReader("(a)\r\n(b c)\n"))
+		rs.SetSourceRegistry(sr)
+		scanAll(rs)
+
+		l1, hasL1 := sr.Line("lines.l", 1)
+		require.True(t, hasL1)
+		require.Equal(t, "(a)", l1)
+		l2, hasL2 := sr.Line("lines.l", 2)
+		require.True(t, hasL2)
+		require.Equal(t, "(b c)", l2)
+		_, hasL4 := sr.Line("lines.l", 4)
+		require.False(t, hasL4)
+		_, hasOther := sr.Line("other.l", 1)
+		require.False(t, hasOther)
+	})
+
+	t.Run("excerpt", func(t *testing.T) {
+		sr := NewSourceRegistry()
+		rs := NewRuneScanner("excerpt.l", strings.NewReader("(a)\n\t(b c)"))
+		rs.SetSourceRegistry(sr)
+		scanAll(rs)
+
+		require.Equal(t, "\n\t\t(b c)\n\t\t  ^", sr.Excerpt(ScannerPosition{
+			SourceFile: "excerpt.l",
+			Row:        2,
+			Col:        4,
+		}))
+		require.Equal(t, "", sr.Excerpt(ScannerPosition{
+			SourceFile: "unknown.l",
+			Row:        1,
+			Col:        1,
+		}))
+	})
+
+	t.Run("excerptTabWidth", func(t *testing.T) {
+		sr := NewSourceRegistry()
+		rs := NewRuneScanner("tabs.l", strings.NewReader("\t(b c)"))
+		rs.SetSourceRegistry(sr)
+		rs.SetTabWidth(4)
+		scanAll(rs)
+
+		require.Equal(t, "\n\t\t(b c)\n\t\t  ^", sr.Excerpt(ScannerPosition{
+			SourceFile: "tabs.l",
+			Row:        1,
+			Col:        7,
+		}))
+	})
+
+	t.Run("excerptSpan", func(t *testing.T) {
+		sr := NewSourceRegistry()
+		rs := NewRuneScanner("span.l", strings.NewReader("(abc d)\n(e\n f)"))
+		rs.SetSourceRegistry(sr)
+		scanAll(rs)
+		pos := func(row, col int) ScannerPosition {
+			return ScannerPosition{SourceFile: "span.l", Row: row, Col: col}
+		}
+
+		require.Equal(t, "\n\t(abc d)\n\t ^~~", sr.ExcerptSpan(SourceSpan{
+			Start: pos(1, 2),
+			End:   pos(1, 5),
+		}))
+		require.Equal(t, "\n\t(e\n\t^~", sr.ExcerptSpan(SourceSpan{
+			Start: pos(2, 1),
+			End:   pos(3, 4),
+		}))
+		require.Equal(t, sr.Excerpt(pos(1, 6)), sr.ExcerptSpan(SourceSpan{
+			Start: pos(1, 6),
+		}))
+	})
+
+	t.Run("quote", func(t *testing.T) {
+		rs := NewRuneScanner("quote.l", strings.NewReader("(a)\n(fail \"x\")"))
+		exprs, err := ParseTokens(NewTokenScanner(rs))
+		require.NoError(t, err)
+		_, err = exprs[1].Eval(BuiltinContext())
+		require.NotContains(t, err.Error(), "(fail")
+		require.Contains(t, rs.Quote(err).Error(), "\n\t(fail \"x\")\n\t^")
+
+		// errors from other sources aren't quoted.
+		other := &EvalError{Msg: "x", Pos: ScannerPosition{SourceFile: "other.l", Row: 2, Col: 1}}
+		require.NotContains(t, rs.Quote(other).Error(), "(fail")
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		// an ExprScanner only retains the expression it last read.
+		rs := NewRuneScanner("stream.l", strings.NewReader("(a)\n(b\n c)\n(d)"))
+		es := NewExprScanner(NewTokenScanner(rs))
+		for i := 0; i < 2; i++ {
+			_, err := es.Next()
+			require.NoError(t, err)
+		}
+		_, hasA := rs.text.line(1)
+		require.False(t, hasA)
+		b, hasB := rs.text.line(2)
+		require.True(t, hasB)
+		require.Equal(t, "(b", b)
+	})
+
+	t.Run("scoped", func(t *testing.T) {
+		// sources of the same name don't share text; each position quotes the
+		// source it was scanned from.
+		_, errA := ParseString("same.l", "(a)\n(b")
+		_, errB := ParseString("same.l", "(c)\n(d e")
+		require.Contains(t, errA.Error(), "(b")
+		require.NotContains(t, errA.Error(), "(d e")
+		require.Contains(t, errB.Error(), "(d e")
+	})
+}
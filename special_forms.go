@@ -0,0 +1,174 @@
+package golisp2
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+type (
+	// SpecialFormParser parses a special form: an expression the parser handles
+	// itself, rather than as a function call. It's called with the scanner at
+	// the form's name, just past the open paren, and must read up to and
+	// including the close paren. See ParseFormArgs for parsing the usual case.
+	SpecialFormParser func(ts *TokenScanner) (Expr, error)
+
+	// SpecialFormRegistry holds the special forms a parse recognizes, by name.
+	// Their names are reserved words, which can't be bound as identifiers. It
+	// is safe for concurrent use.
+	SpecialFormRegistry struct {
+		mu    sync.RWMutex
+		forms map[string]SpecialFormParser
+	}
+)
+
+// DefaultSpecialForms is the registry new token scanners parse with. Forms
+// registered in it are available to every parse that doesn't use a registry of
+// its own.
+var DefaultSpecialForms *SpecialFormRegistry
+
+func init() {
+	// set here rather than in its declaration, as parsing the forms
+	// refers back to it.
+	DefaultSpecialForms = NewSpecialFormRegistry()
+}
+
+// NewSpecialFormRegistry creates a registry of the built-in special forms;
+// e.g. if, fn and let.
+func NewSpecialFormRegistry() *SpecialFormRegistry {
+	return &SpecialFormRegistry{
+		forms: map[string]SpecialFormParser{
+			"if":          tryParseIfTail,
+			"fn":          tryParseFnTail,
+			"let":         tryParseLetTail,
+			"let*":        tryParseLetTail,
+			"letValues":   tryParseLetValuesTail,
+			"set!":        tryParseSetTail,
+			"cond":        tryParseCondTail,
+			"when":        tryParseWhenTail,
+			"unless":      tryParseWhenTail,
+			"while":       tryParseWhileTail,
+			"for":         tryParseForTail,
+			"dotimes":     tryParseForTail,
+			"defun":       tryParseDefunTail,
+			"defstruct":   tryParseDefStructTail,
+			"time":        tryParseTimeTail,
+			"deftest":     tryParseDefTestTail,
+			"assertError": tryParseAssertErrorTail,
+			"go":          tryParseGoTail,
+			"return":      tryParseReturnTail,
+			"break":       tryParseBreakTail,
+			"continue":    tryParseBreakTail,
+			":":           tryParseMethodCallTail,
+			"defgeneric":  tryParseDefGenericTail,
+			"defmethod":   tryParseDefMethodTail,
+			"import":      tryParseImportTail,
+		},
+	}
+}
+
+// Register adds a special form. Returns an error if a form of the name already
+// exists; the built-in forms can't be replaced.
+func (r *SpecialFormRegistry) Register(name string, parse SpecialFormParser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.forms[name]; exists {
+		return fmt.Errorf("special form '%s' is already registered", name)
+	}
+	r.forms[name] = parse
+	return nil
+}
+
+// lookup returns the parser of the named form, if there is one.
+func (r *SpecialFormRegistry) lookup(name string) (SpecialFormParser, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	parse, ok := r.forms[name]
+	return parse, ok
+}
+
+// literalWords are the idents the parser reads as literal values.
+var literalWords = map[string]bool{
+	"nil": true, "true": true, "false": true,
+}
+
+// ReservedWords returns the words that can't be bound as identifiers, in
+// sorted order: the names of the special forms, and the literals nil, true and
+// false. It's meant for tooling, like highlighters and completion.
+func (r *SpecialFormRegistry) ReservedWords() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	words := make([]string, 0, len(r.forms)+len(literalWords))
+	for word := range r.forms {
+		if word != ":" {
+			words = append(words, word)
+		}
+	}
+	for word := range literalWords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// IsReservedWord returns whether the word is reserved. See ReservedWords.
+func (r *SpecialFormRegistry) IsReservedWord(word string) bool {
+	_, isForm := r.lookup(word)
+	return isForm || literalWords[word]
+}
+
+// ReservedWords returns the reserved words of DefaultSpecialForms.
+func ReservedWords() []string {
+	return DefaultSpecialForms.ReservedWords()
+}
+
+// IsReservedWord returns whether the word is reserved in DefaultSpecialForms.
+func IsReservedWord(word string) bool {
+	return DefaultSpecialForms.IsReservedWord(word)
+}
+
+// ParseFormArgs parses the rest of a special form, for forms that take a list
+// of expressions: its name, each of the expressions, and the close paren. It's
+// meant to be used by a SpecialFormParser.
+func ParseFormArgs(ts *TokenScanner) (ScannedToken, []Expr, error) {
+	maybeNameToken := ts.Token()
+	if maybeNameToken == nil {
+		return ScannedToken{}, nil, NewParseEOFError("parse ended in special form", ts.Pos())
+	}
+	nameToken := *maybeNameToken
+	ts.Advance()
+	exprs, err := maybeParseExprs(ts)
+	if err != nil {
+		return ScannedToken{}, nil, err
+	}
+	if err := expectCallClose(ts); err != nil {
+		return ScannedToken{}, nil, err
+	}
+	return nameToken, exprs, nil
+}
+
+// tryParseImportTail reports that import isn't supported yet. It's reserved so
+// that scripts don't come to depend on binding it.
+func tryParseImportTail(ts *TokenScanner) (Expr, error) {
+	return nil, NewParseError("import is not supported", *ts.Token())
+}
+
+// checkBindable returns a parse error if the token is a reserved word, which
+// the form can't bind.
+func checkBindable(ts *TokenScanner, token ScannedToken, form string) error {
+	if !ts.specialForms().IsReservedWord(token.Value) {
+		return nil
+	}
+	return NewParseError(
+		fmt.Sprintf("%s cannot bind '%s'; it's a reserved word", form, token.Value), token)
+}
+
+// tokenOfIdent returns the token the ident was parsed from.
+func tokenOfIdent(il *IdentLiteral) ScannedToken {
+	return ScannedToken{
+		Typ:   IdentTT,
+		Value: il.Val,
+		Pos:   il.Pos,
+		End:   il.End,
+	}
+}
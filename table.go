@@ -0,0 +1,441 @@
+package golisp2
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// newTableFromMaps creates a table with a row for each map. The columns are
+// every key used by any of the maps, in sorted order; rows that lack a column
+// have nil for it.
+func newTableFromMaps(maps []*MapValue) *TableValue {
+	seen := map[string]bool{}
+	cols := []string{}
+	for _, m := range maps {
+		for k := range m.Vals {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	rows := make([][]Value, 0, len(maps))
+	for _, m := range maps {
+		row := make([]Value, len(cols))
+		for i, c := range cols {
+			if v, ok := m.Vals[c]; ok {
+				row[i] = v
+			} else {
+				row[i] = Nil
+			}
+		}
+		rows = append(rows, row)
+	}
+	return &TableValue{
+		Columns: cols,
+		Rows:    rows,
+	}
+}
+
+// column returns the index of the named column, or an error if the table
+// doesn't have it.
+func (tv *TableValue) column(name string) (int, error) {
+	for i, c := range tv.Columns {
+		if c == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("table has no column '%s'; columns are %s",
+		name, strings.Join(tv.Columns, ", "))
+}
+
+// rowMap returns the i-th row as a map from column to value.
+func (tv *TableValue) rowMap(i int) *MapValue {
+	vals := make(map[string]Value, len(tv.Columns))
+	for j, c := range tv.Columns {
+		vals[c] = tv.Rows[i][j]
+	}
+	return &MapValue{
+		Vals: vals,
+	}
+}
+
+// tableFn creates a table from a list of maps. See newTableFromMaps.
+func tableFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asList *ListValue
+	err := ArgMapperValues(vals...).
+		ReadList(&asList).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	maps := make([]*MapValue, 0, len(asList.Vals))
+	for _, v := range asList.Vals {
+		asMap, isMap := v.(*MapValue)
+		if !isMap {
+			return nil, fmt.Errorf("table expects a list of maps; got %s", TypeName(v))
+		}
+		maps = append(maps, asMap)
+	}
+	return newTableFromMaps(maps), nil
+}
+
+// tableRowsFn returns the rows of a table as a list of maps.
+func tableRowsFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var t *TableValue
+	err := ArgMapperValues(vals...).
+		ReadTable(&t).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]Value, 0, len(t.Rows))
+	for i := range t.Rows {
+		rows = append(rows, t.rowMap(i))
+	}
+	return &ListValue{
+		Vals: rows,
+	}, nil
+}
+
+// tableSelectFn returns a table of just the given columns, in the order given.
+func tableSelectFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var t *TableValue
+	var cols []*StringValue
+	err := ArgMapperValues(vals...).
+		ReadTable(&t).
+		ReadStrings(&cols).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	idxs := make([]int, 0, len(cols))
+	names := make([]string, 0, len(cols))
+	for _, c := range cols {
+		i, err := t.column(c.Val)
+		if err != nil {
+			return nil, err
+		}
+		idxs = append(idxs, i)
+		names = append(names, c.Val)
+	}
+	rows := make([][]Value, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		row := make([]Value, 0, len(idxs))
+		for _, i := range idxs {
+			row = append(row, r[i])
+		}
+		rows = append(rows, row)
+	}
+	return &TableValue{
+		Columns: names,
+		Rows:    rows,
+	}, nil
+}
+
+// tableWhereFn returns a table of the rows the function returns true for. The
+// function is passed each row as a map.
+func tableWhereFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var t *TableValue
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadTable(&t).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	rows := [][]Value{}
+	for i, r := range t.Rows {
+		v, err := ec.callValue(asFn, t.rowMap(i))
+		if err != nil {
+			return nil, err
+		}
+		asBool, isBool := v.(*BoolValue)
+		if !isBool {
+			return nil, fmt.Errorf("tableWhere function must return a bool; got %s",
+				TypeName(v))
+		}
+		if asBool.Val {
+			rows = append(rows, r)
+		}
+	}
+	return &TableValue{
+		Columns: t.Columns,
+		Rows:    rows,
+	}, nil
+}
+
+// tableJoinFn returns the inner join of two tables on a column they share:
+// a row for each pair of rows that have equal values in it. The columns are
+// those of the left table, followed by the others of the right; which must not
+// share any names.
+func tableJoinFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var left, right *TableValue
+	var col *StringValue
+	err := ArgMapperValues(vals...).
+		ReadTable(&left).
+		ReadTable(&right).
+		ReadString(&col).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	leftI, err := left.column(col.Val)
+	if err != nil {
+		return nil, err
+	}
+	rightI, err := right.column(col.Val)
+	if err != nil {
+		return nil, err
+	}
+	cols := append([]string{}, left.Columns...)
+	for i, c := range right.Columns {
+		if i == rightI {
+			continue
+		}
+		if _, err := left.column(c); err == nil {
+			return nil, fmt.Errorf("tableJoin tables both have column '%s'", c)
+		}
+		cols = append(cols, c)
+	}
+
+	rows := [][]Value{}
+	for _, l := range left.Rows {
+		for _, r := range right.Rows {
+			if !valuesEqual(l[leftI], r[rightI]) {
+				continue
+			}
+			row := append(make([]Value, 0, len(cols)), l...)
+			row = append(row, r[:rightI]...)
+			row = append(row, r[rightI+1:]...)
+			rows = append(rows, row)
+		}
+	}
+	return &TableValue{
+		Columns: cols,
+		Rows:    rows,
+	}, nil
+}
+
+// tableGroupFn groups the rows of a table by the value of a column, and
+// aggregates each group. The aggregates are a map from the name of a result
+// column to a function, which is passed the rows of the group as a list of
+// maps. The result has a row per group, in the order they first appear, with
+// the grouped column followed by the aggregate columns.
+func tableGroupFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var t *TableValue
+	var col *StringValue
+	var aggs *MapValue
+	err := ArgMapperValues(vals...).
+		ReadTable(&t).
+		ReadString(&col).
+		ReadMap(&aggs).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	colI, err := t.column(col.Val)
+	if err != nil {
+		return nil, err
+	}
+	aggNames := sortedKeys(aggs.Vals)
+	aggFns := make([]*FuncValue, 0, len(aggNames))
+	for _, name := range aggNames {
+		asFn, isFn := aggs.Vals[name].(*FuncValue)
+		if !isFn {
+			return nil, fmt.Errorf("tableGroup aggregate '%s' must be a func; got %s",
+				name, TypeName(aggs.Vals[name]))
+		}
+		aggFns = append(aggFns, asFn)
+	}
+
+	// groups are keyed by their inspected value, as values can't be
+	// map keys themselves.
+	type group struct {
+		key  Value
+		rows []Value
+	}
+	groups := []*group{}
+	byKey := map[string]*group{}
+	for i, r := range t.Rows {
+		k := TypeName(r[colI]) + ":" + r[colI].InspectStr()
+		g, found := byKey[k]
+		if !found {
+			g = &group{key: r[colI]}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.rows = append(g.rows, t.rowMap(i))
+	}
+
+	rows := make([][]Value, 0, len(groups))
+	for _, g := range groups {
+		row := []Value{g.key}
+		for _, fn := range aggFns {
+			v, err := ec.callValue(fn, &ListValue{Vals: g.rows})
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	return &TableValue{
+		Columns: append([]string{col.Val}, aggNames...),
+		Rows:    rows,
+	}, nil
+}
+
+// tableSortByFn returns the table sorted by a column; descending if the
+// optional third argument is true. Numbers and strings are sorted by value;
+// nils first, and otherwise by type.
+func tableSortByFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var t *TableValue
+	var col *StringValue
+	var maybeDesc Value
+	err := ArgMapperValues(vals...).
+		ReadTable(&t).
+		ReadString(&col).
+		MaybeReadValue(&maybeDesc).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	colI, err := t.column(col.Val)
+	if err != nil {
+		return nil, err
+	}
+	desc := false
+	if maybeDesc != nil {
+		asBool, isBool := maybeDesc.(*BoolValue)
+		if !isBool {
+			return nil, fmt.Errorf("tableSortBy expects a bool; got %s", TypeName(maybeDesc))
+		}
+		desc = asBool.Val
+	}
+
+	rows := append([][]Value{}, t.Rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		if desc {
+			return compareSortValues(rows[j][colI], rows[i][colI]) < 0
+		}
+		return compareSortValues(rows[i][colI], rows[j][colI]) < 0
+	})
+	return &TableValue{
+		Columns: t.Columns,
+		Rows:    rows,
+	}, nil
+}
+
+// compareSortValues orders two values for sorting. Numbers and strings compare
+// by value; otherwise, nils come first and the rest are ordered by type.
+func compareSortValues(a, b Value) int {
+	switch tA := a.(type) {
+	case *NumberValue:
+		if tB, isNum := b.(*NumberValue); isNum {
+			switch {
+			case tA.Val < tB.Val:
+				return -1
+			case tA.Val > tB.Val:
+				return 1
+			default:
+				return 0
+			}
+		}
+	case *StringValue:
+		if tB, isStr := b.(*StringValue); isStr {
+			return strings.Compare(tA.Val, tB.Val)
+		}
+	case *TimeValue:
+		if tB, isTime := b.(*TimeValue); isTime {
+			switch {
+			case tA.Val.Before(tB.Val):
+				return -1
+			case tA.Val.After(tB.Val):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	_, aIsNil := a.(*NilValue)
+	_, bIsNil := b.(*NilValue)
+	switch {
+	case aIsNil && bIsNil:
+		return 0
+	case aIsNil:
+		return -1
+	case bIsNil:
+		return 1
+	default:
+		return strings.Compare(TypeName(a), TypeName(b))
+	}
+}
+
+// tableFromCSVFn parses CSV text into a table. The first record is the header.
+// Fields that are numbers become numbers, and empty fields become nil.
+func tableFromCSVFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var src *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&src).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	records, err := csv.NewReader(strings.NewReader(src.Val)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("tableFromCSV could not parse CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return &TableValue{Columns: []string{}, Rows: [][]Value{}}, nil
+	}
+	rows := make([][]Value, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		row := make([]Value, 0, len(rec))
+		for _, field := range rec {
+			if field == "" {
+				row = append(row, Nil)
+			} else if f, err := strconv.ParseFloat(field, 64); err == nil {
+				row = append(row, &NumberValue{Val: f})
+			} else {
+				row = append(row, &StringValue{Val: field})
+			}
+		}
+		rows = append(rows, row)
+	}
+	return &TableValue{
+		Columns: records[0],
+		Rows:    rows,
+	}, nil
+}
+
+// tableFromJSONFn parses JSON text, which must be an array of objects, into a
+// table. See newTableFromMaps.
+func tableFromJSONFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var src *StringValue
+	err := ArgMapperValues(vals...).
+		ReadString(&src).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	var data []map[string]interface{}
+	if err := json.Unmarshal([]byte(src.Val), &data); err != nil {
+		return nil, fmt.Errorf("tableFromJSON expects an array of objects: %w", err)
+	}
+	maps := make([]*MapValue, 0, len(data))
+	for _, obj := range data {
+		v, err := valueFromJSONData(obj)
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, v.(*MapValue))
+	}
+	return newTableFromMaps(maps), nil
+}
@@ -0,0 +1,56 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_table(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `
+		(let people (table (list
+			(map "name" "ann" "dept" "eng" "age" 41)
+			(map "name" "bob" "dept" "ops" "age" 29)
+			(map "name" "cat" "dept" "eng"))))
+		(let nl (charFromCode 10))
+		(let depts (tableFromCSV (concat "dept,floor" nl "eng,3" nl "ops,1" nl)))`)
+	eval := func(src string) string {
+		t.Helper()
+		return evalStrInContext(t, ec, src).InspectStr()
+	}
+
+	require.Equal(t,
+		`table[age dept name][41 "eng" "ann"][29 "ops" "bob"][nil "eng" "cat"]`,
+		eval(`people`))
+	require.Equal(t, `3`, eval(`(len people)`))
+	require.Equal(t, `true`, eval(`(isTable people)`))
+	require.Equal(t, `{ age:41 dept:"eng" name:"ann" }`, eval(`(car (cellsFromList (tableRows people)))`))
+
+	require.Equal(t, `table[name age]["ann" 41]["bob" 29]["cat" nil]`,
+		eval(`(tableSelect people "name" "age")`))
+	require.Equal(t, `table[age dept name][41 "eng" "ann"]`,
+		eval(`(tableWhere people (fn (r) (if (isNil (mapGet r "age")) false (> (mapGet r "age") 30))))`))
+	require.Equal(t, `table[age dept name][nil "eng" "cat"][29 "ops" "bob"][41 "eng" "ann"]`,
+		eval(`(tableSortBy people "age")`))
+	require.Equal(t, `table[age dept name][41 "eng" "ann"][29 "ops" "bob"][nil "eng" "cat"]`,
+		eval(`(tableSortBy people "age" true)`))
+	require.Equal(t, `table[age dept name floor][41 "eng" "ann" 3][29 "ops" "bob" 1][nil "eng" "cat" 3]`,
+		eval(`(tableJoin people depts "dept")`))
+	require.Equal(t, `table[dept count]["eng" 2]["ops" 1]`,
+		eval(`(tableGroup people "dept" (map "count" len))`))
+
+	fromJSON, err := tableFromJSONFn(ec, &StringValue{Val: `[{"a": 1, "b": "x"}, {"b": true}]`})
+	require.NoError(t, err)
+	require.Equal(t, `table[a b][1 "x"][nil true]`, fromJSON.InspectStr())
+	data, err := MarshalValueJSON(fromJSON)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"a": 1, "b": "x"}, {"a": null, "b": true}]`, string(data))
+
+	err = evalStrInContextToErr(t, ec, `(tableSelect people "height")`)
+	require.Contains(t, err.Error(), "table has no column 'height'; columns are age, dept, name")
+	err = evalStrInContextToErr(t, ec, `(tableJoin people people "name")`)
+	require.Contains(t, err.Error(), "tableJoin tables both have column 'age'")
+	err = evalStrInContextToErr(t, ec, `(table (list 1))`)
+	require.Contains(t, err.Error(), "table expects a list of maps; got number")
+}
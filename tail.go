@@ -0,0 +1,123 @@
+package golisp2
+
+// tailWalker collects the call expressions in tail position.
+type tailWalker struct {
+	calls []*CallExpr
+}
+
+// TailCalls returns the call expressions of the program that are in tail
+// position, in source order. A call is in tail position if the function it's in
+// returns its result as is, with nothing left to evaluate: it's the last
+// expression of the function's body, the value of a return, or the last
+// expression of an if, cond, when, unless or block let that is itself in tail
+// position.
+//
+// Calls outside of any function are never in tail position. A recursive
+// function whose recursive calls are all tail calls can be rewritten as a loop.
+func TailCalls(exprs []Expr) []*CallExpr {
+	tw := &tailWalker{}
+	tw.exprs(exprs, false)
+	return tw.calls
+}
+
+// exprs walks each of the expressions; none are in tail position.
+func (tw *tailWalker) exprs(exprs []Expr, inFn bool) {
+	for _, e := range exprs {
+		tw.expr(e, false, inFn)
+	}
+}
+
+// body walks a sequence of expressions, where only the last is in tail position
+// if the body is.
+func (tw *tailWalker) body(body []Expr, tail, inFn bool) {
+	for i, e := range body {
+		tw.expr(e, tail && i == len(body)-1, inFn)
+	}
+}
+
+// expr walks the expression, and any it contains. tail indicates whether the
+// expression is in tail position, and inFn whether it's within a function.
+func (tw *tailWalker) expr(e Expr, tail, inFn bool) {
+	switch tE := e.(type) {
+	case *CallExpr:
+		if tail && len(tE.Exprs) > 0 {
+			tw.calls = append(tw.calls, tE)
+		}
+		tw.exprs(tE.Exprs, inFn)
+
+	case *IfExpr:
+		tw.expr(tE.Cond, false, inFn)
+		tw.expr(tE.Case1, tail, inFn)
+		if tE.Case2 != nil {
+			tw.expr(tE.Case2, tail, inFn)
+		}
+
+	case *CondExpr:
+		for _, clause := range tE.Clauses {
+			if clause.Test != nil {
+				tw.expr(clause.Test, false, inFn)
+			}
+			tw.body(clause.Body, tail, inFn)
+		}
+
+	case *WhenExpr:
+		tw.expr(tE.Cond, false, inFn)
+		tw.body(tE.Body, tail, inFn)
+
+	case *WhileExpr:
+		tw.expr(tE.Cond, false, inFn)
+		tw.exprs(tE.Body, inFn)
+
+	case *ForExpr:
+		tw.expr(tE.Binding.Value, false, inFn)
+		tw.exprs(tE.Body, inFn)
+
+	case *DoTimesExpr:
+		tw.expr(tE.Binding.Value, false, inFn)
+		tw.exprs(tE.Body, inFn)
+
+	case *FnExpr:
+		tw.body(tE.Body, true, true)
+
+	case *LetExpr:
+		tw.expr(tE.Value, false, inFn)
+
+	case *BlockLetExpr:
+		for _, b := range tE.Bindings {
+			tw.expr(b.Value, false, inFn)
+		}
+		tw.body(tE.Body, tail, inFn)
+
+	case *LetValuesExpr:
+		tw.expr(tE.Value, false, inFn)
+		tw.body(tE.Body, tail, inFn)
+
+	case *SetExpr:
+		tw.expr(tE.Value, false, inFn)
+
+	case *TimeExpr:
+		tw.expr(tE.Expr, false, inFn)
+
+	case *DefTestExpr:
+		tw.exprs(tE.Body, false)
+
+	case *AssertErrorExpr:
+		tw.expr(tE.Expr, false, inFn)
+
+	case *ReturnExpr:
+		if tE.Expr != nil {
+			tw.expr(tE.Expr, inFn, inFn)
+		}
+
+	case *GoExpr:
+		// a return can't pass out of a goroutine.
+		tw.expr(tE.Expr, false, false)
+
+	case *MethodCallExpr:
+		tw.expr(tE.Object, false, inFn)
+		tw.exprs(tE.Args, inFn)
+
+	case *DefMethodExpr:
+		tw.expr(tE.Fn, false, inFn)
+	}
+}
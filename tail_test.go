@@ -0,0 +1,55 @@
+package golisp2
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TailCalls(t *testing.T) {
+
+	tailCallStrs := func(t *testing.T, src string) []string {
+		t.Helper()
+		exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("testfile", strings.NewReader(src))))
+		require.NoError(t, err)
+		strs := []string{}
+		for _, ce := range TailCalls(exprs) {
+			strs = append(strs, ce.Exprs[0].CodeStr())
+		}
+		return strs
+	}
+
+	t.Run("branches", func(t *testing.T) {
+		require.Equal(t, []string{"g", "f"}, tailCallStrs(t, `
+			(defun f (n)
+				(print n)
+				(if (< n 1) (g n) (f (- n 1))))`))
+		require.Equal(t, []string{"a", "b", "c", "d"}, tailCallStrs(t, `
+			(fn (x)
+				(cond
+					((== x 1) (a))
+					(else (b))))
+			(fn (x) (when x (c)))
+			(fn (x) (let ((y (e))) (d x)))`))
+	})
+
+	t.Run("notTail", func(t *testing.T) {
+		require.Empty(t, tailCallStrs(t, `(f (g 1))`))
+		require.Equal(t, []string{"+"}, tailCallStrs(t, `(fn (x) (+ 1 (f x)))`))
+		require.Equal(t, []string{"print"}, tailCallStrs(t, `
+			(fn (x)
+				(while (f x) (g x))
+				(time (h x))
+				(go (return (k x)))
+				(print 1))`))
+	})
+
+	t.Run("return", func(t *testing.T) {
+		require.Equal(t, []string{"f", "g"}, tailCallStrs(t, `
+			(fn ()
+				(dotimes (i 2) (return (f 1)))
+				(g 2))`))
+		require.Empty(t, tailCallStrs(t, `(return (f 1))`))
+	})
+}
@@ -2,17 +2,60 @@ package golisp2
 
 import (
 	"unicode"
+	"unicode/utf8"
 )
 
 type (
 	// TokenScanner reads over an input source of characters, transforming them
-	// into tokens.
+	// into tokens. It can be used on it's own as a streaming lexer, independent
+	// of the parser.
+	//
+	// The scanner starts before the first token: Token is nil until Advance is
+	// first called. Each call to Advance moves to the next token, until the
+	// source is exhausted; then Token is nil and Done is true. Peek can be used
+	// to look at the next token without moving to it.
+	//
+	// Malformed input doesn't stop the scan: it's returned as an InvalidTT token,
+	// and scanning can continue after it. Failures reading the source do stop the
+	// scan, and are reported by Err.
+	//
+	// By default comments are skipped; see ScanComments.
 	TokenScanner struct {
 		done bool
 		t    *ScannedToken
 		st   *subTokenScanner
+		mode ScanMode
+
+		// peeked indicates next holds a token read ahead by Peek.
+		peeked bool
+		next   *ScannedToken
+
+		// header holds any comments that preceded the first token, and sawToken
+		// whether that first token has been reached.
+		header   []ScannedToken
+		sawToken bool
+
+		// depth counts the parens opened and not yet closed by the tokens
+		// advanced over.
+		depth int
+
+		// lastEnd is the end of the token most recently advanced past.
+		lastEnd ScannerPosition
+
+		// pending indicates Advance has been called, but the token it moves to
+		// hasn't been read yet. See resolve.
+		pending bool
+
+		// forms are the special forms parsed from the scanner; if nil,
+		// DefaultSpecialForms. ops likewise are the operators; if nil,
+		// DefaultOperators.
+		forms *SpecialFormRegistry
+		ops   *OperatorRegistry
 	}
 
+	// ScanMode is a set of flags that control what a TokenScanner emits.
+	ScanMode uint
+
 	// subTokenScanner is a private substructure for TokenScanner that does most
 	// of the work. It's responsible for buffering in-progress tokens.
 	subTokenScanner struct {
@@ -22,11 +65,28 @@ type (
 		// have not yet been turned into a token.
 		buf []byte
 
-		// startPos is the pos of the start of the buffer.
-		startPos ScannerPosition
+		// startPos is the pos of the start of the buffer, and endPos the pos
+		// just past its end.
+		startPos, endPos ScannerPosition
+
+		// maxLen is the longest a token can be, in bytes. Zero means no limit.
+		maxLen int
+
+		// err is set if the scan was stopped by a token exceeding maxLen.
+		err error
 	}
 )
 
+const (
+	// ScanComments makes the scanner emit comments as CommentTT tokens, rather
+	// than skipping them. Note the parser doesn't accept comment tokens.
+	ScanComments ScanMode = 1 << iota
+)
+
+// DefaultMaxTokenLen is the default limit on the length of a single token, in
+// bytes.
+const DefaultMaxTokenLen = 1 << 20
+
 // NewTokenScanner creates a new TokenScanner around the provided source.
 func NewTokenScanner(src *RuneScanner) *TokenScanner {
 	return &TokenScanner{
@@ -34,49 +94,163 @@ func NewTokenScanner(src *RuneScanner) *TokenScanner {
 	}
 }
 
+// SetMode changes what the scanner emits. Should be called before the first
+// call to Advance or Peek.
+func (ts *TokenScanner) SetMode(mode ScanMode) {
+	ts.mode = mode
+}
+
+// SetSpecialForms changes the special forms recognized when parsing from the
+// scanner. If nil, DefaultSpecialForms.
+func (ts *TokenScanner) SetSpecialForms(r *SpecialFormRegistry) {
+	ts.forms = r
+}
+
+// specialForms returns the special forms recognized when parsing from the
+// scanner.
+func (ts *TokenScanner) specialForms() *SpecialFormRegistry {
+	if ts.forms == nil {
+		return DefaultSpecialForms
+	}
+	return ts.forms
+}
+
+// SetOperators changes the operators recognized when parsing from the scanner.
+// If nil, DefaultOperators.
+func (ts *TokenScanner) SetOperators(r *OperatorRegistry) {
+	ts.ops = r
+}
+
+// operators returns the operators recognized when parsing from the scanner.
+func (ts *TokenScanner) operators() *OperatorRegistry {
+	if ts.ops == nil {
+		return DefaultOperators
+	}
+	return ts.ops
+}
+
+// SetMaxTokenLen limits how long a single token (e.g. a string literal) can be,
+// in bytes. A longer token stops the scan with a TokenLengthError, rather than
+// being buffered in full. Zero removes the limit. Defaults to
+// DefaultMaxTokenLen.
+func (ts *TokenScanner) SetMaxTokenLen(maxLen int) {
+	ts.st.maxLen = maxLen
+}
+
 // Done indicates if the underlying source has been exhausted, with no more
 // values to read.
 func (ts *TokenScanner) Done() bool {
+	ts.resolve()
 	return ts.done
 }
 
 // Err returns any error encountered while scanning the input. Will be io.EOF if
-// the scan completed the input.
+// the scan completed the input, and nil if it hasn't yet.
 func (ts *TokenScanner) Err() error {
+	ts.resolve()
+	if ts.st.err != nil {
+		return ts.st.err
+	}
 	return ts.st.src.Err()
 }
 
-// Pos returns the current location of the scan relative to it's source.
+// Pos returns the current location of the scan relative to it's source. Note
+// this is the location of the underlying source, which is past the current
+// token, and past any peeked token. Use the tokens' own positions to locate
+// them.
 func (ts *TokenScanner) Pos() ScannerPosition {
 	return ts.st.src.Pos()
 }
 
 // Advance will read in the next token into the scanner.
+//
+// The token is read lazily, when it's first asked for; so advancing past the
+// end of an expression doesn't wait on input that follows it. This matters
+// when the source is interactive, e.g. stdin.
 func (ts *TokenScanner) Advance() {
-	var maybeNextT *ScannedToken
-	for !ts.st.src.Done() {
-		maybeNextT = scanNextToken(ts.st)
-		if maybeNextT != nil && maybeNextT.Typ == CommentTT {
-			// skip comments; by definition they don't need to be parsed
-			continue
-		}
-		break
+	ts.resolve()
+	if ts.t != nil {
+		ts.lastEnd = ts.t.End
 	}
-	ts.t = maybeNextT
-	if maybeNextT == nil {
+	ts.pending = true
+}
+
+// resolve reads the token a pending Advance moves to.
+func (ts *TokenScanner) resolve() {
+	if !ts.pending {
+		return
+	}
+	ts.pending = false
+	if ts.peeked {
+		ts.t = ts.next
+		ts.peeked, ts.next = false, nil
+	} else {
+		ts.t = ts.scan()
+	}
+	if ts.t == nil {
 		ts.done = true
+		return
+	}
+	switch ts.t.Typ {
+	case OpenParenTT:
+		ts.depth++
+	case CloseParenTT:
+		ts.depth--
+	}
+}
+
+// Peek returns the token the next call to Advance will move to, without
+// moving to it. Will be nil if there are no more tokens.
+func (ts *TokenScanner) Peek() *ScannedToken {
+	ts.resolve()
+	if !ts.peeked {
+		ts.next = ts.scan()
+		ts.peeked = true
 	}
+	return ts.next
 }
 
 // Token returns the token currently read by the scanner. Will be nil if
-// `Advance` has never been called.
+// `Advance` has never been called, or if the source has been exhausted.
 func (ts *TokenScanner) Token() *ScannedToken {
+	ts.resolve()
 	return ts.t
 }
 
+// LeadingComments returns the comments that preceded the first token of the
+// source. They are retained regardless of the scan mode.
+func (ts *TokenScanner) LeadingComments() []ScannedToken {
+	return ts.header
+}
+
+// scan reads the next token from the source, handling comments as per the
+// mode. Returns nil once the source is exhausted.
+func (ts *TokenScanner) scan() *ScannedToken {
+	for !ts.st.Done() {
+		nextT := scanNextToken(ts.st)
+		if nextT == nil || ts.st.err != nil {
+			return nil
+		}
+		if nextT.Typ != CommentTT {
+			ts.sawToken = true
+			return nextT
+		}
+		// Comments before any code are retained, as they may contain the
+		// manifest.
+		if !ts.sawToken {
+			ts.header = append(ts.header, *nextT)
+		}
+		if ts.mode&ScanComments != 0 {
+			return nextT
+		}
+	}
+	return nil
+}
+
 func newSubTokenScanner(src *RuneScanner) *subTokenScanner {
 	return &subTokenScanner{
-		src: src,
+		src:    src,
+		maxLen: DefaultMaxTokenLen,
 	}
 }
 
@@ -85,7 +259,7 @@ func (ss *subTokenScanner) Done() bool {
 	// Particularly, what if the underlying stream is done but there's still a
 	// token prepped for grabbing? Need to make sure that I neither double-process
 	// or skip the last rune.
-	return ss.src.Done()
+	return ss.err != nil || ss.src.Done()
 }
 
 // Rune returns the current rune being scanned.
@@ -95,13 +269,25 @@ func (ss *subTokenScanner) Rune() rune {
 
 // Advance adds the current rune to the buffer, and moves to the next step.
 func (ss *subTokenScanner) Advance() {
-	if ss.src.Done() {
+	if ss.Done() {
 		return
 	}
 	if len(ss.buf) == 0 {
 		ss.startPos = ss.src.Pos()
 	}
-	ss.buf = append(ss.buf, []byte(string(ss.src.Rune()))...)
+	if ss.maxLen > 0 && len(ss.buf)+utf8.RuneLen(ss.src.Rune()) > ss.maxLen {
+		ss.err = ss.src.Quote(&TokenLengthError{
+			Max: ss.maxLen,
+			Pos: ss.startPos,
+		})
+		ss.buf = nil
+		return
+	}
+	r := ss.src.Rune()
+	ss.buf = append(ss.buf, []byte(string(r))...)
+	ss.endPos = ss.src.Pos()
+	ss.endPos.Col++
+	ss.endPos.Offset += utf8.RuneLen(r)
 	ss.src.Advance()
 }
 
@@ -122,6 +308,7 @@ func (ss *subTokenScanner) Complete(t TokenType) *ScannedToken {
 		Typ:   t,
 		Value: val,
 		Pos:   ss.startPos,
+		End:   ss.endPos,
 	}
 }
 
@@ -150,6 +337,8 @@ func scanNextToken(s *subTokenScanner) *ScannedToken {
 		return s.Complete(CloseParenTT)
 	} else if s.Rune() == ';' {
 		return tryLexComment(s)
+	} else if s.Rune() == ':' {
+		return tryLexKeyword(s)
 	} else if s.Rune() == '-' {
 		return tryLexSignedValue(s)
 	} else if isOperatorRune(s.Rune()) {
@@ -160,6 +349,8 @@ func scanNextToken(s *subTokenScanner) *ScannedToken {
 		return tryLexString(s)
 	} else if isIdentStartRune(s.Rune()) {
 		return tryLexIdent(s)
+	} else if isDecimalRune(s.Rune()) {
+		return tryLexDot(s)
 	}
 
 	return s.FlushInvalid()
@@ -279,6 +470,17 @@ func tryLexString(s *subTokenScanner) *ScannedToken {
 	}
 }
 
+func tryLexDot(s *subTokenScanner) *ScannedToken {
+	if !isDecimalRune(s.Rune()) {
+		return s.FlushInvalid()
+	}
+	s.Advance()
+	if scannerAtBoundary(s) {
+		return s.Complete(DotTT)
+	}
+	return s.FlushInvalid()
+}
+
 func tryLexIdent(s *subTokenScanner) *ScannedToken {
 	if !isIdentStartRune(s.Rune()) {
 		return s.FlushInvalid()
@@ -297,6 +499,32 @@ func tryLexIdent(s *subTokenScanner) *ScannedToken {
 	}
 }
 
+func tryLexKeyword(s *subTokenScanner) *ScannedToken {
+	if s.Rune() != ':' {
+		return s.FlushInvalid()
+	}
+	s.Advance()
+	// a lone colon is the method call form, rather than a keyword.
+	if scannerAtBoundary(s) {
+		return s.Complete(IdentTT)
+	}
+	if !isIdentStartRune(s.Rune()) {
+		return s.FlushInvalid()
+	}
+	s.Advance()
+
+	for {
+		if scannerAtBoundary(s) {
+			return s.Complete(KeywordTT)
+		}
+		if isIdentRune(s.Rune()) {
+			s.Advance()
+			continue
+		}
+		return s.FlushInvalid()
+	}
+}
+
 func scannerAtBoundary(s *subTokenScanner) bool {
 	return s.Done() ||
 		isSpaceRune(s.Rune()) ||
@@ -353,5 +581,6 @@ func isIdentStartRune(r rune) bool {
 }
 
 func isIdentRune(r rune) bool {
-	return isIdentStartRune(r) || unicode.IsDigit(r)
+	return isIdentStartRune(r) || unicode.IsDigit(r) ||
+		r == '!' || r == '?' || r == '*' || r == '-'
 }
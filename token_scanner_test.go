@@ -1,8 +1,11 @@
 package golisp2
 
 import (
+	"errors"
+	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/require"
 )
@@ -67,6 +70,32 @@ func Test_Tokenization(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:  "dot",
+			Input: `(a . b)`,
+			Output: []ScannedToken{
+				ScannedToken{
+					Typ:   OpenParenTT,
+					Value: "(",
+				},
+				ScannedToken{
+					Typ:   IdentTT,
+					Value: "a",
+				},
+				ScannedToken{
+					Typ:   DotTT,
+					Value: ".",
+				},
+				ScannedToken{
+					Typ:   IdentTT,
+					Value: "b",
+				},
+				ScannedToken{
+					Typ:   CloseParenTT,
+					Value: ")",
+				},
+			},
+		},
 		{
 			Name:  "basicNumbers",
 			Input: `1 57.123 -2`,
@@ -194,6 +223,16 @@ func Test_Tokenization(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:  "dashedIdent",
+			Input: `point-x`,
+			Output: []ScannedToken{
+				ScannedToken{
+					Typ:   IdentTT,
+					Value: "point-x",
+				},
+			},
+		},
 		{
 			Name:  "badNum",
 			Input: `123z`,
@@ -234,6 +273,60 @@ func Test_Tokenization(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name:  "keywords",
+			Input: "(:a :opts-2)",
+			Output: []ScannedToken{
+				ScannedToken{
+					Typ:   OpenParenTT,
+					Value: "(",
+				},
+				ScannedToken{
+					Typ:   KeywordTT,
+					Value: ":a",
+				},
+				ScannedToken{
+					Typ:   KeywordTT,
+					Value: ":opts-2",
+				},
+				ScannedToken{
+					Typ:   CloseParenTT,
+					Value: ")",
+				},
+			},
+		},
+		{
+			Name:  "methodCall",
+			Input: "(: o)",
+			Output: []ScannedToken{
+				ScannedToken{
+					Typ:   OpenParenTT,
+					Value: "(",
+				},
+				ScannedToken{
+					Typ:   IdentTT,
+					Value: ":",
+				},
+				ScannedToken{
+					Typ:   IdentTT,
+					Value: "o",
+				},
+				ScannedToken{
+					Typ:   CloseParenTT,
+					Value: ")",
+				},
+			},
+		},
+		{
+			Name:  "badKeyword",
+			Input: ":1",
+			Output: []ScannedToken{
+				ScannedToken{
+					Typ:   InvalidTT,
+					Value: ":1",
+				},
+			},
+		},
 	}
 
 	for _, c := range testCases {
@@ -270,11 +363,28 @@ func Test_Tokenization(t *testing.T) {
 				Typ:   NumberTT,
 				Value: "12",
 				Pos:   makePos(1, 1),
+				End: ScannerPosition{
+					SourceFile: fName,
+					Col:        3,
+					Row:        1,
+					Offset:     2,
+				},
 			},
 			ScannedToken{
 				Typ:   NumberTT,
 				Value: "34",
-				Pos:   makePos(3, 2),
+				Pos: ScannerPosition{
+					SourceFile: fName,
+					Col:        3,
+					Row:        2,
+					Offset:     5,
+				},
+				End: ScannerPosition{
+					SourceFile: fName,
+					Col:        5,
+					Row:        2,
+					Offset:     7,
+				},
 			},
 		}
 		require.Equal(t, expectedTokens, actualTokens)
@@ -287,12 +397,129 @@ func Test_Tokenization(t *testing.T) {
 				Typ:   InvalidTT,
 				Value: "\x01",
 				Pos:   makePos(1, 1),
+				End: ScannerPosition{
+					SourceFile: fName,
+					Col:        2,
+					Row:        1,
+					Offset:     1,
+				},
 			},
 		}
 		require.Equal(t, expectedTokens, actualTokens)
 	})
 }
 
+func Test_TokenScanner(t *testing.T) {
+
+	t.Run("peek", func(t *testing.T) {
+		ts := NewTokenScanner(NewRuneScanner("peek.l", strings.NewReader(`(a)`)))
+		require.Nil(t, ts.Token())
+		require.Equal(t, "(", ts.Peek().Value)
+		require.Equal(t, "(", ts.Peek().Value)
+		ts.Advance()
+		require.Equal(t, "(", ts.Token().Value)
+		require.Equal(t, "a", ts.Peek().Value)
+		ts.Advance()
+		ts.Advance()
+		require.Equal(t, ")", ts.Token().Value)
+		require.Nil(t, ts.Peek())
+		require.False(t, ts.Done())
+		ts.Advance()
+		require.Nil(t, ts.Token())
+		require.True(t, ts.Done())
+		require.Equal(t, io.EOF, ts.Err())
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		src := "; header\n(a ; trailing\n)"
+		ts := NewTokenScanner(NewRuneScanner("comments.l", strings.NewReader(src)))
+		ts.SetMode(ScanComments)
+		types := []TokenType{}
+		for ts.Advance(); !ts.Done(); ts.Advance() {
+			types = append(types, ts.Token().Typ)
+		}
+		require.Equal(t, []TokenType{
+			CommentTT, OpenParenTT, IdentTT, CommentTT, CloseParenTT,
+		}, types)
+		require.Len(t, ts.LeadingComments(), 1)
+		require.Equal(t, "; header", ts.LeadingComments()[0].Value)
+
+		skipping := NewTokenScanner(NewRuneScanner("comments.l", strings.NewReader(src)))
+		skipping.Advance()
+		require.Equal(t, OpenParenTT, skipping.Token().Typ)
+		require.Len(t, skipping.LeadingComments(), 1)
+	})
+
+	t.Run("oneByteReader", func(t *testing.T) {
+		src := `(concat "héllo" 12.5) ; done`
+		expected := tokenizeString("reader.l", src)
+		ts := NewTokenScanner(NewRuneScanner("reader.l",
+			iotest.OneByteReader(strings.NewReader(src))))
+		actual := []ScannedToken{}
+		for ts.Advance(); !ts.Done(); ts.Advance() {
+			actual = append(actual, *ts.Token())
+		}
+		require.Equal(t, expected, actual)
+	})
+
+	t.Run("readError", func(t *testing.T) {
+		readErr := errors.New("disk on fire")
+		src := io.MultiReader(strings.NewReader("(a "), &failingReader{err: readErr})
+		ts := NewTokenScanner(NewRuneScanner("error.l", src))
+		for ts.Advance(); !ts.Done(); ts.Advance() {
+		}
+		require.Equal(t, readErr, ts.Err())
+	})
+
+	t.Run("maxTokenLen", func(t *testing.T) {
+		// an unterminated string that never ends.
+		src := io.MultiReader(strings.NewReader("(a\n \""), repeatReader('x'))
+		ts := NewTokenScanner(NewRuneScanner("long.l", src))
+		ts.SetMaxTokenLen(64)
+		ts.Advance()
+		ts.Advance()
+		require.Equal(t, "a", ts.Token().Value)
+		ts.Advance()
+		require.True(t, ts.Done())
+
+		asLength, isLength := ts.Err().(*TokenLengthError)
+		require.True(t, isLength)
+		require.Equal(t, 64, asLength.Max)
+		require.Equal(t, 2, asLength.Pos.Row)
+		require.Equal(t, 2, asLength.Pos.Col)
+		require.Contains(t, asLength.Error(), "Token longer than 64 bytes")
+
+		_, parseErr := ParseTokens(NewTokenScanner(
+			NewRuneScanner("long.l", strings.NewReader(`"`+strings.Repeat("x", 100)+`"`)),
+		))
+		require.NoError(t, parseErr)
+		short := NewTokenScanner(
+			NewRuneScanner("long.l", strings.NewReader(`(a "`+strings.Repeat("x", 100)+`")`)))
+		short.SetMaxTokenLen(64)
+		_, parseErr = ParseTokens(short)
+		require.True(t, errors.As(parseErr, &asLength))
+	})
+}
+
+// failingReader is an io.Reader that always fails with the given error.
+type failingReader struct {
+	err error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	return 0, fr.err
+}
+
+// repeatReader is an io.Reader that endlessly repeats the given byte.
+type repeatReader byte
+
+func (rr repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(rr)
+	}
+	return len(p), nil
+}
+
 // tokenizeString converts the provided string to a list of tokens.
 func tokenizeString(srcName, str string) []ScannedToken {
 	tokens := []ScannedToken{}
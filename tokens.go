@@ -13,6 +13,9 @@ type (
 		Typ   TokenType
 		Value string
 		Pos   ScannerPosition
+
+		// End is the position just past the last rune of the token.
+		End ScannerPosition
 	}
 )
 
@@ -44,6 +47,12 @@ const (
 
 	// CommentTT represents a comment.
 	CommentTT
+
+	// DotTT is a standalone dot, as used in `(a . rest)`.
+	DotTT
+
+	// KeywordTT is a keyword; e.g. `:name`.
+	KeywordTT
 )
 
 // String is just a simple mapping to a human readable string for token types.
@@ -67,6 +76,10 @@ func (tt TokenType) String() string {
 		return "StringTT"
 	case CommentTT:
 		return "CommentTT"
+	case DotTT:
+		return "DotTT"
+	case KeywordTT:
+		return "KeywordTT"
 	default:
 		return fmt.Sprintf("<unknown type %d>", tt)
 	}
@@ -0,0 +1,83 @@
+package golisp2
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Tracer creates spans for script activity, so it can appear in distributed
+	// traces alongside the host. It's shaped to be a thin wrapper around an
+	// OpenTelemetry tracer; see the otelgl package.
+	Tracer interface {
+		// Start begins a span with the given name. It is a child of any span in the
+		// given context; the returned context contains the new span.
+		Start(ctx context.Context, name string) (context.Context, Span)
+	}
+
+	// Span is a single traced operation.
+	Span interface {
+		// SetAttribute attaches a key/value pair to the span.
+		SetAttribute(key, value string)
+
+		// RecordError marks the span as failed with the given error.
+		RecordError(err error)
+
+		// End completes the span.
+		End()
+	}
+)
+
+// SetTracer sets the tracer used to create spans for program runs and for
+// calls to traced functions. A nil tracer disables tracing. This applies to all
+// parent and sub contexts.
+func (ec *EvalContext) SetTracer(t Tracer) {
+	ec.environ().tracer = t
+}
+
+// startSpan begins a span as a child of the context's current span, and makes
+// the new span current. The returned function ends the span, records err if
+// non-nil, and restores the previous span. If there's no tracer, this does
+// nothing.
+func (ec *EvalContext) startSpan(
+	name string, attrs map[string]string,
+) func(err error) {
+	env := ec.environ()
+	if env.tracer == nil {
+		return func(error) {}
+	}
+	parentCtx := env.ctx
+	spanCtx, span := env.tracer.Start(parentCtx, name)
+	for k, v := range attrs {
+		span.SetAttribute(k, v)
+	}
+	env.ctx = spanCtx
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		env.ctx = parentCtx
+	}
+}
+
+// traceFn marks a copy of the given function as traced, so each call to it is
+// recorded as a span.
+func traceFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var asFn *FuncValue
+	err := ArgMapperValues(vals...).
+		ReadFunc(&asFn).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	traced := *asFn
+	traced.Traced = true
+	return &traced, nil
+}
+
+// spanPos formats the position as a span attribute.
+func spanPos(pos ScannerPosition) string {
+	return fmt.Sprintf("%s:%d:%d", pos.SourceFile, pos.Row, pos.Col)
+}
@@ -0,0 +1,78 @@
+package golisp2
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// recordingTracer is a Tracer that keeps every span it starts.
+	recordingTracer struct {
+		spans []*recordingSpan
+	}
+
+	// recordingSpan is a Span that keeps everything reported to it.
+	recordingSpan struct {
+		name   string
+		parent *recordingSpan
+		attrs  map[string]string
+		err    error
+		ended  bool
+	}
+
+	// spanKey is the context key recordingTracer stores spans under.
+	spanKey struct{}
+)
+
+func (rt *recordingTracer) Start(
+	ctx context.Context, name string,
+) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordingSpan)
+	s := &recordingSpan{name: name, parent: parent, attrs: map[string]string{}}
+	rt.spans = append(rt.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (rs *recordingSpan) SetAttribute(key, value string) { rs.attrs[key] = value }
+func (rs *recordingSpan) RecordError(err error)          { rs.err = err }
+func (rs *recordingSpan) End()                           { rs.ended = true }
+
+func Test_Tracer(t *testing.T) {
+	rt := &recordingTracer{}
+	ec := BuiltinContext().SubContext(nil)
+	ec.SetTracer(rt)
+
+	prog, err := ParseProgram(NewTokenScanner(NewRuneScanner(
+		"script.l", strings.NewReader(`
+		(let double (trace (fn (x) (concat x x))))
+		(let fail (trace (fn () (len 1))))
+		(double "a")
+		(concat "untraced")
+		(fail)`))))
+	require.NoError(t, err)
+	_, err = prog.Eval(ec)
+	require.Error(t, err)
+
+	require.Len(t, rt.spans, 3)
+	run, double, fail := rt.spans[0], rt.spans[1], rt.spans[2]
+	require.Equal(t, "golisp.run", run.name)
+	require.Equal(t, "script.l", run.attrs["golisp.source"])
+	require.Error(t, run.err)
+
+	require.Equal(t, "golisp.call", double.name)
+	require.Equal(t, "double", double.attrs["golisp.fn"])
+	require.Equal(t, run, double.parent)
+	require.NoError(t, double.err)
+
+	require.Equal(t, "fail", fail.attrs["golisp.fn"])
+	require.Error(t, fail.err)
+	for _, s := range rt.spans {
+		require.True(t, s.ended)
+	}
+
+	// the context is restored once the run completes.
+	require.Nil(t, ec.Context().Value(spanKey{}))
+}
@@ -0,0 +1,205 @@
+package golisp2
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+// validateFn checks the data against a schema, and returns a list of the ways
+// it doesn't conform; empty if it does. Each violation is a map of the "path"
+// to the offending value (e.g. "address.zip" or "tags[2]"), and a "message".
+//
+// The schema is a map from each field to the type of its value; e.g. "string",
+// "number", "bool", "list", "map", "keyword", or "any". Or, to constrain the
+// value further, to a map of rules:
+//
+//   - "type": the type of the value. Defaults to "any".
+//   - "required": whether the field must be present. Defaults to true.
+//   - "min", "max": bounds on a number, or on the length of a string or list.
+//   - "enum": a list of the allowed values.
+//   - "pattern": a regular expression a string must match.
+//   - "fields": the schema of a map.
+//   - "items": the type or rules each element of a list must conform to.
+//
+// Fields of the data not in the schema are allowed.
+func validateFn(ec *EvalContext, vals ...Value) (Value, error) {
+	var data Value
+	var schema *MapValue
+	err := ArgMapperValues(vals...).
+		ReadValue(&data).
+		ReadMap(&schema).
+		Complete()
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{}
+	if err := v.fields("", data, schema); err != nil {
+		return nil, err
+	}
+	return &ListValue{
+		Vals: v.violations,
+	}, nil
+}
+
+// validator collects the violations found while validating data.
+type validator struct {
+	violations []Value
+}
+
+// violation records that the value at the path doesn't conform to the schema.
+func (v *validator) violation(path, format string, args ...interface{}) {
+	v.violations = append(v.violations, &MapValue{
+		Vals: map[string]Value{
+			"path":    &StringValue{Val: path},
+			"message": &StringValue{Val: fmt.Sprintf(format, args...)},
+		},
+	})
+}
+
+// fields validates the data at the path against a map schema. Returns an error
+// if the schema itself is invalid.
+func (v *validator) fields(path string, data Value, schema *MapValue) error {
+	asMap, isMap := data.(*MapValue)
+	if !isMap {
+		v.violation(path, "expected map; got %s", TypeName(data))
+		return nil
+	}
+	keys := make([]string, 0, len(schema.Vals))
+	for k := range schema.Vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fieldPath := k
+		if path != "" {
+			fieldPath = path + "." + k
+		}
+		rules, err := schemaRules(fieldPath, schema.Vals[k])
+		if err != nil {
+			return err
+		}
+		fieldV, present := asMap.Vals[k]
+		if !present {
+			if required, isBool := rules["required"].(*BoolValue); !isBool || required.Val {
+				v.violation(fieldPath, "is required")
+			}
+			continue
+		}
+		if err := v.value(fieldPath, fieldV, rules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value validates the value at the path against its rules.
+func (v *validator) value(path string, val Value, rules map[string]Value) error {
+	typ := "any"
+	if asStr, isStr := rules["type"].(*StringValue); isStr {
+		typ = asStr.Val
+	} else if rules["type"] != nil {
+		return fmt.Errorf("validate schema for '%s' has a non-string type", path)
+	}
+	if typ != "any" && TypeName(val) != typ {
+		v.violation(path, "expected %s; got %s", typ, TypeName(val))
+		return nil
+	}
+
+	size, sizeDesc := 0.0, ""
+	switch tV := val.(type) {
+	case *NumberValue:
+		size, sizeDesc = tV.Val, "value"
+	case *StringValue:
+		size, sizeDesc = float64(utf8.RuneCountInString(tV.Val)), "length"
+	case *ListValue:
+		size, sizeDesc = float64(len(tV.Vals)), "length"
+	}
+	for _, bound := range []string{"min", "max"} {
+		boundV, hasBound := rules[bound]
+		if !hasBound {
+			continue
+		}
+		asNum, isNum := boundV.(*NumberValue)
+		if !isNum {
+			return fmt.Errorf("validate schema for '%s' has a non-number %s", path, bound)
+		}
+		if sizeDesc == "" {
+			continue
+		}
+		if bound == "min" && size < asNum.Val {
+			v.violation(path, "%s must be at least %s", sizeDesc, asNum.InspectStr())
+		} else if bound == "max" && size > asNum.Val {
+			v.violation(path, "%s must be at most %s", sizeDesc, asNum.InspectStr())
+		}
+	}
+
+	if enumV, hasEnum := rules["enum"]; hasEnum {
+		asList, isList := enumV.(*ListValue)
+		if !isList {
+			return fmt.Errorf("validate schema for '%s' has a non-list enum", path)
+		}
+		found := false
+		for _, allowed := range asList.Vals {
+			found = found || valuesEqual(val, allowed)
+		}
+		if !found {
+			v.violation(path, "must be one of %s", asList.InspectStr())
+		}
+	}
+
+	if patternV, hasPattern := rules["pattern"]; hasPattern {
+		asStr, isStr := patternV.(*StringValue)
+		if !isStr {
+			return fmt.Errorf("validate schema for '%s' has a non-string pattern", path)
+		}
+		re, err := regexp.Compile(asStr.Val)
+		if err != nil {
+			return fmt.Errorf("validate schema for '%s' has an invalid pattern: %w", path, err)
+		}
+		if s, isStr := val.(*StringValue); isStr && !re.MatchString(s.Val) {
+			v.violation(path, "must match %s", asStr.Val)
+		}
+	}
+
+	if fieldsV, hasFields := rules["fields"]; hasFields {
+		asMap, isMap := fieldsV.(*MapValue)
+		if !isMap {
+			return fmt.Errorf("validate schema for '%s' has non-map fields", path)
+		}
+		if err := v.fields(path, val, asMap); err != nil {
+			return err
+		}
+	}
+
+	if itemsV, hasItems := rules["items"]; hasItems {
+		itemRules, err := schemaRules(path+"[]", itemsV)
+		if err != nil {
+			return err
+		}
+		if asList, isList := val.(*ListValue); isList {
+			for i, item := range asList.Vals {
+				if err := v.value(fmt.Sprintf("%s[%d]", path, i), item, itemRules); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaRules returns the rules for a field of a schema, which may be a type
+// name or a map of rules.
+func schemaRules(path string, spec Value) (map[string]Value, error) {
+	switch tV := spec.(type) {
+	case *StringValue:
+		return map[string]Value{"type": tV}, nil
+	case *MapValue:
+		return tV.Vals, nil
+	default:
+		return nil, fmt.Errorf(
+			"validate schema for '%s' must be a type name or map; got %s",
+			path, TypeName(spec))
+	}
+}
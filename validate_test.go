@@ -0,0 +1,47 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validate(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `
+		(let schema (map
+			"name" "string"
+			"age" (map "type" "number" "min" 0 "max" 150)
+			"role" (map "enum" (list "admin" "user") "required" false)
+			"email" (map "type" "string" "pattern" "^[^@]+@[^@]+$")
+			"tags" (map "type" "list" "max" 2 "items" "string")
+			"address" (map "type" "map" "fields" (map "zip" "string"))))`)
+	validate := func(data string) string {
+		t.Helper()
+		return evalStrInContext(t, ec, `(validate `+data+` schema)`).InspectStr()
+	}
+
+	require.Equal(t, `[]`, validate(`(map
+		"name" "ann" "age" 30 "email" "ann@example.com" "tags" (list "a")
+		"address" (map "zip" "12345") "extra" 1)`))
+
+	require.Equal(t,
+		`[{ message:"is required" path:"address.zip" } `+
+			`{ message:"expected number; got string" path:"age" } `+
+			`{ message:"must match ^[^@]+@[^@]+$" path:"email" } `+
+			`{ message:"is required" path:"name" } `+
+			`{ message:"must be one of ["admin" "user"]" path:"role" } `+
+			`{ message:"length must be at most 2" path:"tags" } `+
+			`{ message:"expected string; got number" path:"tags[1]" }]`,
+		validate(`(map
+			"age" "old" "role" "root" "email" "nope" "tags" (list "a" 1 "c")
+			"address" (map))`))
+
+	require.Equal(t, `[{ message:"value must be at least 0" path:"age" }]`,
+		validate(`(map "name" "a" "age" -1 "email" "a@b" "tags" (list)
+			"address" (map "zip" "1"))`))
+	require.Equal(t, `[{ message:"expected map; got number" path:"" }]`, validate(`1`))
+
+	err := evalStrInContextToErr(t, ec, `(validate (map) (map "a" 1))`)
+	require.Contains(t, err.Error(), "validate schema for 'a' must be a type name or map; got number")
+}
@@ -3,7 +3,10 @@ package golisp2
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type (
@@ -38,11 +41,76 @@ type (
 		Val bool
 	}
 
+	// KeywordValue is a representation of a keyword within the interpreted
+	// environment. Keywords evaluate to themselves; they're used as map keys and
+	// to name keyword arguments.
+	KeywordValue struct {
+		// Val is the name of the keyword, without the leading colon.
+		Val string
+	}
+
+	// SymbolValue is a representation of an identifier as a value, such as one
+	// in quoted code. Unlike a string, it stands for a name in the program.
+	SymbolValue struct {
+		Val string
+	}
+
 	// FuncValue is a representation of a basic function within the interpreted
 	// environment.
 	FuncValue struct {
 		// Fn is the function body the function value references.
 		Fn func(*EvalContext, ...Value) (Value, error)
+
+		// Name is the name the function was registered under, if any.
+		Name string
+
+		// Params are the names of the function's parameters, if they're known.
+		// If MaxArgs is -1, the last collects any remaining arguments.
+		Params []string
+
+		// MinArgs and MaxArgs bound the number of arguments the function can be
+		// called with; MaxArgs is -1 if there's no upper bound. They're only
+		// checked if Params is set.
+		MinArgs, MaxArgs int
+
+		// Deprecated is set if the function should no longer be used. Calling it
+		// will raise a warning diagnostic.
+		Deprecated *Deprecation
+
+		// Nondeterministic marks functions whose results can't be reproduced,
+		// such as those that read external state. They can't be called in
+		// deterministic mode.
+		Nondeterministic bool
+
+		// Traced marks functions whose calls are recorded as spans, if the context
+		// has a tracer.
+		Traced bool
+
+		// Pure marks functions without side effects, whose results only depend on
+		// their arguments. Only they can be called in pure mode; see
+		// EvalContext.SetPureOnly.
+		Pure bool
+
+		// generic is set for functions declared with defgeneric, and holds their
+		// methods.
+		generic *genericFn
+
+		// builtin is set for the functions in builtinFns.
+		builtin bool
+
+		// def is the fn, defstruct or defgeneric expression that created the
+		// function, if any.
+		def Expr
+	}
+
+	// Deprecation describes why a function is deprecated, and what should be
+	// used instead.
+	Deprecation struct {
+		// Notice is a short explanation of the deprecation.
+		Notice string
+
+		// Replacement is the name of the function to use instead. May be empty.
+		Replacement string
 	}
 
 	// CellValue is a representation of a pair of values within the interpreted
@@ -61,16 +129,142 @@ type (
 	MapValue struct {
 		Vals map[string]Value
 	}
+
+	// StructType describes a record type declared with defstruct.
+	StructType struct {
+		Name   string
+		Fields []string
+	}
+
+	// StructValue is an instance of a struct type. Vals holds the value of each
+	// field, in the order they were declared.
+	StructValue struct {
+		Type *StructType
+		Vals []Value
+	}
+
+	// TableValue is a table of rows that share the same columns. Each row has a
+	// value for every column, in the order of Columns.
+	TableValue struct {
+		Columns []string
+		Rows    [][]Value
+	}
+
+	// SeqValue represents a lazy sequence of values. Elements are only produced
+	// as they are consumed, so a sequence may be infinite.
+	SeqValue struct {
+		// Iter starts a new pass over the sequence's elements. Each call must
+		// return an independent iterator.
+		Iter func() SeqIterator
+	}
+
+	// SeqIterator produces the next element of a sequence. Once the sequence is
+	// exhausted, it returns false.
+	SeqIterator func(ec *EvalContext) (Value, bool, error)
+
+	// ChanValue is a channel, that passes values between the goroutines started
+	// by go expressions.
+	ChanValue struct {
+		ch chan Value
+
+		// done is closed once the channel is; closeOnce guards it. err is set
+		// beforehand if the channel was closed by a failed go expression.
+		done      chan struct{}
+		closeOnce sync.Once
+		err       error
+	}
+
+	// TimeValue is an instant in time.
+	TimeValue struct {
+		Val time.Time
+	}
+
+	// ValuesValue holds several results returned at once, e.g. by divmod. They
+	// can be bound to separate names with letValues.
+	ValuesValue struct {
+		Vals []Value
+	}
+
+	// WaitGroupValue waits for a set of goroutines to finish, like a
+	// sync.WaitGroup.
+	WaitGroupValue struct {
+		wg sync.WaitGroup
+
+		// count tracks the counter of wg, so it going negative can be reported
+		// as an error rather than panicking.
+		count int64
+	}
+
+	// HostValue is an opaque handle to a Go value the host passes to scripts,
+	// such as a connection or file. Scripts can hold it, and pass it back to the
+	// host's functions, but can't look inside it. See NewHostResource for
+	// handles to resources that must be released.
+	HostValue struct {
+		Val interface{}
+
+		// res is the resource the handle releases; nil if there's nothing to
+		// release.
+		res *hostResource
+	}
+
+	// ObjectValue is a mutable set of named slots, holding both state and
+	// methods. Slots the object doesn't have are looked up in its prototype, and
+	// then in that's prototype, and so on.
+	ObjectValue struct {
+		// Proto is the object slots are inherited from; nil if none.
+		Proto *ObjectValue
+
+		mu    sync.RWMutex
+		slots map[string]Value
+	}
+)
+
+var (
+	// Nil is the nil value. NilValue has no state, so every nil can be this one
+	// rather than a new allocation.
+	Nil = &NilValue{}
+
+	// True and False are the two bool values. Bools are never modified, so they
+	// can be shared; see NewBoolValue.
+	True  = &BoolValue{Val: true}
+	False = &BoolValue{Val: false}
 )
 
+// NewBoolValue returns True or False, rather than allocating a new bool.
+func NewBoolValue(b bool) *BoolValue {
+	if b {
+		return True
+	}
+	return False
+}
+
+// smallNumbers are shared values of the small non-negative integers, which
+// counters and indexes make far more common than any other numbers.
+var smallNumbers = func() [256]*NumberValue {
+	var nums [256]*NumberValue
+	for i := range nums {
+		nums[i] = &NumberValue{Val: float64(i)}
+	}
+	return nums
+}()
+
+// NewNumberValue returns a number value. Small non-negative integers are
+// shared rather than allocated, so the value must not be modified.
+func NewNumberValue(f float64) *NumberValue {
+	if f >= 0 && f < float64(len(smallNumbers)) && f == math.Trunc(f) && !math.Signbit(f) {
+		return smallNumbers[int(f)]
+	}
+	return &NumberValue{Val: f}
+}
+
 // NewCellValue creates a cell with the given left/right values. Either can be
 // 'nil'.
 func NewCellValue(left, right Value) *CellValue {
 	if left == nil {
-		left = &NilValue{}
+		left = Nil
 	}
 	if right == nil {
-		right = &NilValue{}
+		right = Nil
 	}
 	return &CellValue{
 		Left:  left,
@@ -83,10 +277,54 @@ func (cv *CellValue) Eval(*EvalContext) (Value, error) {
 	return cv, nil
 }
 
-// InspectStr outputs the contents of all the cells.
+// InspectStr outputs the contents of all the cells. Proper lists - chains of
+// cells terminated by nil - are printed in list notation; e.g. `(1 2 3)`.
 func (cv *CellValue) InspectStr() string {
-	// todo (bs): if second cell is a node, treat this different
-	return fmt.Sprintf("(%s . %s)", cv.Left.InspectStr(), cv.Right.InspectStr())
+	vals, tail := cv.chainVals()
+	var sb strings.Builder
+	sb.WriteString("(")
+	for i, v := range vals {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(v.InspectStr())
+	}
+	if _, isNil := tail.(*NilValue); !isNil {
+		sb.WriteString(" . ")
+		sb.WriteString(tail.InspectStr())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// chainVals follows the chain of cells linked through their right value, and
+// returns the left values of each along with the first non-cell right value
+// that terminates the chain.
+func (cv *CellValue) chainVals() ([]Value, Value) {
+	vals := []Value{}
+	var curr Value = cv
+	for {
+		asCell, isCell := curr.(*CellValue)
+		if !isCell {
+			return vals, curr
+		}
+		vals = append(vals, asCell.Left)
+		curr = asCell.Right
+	}
+}
+
+// NewDeprecatedFunc creates a function value with the given name that raises a
+// deprecation warning when called.
+func NewDeprecatedFunc(
+	name string,
+	fn func(*EvalContext, ...Value) (Value, error),
+	dep Deprecation,
+) *FuncValue {
+	return &FuncValue{
+		Fn:         fn,
+		Name:       name,
+		Deprecated: &dep,
+	}
 }
 
 // InspectStr prints the number.
@@ -112,6 +350,16 @@ func (bv *BoolValue) InspectStr() string {
 	return fmt.Sprintf("%t", bv.Val)
 }
 
+// InspectStr prints the keyword with its leading colon; e.g. `:name`.
+func (kv *KeywordValue) InspectStr() string {
+	return ":" + kv.Val
+}
+
+// InspectStr prints the symbol's name.
+func (sv *SymbolValue) InspectStr() string {
+	return sv.Val
+}
+
 // InspectStr outputs some information about the function.
 func (fv *FuncValue) InspectStr() string {
 	// note (bs): probably want to customize this to print some details about the
@@ -120,6 +368,58 @@ func (fv *FuncValue) InspectStr() string {
 	return fmt.Sprintf("<func>")
 }
 
+// Signature describes how the function is called, in the form
+// `(range from [to] [step])`. Returns just the name if the parameters aren't
+// known.
+func (fv *FuncValue) Signature() string {
+	if fv.Params == nil {
+		return profileName(fv)
+	}
+	parts := []string{profileName(fv)}
+	for i, p := range fv.Params {
+		switch {
+		case fv.MaxArgs < 0 && i == len(fv.Params)-1:
+			p += "..."
+		case i >= fv.MinArgs:
+			p = "[" + p + "]"
+		}
+		parts = append(parts, p)
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// checkArgCount returns an error if the function can't be called with n
+// arguments. name is the name it was called by.
+func (fv *FuncValue) checkArgCount(name string, n int, pos ScannerPosition) error {
+	if fv.Params == nil || (n >= fv.MinArgs && (fv.MaxArgs < 0 || n <= fv.MaxArgs)) {
+		return nil
+	}
+	return &EvalError{
+		Msg: formatMessage(CallArgCountMsg, struct {
+			Name, Expected string
+			Actual         int
+		}{name, describeArity(fv.MinArgs, fv.MaxArgs), n}),
+		Pos: pos,
+	}
+}
+
+// describeArity describes a number of arguments; e.g. "1 to 2 arguments". max
+// is -1 if there's no upper limit.
+func describeArity(min, max int) string {
+	switch {
+	case max < 0 && min == 1:
+		return "at least 1 argument"
+	case max < 0:
+		return fmt.Sprintf("at least %d arguments", min)
+	case min == max && min == 1:
+		return "1 argument"
+	case min == max:
+		return fmt.Sprintf("%d arguments", min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", min, max)
+	}
+}
+
 // InspectStr returns a human-readable string representation of the list.
 func (lv *ListValue) InspectStr() string {
 	var sb strings.Builder
@@ -134,16 +434,296 @@ func (lv *ListValue) InspectStr() string {
 	return sb.String()
 }
 
-// InspectStr returns a human-readable map representation of the list.
+// InspectStr returns a human-readable representation of the struct; e.g.
+// `point{x:1 y:2}`.
+func (sv *StructValue) InspectStr() string {
+	var sb strings.Builder
+	sb.WriteString(sv.Type.Name)
+	sb.WriteString("{")
+	for i, f := range sv.Type.Fields {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(f)
+		sb.WriteString(":")
+		sb.WriteString(sv.Vals[i].InspectStr())
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// InspectStr prints the columns of the table, followed by each row.
+func (tv *TableValue) InspectStr() string {
+	var sb strings.Builder
+	sb.WriteString("table[")
+	sb.WriteString(strings.Join(tv.Columns, " "))
+	sb.WriteString("]")
+	for _, r := range tv.Rows {
+		sb.WriteString("[")
+		for i, v := range r {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(v.InspectStr())
+		}
+		sb.WriteString("]")
+	}
+	return sb.String()
+}
+
+// NewListSeq creates a sequence over the elements of the list.
+func NewListSeq(lv *ListValue) *SeqValue {
+	return &SeqValue{
+		Iter: func() SeqIterator {
+			i := 0
+			return func(_ *EvalContext) (Value, bool, error) {
+				if i >= len(lv.Vals) {
+					return nil, false, nil
+				}
+				i++
+				return lv.Vals[i-1], true, nil
+			}
+		},
+	}
+}
+
+// InspectStr returns a placeholder representation of the sequence. Elements
+// aren't printed, as doing so may never terminate.
+func (sv *SeqValue) InspectStr() string {
+	return "<seq>"
+}
+
+// InspectStr returns a placeholder representation of the channel.
+func (cv *ChanValue) InspectStr() string {
+	return "<chan>"
+}
+
+// InspectStr returns the time in RFC 3339 format.
+func (tv *TimeValue) InspectStr() string {
+	return fmt.Sprintf("<time %s>", tv.Val.Format(time.RFC3339Nano))
+}
+
+// InspectStr returns each of the values, in the form they'd be created in.
+func (vv *ValuesValue) InspectStr() string {
+	var sb strings.Builder
+	sb.WriteString("(values")
+	for _, v := range vv.Vals {
+		sb.WriteString(" ")
+		sb.WriteString(v.InspectStr())
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// NewObjectValue creates an object with a copy of the slots, that inherits
+// from proto. proto may be nil.
+func NewObjectValue(slots map[string]Value, proto *ObjectValue) *ObjectValue {
+	ov := &ObjectValue{
+		Proto: proto,
+		slots: make(map[string]Value, len(slots)),
+	}
+	for k, v := range slots {
+		ov.slots[k] = v
+	}
+	return ov
+}
+
+// Get returns the value of the slot, from the object or the nearest of its
+// prototypes that has it.
+func (ov *ObjectValue) Get(name string) (Value, bool) {
+	for o := ov; o != nil; o = o.Proto {
+		o.mu.RLock()
+		v, hasV := o.slots[name]
+		o.mu.RUnlock()
+		if hasV {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the slot on the object itself; its prototypes are unchanged.
+func (ov *ObjectValue) Set(name string, v Value) {
+	ov.mu.Lock()
+	defer ov.mu.Unlock()
+	ov.slots[name] = v
+}
+
+// InspectStr prints the object's own slots, in sorted order. Inherited slots
+// aren't included.
+func (ov *ObjectValue) InspectStr() string {
+	ov.mu.RLock()
+	defer ov.mu.RUnlock()
+	return "object" + (&MapValue{Vals: ov.slots}).InspectStr()
+}
+
+// InspectStr returns a placeholder representation of the handle, naming the
+// Go type it wraps.
+func (hv *HostValue) InspectStr() string {
+	return fmt.Sprintf("<host %T>", hv.Val)
+}
+
+// InspectStr returns a placeholder representation of the wait group.
+func (wv *WaitGroupValue) InspectStr() string {
+	return "<waitGroup>"
+}
+
+// InspectStr returns a human-readable map representation of the list. Keys are
+// printed in sorted order.
 func (mv *MapValue) InspectStr() string {
 	var sb strings.Builder
 	sb.WriteString("{")
-	for k, v := range mv.Vals {
+	for _, k := range sortedKeys(mv.Vals) {
 		sb.WriteString(" ")
 		sb.WriteString(k)
 		sb.WriteString(":")
-		sb.WriteString(v.InspectStr())
+		sb.WriteString(mv.Vals[k].InspectStr())
 	}
 	sb.WriteString(" }")
 	return sb.String()
 }
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TypeName returns the name scripts use for the value's type; e.g. "number".
+// Structs are named by their struct type.
+func TypeName(v Value) string {
+	switch tV := v.(type) {
+	case *NilValue:
+		return "nil"
+	case *NumberValue:
+		return "number"
+	case *StringValue:
+		return "string"
+	case *BoolValue:
+		return "bool"
+	case *KeywordValue:
+		return "keyword"
+	case *SymbolValue:
+		return "symbol"
+	case *FuncValue:
+		return "func"
+	case *CellValue:
+		return "cell"
+	case *ListValue:
+		return "list"
+	case *MapValue:
+		return "map"
+	case *SeqValue:
+		return "seq"
+	case *TableValue:
+		return "table"
+	case *ChanValue:
+		return "chan"
+	case *WaitGroupValue:
+		return "waitGroup"
+	case *ValuesValue:
+		return "values"
+	case *TimeValue:
+		return "time"
+	case *ObjectValue:
+		return "object"
+	case *HostValue:
+		return "host"
+	case *StructValue:
+		return tV.Type.Name
+	default:
+		return "unknown"
+	}
+}
+
+// valuesEqual indicates if the values are structurally equal: the same type,
+// with equal contents. Functions, sequences and objects are only equal to
+// themselves.
+func valuesEqual(a, b Value) bool {
+	switch tA := a.(type) {
+	case *NilValue:
+		_, isNil := b.(*NilValue)
+		return isNil
+	case *NumberValue:
+		tB, isNum := b.(*NumberValue)
+		return isNum && tA.Val == tB.Val
+	case *StringValue:
+		tB, isStr := b.(*StringValue)
+		return isStr && tA.Val == tB.Val
+	case *BoolValue:
+		tB, isBool := b.(*BoolValue)
+		return isBool && tA.Val == tB.Val
+	case *KeywordValue:
+		tB, isKeyword := b.(*KeywordValue)
+		return isKeyword && tA.Val == tB.Val
+	case *SymbolValue:
+		tB, isSymbol := b.(*SymbolValue)
+		return isSymbol && tA.Val == tB.Val
+	case *CellValue:
+		tB, isCell := b.(*CellValue)
+		return isCell && valuesEqual(tA.Left, tB.Left) &&
+			valuesEqual(tA.Right, tB.Right)
+	case *ListValue:
+		tB, isList := b.(*ListValue)
+		if !isList || len(tA.Vals) != len(tB.Vals) {
+			return false
+		}
+		for i := range tA.Vals {
+			if !valuesEqual(tA.Vals[i], tB.Vals[i]) {
+				return false
+			}
+		}
+		return true
+	case *MapValue:
+		tB, isMap := b.(*MapValue)
+		if !isMap || len(tA.Vals) != len(tB.Vals) {
+			return false
+		}
+		for k, v := range tA.Vals {
+			bV, hasK := tB.Vals[k]
+			if !hasK || !valuesEqual(v, bV) {
+				return false
+			}
+		}
+		return true
+	case *TableValue:
+		tB, isTable := b.(*TableValue)
+		if !isTable || len(tA.Columns) != len(tB.Columns) ||
+			len(tA.Rows) != len(tB.Rows) {
+			return false
+		}
+		for i := range tA.Columns {
+			if tA.Columns[i] != tB.Columns[i] {
+				return false
+			}
+		}
+		for i := range tA.Rows {
+			for j := range tA.Rows[i] {
+				if !valuesEqual(tA.Rows[i][j], tB.Rows[i][j]) {
+					return false
+				}
+			}
+		}
+		return true
+	case *TimeValue:
+		tB, isTime := b.(*TimeValue)
+		return isTime && tA.Val.Equal(tB.Val)
+	case *StructValue:
+		tB, isStruct := b.(*StructValue)
+		if !isStruct || tA.Type != tB.Type {
+			return false
+		}
+		for i := range tA.Vals {
+			if !valuesEqual(tA.Vals[i], tB.Vals[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
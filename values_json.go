@@ -0,0 +1,117 @@
+package golisp2
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MarshalValueJSON converts the value to JSON. Numbers, strings, keywords,
+// bools, nil, times, lists and maps are supported; other values (e.g.
+// functions) are an error. Keywords are converted to their name, and times to
+// RFC 3339 strings.
+func MarshalValueJSON(v Value) ([]byte, error) {
+	data, err := valueToJSONData(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// UnmarshalValueJSON converts JSON into a value. Objects become maps, and
+// arrays become lists.
+func UnmarshalValueJSON(b []byte) (Value, error) {
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return valueFromJSONData(data)
+}
+
+// valueToJSONData converts the value to the generic representation used by
+// encoding/json.
+func valueToJSONData(v Value) (interface{}, error) {
+	switch tV := v.(type) {
+	case *NilValue:
+		return nil, nil
+	case *NumberValue:
+		return tV.Val, nil
+	case *StringValue:
+		return tV.Val, nil
+	case *KeywordValue:
+		return tV.Val, nil
+	case *BoolValue:
+		return tV.Val, nil
+	case *TimeValue:
+		return tV.Val.Format(time.RFC3339Nano), nil
+	case *ListValue:
+		elems := make([]interface{}, 0, len(tV.Vals))
+		for _, e := range tV.Vals {
+			data, err := valueToJSONData(e)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, data)
+		}
+		return elems, nil
+	case *MapValue:
+		fields := make(map[string]interface{}, len(tV.Vals))
+		for k, e := range tV.Vals {
+			data, err := valueToJSONData(e)
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = data
+		}
+		return fields, nil
+	case *TableValue:
+		rows := make([]interface{}, 0, len(tV.Rows))
+		for i := range tV.Rows {
+			data, err := valueToJSONData(tV.rowMap(i))
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, data)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to JSON", v)
+	}
+}
+
+// valueFromJSONData converts the generic representation used by encoding/json
+// into a value.
+func valueFromJSONData(data interface{}) (Value, error) {
+	switch tD := data.(type) {
+	case nil:
+		return Nil, nil
+	case float64:
+		return &NumberValue{Val: tD}, nil
+	case string:
+		return &StringValue{Val: tD}, nil
+	case bool:
+		return NewBoolValue(tD), nil
+	case []interface{}:
+		vals := make([]Value, 0, len(tD))
+		for _, e := range tD {
+			v, err := valueFromJSONData(e)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return &ListValue{Vals: vals}, nil
+	case map[string]interface{}:
+		vals := make(map[string]Value, len(tD))
+		for k, e := range tD {
+			v, err := valueFromJSONData(e)
+			if err != nil {
+				return nil, err
+			}
+			vals[k] = v
+		}
+		return &MapValue{Vals: vals}, nil
+	default:
+		return nil, fmt.Errorf("cannot convert JSON type %T to a value", data)
+	}
+}
@@ -0,0 +1,34 @@
+package golisp2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_valueJSON(t *testing.T) {
+	v := &MapValue{
+		Vals: map[string]Value{
+			"n": &NumberValue{Val: 1.5},
+			"s": &StringValue{Val: "str"},
+			"b": &BoolValue{Val: true},
+			"z": &NilValue{},
+			"l": &ListValue{Vals: []Value{
+				&NumberValue{Val: 1},
+				&StringValue{Val: "two"},
+			}},
+		},
+	}
+	data, err := MarshalValueJSON(v)
+	require.NoError(t, err)
+	require.JSONEq(t,
+		`{"n": 1.5, "s": "str", "b": true, "z": null, "l": [1, "two"]}`,
+		string(data))
+
+	roundTrip, err := UnmarshalValueJSON(data)
+	require.NoError(t, err)
+	require.Equal(t, v.InspectStr(), roundTrip.InspectStr())
+
+	_, fnErr := MarshalValueJSON(&FuncValue{Fn: printFn})
+	require.Error(t, fnErr)
+}
@@ -1,6 +1,7 @@
 package golisp2
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,71 @@ func Test_boolValue(t *testing.T) {
 	})
 }
 
+func Test_singletonValues(t *testing.T) {
+	t.Run("shared", func(t *testing.T) {
+		require.True(t, NewBoolValue(true) == True)
+		require.True(t, NewBoolValue(false) == False)
+		require.True(t, evalStrToVal(t, `(< 1 2)`) == True)
+		require.True(t, evalStrToVal(t, `(not true)`) == False)
+		require.True(t, evalStrToVal(t, `(if false 1)`) == Nil)
+	})
+
+	t.Run("noAllocs", func(t *testing.T) {
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = NewBoolValue(true)
+			_ = Nil
+		})
+		require.Equal(t, 0.0, allocs)
+	})
+}
+
+func BenchmarkNewBoolValue(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = NewBoolValue(i%2 == 0)
+	}
+}
+
+func BenchmarkEvalComparisons(b *testing.B) {
+	exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("bench.l", strings.NewReader(`
+		(let n 0)
+		(dotimes (i 100)
+			(when (and (< i 50) (not (isNil i)))
+				(set! n (+ n 1))))`))))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ec := BuiltinContext().SubContext(nil)
+		for _, e := range exprs {
+			if _, err := e.Eval(ec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Test_cellValue(t *testing.T) {
+	t.Run("InspectStr", func(t *testing.T) {
+		require.Equal(t, "(1 . 2)", evalStrToVal(t, `(cons 1 2)`).InspectStr())
+		require.Equal(t, "(1)", evalStrToVal(t, `(cons 1 nil)`).InspectStr())
+		require.Equal(t,
+			"(1 2 3)",
+			evalStrToVal(t, `(cons 1 (cons 2 (cons 3 nil)))`).InspectStr())
+		require.Equal(t,
+			"((1 2) 3)",
+			evalStrToVal(t, `(cons (cons 1 (cons 2 nil)) (cons 3 nil))`).InspectStr())
+		require.Equal(t,
+			`(1 2 . "x")`,
+			evalStrToVal(t, `(cons 1 (cons 2 "x"))`).InspectStr())
+		require.Equal(t,
+			"((1 . 2) 3 . 4)",
+			evalStrToVal(t, `(cons (cons 1 2) (cons 3 4))`).InspectStr())
+	})
+}
+
 func Test_listValue(t *testing.T) {
 
 	t.Run("create", func(t *testing.T) {
@@ -381,3 +447,35 @@ func Test_mapValue(t *testing.T) {
 		})
 	})
 }
+
+func Test_funcSignature(t *testing.T) {
+	ec := BuiltinContext().SubContext(nil)
+	evalStrInContext(t, ec, `
+		(defun f (a b) a)
+		(defun g (a :opts o) a)
+		(defstruct point x y)`)
+	signature := func(name string) string {
+		v, _ := ec.Resolve(name)
+		return assertAsFunc(t, v).Signature()
+	}
+
+	require.Equal(t, "(car cell)", signature("car"))
+	require.Equal(t, "(cons [left] [right])", signature("cons"))
+	require.Equal(t, "(concat strs...)", signature("concat"))
+	require.Equal(t, "(random)", signature("random"))
+	require.Equal(t, "(f a b)", signature("f"))
+	require.Equal(t, "(g a [:opts])", signature("g"))
+	require.Equal(t, "(point x y)", signature("point"))
+	require.Equal(t, "<anonymous>", (&FuncValue{}).Signature())
+
+	err := evalStrInContextToErr(t, ec, `(car (list 1) 2 3)`)
+	require.Contains(t, err.Error(), "Eval error 'car: expected 1 argument; got 3': 'testfile' (line 1, col 1)")
+	err = evalStrInContextToErr(t, ec, `(f 1)`)
+	require.Contains(t, err.Error(), "f: expected 2 arguments; got 1")
+	err = evalStrInContextToErr(t, ec, `(g)`)
+	require.Contains(t, err.Error(), "g: expected 1 to 3 arguments; got 0")
+	err = evalStrInContextToErr(t, ec, `(and)`)
+	require.Contains(t, err.Error(), "and: expected at least 1 argument; got 0")
+	err = evalStrInContextToErr(t, ec, `(point-x)`)
+	require.Contains(t, err.Error(), "point-x: expected 1 argument; got 0")
+}
@@ -0,0 +1,225 @@
+package golisp2
+
+import "fmt"
+
+// Walk traverses the expression tree in depth-first order. It calls fn with
+// the expression; if fn returns true, it then walks each of the expression's
+// sub-expressions in the order they appear in source. Only sub-expressions
+// that are evaluated are visited: the names a let or defstruct binds, or the
+// method a method call names, aren't.
+func Walk(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	for _, child := range subExprs(e) {
+		Walk(child, fn)
+	}
+}
+
+// subExprs returns the evaluated sub-expressions of the expression, in source
+// order.
+func subExprs(e Expr) []Expr {
+	switch tE := e.(type) {
+	case *CallExpr:
+		return tE.Exprs
+	case *IfExpr:
+		if tE.Case2 == nil {
+			return []Expr{tE.Cond, tE.Case1}
+		}
+		return []Expr{tE.Cond, tE.Case1, tE.Case2}
+	case *CondExpr:
+		var exprs []Expr
+		for _, clause := range tE.Clauses {
+			if clause.Test != nil {
+				exprs = append(exprs, clause.Test)
+			}
+			exprs = append(exprs, clause.Body...)
+		}
+		return exprs
+	case *WhenExpr:
+		return append([]Expr{tE.Cond}, tE.Body...)
+	case *WhileExpr:
+		return append([]Expr{tE.Cond}, tE.Body...)
+	case *ForExpr:
+		return append([]Expr{tE.Binding.Value}, tE.Body...)
+	case *DoTimesExpr:
+		return append([]Expr{tE.Binding.Value}, tE.Body...)
+	case *FnExpr:
+		return tE.Body
+	case *LetExpr:
+		return []Expr{tE.Value}
+	case *BlockLetExpr:
+		exprs := make([]Expr, 0, len(tE.Bindings)+len(tE.Body))
+		for _, b := range tE.Bindings {
+			exprs = append(exprs, b.Value)
+		}
+		return append(exprs, tE.Body...)
+	case *LetValuesExpr:
+		return append([]Expr{tE.Value}, tE.Body...)
+	case *SetExpr:
+		return []Expr{tE.Value}
+	case *TimeExpr:
+		return []Expr{tE.Expr}
+	case *DefTestExpr:
+		return tE.Body
+	case *AssertErrorExpr:
+		return []Expr{tE.Expr}
+	case *ReturnExpr:
+		if tE.Expr == nil {
+			return nil
+		}
+		return []Expr{tE.Expr}
+	case *GoExpr:
+		return []Expr{tE.Expr}
+	case *MethodCallExpr:
+		return append([]Expr{tE.Object}, tE.Args...)
+	case *DefMethodExpr:
+		return []Expr{tE.Fn}
+	default:
+		return nil
+	}
+}
+
+// Rewrite transforms the expression tree from the bottom up: each
+// sub-expression (as visited by Walk) is rewritten first, and then fn is called
+// with a copy of the expression that holds the rewritten sub-expressions. What
+// fn returns replaces the expression; it can return its argument to keep it.
+// The original tree isn't modified.
+//
+// Returns the first error fn returns. A defmethod's function must be rewritten
+// to another fn expression.
+func Rewrite(e Expr, fn func(Expr) (Expr, error)) (Expr, error) {
+	rw := &rewriter{fn: fn}
+	out := rw.expr(e)
+	if rw.err != nil {
+		return nil, rw.err
+	}
+	resolveLexical([]Expr{out})
+	return out, nil
+}
+
+// rewriter rewrites expressions, keeping the first error encountered. Once
+// there's an error, expressions are returned as they are.
+type rewriter struct {
+	fn  func(Expr) (Expr, error)
+	err error
+}
+
+func (rw *rewriter) exprs(exprs []Expr) []Expr {
+	if exprs == nil {
+		return nil
+	}
+	out := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		out[i] = rw.expr(e)
+	}
+	return out
+}
+
+func (rw *rewriter) expr(e Expr) Expr {
+	if e == nil || rw.err != nil {
+		return e
+	}
+	switch tE := e.(type) {
+	case *IdentLiteral:
+		// copied so resolving the rewritten tree doesn't change the original.
+		cp := *tE
+		e = &cp
+	case *CallExpr:
+		cp := *tE
+		cp.Exprs = rw.exprs(tE.Exprs)
+		e = &cp
+	case *IfExpr:
+		cp := *tE
+		cp.Cond, cp.Case1, cp.Case2 = rw.expr(tE.Cond), rw.expr(tE.Case1), rw.expr(tE.Case2)
+		e = &cp
+	case *CondExpr:
+		cp := *tE
+		cp.Clauses = make([]CondClause, len(tE.Clauses))
+		for i, clause := range tE.Clauses {
+			cp.Clauses[i] = CondClause{Test: rw.expr(clause.Test), Body: rw.exprs(clause.Body)}
+		}
+		e = &cp
+	case *WhenExpr:
+		cp := *tE
+		cp.Cond, cp.Body = rw.expr(tE.Cond), rw.exprs(tE.Body)
+		e = &cp
+	case *WhileExpr:
+		cp := *tE
+		cp.Cond, cp.Body = rw.expr(tE.Cond), rw.exprs(tE.Body)
+		e = &cp
+	case *ForExpr:
+		cp := *tE
+		cp.Binding.Value, cp.Body = rw.expr(tE.Binding.Value), rw.exprs(tE.Body)
+		e = &cp
+	case *DoTimesExpr:
+		cp := *tE
+		cp.Binding.Value, cp.Body = rw.expr(tE.Binding.Value), rw.exprs(tE.Body)
+		e = &cp
+	case *FnExpr:
+		cp := *tE
+		cp.Body = rw.exprs(tE.Body)
+		e = &cp
+	case *LetExpr:
+		cp := *tE
+		cp.Value = rw.expr(tE.Value)
+		e = &cp
+	case *BlockLetExpr:
+		cp := *tE
+		cp.Bindings = make([]LetBinding, len(tE.Bindings))
+		for i, b := range tE.Bindings {
+			cp.Bindings[i] = LetBinding{Ident: b.Ident, Value: rw.expr(b.Value)}
+		}
+		cp.Body = rw.exprs(tE.Body)
+		e = &cp
+	case *LetValuesExpr:
+		cp := *tE
+		cp.Value, cp.Body = rw.expr(tE.Value), rw.exprs(tE.Body)
+		e = &cp
+	case *SetExpr:
+		cp := *tE
+		cp.Value = rw.expr(tE.Value)
+		e = &cp
+	case *TimeExpr:
+		cp := *tE
+		cp.Expr = rw.expr(tE.Expr)
+		e = &cp
+	case *DefTestExpr:
+		cp := *tE
+		cp.Body = rw.exprs(tE.Body)
+		e = &cp
+	case *AssertErrorExpr:
+		cp := *tE
+		cp.Expr = rw.expr(tE.Expr)
+		e = &cp
+	case *ReturnExpr:
+		cp := *tE
+		cp.Expr = rw.expr(tE.Expr)
+		e = &cp
+	case *GoExpr:
+		cp := *tE
+		cp.Expr = rw.expr(tE.Expr)
+		e = &cp
+	case *MethodCallExpr:
+		cp := *tE
+		cp.Object, cp.Args = rw.expr(tE.Object), rw.exprs(tE.Args)
+		e = &cp
+	case *DefMethodExpr:
+		cp := *tE
+		fnE, isFn := rw.expr(tE.Fn).(*FnExpr)
+		if !isFn && rw.err == nil {
+			rw.err = fmt.Errorf("method of '%s' must be rewritten to a fn", tE.Name.Val)
+		}
+		cp.Fn = fnE
+		e = &cp
+	}
+	if rw.err != nil {
+		return e
+	}
+	out, err := rw.fn(e)
+	if err != nil {
+		rw.err = err
+		return e
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package golisp2
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Walk(t *testing.T) {
+	parse := func(t *testing.T, src string) Expr {
+		exprs, err := ParseTokens(NewTokenScanner(NewRuneScanner("walk.l", strings.NewReader(src))))
+		require.NoError(t, err)
+		require.Equal(t, 1, len(exprs))
+		return exprs[0]
+	}
+
+	t.Run("order", func(t *testing.T) {
+		e := parse(t, `(let f (fn (a) (if (< a 1) (cond (a b) (else c)) (let* ((d e)) (g d)))))`)
+		idents := []string{}
+		Walk(e, func(e Expr) bool {
+			if ident, isIdent := e.(*IdentLiteral); isIdent {
+				idents = append(idents, ident.Val)
+			}
+			return true
+		})
+		// bound names (f, d) aren't visited.
+		require.Equal(t, []string{"a", "a", "b", "c", "e", "g", "d"}, idents)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		e := parse(t, `(list (fn () hidden) shown)`)
+		idents := []string{}
+		Walk(e, func(e Expr) bool {
+			if ident, isIdent := e.(*IdentLiteral); isIdent {
+				idents = append(idents, ident.Val)
+			}
+			_, isFn := e.(*FnExpr)
+			return !isFn
+		})
+		require.Equal(t, []string{"list", "shown"}, idents)
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		src := `(let x (+ one (if (> one 0) (* one 2) 3)))`
+		e := parse(t, src)
+		rewritten, err := Rewrite(e, func(e Expr) (Expr, error) {
+			if ident, isIdent := e.(*IdentLiteral); isIdent && ident.Val == "one" {
+				return NewNumberLiteral(1), nil
+			}
+			return e, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, parse(t, src).CodeStr(), e.CodeStr())
+		v := mustEval(t, rewritten, BuiltinContext().SubContext(nil))
+		require.Equal(t, "3", v.InspectStr())
+	})
+
+	t.Run("rewriteErrors", func(t *testing.T) {
+		failed := errors.New("failed")
+		_, err := Rewrite(parse(t, `(list a b)`), func(e Expr) (Expr, error) {
+			return nil, failed
+		})
+		require.Equal(t, failed, err)
+
+		_, err = Rewrite(parse(t, `(defmethod m (x :any) x)`), func(e Expr) (Expr, error) {
+			if _, isFn := e.(*FnExpr); isFn {
+				return NewNilLiteral(), nil
+			}
+			return e, nil
+		})
+		require.Error(t, err)
+	})
+}